@@ -2,26 +2,13 @@
 NAME="gosb"
 CURRENT=`pwd`
 
-FILE="gosb_run.sh"
-
-#Creating the command file.
-if [ -f "$FILE" ]; then
-	rm -f $FILE
-fi
-
-echo "
-#!/bin/bash
-CURRENT=\"$CURRENT\"
-GOROOT=$CURRENT $CURRENT/bin/go \$@
-" > $FILE
-
-chmod +x $FILE
-
 # Installing command.
+# The go command finds its GOROOT from its executable, through the symlink,
+# and selects the sandbox backend with its -gosb build flag.
 printf "%`tput cols`s"|tr ' ' '.'
 echo "Installing cmd as $NAME"
 if [ -f "/usr/local/bin/$NAME" ]; then
   rm /usr/local/bin/$NAME
 fi
-ln -s $CURRENT/$FILE /usr/local/bin/$NAME
+ln -s $CURRENT/bin/go /usr/local/bin/$NAME
 echo "Intalled as: `which $NAME`"
@@ -226,5 +226,13 @@ symbol's default object file symbol name and only has the effect of making
 the symbol accessible to other packages.
 Because this directive can subvert the type system and package
 modularity, it is only enabled in files that have imported "unsafe".
+
+	//go:sandbox "mem" "sys"
+
+The //go:sandbox directive specifies that the next function or method declared
+in the file runs in a sandbox with the memory view mem and the syscall classes sys,
+as the body of a sandbox["mem", "sys"] func() {...} literal. Its sandbox id is
+the name of the function, e.g., importpath.F or importpath.(*T).M. The type of
+the function remains a plain func type.
 */
 package main
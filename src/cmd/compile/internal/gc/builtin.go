@@ -252,8 +252,8 @@ func runtimeTypes() []*types.Type {
 	typs[55] = functype(nil, []*Node{anonfield(typs[0])}, []*Node{anonfield(typs[4])})
 	typs[56] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[5])}, []*Node{anonfield(typs[5])})
 	typs[57] = types.Types[TUNSAFEPTR]
-	typs[58] = functype(nil, []*Node{anonfield(typs[5])}, []*Node{anonfield(typs[57])})
-	typs[59] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[6])}, []*Node{anonfield(typs[5])})
+	typs[58] = functype(nil, []*Node{anonfield(typs[5]), anonfield(typs[4])}, []*Node{anonfield(typs[57])})
+	typs[59] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[6]), anonfield(typs[4])}, []*Node{anonfield(typs[5])})
 	typs[60] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[5])}, []*Node{anonfield(typs[5]), anonfield(typs[17])})
 	typs[61] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[3]), anonfield(typs[3])}, nil)
 	typs[62] = functype(nil, []*Node{anonfield(typs[3])}, nil)
@@ -276,8 +276,8 @@ func runtimeTypes() []*types.Type {
 	typs[79] = functype(nil, []*Node{anonfield(typs[6])}, nil)
 	typs[80] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[67])}, nil)
 	typs[81] = types.NewChan(typs[5], types.Cboth)
-	typs[82] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[21])}, []*Node{anonfield(typs[81])})
-	typs[83] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[4])}, []*Node{anonfield(typs[81])})
+	typs[82] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[21]), anonfield(typs[4])}, []*Node{anonfield(typs[81])})
+	typs[83] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[4]), anonfield(typs[4])}, []*Node{anonfield(typs[81])})
 	typs[84] = types.NewChan(typs[5], types.Crecv)
 	typs[85] = functype(nil, []*Node{anonfield(typs[84]), anonfield(typs[6])}, nil)
 	typs[86] = functype(nil, []*Node{anonfield(typs[84]), anonfield(typs[6])}, []*Node{anonfield(typs[17])})
@@ -293,10 +293,10 @@ func runtimeTypes() []*types.Type {
 	typs[96] = types.NewPtr(typs[17])
 	typs[97] = functype(nil, []*Node{anonfield(typs[6]), anonfield(typs[96]), anonfield(typs[84])}, []*Node{anonfield(typs[17])})
 	typs[98] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[3]), anonfield(typs[4])}, []*Node{anonfield(typs[4]), anonfield(typs[17])})
-	typs[99] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[4]), anonfield(typs[4])}, []*Node{anonfield(typs[57])})
-	typs[100] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[21]), anonfield(typs[21])}, []*Node{anonfield(typs[57])})
+	typs[99] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[4]), anonfield(typs[4]), anonfield(typs[4])}, []*Node{anonfield(typs[57])})
+	typs[100] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[21]), anonfield(typs[21]), anonfield(typs[4])}, []*Node{anonfield(typs[57])})
 	typs[101] = types.NewSlice(typs[5])
-	typs[102] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[101]), anonfield(typs[4])}, []*Node{anonfield(typs[101])})
+	typs[102] = functype(nil, []*Node{anonfield(typs[3]), anonfield(typs[101]), anonfield(typs[4]), anonfield(typs[4])}, []*Node{anonfield(typs[101])})
 	typs[103] = functype(nil, []*Node{anonfield(typs[6]), anonfield(typs[6]), anonfield(typs[51])}, nil)
 	typs[104] = functype(nil, []*Node{anonfield(typs[57]), anonfield(typs[51])}, nil)
 	typs[105] = functype(nil, []*Node{anonfield(typs[6]), anonfield(typs[6]), anonfield(typs[51])}, []*Node{anonfield(typs[17])})
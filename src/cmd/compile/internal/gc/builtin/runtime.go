@@ -18,6 +18,7 @@ import "unsafe"
 func sandbox_prolog(id string, mem string, sys string)
 func sandbox_epilog(id string, mem string, sys string)
 
+// The id argument of the functions that allocate is the allocating package.
 func newobject(typ *byte, id int) *any
 func panicdivide()
 func panicshift()
@@ -88,19 +89,19 @@ func convI2I(typ *byte, elem any) (ret any)
 
 // Specialized type-to-interface conversion.
 // These return only a data pointer.
-func convT16(val any) unsafe.Pointer     // val must be uint16-like (same size and alignment as a uint16)
-func convT32(val any) unsafe.Pointer     // val must be uint32-like (same size and alignment as a uint32)
-func convT64(val any) unsafe.Pointer     // val must be uint64-like (same size and alignment as a uint64 and contains no pointers)
-func convTstring(val any) unsafe.Pointer // val must be a string
-func convTslice(val any) unsafe.Pointer  // val must be a slice
+func convT16(val any, id int) unsafe.Pointer     // val must be uint16-like (same size and alignment as a uint16)
+func convT32(val any, id int) unsafe.Pointer     // val must be uint32-like (same size and alignment as a uint32)
+func convT64(val any, id int) unsafe.Pointer     // val must be uint64-like (same size and alignment as a uint64 and contains no pointers)
+func convTstring(val any, id int) unsafe.Pointer // val must be a string
+func convTslice(val any, id int) unsafe.Pointer  // val must be a slice
 
 // Type to empty-interface conversion.
-func convT2E(typ *byte, elem *any) (ret any)
-func convT2Enoptr(typ *byte, elem *any) (ret any)
+func convT2E(typ *byte, elem *any, id int) (ret any)
+func convT2Enoptr(typ *byte, elem *any, id int) (ret any)
 
 // Type to non-empty-interface conversion.
-func convT2I(tab *byte, elem *any) (ret any)
-func convT2Inoptr(tab *byte, elem *any) (ret any)
+func convT2I(tab *byte, elem *any, id int) (ret any)
+func convT2Inoptr(tab *byte, elem *any, id int) (ret any)
 
 // interface type assertions x.(T)
 func assertE2I(typ *byte, iface any) (ret any)
@@ -147,8 +148,8 @@ func mapiternext(hiter *any)
 func mapclear(mapType *byte, hmap map[any]any)
 
 // *byte is really *runtime.Type
-func makechan64(chanType *byte, size int64) (hchan chan any)
-func makechan(chanType *byte, size int) (hchan chan any)
+func makechan64(chanType *byte, size int64, id int) (hchan chan any)
+func makechan(chanType *byte, size int, id int) (hchan chan any)
 func chanrecv1(hchan <-chan any, elem *any)
 func chanrecv2(hchan <-chan any, elem *any) bool
 func chansend1(hchan chan<- any, elem *any)
@@ -175,9 +176,9 @@ func selectsetpc(cas *byte)
 func selectgo(cas0 *byte, order0 *byte, ncases int) (int, bool)
 func block()
 
-func makeslice(typ *byte, len int, cap int) unsafe.Pointer
-func makeslice64(typ *byte, len int64, cap int64) unsafe.Pointer
-func growslice(typ *byte, old []any, cap int) (ary []any)
+func makeslice(typ *byte, len int, cap int, id int) unsafe.Pointer
+func makeslice64(typ *byte, len int64, cap int64, id int) unsafe.Pointer
+func growslice(typ *byte, old []any, cap int, id int) (ary []any)
 func memmove(to *any, frm *any, length uintptr)
 func memclrNoHeapPointers(ptr unsafe.Pointer, n uintptr)
 func memclrHasPointers(ptr unsafe.Pointer, n uintptr)
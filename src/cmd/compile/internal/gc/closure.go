@@ -24,7 +24,10 @@ func (p *noder) funcLit(expr *syntax.FuncLit) *Node {
 	clo.Func.Ntype = ntype
 
 	// @aghosn keep track of sandboxes
-	xfunc.IsSandbox, xfunc.Id, xfunc.Mem, xfunc.Sys = expr.IsSandbox, expr.Id, expr.Mem, expr.Sys
+	if expr.IsSandbox {
+		expr.SetSandboxId(p.sandboxId(expr))
+	}
+	xfunc.IsSandbox, xfunc.Id = expr.IsSandbox, expr.Id
 
 	xfunc.Func.Closure = clo
 	clo.Func.Closure = xfunc
@@ -82,8 +85,11 @@ func typecheckclosure(clo *Node, top int) {
 		xfunc.SetIota(x)
 	}
 
+	// @aghosn sandbox literals have a sandbox type.
+	typechecksandbox(xfunc)
 	clo.Func.Ntype = typecheck(clo.Func.Ntype, ctxType)
 	clo.Type = clo.Func.Ntype.Type
+	setsandboxtype(xfunc, clo.Type)
 	clo.Func.Top = top
 
 	// Do not typecheck xfunc twice, otherwise, we will end up pushing
@@ -113,6 +119,7 @@ func typecheckclosure(clo *Node, top int) {
 	disableExport(xfunc.Func.Nname.Sym)
 	declare(xfunc.Func.Nname, PFUNC)
 	xfunc = typecheck(xfunc, ctxStmt)
+	setsandboxtype(xfunc, xfunc.Type)
 
 	// Type check the body now, but only if we're inside a function.
 	// At top level (in a variable initialization: curfn==nil) we're not
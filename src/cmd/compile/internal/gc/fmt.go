@@ -790,7 +790,11 @@ func typefmt(t *types.Type, flag FmtFlag, mode fmtMode, depth int) string {
 				buf = append(buf, tmodeString(t.Recvs(), mode, depth)...)
 				buf = append(buf, ' ')
 			}
-			buf = append(buf, "func"...)
+			if sb := t.FuncType().Sandbox; sb != nil {
+				buf = append(buf, fmt.Sprintf("sandbox[%q, %q]", sb.Mem, sb.Sys)...)
+			} else {
+				buf = append(buf, "func"...)
+			}
 		}
 		buf = append(buf, tmodeString(t.Params(), mode, depth)...)
 
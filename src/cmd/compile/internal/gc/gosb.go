@@ -6,6 +6,9 @@ import (
 	"cmd/compile/internal/types"
 	"cmd/internal/bio"
 	"fmt"
+	"gosb/commons"
+	"strconv"
+	"strings"
 )
 
 type Pkg = types.Pkg
@@ -16,11 +19,246 @@ var sandboxes []*Node
 
 var sandboxToPkgs map[*Node][]*Pkg
 
-const (
-	SandboxHeader = "\xeegosandx"
-	SandboxFooter = "\xefgosandx"
+// sandboxIds holds the ids of the sandboxes of the package, and
+// sandboxCounts the number of unnamed sandboxes of each function.
+var (
+	sandboxIds    = make(map[string]bool)
+	sandboxCounts = make(map[string]int)
 )
 
+// sandboxId returns the id of the sandbox literal fn, i.e., pkg.F#name if
+// the sandbox is named, pkg.F#n for the n-th unnamed sandbox of F otherwise,
+// where F is the enclosing top-level function. Unlike the closure names, ids
+// do not depend on the other declarations of the package, and policies can
+// refer to them across builds. Sandboxes outside functions belong to init.
+// The init functions are numbered in source order, e.g., init.0.
+func (p *noder) sandboxId(fn *syntax.FuncLit) string {
+	pkg := sandboxPkg()
+	fun := p.sbfunc
+	if fun == "" {
+		fun = "init"
+	}
+	name := fn.Name
+	if name == "" {
+		name = strconv.Itoa(sandboxCounts[fun])
+		sandboxCounts[fun]++
+	}
+	id := pkg + "." + fun + "#" + name
+	if sandboxIds[id] {
+		p.yyerrorpos(fn.Pos(), "duplicate sandbox name %s in %s", name, fun)
+	}
+	sandboxIds[id] = true
+	return id
+}
+
+// sandboxPkg returns the package part of the sandbox ids.
+func sandboxPkg() string {
+	if myimportpath == "" {
+		return localpkg.Name
+	}
+	return myimportpath
+}
+
+// sandboxPragma is a //go:sandbox "mem" "sys" directive, that sandboxes the
+// function declaration that follows it.
+type sandboxPragma struct {
+	pos      syntax.Pos
+	mem, sys string
+	used     bool
+}
+
+// sandboxPragma parses the //go:sandbox directive text at pos.
+func (p *noder) sandboxPragma(pos syntax.Pos, text string) syntax.Pragma {
+	f := pragmaFields(text)
+	if len(f) != 3 || !isQuoted(f[1]) || !isQuoted(f[2]) {
+		p.error(syntax.Error{Pos: pos, Msg: `usage: //go:sandbox "mem" "sys"`})
+		return 0
+	}
+	mem, err1 := strconv.Unquote(f[1])
+	sys, err2 := strconv.Unquote(f[2])
+	if err1 != nil || err2 != nil {
+		p.error(syntax.Error{Pos: pos, Msg: `usage: //go:sandbox "mem" "sys"`})
+		return 0
+	}
+	if _, _, err := commons.ParseSandboxView(mem); err != nil {
+		p.error(syntax.Error{Pos: pos, Msg: fmt.Sprintf("invalid sandbox memory view %q: %s", mem, sandboxErrorMsg(err))})
+		return 0
+	}
+	if _, err := commons.ParseSyscalls(sys); err != nil {
+		p.error(syntax.Error{Pos: pos, Msg: fmt.Sprintf("invalid sandbox syscalls %q: %s", sys, sandboxErrorMsg(err))})
+		return 0
+	}
+	p.sbpragmas = append(p.sbpragmas, sandboxPragma{pos: pos, mem: mem, sys: sys})
+	return Sandboxed
+}
+
+// sandboxFunc sandboxes the declaration fun of f with its //go:sandbox
+// directive, the last one before fun. As a sandbox literal, f starts with
+// the prolog and the epilog of the sandbox, and is registered with the other
+// sandboxes. Its id is the name of the function, e.g., pkg.F or pkg.(*T).M.
+func (p *noder) sandboxFunc(f *Node, fun *syntax.FuncDecl) {
+	var prag *sandboxPragma
+	for i := range p.sbpragmas {
+		pos := p.sbpragmas[i].pos
+		if pos.Line() < fun.Pos().Line() || pos.Line() == fun.Pos().Line() && pos.Col() < fun.Pos().Col() {
+			prag = &p.sbpragmas[i]
+		}
+	}
+	if prag == nil {
+		Fatalf("missing //go:sandbox directive for %v", fun.Name.Value)
+	}
+	prag.used = true
+	if fun.Body == nil {
+		p.yyerrorpos(prag.pos, "can only use //go:sandbox on functions with a body")
+		return
+	}
+	id := sandboxPkg() + "." + p.sbfunc
+	fun.Body.List = append(syntax.SandboxStmts(fun.Body.Pos(), id, prag.mem, prag.sys), fun.Body.List...)
+	f.IsSandbox, f.Id = true, strconv.Quote(id)
+}
+
+// sandboxFuncName returns the name of the symbol of fun, e.g., F, init.0,
+// T.M or (*T).M.
+func sandboxFuncName(fun *syntax.FuncDecl, sym *types.Sym) string {
+	name := fun.Name.Value
+	if fun.Recv == nil {
+		return sym.Name
+	}
+	typ, ptr := fun.Recv.Type, false
+	for {
+		if p, ok := typ.(*syntax.ParenExpr); ok {
+			typ = p.X
+		} else if op, ok := typ.(*syntax.Operation); ok && op.Op == syntax.Mul && op.Y == nil && !ptr {
+			typ, ptr = op.X, true
+		} else {
+			break
+		}
+	}
+	recv, ok := typ.(*syntax.Name)
+	if !ok {
+		// Invalid receiver, reported by typecheck.
+		return name
+	}
+	if ptr {
+		return "(*" + recv.Value + ")." + name
+	}
+	return recv.Value + "." + name
+}
+
+// typechecksandbox resolves the memory view and the syscalls of the sandbox
+// fn, i.e., the arguments of its prolog and epilog, see
+// syntax.sandboxConfig. They must be string constants, e.g., a named
+// constant shared by several sandboxes. The prolog and epilog get their
+// values as untyped literals.
+func typechecksandbox(fn *Node) {
+	if !fn.IsSandbox || fn.Mem != "" || fn.Nbody.Len() < 2 {
+		// Not a sandbox, or already resolved.
+		return
+	}
+	prolog, epilog := fn.Nbody.Index(0), fn.Nbody.Index(1).Left
+	for i, conf := range []*string{&fn.Mem, &fn.Sys} {
+		value := typechecksandboxconf(prolog.List.Index(i+1), i)
+		*conf = strconv.Quote(value)
+		prolog.List.SetIndex(i+1, nodlit(Val{value}))
+		epilog.List.SetIndex(i+1, nodlit(Val{value}))
+	}
+}
+
+// sandboxTypeConf is the configuration of a sandbox func type, as written
+// in the source, i.e., the expressions of its memory view and syscalls.
+type sandboxTypeConf struct {
+	Mem, Sys *Node
+}
+
+// typechecksandboxtype resolves the configuration of the func type n, an
+// OTFUNC. It returns nil if n is not a sandbox type, see noder.signature.
+func typechecksandboxtype(n *Node) *types.Sandbox {
+	if n.SandboxType == nil {
+		return nil
+	}
+	return types.NewSandbox(typechecksandboxconf(n.SandboxType.Mem, 0), typechecksandboxconf(n.SandboxType.Sys, 1))
+}
+
+// setsandboxtype turns t, the type of the sandbox literal fn, into a sandbox
+// type with the resolved configuration of fn. Sandbox literals are the only
+// values of sandbox types: calls through these values go through the prolog
+// and the epilog of the literal, with the configuration of the type.
+func setsandboxtype(fn *Node, t *types.Type) {
+	if !fn.IsSandbox || fn.Mem == "" || t == nil || t.Etype != TFUNC {
+		return
+	}
+	mem, _ := strconv.Unquote(fn.Mem)
+	sys, _ := strconv.Unquote(fn.Sys)
+	t.FuncType().Sandbox = types.NewSandbox(mem, sys)
+}
+
+// sandboxassignop reports whether a value of type src can be assigned to
+// dst because of their sandbox configurations. Values of a sandbox type can
+// be used as plain funcs with an identical signature, provided that src or
+// dst is not a named type. Plain funcs, and sandboxes with a different
+// configuration, cannot be used as sandboxes.
+func sandboxassignop(src, dst *types.Type, why *string) Op {
+	if !types.IdenticalSignature(src.Orig, dst.Orig) {
+		return 0
+	}
+	switch {
+	case !dst.Orig.IsSandbox():
+		if src.Sym == nil || dst.Sym == nil {
+			return OCONVNOP
+		}
+	case !src.Orig.IsSandbox():
+		if why != nil {
+			*why = fmt.Sprintf(":\n\t%v is not a sandbox", src)
+		}
+	default:
+		if why != nil {
+			*why = ":\n\tsandbox configurations differ"
+		}
+	}
+	return 0
+}
+
+// typechecksandboxconf typechecks n, the memory view (i == 0) or the
+// syscalls (i == 1) of a sandbox, and returns its value.
+func typechecksandboxconf(n *Node, i int) string {
+	pos := n.Pos
+	// The parser already checked literals.
+	checked := n.Op == OLITERAL
+	n = typecheck(n, ctxExpr)
+	value := ""
+	if Isconst(n, CTSTR) {
+		value = strlit(n)
+		if checked {
+			return value
+		}
+		var err error
+		if i == 0 {
+			_, _, err = commons.ParseSandboxView(value)
+		} else {
+			_, err = commons.ParseSyscalls(value)
+		}
+		if err != nil {
+			kind := "memory view"
+			if i == 1 {
+				kind = "syscalls"
+			}
+			yyerrorl(pos, "invalid sandbox %s %q: %s", kind, value, sandboxErrorMsg(err))
+		}
+	} else if n.Type != nil && !n.Diag() {
+		yyerrorl(pos, "sandbox configuration %v is not a string constant", n)
+	}
+	return value
+}
+
+// sandboxErrorMsg formats an error produced by the gosb/commons parsers.
+func sandboxErrorMsg(err error) string {
+	msg := strings.TrimSpace(err.Error())
+	if len(msg) > 0 {
+		msg = strings.ToLower(msg[:1]) + msg[1:]
+	}
+	return msg
+}
+
 func (n *Node) SandboxName() string {
 	if !n.IsSandbox || n.Op != ODCLFUNC || n.Func == nil || n.Func.Nname == nil {
 		panic("Unable to get sandbox name")
@@ -139,14 +377,14 @@ func dumpSandObj(bout *bio.Writer) {
 // printSandObjHeader writes the go sandboxes header, that for the moment
 // contains only the number of entries.
 func printSandObjHeader(bout *bio.Writer) {
-	fmt.Fprintf(bout, "%v\n", SandboxHeader)
+	fmt.Fprintf(bout, "%v\n", commons.ObjHeader)
 	fmt.Fprintf(bout, "%v\n", len(sandboxes))
 	bout.Flush()
 }
 
 // printSandObjFooter footer for a sandbox object entry
 func printSandObjFooter(bout *bio.Writer) {
-	fmt.Fprintf(bout, "%v\n", SandboxFooter)
+	fmt.Fprintf(bout, "%v\n", commons.ObjFooter)
 	bout.Flush()
 }
 
@@ -190,7 +428,25 @@ func dumpSandbox(s *Node, bout *bio.Writer) {
 
 // ssa external function
 
-func newobjectPkgArg(s *state) *ssa.Value {
-	itpe := types.Types[types.TINT]
-	return s.constInt64(itpe, int64(syntax.PkgId))
+// allocPkgVar holds the id of the package being compiled, that the runtime
+// allocation functions use to tag the spans without unwinding the stack.
+// The ids depend on the program the package is linked in, the linker sets
+// it, see ld.setPkgIds.
+var allocPkgVar *Node
+
+// declareAllocPkg declares allocPkgVar before the backend compiles the
+// functions, which might be concurrent.
+func declareAllocPkg() {
+	allocPkgVar = newname(lookup(commons.PkgIdSym))
+	addvar(allocPkgVar, types.Types[TINT], PEXTERN)
+}
+
+// allocPkgArg loads the id of the package being compiled.
+func allocPkgArg(s *state) *ssa.Value {
+	return s.expr(allocPkgVar)
+}
+
+// allocPkgNode is allocPkgArg for the calls generated by walk.
+func allocPkgNode() *Node {
+	return allocPkgVar
 }
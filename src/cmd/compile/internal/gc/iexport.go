@@ -170,6 +170,14 @@
 //         }
 //     }
 //
+//     type SandboxType struct {
+//         Tag       itag // sandboxType
+//         PkgPath   stringOff
+//         Mem       stringOff
+//         Sys       stringOff
+//         Signature Signature
+//     }
+//
 //
 //     type Signature struct {
 //         Params   []Param
@@ -213,9 +221,10 @@ import (
 )
 
 // Current indexed export format version. Increase with each format change.
+// 2: added sandbox types
 // 1: added column details to Pos
 // 0: Go1.11 encoding
-const iexportVersion = 1
+const iexportVersion = 2
 
 // predeclReserved is the number of type offsets reserved for types
 // implicitly declared in the universe block.
@@ -236,6 +245,7 @@ const (
 	signatureType
 	structType
 	interfaceType
+	sandboxType
 )
 
 func iexport(out *bufio.Writer) {
@@ -653,8 +663,15 @@ func (w *exportWriter) doTyp(t *types.Type) {
 		w.typ(t.Elem())
 
 	case TFUNC:
-		w.startType(signatureType)
-		w.setPkg(t.Pkg(), true)
+		if sb := t.FuncType().Sandbox; sb != nil {
+			w.startType(sandboxType)
+			w.setPkg(t.Pkg(), true)
+			w.string(sb.Mem)
+			w.string(sb.Sys)
+		} else {
+			w.startType(signatureType)
+			w.setPkg(t.Pkg(), true)
+		}
 		w.signature(t)
 
 	case TSTRUCT:
@@ -97,8 +97,9 @@ func (r *intReader) uint64() uint64 {
 func iimport(pkg *types.Pkg, in *bio.Reader) {
 	ir := &intReader{in, pkg}
 
+	// Version 1 only lacks the sandbox types.
 	version := ir.uint64()
-	if version != iexportVersion {
+	if version != iexportVersion && version != 1 {
 		yyerror("import %q: unknown export format version %d", pkg.Path, version)
 		errorexit()
 	}
@@ -120,7 +121,8 @@ func iimport(pkg *types.Pkg, in *bio.Reader) {
 	in.MustSeek(int64(sLen+dLen), os.SEEK_CUR)
 
 	p := &iimporter{
-		ipkg: pkg,
+		ipkg:    pkg,
+		version: version,
 
 		pkgCache:     map[uint64]*types.Pkg{},
 		posBaseCache: map[uint64]*src.PosBase{},
@@ -190,7 +192,8 @@ func iimport(pkg *types.Pkg, in *bio.Reader) {
 }
 
 type iimporter struct {
-	ipkg *types.Pkg
+	ipkg    *types.Pkg
+	version uint64
 
 	pkgCache     map[uint64]*types.Pkg
 	posBaseCache map[uint64]*src.PosBase
@@ -523,6 +526,16 @@ func (r *importReader) typ1() *types.Type {
 		r.setPkg()
 		return r.signature(nil)
 
+	case sandboxType:
+		if r.p.version < 2 {
+			Fatalf("unexpected sandbox type in export format version %d", r.p.version)
+		}
+		r.setPkg()
+		sb := types.NewSandbox(r.string(), r.string())
+		t := r.signature(nil)
+		t.FuncType().Sandbox = sb
+		return t
+
 	case structType:
 		r.setPkg()
 
@@ -48,6 +48,9 @@ const (
 
 	// Runtime-only type pragmas
 	NotInHeap // values of this type must not be heap allocated
+
+	// @aghosn func pragmas of sandboxes, see noder.sandboxPragma.
+	Sandboxed // func runs in a sandbox
 )
 
 func pragmaValue(verb string) syntax.Pragma {
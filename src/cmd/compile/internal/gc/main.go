@@ -10,7 +10,6 @@ import (
 	"bufio"
 	"bytes"
 	"cmd/compile/internal/ssa"
-	"cmd/compile/internal/syntax"
 	"cmd/compile/internal/types"
 	"cmd/internal/bio"
 	"cmd/internal/dwarf"
@@ -202,7 +201,6 @@ func Main(archInit func(*Arch)) {
 	smallFrames := false
 
 	// @aghosn we get the pkgId
-	flag.IntVar(&syntax.PkgId, "pkgId", -1, "package id for the allocator")
 
 	flag.BoolVar(&compiling_runtime, "+", false, "compiling runtime")
 	flag.BoolVar(&compiling_std, "std", false, "compiling standard library")
@@ -578,6 +576,7 @@ func Main(archInit func(*Arch)) {
 			Curfn = n
 			decldepth = 1
 			saveerrors()
+			typechecksandbox(Curfn)
 			typecheckslice(Curfn.Nbody.Slice(), ctxStmt)
 			checkreturn(Curfn)
 			if nerrors != 0 {
@@ -684,6 +683,7 @@ func Main(archInit func(*Arch)) {
 	// This must be before peekitabs, because peekitabs
 	// can trigger function compilation.
 	initssaconfig()
+	declareAllocPkg()
 
 	// Just before compilation, compile itabs found on
 	// the right side of OCONVIFACE so that methods
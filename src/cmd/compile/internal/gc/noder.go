@@ -141,6 +141,13 @@ type noder struct {
 	scopeVars []int
 
 	lastCloseScopePos syntax.Pos
+
+	// sbfunc is the name of the top-level function being noded, for the
+	// ids of its sandboxes.
+	sbfunc string
+
+	// sbpragmas are the //go:sandbox directives of the file.
+	sbpragmas []sandboxPragma
 }
 
 func (p *noder) funcBody(fn *Node, block *syntax.BlockStmt) {
@@ -243,6 +250,12 @@ func (p *noder) node() {
 
 	xtop = append(xtop, p.decls(p.file.DeclList)...)
 
+	for _, prag := range p.sbpragmas {
+		if !prag.used {
+			p.yyerrorpos(prag.pos, "misplaced //go:sandbox directive")
+		}
+	}
+
 	for _, n := range p.linknames {
 		if !imported_unsafe {
 			p.yyerrorpos(n.pos, "//go:linkname only allowed in Go files that import \"unsafe\"")
@@ -503,7 +516,12 @@ func (p *noder) funcDecl(fun *syntax.FuncDecl) *Node {
 		declare(f.Func.Nname, PFUNC)
 	}
 
+	p.sbfunc = sandboxFuncName(fun, name)
+	if pragma&Sandboxed != 0 {
+		p.sandboxFunc(f, fun)
+	}
 	p.funcBody(f, fun.Body)
+	p.sbfunc = ""
 
 	if fun.Body != nil {
 		if f.Func.Pragma&Noescape != 0 {
@@ -536,6 +554,10 @@ func (p *noder) signature(recv *syntax.Field, typ *syntax.FuncType) *Node {
 	}
 	n.List.Set(p.params(typ.ParamList, true))
 	n.Rlist.Set(p.params(typ.ResultList, false))
+	// @aghosn the configuration of sandbox types, resolved by typecheck.
+	if typ.Mem != nil {
+		n.SandboxType = &sandboxTypeConf{p.expr(syntax.SandboxArg(typ.Mem)), p.expr(syntax.SandboxArg(typ.Sys))}
+	}
 	return n
 }
 
@@ -1506,6 +1528,9 @@ func (p *noder) pragma(pos syntax.Pos, text string) syntax.Pragma {
 		}
 		p.linknames = append(p.linknames, linkname{pos, f[1], target})
 
+	case text == "go:sandbox" || strings.HasPrefix(text, "go:sandbox "):
+		return p.sandboxPragma(pos, text)
+
 	case strings.HasPrefix(text, "go:cgo_import_dynamic "):
 		// This is permitted for general use because Solaris
 		// code relies on it in golang.org/x/sys/unix and others.
@@ -13,6 +13,7 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
+	"gosb/commons"
 	"io"
 	"sort"
 	"strconv"
@@ -76,7 +77,7 @@ func dumpobj1(outfile string, mode int) {
 	if len(sandboxes) > 0 {
 		start := startArchiveEntry(bout)
 		dumpSandObj(bout)
-		finishArchiveEntry(bout, start, "__.SANDBOX")
+		finishArchiveEntry(bout, start, commons.ObjEntry)
 	}
 }
 
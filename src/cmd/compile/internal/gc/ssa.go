@@ -2487,7 +2487,7 @@ func (s *state) expr(n *Node) *ssa.Value {
 		}
 		typ := s.expr(n.Left)
 		//TODO(aghosn) add argument here?
-		pkgId := newobjectPkgArg(s)
+		pkgId := allocPkgArg(s)
 		vv := s.rtcall(newobject, true, []*types.Type{n.Type}, typ, pkgId)
 		return vv[0]
 
@@ -2582,7 +2582,7 @@ func (s *state) append(n *Node, inplace bool) *ssa.Value {
 	// Call growslice
 	s.startBlock(grow)
 	taddr := s.expr(n.Left)
-	r := s.rtcall(growslice, true, []*types.Type{pt, types.Types[TINT], types.Types[TINT]}, taddr, p, l, c, nl)
+	r := s.rtcall(growslice, true, []*types.Type{pt, types.Types[TINT], types.Types[TINT]}, taddr, p, l, c, nl, allocPkgArg(s))
 
 	if inplace {
 		if sn.Op == ONAME && sn.Class() != PEXTERN {
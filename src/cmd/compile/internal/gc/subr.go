@@ -639,6 +639,11 @@ func assignop(src *types.Type, dst *types.Type, why *string) Op {
 		}
 	}
 
+	// @aghosn sandbox func types, see sandboxassignop.
+	if op := sandboxassignop(src, dst, why); op != 0 {
+		return op
+	}
+
 	// 5. src is the predeclared identifier nil and dst is a nillable type.
 	if src.Etype == TNIL {
 		switch dst.Etype {
@@ -717,6 +722,12 @@ func convertop(src *types.Type, dst *types.Type, why *string) Op {
 		return OCONVNOP
 	}
 
+	// @aghosn src is a sandbox func type and dst a plain func type with an
+	// identical signature.
+	if src.Orig.IsSandbox() && !dst.Orig.IsSandbox() && types.IdenticalSignature(src.Orig, dst.Orig) {
+		return OCONVNOP
+	}
+
 	// 3. src and dst are unnamed pointer types and, ignoring struct tags,
 	// their base types have identical underlying types.
 	if src.IsPtr() && dst.IsPtr() && src.Sym == nil && dst.Sym == nil {
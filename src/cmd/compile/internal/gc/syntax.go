@@ -67,6 +67,9 @@ type Node struct {
 	Id        string
 	Mem       string
 	Sys       string
+
+	// The configuration of a sandbox func type, OTFUNC.
+	SandboxType *sandboxTypeConf
 }
 
 func (n *Node) ResetAux() {
@@ -508,10 +508,13 @@ func typecheck1(n *Node, top int) (res *Node) {
 
 	case OTFUNC:
 		ok |= ctxType
-		setTypeNode(n, functype(n.Left, n.List.Slice(), n.Rlist.Slice()))
+		t := functype(n.Left, n.List.Slice(), n.Rlist.Slice())
+		t.FuncType().Sandbox = typechecksandboxtype(n)
+		setTypeNode(n, t)
 		n.Left = nil
 		n.List.Set(nil)
 		n.Rlist.Set(nil)
+		n.SandboxType = nil
 
 	// type or expr
 	case ODEREF:
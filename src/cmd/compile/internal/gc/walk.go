@@ -906,7 +906,7 @@ opswitch:
 			fn = substArgTypes(fn, fromType)
 			dowidth(fn.Type)
 			call := nod(OCALL, fn, nil)
-			call.List.Set1(n.Left)
+			call.List.Set2(n.Left, allocPkgNode())
 			call = typecheck(call, ctxExpr)
 			call = walkexpr(call, init)
 			call = safeexpr(call, init)
@@ -946,6 +946,9 @@ opswitch:
 		dowidth(fn.Type)
 		n = nod(OCALL, fn, nil)
 		n.List.Set2(tab, v)
+		if !fromType.IsInterface() {
+			n.List.Append(allocPkgNode())
+		}
 		n = typecheck(n, ctxExpr)
 		n = walkexpr(n, init)
 
@@ -1200,7 +1203,7 @@ opswitch:
 			argtype = types.Types[TINT]
 		}
 
-		n = mkcall1(chanfn(fnname, 1, n.Type), n.Type, init, typename(n.Type), conv(size, argtype))
+		n = mkcall1(chanfn(fnname, 1, n.Type), n.Type, init, typename(n.Type), conv(size, argtype), allocPkgNode())
 
 	case OMAKEMAP:
 		t := n.Type
@@ -1355,7 +1358,7 @@ opswitch:
 			m.Type = t
 
 			fn := syslook(fnname)
-			m.Left = mkcall1(fn, types.Types[TUNSAFEPTR], init, typename(t.Elem()), conv(len, argtype), conv(cap, argtype))
+			m.Left = mkcall1(fn, types.Types[TUNSAFEPTR], init, typename(t.Elem()), conv(len, argtype), conv(cap, argtype), allocPkgNode())
 			m.Left.SetNonNil(true)
 			m.List.Set2(conv(len, types.Types[TINT]), conv(cap, types.Types[TINT]))
 
@@ -2628,7 +2631,7 @@ func appendslice(n *Node, init *Nodes) *Node {
 	fn = substArgTypes(fn, elemtype, elemtype)
 
 	// s = growslice(T, s, n)
-	nif.Nbody.Set1(nod(OAS, s, mkcall1(fn, s.Type, &nif.Ninit, typename(elemtype), s, nn)))
+	nif.Nbody.Set1(nod(OAS, s, mkcall1(fn, s.Type, &nif.Ninit, typename(elemtype), s, nn, allocPkgNode())))
 	nodes.Append(nif)
 
 	// s = s[:n]
@@ -2800,7 +2803,7 @@ func extendslice(n *Node, init *Nodes) *Node {
 	fn = substArgTypes(fn, elemtype, elemtype)
 
 	// s = growslice(T, s, n)
-	nif.Nbody.Set1(nod(OAS, s, mkcall1(fn, s.Type, &nif.Ninit, typename(elemtype), s, nn)))
+	nif.Nbody.Set1(nod(OAS, s, mkcall1(fn, s.Type, &nif.Ninit, typename(elemtype), s, nn, allocPkgNode())))
 	nodes = append(nodes, nif)
 
 	// s = s[:n]
@@ -2926,7 +2929,7 @@ func walkappend(n *Node, init *Nodes, dst *Node) *Node {
 
 	nx.Nbody.Set1(nod(OAS, ns,
 		mkcall1(fn, ns.Type, &nx.Ninit, typename(ns.Type.Elem()), ns,
-			nod(OADD, nod(OLEN, ns, nil), na))))
+			nod(OADD, nod(OLEN, ns, nil), na), allocPkgNode())))
 
 	l = append(l, nx)
 
@@ -1,42 +1,96 @@
 package syntax
 
 import (
+	"gosb/commons"
 	"strconv"
+	"strings"
+	"unicode"
 )
 
-var sandboxCounter int = 0
-
-// Identifier for the package
-var PkgId int
-
-//TODO(aghosn) see if we want to have two ints instead of a string
-func generateSandboxId() *BasicLit {
-	b := new(BasicLit)
-	b.Kind = StringLit
-	b.Value = "\"" + strconv.Itoa(PkgId) + ":" + strconv.Itoa(sandboxCounter) + "\""
-	sandboxCounter++
-	return b
+// SetSandboxId sets the id of the sandbox literal f. The parser cannot
+// compute it, as it depends on the enclosing function and on the other
+// sandboxes of the package, see gc.sandboxId.
+func (f *FuncLit) SetSandboxId(id string) {
+	f.Id = strconv.Quote(id)
+	if f.idLit != nil {
+		f.idLit.Value = f.Id
+	}
 }
 
-func (p *parser) sandboxConfig() (string, string, string, []Stmt) {
+// sandboxHeader parses [mem, sys] or [mem, sys, "name"], the header of
+// sandbox literals and types. name is nil if there is none.
+func (p *parser) sandboxHeader() (memory, syscalls Expr, name *BasicLit) {
 	if trace {
-		defer p.trace("sandboxType")()
+		defer p.trace("sandboxHeader")()
 	}
 
-	pos := p.pos()
-
-	// Parse ["mem", "sys"], generate unique sandbox id
 	p.want(_Lbrack)
-	memory := p.oliteral()
+	memory = p.sandboxExpr()
 	p.want(_Comma)
-	syscalls := p.oliteral()
+	syscalls = p.sandboxExpr()
+	if p.got(_Comma) {
+		name = p.sandboxLiteral()
+	}
 	p.want(_Rbrack)
 
-	id := generateSandboxId()
-	id.pos = memory.pos
+	if b, ok := memory.(*BasicLit); ok {
+		p.checkMemoryView(b)
+	}
+	if b, ok := syscalls.(*BasicLit); ok {
+		p.checkSyscalls(b)
+	}
+	return
+}
+
+// sandboxType turns the signature typ into a sandbox type with the header
+// memory, syscalls and name. Sandbox types cannot be named, the name of a
+// sandbox belongs to its literal.
+func (p *parser) sandboxType(typ *FuncType, pos Pos, memory, syscalls Expr, name *BasicLit) *FuncType {
+	if name != nil {
+		p.errorAt(name.pos, "sandbox type cannot have a name")
+	}
+	typ.pos = pos
+	typ.Mem, typ.Sys = memory, syscalls
+	return typ
+}
 
-	config := []Expr{id, memory, syscalls}
+// sandboxConfig sets the name of f, and returns the calls to the prolog and
+// the epilog of the sandbox. They share the id of f, set later with
+// SetSandboxId.
+func (p *parser) sandboxConfig(f *FuncLit, memory, syscalls Expr, name *BasicLit) []Stmt {
+	pos := f.pos
+	if name != nil {
+		f.Name = p.checkSandboxName(name)
+	}
 
+	id := new(BasicLit)
+	id.pos = memory.Pos()
+	id.Kind = StringLit
+	id.Value = `""`
+	f.idLit = id
+
+	// The type checker resolves the configuration, see gc.typechecksandbox.
+	return sandboxStmts(pos, []Expr{id, SandboxArg(memory), SandboxArg(syscalls)})
+}
+
+// SandboxStmts returns the calls to the prolog and the epilog of the sandbox
+// id with the memory view mem and the syscalls sys, at pos. The compiler
+// sandboxes functions with a //go:sandbox directive with them.
+func SandboxStmts(pos Pos, id, mem, sys string) []Stmt {
+	config := make([]Expr, 3)
+	for i, v := range []string{id, mem, sys} {
+		b := new(BasicLit)
+		b.pos = pos
+		b.Kind = StringLit
+		b.Value = strconv.Quote(v)
+		config[i] = b
+	}
+	return sandboxStmts(pos, config)
+}
+
+// sandboxStmts returns the calls to the prolog and the epilog of a sandbox
+// with the arguments config, i.e., its id, memory view and syscalls.
+func sandboxStmts(pos Pos, config []Expr) []Stmt {
 	//call to preinit, replace with constant from somewhere.
 	prolog := sandboxGenerateCall("sandbox_prolog", config)
 	prologStmt := new(ExprStmt)
@@ -48,7 +102,170 @@ func (p *parser) sandboxConfig() (string, string, string, []Stmt) {
 	epilogStmt.Tok = _Defer
 	epilogStmt.Call = epilog_call
 	epilogStmt.pos = pos
-	return id.Value, memory.Value, syscalls.Value, []Stmt{prologStmt, epilogStmt}
+	return []Stmt{prologStmt, epilogStmt}
+}
+
+// sandboxExpr parses the memory view or the syscalls of a sandbox, i.e., a
+// string constant expression. Literals are checked by the parser, other
+// expressions by the type checker.
+func (p *parser) sandboxExpr() Expr {
+	p.xnest++
+	x := p.expr()
+	p.xnest--
+	if b, ok := x.(*BasicLit); ok && b.Kind != StringLit {
+		p.errorAt(b.pos, "sandbox configuration must be a string constant")
+		b.Kind, b.Value = StringLit, `""`
+	}
+	return x
+}
+
+// SandboxArg returns the configuration x as resolved by the compiler, i.e.,
+// as an argument of the prolog and the epilog, or in a sandbox type. Expressions are parenthesized to keep their position,
+// the compiler shares the nodes of the uses of a name with its declaration.
+func SandboxArg(x Expr) Expr {
+	if _, ok := x.(*BasicLit); ok {
+		return x
+	}
+	p := new(ParenExpr)
+	p.pos = x.Pos()
+	p.X = x
+	return p
+}
+
+// sandboxLiteral parses the name of a sandbox. It returns an empty name if
+// there is none.
+func (p *parser) sandboxLiteral() *BasicLit {
+	pos := p.pos()
+	if b := p.oliteral(); b != nil {
+		if b.Kind != StringLit {
+			p.errorAt(b.pos, "sandbox name must be a string literal")
+			b.Kind, b.Value = StringLit, `""`
+		}
+		return b
+	}
+	p.syntaxError("expecting string literal")
+	p.advance(_Comma, _Rbrack)
+	b := new(BasicLit)
+	b.pos = pos
+	b.Kind = StringLit
+	b.Value = `""`
+	return b
+}
+
+// checkSandboxName validates the name of a sandbox, and returns it
+// unquoted. Names are identifiers, so that they can be part of sandbox ids.
+func (p *parser) checkSandboxName(b *BasicLit) string {
+	name, err := strconv.Unquote(b.Value)
+	if err != nil {
+		// The scanner already reported the error.
+		return ""
+	}
+	if !IsSandboxName(name) {
+		p.errorAt(b.pos, "invalid sandbox name "+b.Value+": must be an identifier")
+		return ""
+	}
+	return name
+}
+
+// IsSandboxName reports whether name can name a sandbox.
+func IsSandboxName(name string) bool {
+	if name == "" || name == "_" {
+		return false
+	}
+	for i, c := range name {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkMemoryView validates the memory view of a sandbox. Errors are
+// reported at the offending entry.
+func (p *parser) checkMemoryView(b *BasicLit) {
+	value, offsets, ok := sandboxEntries(b, commons.DELIMITER_PKGS)
+	if !ok || len(value) == 0 {
+		return
+	}
+	for i, entry := range strings.Split(value, commons.DELIMITER_PKGS) {
+		if len(strings.TrimSpace(entry)) == 0 {
+			p.sandboxError(b, offsets[i], "invalid sandbox memory view", "empty entry")
+			return
+		}
+		if _, _, err := commons.ParseSandboxView(entry); err != nil {
+			p.sandboxError(b, offsets[i], "invalid sandbox memory view", err.Error())
+			return
+		}
+	}
+	// Checks that span several entries, e.g., duplicates.
+	if _, _, err := commons.ParseSandboxView(value); err != nil {
+		p.sandboxError(b, 0, "invalid sandbox memory view", err.Error())
+	}
+}
+
+// checkSyscalls validates the syscall classes of a sandbox. Errors are
+// reported at the offending class.
+func (p *parser) checkSyscalls(b *BasicLit) {
+	value, offsets, ok := sandboxEntries(b, commons.DELIMITER_SYSCALLS)
+	if !ok || len(strings.TrimSpace(value)) == 0 {
+		return
+	}
+	for i, class := range strings.Split(value, commons.DELIMITER_SYSCALLS) {
+		if len(strings.TrimSpace(class)) == 0 {
+			p.sandboxError(b, offsets[i], "invalid sandbox syscalls", "empty syscall class")
+			return
+		}
+		if _, err := commons.ParseSyscalls(class); err != nil {
+			p.sandboxError(b, offsets[i], "invalid sandbox syscalls", err.Error())
+			return
+		}
+	}
+	// Checks that span several classes, e.g., duplicates.
+	if _, err := commons.ParseSyscalls(value); err != nil {
+		p.sandboxError(b, 0, "invalid sandbox syscalls", err.Error())
+	}
+}
+
+// sandboxEntries unquotes the literal b and returns the offset, in the
+// literal, of each element delimited by sep. Offsets are 0 if they cannot
+// be mapped back to the source, e.g., because of escape sequences.
+func sandboxEntries(b *BasicLit, sep string) (string, []uint, bool) {
+	value, err := strconv.Unquote(b.Value)
+	if err != nil {
+		// The scanner already reported the error.
+		return "", nil, false
+	}
+	exact := len(value) == len(b.Value)-2 && !strings.Contains(value, "\n")
+	offsets := []uint{}
+	start := 0
+	for {
+		off := uint(0)
+		if exact {
+			// Skip the opening quote and leading white spaces.
+			trimmed := strings.TrimLeft(value[start:], " \t")
+			off = uint(1 + start + len(value[start:]) - len(trimmed))
+		}
+		offsets = append(offsets, off)
+		i := strings.Index(value[start:], sep)
+		if i < 0 {
+			break
+		}
+		start += i + len(sep)
+	}
+	return value, offsets, true
+}
+
+// sandboxError reports msg at offset bytes from the start of b.
+func (p *parser) sandboxError(b *BasicLit, offset uint, prefix, msg string) {
+	pos := b.pos
+	if offset != 0 {
+		pos = MakePos(pos.Base(), pos.Line(), pos.Col()+offset)
+	}
+	msg = strings.TrimSpace(msg)
+	if len(msg) > 0 {
+		msg = strings.ToLower(msg[:1]) + msg[1:]
+	}
+	p.errorAt(pos, prefix+" "+b.Value+": "+msg)
 }
 
 func sandboxGenerateCall(name string, args []Expr) *CallExpr {
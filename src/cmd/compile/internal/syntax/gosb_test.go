@@ -0,0 +1,117 @@
+package syntax
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSandboxConfig(t *testing.T) {
+	for _, test := range []struct {
+		config string
+		err    string // "" means no error, otherwise "col: message"
+	}{
+		{`["", ""]`, ""},
+		{`["main:R", "file,net"]`, ""},
+		{`["net/http:RW, self:P", " all "]`, ""},
+		{"[`main:RX`, `time`]", ""},
+		{`["main:R, self:heap=16M, self:copies=2", ""]`, ""},
+
+		// memory views
+		{`["main:RWR", ""]`, "25: invalid sandbox memory view \"main:RWR\": redundant permission marker R"},
+		{`["main:R,net/htp", ""]`, "32: invalid sandbox memory view \"main:R,net/htp\": parsing error"},
+		{`["main:R, fmt:W", ""]`, "33: invalid sandbox memory view \"main:R, fmt:W\": reading access right"},
+		{`["main:R,", ""]`, "32: invalid sandbox memory view \"main:R,\": empty entry"},
+		{`["fmt:P", ""]`, "25: invalid sandbox memory view \"fmt:P\": pristine applied"},
+		{`["main:R,main:RW", ""]`, "24: invalid sandbox memory view \"main:R,main:RW\": duplicated entry"},
+		{`["main:R,self:heap=16T", ""]`, "32: invalid sandbox memory view \"main:R,self:heap=16T\": invalid size 16T"},
+		{`["self:heap=1K,self:heap=2K", ""]`, "24: invalid sandbox memory view \"self:heap=1K,self:heap=2K\": duplicated heap quota"},
+		{`["\x6dain:Z", ""]`, "24: invalid sandbox memory view \"\\x6dain:Z\": invalid permission marker Z"},
+
+		// syscalls
+		{`["", "file,nett"]`, "34: invalid sandbox syscalls \"file,nett\": unknown syscall class nett"},
+		{`["", "file,,net"]`, "34: invalid sandbox syscalls \"file,,net\": empty syscall class"},
+		{`["", "net,net"]`, "28: invalid sandbox syscalls \"net,net\": duplicated syscall class"},
+
+		// names
+		{`["", "", "render"]`, ""},
+		{`["", "", "_render2"]`, ""},
+		{`["", "", "2d"]`, "32: invalid sandbox name \"2d\": must be an identifier"},
+		{`["", "", "a>b"]`, "32: invalid sandbox name \"a>b\": must be an identifier"},
+		{`["", "", ""]`, "32: invalid sandbox name \"\": must be an identifier"},
+		{`["", "", name]`, "32: syntax error: unexpected name, expecting string literal"},
+
+		// constant expressions, checked by the type checker
+		{`[mem, ""]`, ""},
+		{`[mem + ",self:P", pkg.Sys]`, ""},
+		{`[("main:R"), ""]`, ""},
+
+		// not string constants
+		{`[1, ""]`, "24: sandbox configuration must be a string constant"},
+		{`["", 'x']`, "28: sandbox configuration must be a string constant"},
+		{`[, ""]`, "24: syntax error: unexpected comma, expecting expression"},
+		{`["", "", 1]`, "32: sandbox name must be a string literal"},
+	} {
+		src := "package p\nfunc _() { _ = sandbox" + test.config + "() {} }\n"
+		var errs []string
+		_, err := Parse(nil, strings.NewReader(src), func(err error) {
+			e := err.(Error)
+			errs = append(errs, fmt.Sprintf("%d:%d: %s", e.Pos.Line(), e.Pos.Col(), e.Msg))
+		}, nil, 0)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.config, err)
+			}
+			continue
+		}
+		if len(errs) == 0 {
+			t.Errorf("%s: missing error %q", test.config, test.err)
+			continue
+		}
+		if want := "2:" + test.err; !strings.HasPrefix(errs[0], want) {
+			t.Errorf("%s: got %q; want prefix %q", test.config, errs[0], want)
+		}
+	}
+}
+
+func TestSandboxType(t *testing.T) {
+	for _, test := range []struct {
+		src string
+		err string // "" means no error, otherwise "line:col: message"
+	}{
+		{`type T sandbox["main:R", "file"](int) error`, ""},
+		{`type T sandbox[mem, ""]()`, ""},
+		{`func f(cb sandbox["", ""](), _ sandbox["", ""]() int) {}`, ""},
+		{`func f() sandbox["", ""]() { return nil }`, ""},
+		{`var _ = []sandbox["", ""](){nil}`, ""},
+		{`var _ = (sandbox["", ""]())(nil)`, ""},
+		{`type T sandbox["", "", "render"]()`, "1:35: sandbox type cannot have a name"},
+		{`type T sandbox["main:Z", ""]()`, "1:28: invalid sandbox memory view \"main:Z\": invalid permission marker Z"},
+		{`type T sandbox[1, ""]()`, "1:27: sandbox configuration must be a string constant"},
+		{`type T sandbox()`, "1:26: syntax error: unexpected (, expecting ["},
+	} {
+		src := "package p; " + test.src + "\n"
+		var errs []string
+		file, err := Parse(nil, strings.NewReader(src), func(err error) {
+			e := err.(Error)
+			errs = append(errs, fmt.Sprintf("%d:%d: %s", e.Pos.Line(), e.Pos.Col(), e.Msg))
+		}, nil, 0)
+		if test.err != "" {
+			if len(errs) == 0 || !strings.HasPrefix(errs[0], test.err) {
+				t.Errorf("%s: got %v; want prefix %q", test.src, errs, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.src, err)
+			continue
+		}
+		var buf strings.Builder
+		if _, err := Fprint(&buf, file, false); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(buf.String(), "sandbox[") {
+			t.Errorf("%s: sandbox type missing from %q", test.src, buf.String())
+		}
+	}
+}
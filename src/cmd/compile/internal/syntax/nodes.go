@@ -170,9 +170,9 @@ type (
 		Body *BlockStmt
 		// @aghosn values for the sandbox
 		IsSandbox bool
-		Id        string
-		Mem       string
-		Sys       string
+		Id        string // set by the compiler, see SetSandboxId
+		Name      string // optional, e.g., sandbox["", "", "name"]
+		idLit     *BasicLit
 		expr
 	}
 
@@ -287,6 +287,7 @@ type (
 	FuncType struct {
 		ParamList  []*Field
 		ResultList []*Field
+		Mem, Sys   Expr // sandbox configuration of sandbox types; or nil
 		expr
 	}
 
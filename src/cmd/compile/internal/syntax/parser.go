@@ -871,25 +871,25 @@ func (p *parser) operand(keep_parens bool) Expr {
 	case _Sandbox:
 		pos := p.pos()
 		p.next()
-		sbid, mem, sys, sbconfig := p.sandboxConfig()
+		memory, syscalls, name := p.sandboxHeader()
 		// Parse the closure type
-		ft := p.funcType()
-		// Parse the mandatory body for the function
+		t := p.funcType()
 		if p.tok != _Lbrace {
-			p.syntaxError("expecting {")
+			// sandbox type
+			return p.sandboxType(t, pos, memory, syscalls, name)
 		}
-
-		p.xnest++
 		f := new(FuncLit)
 		f.pos = pos
-		f.Type = ft
+		sbconfig := p.sandboxConfig(f, memory, syscalls, name)
+		f.Type = t
+
+		p.xnest++
 		f.Body = p.funcBody()
 		p.xnest--
 
 		// @aghosn, add the sandbox lines here
 		f.Body.List = append(sbconfig, f.Body.List...)
 		f.IsSandbox = true
-		f.Id, f.Mem, f.Sys = sbid, mem, sys
 		return f
 
 	case _Lbrack, _Chan, _Map, _Struct, _Interface:
@@ -1163,7 +1163,10 @@ func (p *parser) typeOrNil() Expr {
 		return p.funcType()
 
 	case _Sandbox:
-		p.syntaxError("sandbox cannot be used to define a type yet")
+		// sandboxtype
+		p.next()
+		memory, syscalls, name := p.sandboxHeader()
+		return p.sandboxType(p.funcType(), pos, memory, syscalls, name)
 
 	case _Lbrack:
 		// '[' oexpr ']' ntype
@@ -1504,12 +1507,10 @@ func (p *parser) paramDeclOrNil() *Field {
 	case _Name:
 		f.Name = p.name()
 		switch p.tok {
-		case _Name, _Star, _Arrow, _Func, _Lbrack, _Chan, _Map, _Struct, _Interface, _Lparen:
+		case _Name, _Star, _Arrow, _Func, _Sandbox, _Lbrack, _Chan, _Map, _Struct, _Interface, _Lparen:
 			// sym name_or_type
 			f.Type = p.type_()
 
-		case _Sandbox:
-			p.syntaxError("sandbox cannot be used as a parameter type yet")
 		case _DotDotDot:
 			// sym dotdotdot
 			f.Type = p.dotsType()
@@ -1521,13 +1522,10 @@ func (p *parser) paramDeclOrNil() *Field {
 			f.Name = nil
 		}
 
-	case _Arrow, _Star, _Func, _Lbrack, _Chan, _Map, _Struct, _Interface, _Lparen:
+	case _Arrow, _Star, _Func, _Sandbox, _Lbrack, _Chan, _Map, _Struct, _Interface, _Lparen:
 		// name_or_type
 		f.Type = p.type_()
 
-	case _Sandbox:
-		p.syntaxError("sandbox cannot be used as parameter type yet")
-
 	case _DotDotDot:
 		// dotdotdot
 		f.Type = p.dotsType()
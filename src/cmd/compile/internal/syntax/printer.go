@@ -457,7 +457,11 @@ func (p *printer) printRawNode(n Node) {
 		p.print(_Rbrace)
 
 	case *FuncType:
-		p.print(_Func)
+		if n.Mem != nil {
+			p.print(_Sandbox, _Lbrack, n.Mem, _Comma, blank, n.Sys, _Rbrack)
+		} else {
+			p.print(_Func)
+		}
 		p.printSignature(n)
 
 	case *InterfaceType:
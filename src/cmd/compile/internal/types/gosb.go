@@ -0,0 +1,75 @@
+package types
+
+import "gosb/commons"
+
+// Sandbox is the configuration of a sandbox func type, i.e., the memory
+// view and the syscall classes of the sandbox literals of that type.
+type Sandbox struct {
+	Mem string
+	Sys string
+
+	// canonical forms of Mem and Sys, see NewSandbox
+	mem, sys string
+}
+
+// NewSandbox returns the configuration of a sandbox func type. Sandbox
+// types are identical if their configurations are equivalent, regardless of
+// the order of their entries.
+func NewSandbox(mem, sys string) *Sandbox {
+	return &Sandbox{
+		Mem: mem,
+		Sys: sys,
+		mem: commons.CanonicalMemoryView(mem),
+		sys: commons.CanonicalSyscalls(sys),
+	}
+}
+
+// IsSandbox reports whether t is a sandbox func type.
+func (t *Type) IsSandbox() bool {
+	return t.Etype == TFUNC && t.FuncType().Sandbox != nil
+}
+
+// identical reports whether sandbox configurations s and x are identical.
+// Both are nil for plain func types.
+func (s *Sandbox) identical(x *Sandbox) bool {
+	if s == nil || x == nil {
+		return s == x
+	}
+	return s.mem == x.mem && s.sys == x.sys
+}
+
+// cmp compares sandbox configurations s and x, nil sorts first.
+func (s *Sandbox) cmp(x *Sandbox) Cmp {
+	switch {
+	case s == x:
+		return CMPeq
+	case s == nil || x == nil:
+		return cmpForNe(s == nil)
+	case s.mem != x.mem:
+		return cmpForNe(s.mem < x.mem)
+	case s.sys != x.sys:
+		return cmpForNe(s.sys < x.sys)
+	}
+	return CMPeq
+}
+
+// IdenticalSignature reports whether func types t1 and t2 have identical
+// parameters and results, regardless of their sandbox configurations.
+func IdenticalSignature(t1, t2 *Type) bool {
+	if t1.Etype != TFUNC || t2.Etype != TFUNC {
+		return false
+	}
+	for _, f := range ParamsResults {
+		fs1, fs2 := f(t1).FieldSlice(), f(t2).FieldSlice()
+		if len(fs1) != len(fs2) {
+			return false
+		}
+		for i, f1 := range fs1 {
+			f2 := fs2[i]
+			if f1.IsDDD() != f2.IsDDD() || !Identical(f1.Type, f2.Type) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -91,6 +91,9 @@ func identical(t1, t2 *Type, cmpTags bool, assumedEqual map[typePair]struct{}) b
 		// Check parameters and result parameters for type equality.
 		// We intentionally ignore receiver parameters for type
 		// equality, because they're never relevant.
+		if !t1.FuncType().Sandbox.identical(t2.FuncType().Sandbox) {
+			return false
+		}
 		for _, f := range ParamsResults {
 			// Loop over fields in structs, ignoring argument names.
 			fs1, fs2 := f(t1).FieldSlice(), f(t2).FieldSlice()
@@ -254,6 +254,9 @@ type Func struct {
 	Argwid int64
 
 	Outnamed bool
+
+	// @aghosn configuration of sandbox types, nil for plain func types.
+	Sandbox *Sandbox
 }
 
 // FuncType returns t's extra func-specific fields.
@@ -1119,6 +1122,9 @@ func (t *Type) cmp(x *Type) Cmp {
 		return CMPeq
 
 	case TFUNC:
+		if c := t.FuncType().Sandbox.cmp(x.FuncType().Sandbox); c != CMPeq {
+			return c
+		}
 		for _, f := range RecvsParamsResults {
 			// Loop over fields in structs, ignoring argument names.
 			tfs := f(t).FieldSlice()
@@ -135,6 +135,12 @@
 // 		arguments to pass on each gccgo compiler/linker invocation.
 // 	-gcflags '[pattern=]arg list'
 // 		arguments to pass on each go tool compile invocation.
+// 	-gosb backend
+// 		sandbox backend to record in the binary: sim, vtx, mpk or mprotect.
+// 		Programs that call gosb.InitializeDefault run their sandboxes
+// 		with this backend, vtx by default. The mprotect backend is
+// 		best-effort: it does not filter syscalls, and a sandbox can undo
+// 		its protections.
 // 	-installsuffix suffix
 // 		a suffix to use in the name of the package installation directory,
 // 		in order to keep output separate from default builds.
@@ -788,6 +794,9 @@
 //         TestImports  []string          // imports from TestGoFiles
 //         XTestImports []string          // imports from XTestGoFiles
 //
+//         // Sandbox information
+//         Sandboxes []*Sandbox // sandboxes of the package (when using -sandboxes)
+//
 //         // Error information
 //         Incomplete bool            // this package or a dependency has an error
 //         Error      *PackageError   // error loading package
@@ -859,6 +868,21 @@
 // The -export flag causes list to set the Export field to the name of a
 // file containing up-to-date export information for the given package.
 //
+// The -sandboxes flag causes list to build the packages and set their
+// Sandboxes field, where
+//
+//     type Sandbox struct {
+//         Id       string   // id of the sandbox, e.g., main.main#0
+//         Func     string   // symbol of the sandbox function
+//         Mem      string   // memory view
+//         Sys      string   // syscall classes
+//         Packages []string // packages the sandbox can access, including transitive dependencies
+//     }
+//
+// The Packages are the ones that the linker gives the sandbox access to:
+// the packages that the sandbox references, the packages in its memory view,
+// and their transitive dependencies.
+//
 // The -find flag causes list to identify the named packages but not
 // resolve their dependencies: the Imports and Deps lists will be empty.
 //
@@ -0,0 +1,93 @@
+package list
+
+import (
+	"cmd/go/internal/base"
+	"cmd/go/internal/load"
+	"gosb/commons"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listSandboxes sets the Sandboxes of the packages from the sandbox entries
+// of their compiled packages, see p.Export. The packages of each sandbox are
+// computed like the linker does, see commons.WalkDeps.
+func listSandboxes(pkgs []*load.Package) {
+	all := make(map[string]*load.Package)
+	for _, p := range load.PackageList(pkgs) {
+		all[p.ImportPath] = p
+	}
+	for _, p := range pkgs {
+		if p.Export == "" {
+			continue
+		}
+		data, err := ioutil.ReadFile(p.Export)
+		if err != nil {
+			base.Errorf("go list: reading sandboxes of %s: %v", p.ImportPath, err)
+			continue
+		}
+		sbs, err := commons.ParseObjSandboxes(string(data))
+		if err != nil {
+			base.Errorf("go list: reading sandboxes of %s: %s", p.ImportPath, strings.TrimSpace(err.Error()))
+			continue
+		}
+		for _, sb := range sbs {
+			p.Sandboxes = append(p.Sandboxes, newSandbox(sb, all))
+		}
+	}
+}
+
+// newSandbox returns the description of the sandbox sb. all maps import
+// paths to the packages loaded so far, and gets the packages that the
+// sandbox depends on but that are not dependencies of the listed packages,
+// e.g., gosb.
+func newSandbox(sb commons.ObjSandbox, all map[string]*load.Package) *load.Sandbox {
+	deps := func(path string) []string {
+		p, ok := all[path]
+		if !ok {
+			var stk load.ImportStack
+			p = load.LoadImportWithFlags(path, base.Cwd, nil, &stk, nil, 0)
+			for _, p1 := range load.PackageList([]*load.Package{p}) {
+				all[p1.ImportPath] = p1
+			}
+		}
+		res := make([]string, 0, len(p.Internal.Imports))
+		for _, p1 := range p.Internal.Imports {
+			res = append(res, p1.ImportPath)
+		}
+		return res
+	}
+	visited := make(map[string]bool)
+	visit := func(path string) bool {
+		if visited[path] {
+			return true
+		}
+		visited[path] = true
+		return false
+	}
+	view, _, _ := commons.ParseSandboxView(sb.Mem)
+	for _, root := range commons.SandboxRoots(sb.Packages, view) {
+		commons.WalkDeps(root, deps, visit)
+	}
+
+	res := &load.Sandbox{
+		Id:   unquote(sb.Id),
+		Func: sb.Func,
+		Mem:  unquote(sb.Mem),
+		Sys:  unquote(sb.Sys),
+	}
+	for path := range visited {
+		res.Packages = append(res.Packages, path)
+	}
+	sort.Strings(res.Packages)
+	return res
+}
+
+// unquote returns the sandbox configuration s, that the compiler quotes.
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
@@ -99,6 +99,9 @@ to -f '{{.ImportPath}}'. The struct being passed to the template is:
         TestImports  []string          // imports from TestGoFiles
         XTestImports []string          // imports from XTestGoFiles
 
+        // Sandbox information
+        Sandboxes []*Sandbox // sandboxes of the package (when using -sandboxes)
+
         // Error information
         Incomplete bool            // this package or a dependency has an error
         Error      *PackageError   // error loading package
@@ -170,6 +173,21 @@ a non-nil Error field; other information may or may not be missing
 The -export flag causes list to set the Export field to the name of a
 file containing up-to-date export information for the given package.
 
+The -sandboxes flag causes list to build the packages and set their
+Sandboxes field, where
+
+    type Sandbox struct {
+        Id       string   // id of the sandbox, e.g., main.main#0
+        Func     string   // symbol of the sandbox function
+        Mem      string   // memory view
+        Sys      string   // syscall classes
+        Packages []string // packages the sandbox can access, including transitive dependencies
+    }
+
+The Packages are the ones that the linker gives the sandbox access to:
+the packages that the sandbox references, the packages in its memory view,
+and their transitive dependencies.
+
 The -find flag causes list to identify the named packages but not
 resolve their dependencies: the Imports and Deps lists will be empty.
 
@@ -299,6 +317,7 @@ var (
 	listFind     = CmdList.Flag.Bool("find", false, "")
 	listJson     = CmdList.Flag.Bool("json", false, "")
 	listM        = CmdList.Flag.Bool("m", false, "")
+	listSandbox  = CmdList.Flag.Bool("sandboxes", false, "")
 	listU        = CmdList.Flag.Bool("u", false, "")
 	listTest     = CmdList.Flag.Bool("test", false, "")
 	listVersions = CmdList.Flag.Bool("versions", false, "")
@@ -377,6 +396,9 @@ func runList(cmd *base.Command, args []string) {
 		if *listFind {
 			base.Fatalf("go list -find cannot be used with -m")
 		}
+		if *listSandbox {
+			base.Fatalf("go list -sandboxes cannot be used with -m")
+		}
 		if *listTest {
 			base.Fatalf("go list -test cannot be used with -m")
 		}
@@ -419,6 +441,9 @@ func runList(cmd *base.Command, args []string) {
 	if *listFind && *listTest {
 		base.Fatalf("go list -test cannot be used with -find")
 	}
+	if *listFind && *listSandbox {
+		base.Fatalf("go list -sandboxes cannot be used with -find")
+	}
 
 	load.IgnoreImports = *listFind
 	var pkgs []*load.Package
@@ -437,6 +462,9 @@ func runList(cmd *base.Command, args []string) {
 		if *listExport {
 			base.Fatalf("go list -export requires build cache")
 		}
+		if *listSandbox {
+			base.Fatalf("go list -sandboxes requires build cache")
+		}
 		if *listTest {
 			base.Fatalf("go list -test requires build cache")
 		}
@@ -502,11 +530,11 @@ func runList(cmd *base.Command, args []string) {
 
 	// Do we need to run a build to gather information?
 	needStale := *listJson || strings.Contains(*listFmt, ".Stale")
-	if needStale || *listExport || *listCompiled {
+	if needStale || *listExport || *listCompiled || *listSandbox {
 		var b work.Builder
 		b.Init()
 		b.IsCmdList = true
-		b.NeedExport = *listExport
+		b.NeedExport = *listExport || *listSandbox
 		b.NeedCompiledGoFiles = *listCompiled
 		a := &work.Action{}
 		// TODO: Use pkgsFilter?
@@ -518,6 +546,15 @@ func runList(cmd *base.Command, args []string) {
 		b.Do(a)
 	}
 
+	if *listSandbox {
+		listSandboxes(pkgs)
+		if !*listExport {
+			for _, p := range pkgs {
+				p.Export = ""
+			}
+		}
+	}
+
 	for _, p := range pkgs {
 		// Show vendor-expanded paths in listing
 		p.TestImports = p.Resolve(p.TestImports)
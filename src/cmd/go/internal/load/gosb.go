@@ -0,0 +1,10 @@
+package load
+
+// A Sandbox describes a sandbox of a package, see go list -sandboxes.
+type Sandbox struct {
+	Id       string   // id of the sandbox, e.g., main.main#0
+	Func     string   // symbol of the sandbox function
+	Mem      string   // memory view
+	Sys      string   // syscall classes
+	Packages []string // packages the sandbox can access, including transitive dependencies
+}
@@ -87,6 +87,12 @@ and test commands:
 		arguments to pass on each gccgo compiler/linker invocation.
 	-gcflags '[pattern=]arg list'
 		arguments to pass on each go tool compile invocation.
+	-gosb backend
+		sandbox backend to record in the binary: sim, vtx, mpk or mprotect.
+		Programs that call gosb.InitializeDefault run their sandboxes
+		with this backend, vtx by default. The mprotect backend is
+		best-effort: it does not filter syscalls, and a sandbox can undo
+		its protections.
 	-installsuffix suffix
 		a suffix to use in the name of the package installation directory,
 		in order to keep output separate from default builds.
@@ -241,6 +247,7 @@ func AddBuildFlags(cmd *base.Command, mask BuildFlagMask) {
 	cmd.Flag.StringVar(&cfg.BuildBuildmode, "buildmode", "default", "")
 	cmd.Flag.Var(&load.BuildGcflags, "gcflags", "")
 	cmd.Flag.Var(&load.BuildGccgoflags, "gccgoflags", "")
+	cmd.Flag.StringVar(&cfg.BuildGosb, "gosb", "", "")
 	if mask&OmitModFlag == 0 {
 		cmd.Flag.StringVar(&cfg.BuildMod, "mod", "", "")
 	}
@@ -14,7 +14,6 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 
 	"cmd/go/internal/base"
@@ -56,9 +55,6 @@ func (gcToolchain) gc(b *Builder, a *Action, archive string, importcfg []byte, s
 	}
 	gcargs := []string{"-p", pkgpath}
 
-	// @aghosn adding the action id
-	gcargs = append(gcargs, "-pkgId", strconv.Itoa(a.spkgId))
-
 	if p.Module != nil && p.Module.GoVersion != "" && allowedVersion(p.Module.GoVersion) {
 		gcargs = append(gcargs, "-lang=go"+p.Module.GoVersion)
 	}
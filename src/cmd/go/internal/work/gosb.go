@@ -2,7 +2,10 @@ package work
 
 import (
 	"bytes"
+	"cmd/go/internal/base"
+	"cmd/go/internal/cfg"
 	"fmt"
+	"gosb/backend"
 	"strings"
 )
 
@@ -78,3 +81,15 @@ func registerDependencies(root *Action) {
 	}
 	allDeps = out.Bytes()
 }
+
+// gosbInit records the backend of the -gosb flag in gosb/backend, see
+// backend.Recorded.
+func gosbInit() {
+	if cfg.BuildGosb == "" {
+		return
+	}
+	if _, err := backend.Parse(cfg.BuildGosb); err != nil {
+		base.Fatalf("go %s: invalid -gosb backend %q: expected one of %s", cfg.CmdName, cfg.BuildGosb, strings.Join(backend.Names[:], ", "))
+	}
+	forcedLdflags = append(forcedLdflags, "-X=gosb/backend.recorded="+strings.ToLower(cfg.BuildGosb))
+}
@@ -22,6 +22,7 @@ func BuildInit() {
 	load.ModInit()
 	instrumentInit()
 	buildModeInit()
+	gosbInit()
 
 	// Make sure -pkgdir is absolute, because we run commands
 	// in different directories.
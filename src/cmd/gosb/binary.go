@@ -0,0 +1,198 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/elf"
+	"encoding/json"
+	"fmt"
+	"gosb/commons"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Names of the sections written by the linker, see cmd/link/internal/ld/gosb.go.
+var metaSections = []string{".fake", ".bloated", ".sandboxes", ".gosbsyms"}
+
+// trustedSandbox is the id of the configuration of the trusted code.
+const trustedSandbox = commons.TrustedSandboxId
+
+// A binary is the sandbox metadata of an executable.
+type binary struct {
+	path      string
+	pkgs      []*commons.Package // sorted by name
+	sandboxes []*commons.SandboxDomain
+	sects     []*elf.Section // the metadata sections
+	progs     []*elf.Prog
+	syms      map[string]elf.Symbol
+}
+
+// load reads the metadata of the executable at path.
+func load(path string) (*binary, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b := &binary{path: path, progs: f.Progs, syms: make(map[string]elf.Symbol)}
+	for _, name := range metaSections {
+		if s := f.Section(name); s != nil {
+			b.sects = append(b.sects, s)
+		}
+	}
+	bloated, sandboxes := f.Section(".bloated"), f.Section(".sandboxes")
+	if bloated == nil || sandboxes == nil {
+		return nil, fmt.Errorf("%v: no sandbox metadata", path)
+	}
+	if err := readJSON(bloated, &b.pkgs); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	if err := readJSON(sandboxes, &b.sandboxes); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	sort.Slice(b.pkgs, func(i, j int) bool { return b.pkgs[i].Name < b.pkgs[j].Name })
+	for _, d := range b.sandboxes {
+		if id, err := strconv.Unquote(d.Id); err == nil {
+			d.Id = id
+		}
+		sort.Strings(d.Pkgs)
+	}
+	sort.Slice(b.sandboxes, func(i, j int) bool { return b.sandboxes[i].Id < b.sandboxes[j].Id })
+
+	// The symbols are optional, e.g., in a stripped binary, in which case
+	// the ones gosb needs are still in .gosbsyms.
+	syms, _ := f.Symbols()
+	for _, s := range syms {
+		b.syms[s.Name] = s
+	}
+	if s := f.Section(".gosbsyms"); s != nil && len(syms) == 0 {
+		var gsyms []commons.Symbol
+		if err := readJSON(s, &gsyms); err != nil {
+			return nil, fmt.Errorf("%v: %v", path, err)
+		}
+		for _, s := range gsyms {
+			b.syms[s.Name] = elf.Symbol{Name: s.Name, Value: s.Value, Size: s.Size}
+		}
+	}
+	return b, nil
+}
+
+func readJSON(s *elf.Section, v interface{}) error {
+	data, err := s.Data()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid %v section: %v", s.Name, err)
+	}
+	return nil
+}
+
+// pkg returns the package name.
+func (b *binary) pkg(name string) *commons.Package {
+	i := sort.Search(len(b.pkgs), func(i int) bool { return b.pkgs[i].Name >= name })
+	if i < len(b.pkgs) && b.pkgs[i].Name == name {
+		return b.pkgs[i]
+	}
+	return nil
+}
+
+// trusted computes the trusted address space as gosb.Initialize does.
+func (b *binary) trusted() *commons.VMAreas {
+	space := new(commons.VMAreas)
+	if p := b.pkg(commons.TrustedPkgName); p != nil {
+		for _, s := range p.Sects {
+			if s.Size == 0 {
+				continue
+			}
+			space.Map(&commons.VMArea{Section: commons.Section{
+				Addr: commons.Round(s.Addr, false),
+				Size: commons.Round(s.Size, true),
+				Prot: s.Prot | commons.USER_VAL,
+			}})
+		}
+	}
+	for _, p := range b.pkgs {
+		if p.Name != commons.TrustedPkgName {
+			space.UnmapArea(pkgVMAs(p))
+		}
+	}
+	for _, d := range b.sandboxes {
+		if s, ok := b.syms[d.Func]; ok && s.Size != 0 {
+			space.Unmap(&commons.VMArea{Section: commons.Section{
+				Addr: commons.Round(s.Value, false),
+				Size: commons.Round(s.Size, true),
+			}})
+		}
+	}
+	return space
+}
+
+// pkgVMAs is commons.PackageToVMAs for packages that might be misaligned,
+// which are reported by check rather than aborting.
+func pkgVMAs(p *commons.Package) *commons.VMAreas {
+	acc := make([]*commons.VMArea, 0, len(p.Sects)+len(p.Dynamic))
+	for _, sects := range [][]commons.Section{p.Sects, p.Dynamic} {
+		for _, s := range sects {
+			if s.Size == 0 {
+				continue
+			}
+			start, end := commons.Round(s.Addr, false), commons.Round(s.Addr+s.Size, true)
+			acc = append(acc, &commons.VMArea{Section: commons.Section{
+				Addr: start,
+				Size: end - start,
+				Prot: s.Prot | commons.USER_VAL,
+			}})
+		}
+	}
+	return commons.Convert(acc)
+}
+
+// protString formats the protection of a section, e.g., "rw-".
+func protString(prot uint8) string {
+	res := []byte("---")
+	if prot&commons.R_VAL != 0 {
+		res[0] = 'r'
+	}
+	if prot&commons.W_VAL != 0 {
+		res[1] = 'w'
+	}
+	if prot&commons.X_VAL != 0 {
+		res[2] = 'x'
+	}
+	return string(res)
+}
+
+// viewString formats the memory view of a sandbox as in its configuration.
+func viewString(d *commons.SandboxDomain) string {
+	names := make([]string, 0, len(d.View))
+	for name := range d.View {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]string, 0, len(names)+4)
+	for _, name := range names {
+		entries = append(entries, name+commons.DELIMITER_ENTRY+commons.PermString(d.View[name]))
+	}
+	self := commons.SELF_IDENTIFIER + commons.DELIMITER_ENTRY
+	if d.Pristine {
+		entries = append(entries, self+commons.PRISTINE)
+	}
+	quotas := []struct {
+		name  string
+		value uint64
+	}{
+		{commons.QUOTA_HEAP, d.Quota.Heap},
+		{commons.QUOTA_COPIES, uint64(d.Quota.Copies)},
+		{commons.QUOTA_WARM, uint64(d.Quota.Warm)},
+	}
+	for _, q := range quotas {
+		if q.value != 0 {
+			entries = append(entries, fmt.Sprintf("%v%v%v%v", self, q.name, commons.DELIMITER_QUOTA, q.value))
+		}
+	}
+	return strings.Join(entries, commons.DELIMITER_PKGS)
+}
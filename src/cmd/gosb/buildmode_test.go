@@ -0,0 +1,194 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"internal/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testbuildmodeRun = `
+package main
+
+import (
+	"fmt"
+	"gosb"
+	"gosb/backend"
+	"os"
+	"strings"
+)
+
+var counter int
+
+func tryIt(f func()) (err interface{}) {
+	defer func() { err = recover() }()
+	f()
+	return nil
+}
+
+func run() {
+	b := backend.SIM_BACKEND
+	if os.Getenv("GOSB_BACKEND") == "MPROTECT" {
+		b = backend.MPROTECT_BACKEND
+	}
+	gosb.Initialize(b)
+	s := "hello"
+	sandbox["", ""]() {
+		s = strings.ToUpper(s)
+	}()
+	fmt.Println("allowed:", s)
+	err := tryIt(func() {
+		sandbox["main:R", ""]() {
+			counter++
+		}()
+	})
+	fmt.Println("violation:", err)
+	// Exit from Go for the learning mode to print its summary in a C host.
+	os.Exit(0)
+}
+`
+
+const testbuildmodeMain = `
+package main
+
+func main() { run() }
+`
+
+const testbuildmodeExport = `
+package main
+
+import "C"
+
+//export Run
+func Run() { run() }
+
+func main() {}
+`
+
+const testbuildmodeHost = `
+#include "lib.h"
+
+int main(void) {
+	Run();
+	return 1;
+}
+`
+
+// The sandboxes are at a load bias in PIE and in libraries, and an external
+// linker lays out the sections in c-shared and c-archive build modes.
+func TestBuildModes(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestBuildModes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	for name, src := range map[string]string{
+		"run.go":    testbuildmodeRun,
+		"main.go":   testbuildmodeMain,
+		"export.go": testbuildmodeExport,
+		"host.c":    testbuildmodeHost,
+	} {
+		if err := ioutil.WriteFile(filepath.Join(tmpdir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		flags []string
+		cgo   bool
+	}{
+		{name: "exe"},
+		{name: "pie", flags: []string{"-buildmode=pie"}, cgo: true},
+		{name: "pie-internal", flags: []string{"-buildmode=pie", "-ldflags=-linkmode=internal"}},
+		{name: "c-archive", flags: []string{"-buildmode=c-archive"}, cgo: true},
+		{name: "c-shared", flags: []string{"-buildmode=c-shared"}, cgo: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.cgo {
+				testenv.MustHaveCGO(t)
+			}
+			exe := buildMode(t, tmpdir, tt.name, tt.flags)
+			for _, b := range []struct {
+				name string
+				env  []string
+				want []string
+			}{
+				{"MPROTECT", nil, []string{"allowed: HELLO", "violation: sandbox"}},
+				{"SIM", []string{"GOSB_LEARN=1"}, []string{"allowed: HELLO", "violation: <nil>", `.func2.1: sandbox["`, "main:RW"}},
+			} {
+				cmd := exec.Command(exe)
+				cmd.Dir = tmpdir
+				cmd.Env = append(os.Environ(), append(b.env, "GOSB_BACKEND="+b.name, "LD_LIBRARY_PATH="+tmpdir)...)
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					t.Errorf("%v: %v\n%s", b.name, err, out)
+					continue
+				}
+				for _, want := range b.want {
+					if !bytes.Contains(out, []byte(want)) {
+						t.Errorf("%v: missing %q in output:\n%s", b.name, want, out)
+					}
+				}
+			}
+		})
+	}
+}
+
+// buildMode builds the test program of TestBuildModes with flags, and a C
+// host for the libraries. It returns the executable.
+func buildMode(t *testing.T, dir, name string, flags []string) string {
+	gotool := testenv.GoToolPath(t)
+	exe := filepath.Join(dir, name+".exe")
+	lib := ""
+	files := []string{"run.go", "main.go"}
+	switch name {
+	case "c-archive":
+		lib = filepath.Join(dir, "lib.a")
+		files = []string{"run.go", "export.go"}
+	case "c-shared":
+		lib = filepath.Join(dir, "lib.so")
+		files = []string{"run.go", "export.go"}
+	}
+	out := exe
+	if lib != "" {
+		out = lib
+	}
+	args := append(append([]string{"build", "-o", out}, flags...), files...)
+	cmd := exec.Command(gotool, args...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go %v: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	if lib == "" {
+		return exe
+	}
+
+	cc, err := exec.Command(gotool, "env", "CC").Output()
+	if err != nil {
+		t.Fatalf("go env CC: %v", err)
+	}
+	args = append(strings.Fields(string(cc)), "-o", exe, "host.c", lib)
+	if strings.HasSuffix(lib, ".a") {
+		args = append(args, "-lpthread")
+	}
+	cmd = exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return exe
+}
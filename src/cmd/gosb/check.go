@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gosb/commons"
+	"sort"
+)
+
+// A pageRange is the page-rounded range of a section and its package.
+type pageRange struct {
+	start, end uint64
+	pkg        string
+}
+
+// check returns the problems in the layout of b.
+// Backends isolate packages at page granularity, hence a misaligned
+// section or two packages on the same page break the isolation.
+func check(b *binary) []string {
+	var problems []string
+	var ranges []pageRange
+	for _, p := range b.pkgs {
+		// The trusted package spans the whole binary and is carved by the others.
+		if p.Name == commons.TrustedPkgName {
+			continue
+		}
+		for _, s := range p.Sects {
+			if s.Size == 0 {
+				continue
+			}
+			if s.Addr%commons.PageSize != 0 {
+				problems = append(problems, fmt.Sprintf("package %v: section %#x-%#x is not page aligned", p.Name, s.Addr, s.Addr+s.Size))
+			}
+			ranges = append(ranges, pageRange{commons.Round(s.Addr, false), commons.Round(s.Addr+s.Size, true), p.Name})
+		}
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].start < ranges[j].start })
+	for i := range ranges {
+		for j := i + 1; j < len(ranges) && ranges[j].start < ranges[i].end; j++ {
+			if ranges[i].pkg == ranges[j].pkg {
+				continue
+			}
+			end := ranges[i].end
+			if ranges[j].end < end {
+				end = ranges[j].end
+			}
+			problems = append(problems, fmt.Sprintf("packages %v and %v overlap at %#x-%#x", ranges[i].pkg, ranges[j].pkg, ranges[j].start, end))
+		}
+	}
+
+	for _, d := range b.sandboxes {
+		if d.Id == trustedSandbox {
+			continue
+		}
+		if len(b.syms) != 0 {
+			if _, ok := b.syms[d.Func]; !ok {
+				problems = append(problems, fmt.Sprintf("sandbox %v: no symbol for %v", d.Id, d.Func))
+			}
+		}
+		for _, name := range d.Pkgs {
+			if b.pkg(name) == nil {
+				problems = append(problems, fmt.Sprintf("sandbox %v: unknown package %v", d.Id, name))
+			}
+		}
+		for name := range d.View {
+			if b.pkg(name) == nil {
+				problems = append(problems, fmt.Sprintf("sandbox %v: view names unknown package %v", d.Id, name))
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
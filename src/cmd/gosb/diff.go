@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"gosb/commons"
+	"io"
+	"sort"
+	"strings"
+)
+
+// diff prints the packages and sandboxes that differ between old and new.
+func diff(w io.Writer, old, new *binary) {
+	diffEntries(w, "package", summarizePkgs(old), summarizePkgs(new))
+	diffEntries(w, "sandbox", summarizeSandboxes(old), summarizeSandboxes(new))
+}
+
+// diffEntries prints the entries of old and new that differ, by key.
+func diffEntries(w io.Writer, kind string, old, new map[string]string) {
+	keys := make([]string, 0, len(old)+len(new))
+	for k := range old {
+		keys = append(keys, k)
+	}
+	for k := range new {
+		if _, ok := old[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		o, inOld := old[k]
+		n, inNew := new[k]
+		if inOld && inNew && o == n {
+			continue
+		}
+		if inOld {
+			fmt.Fprintf(w, "- %v %v: %v\n", kind, k, o)
+		}
+		if inNew {
+			fmt.Fprintf(w, "+ %v %v: %v\n", kind, k, n)
+		}
+	}
+}
+
+// summarizePkgs describes each package by the sizes and protections of its
+// sections, as their addresses change with any modification of the binary.
+func summarizePkgs(b *binary) map[string]string {
+	res := make(map[string]string)
+	for _, p := range b.pkgs {
+		var sects []string
+		for _, s := range p.Sects {
+			if s.Size != 0 {
+				sects = append(sects, fmt.Sprintf("%v/%v", s.Size, protString(s.Prot)))
+			}
+		}
+		res[p.Name] = strings.Join(sects, " ")
+	}
+	return res
+}
+
+func summarizeSandboxes(b *binary) map[string]string {
+	res := make(map[string]string)
+	for _, d := range b.sandboxes {
+		res[d.Id] = fmt.Sprintf("%v view=%q sys=%q pkgs=[%v]", d.Func, viewString(d),
+			commons.SyscallPolicyString(d.Sys, d.Args), strings.Join(d.Pkgs, " "))
+	}
+	return res
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Gosb inspects the sandbox metadata that the linker writes into a binary.
+//
+// Usage:
+//	go tool gosb [-pkgs] [-sandboxes] [-trusted] [-segment] binary
+//	go tool gosb -check binary...
+//	go tool gosb -diff old new
+//
+// By default, gosb prints every part of the metadata of the binary:
+//
+//	-pkgs
+//		the segregated packages, with the address range, size and
+//		protection of each of their sections
+//	-sandboxes
+//		each sandbox, with its function, memory view, syscall policy,
+//		quotas and transitive package set
+//	-trusted
+//		the trusted address space, i.e., the memory of the non-bloated
+//		packages minus the segregated packages and the sandbox functions
+//	-segment
+//		the segment that holds the .bloated, .sandboxes and .gosbsyms
+//		sections
+//
+// A sandbox is identified by its enclosing function and its name, e.g.,
+// main.(*T).M#render for sandbox["", "", "render"] in method M of main, or
+// by its rank among the unnamed sandboxes of the function, e.g., main.main#0.
+// A function with a //go:sandbox directive is identified by its name, e.g.,
+// main.(*T).M.
+// The ids only change if the sandbox moves to another function, and policy
+// files refer to them, see the -gosbpolicy linker flag and the GOSB_POLICY
+// environment variable of gosb.Initialize.
+//
+// Before linking, go list -sandboxes reports the sandboxes of the packages,
+// with the same transitive package sets.
+//
+// The addresses are the ones chosen by the Go linker. In PIE binaries and in
+// c-shared and c-archive libraries, gosb.Initialize relocates them when the
+// program starts, and an external linker might move the Go sections of the
+// binary, see the ELF section headers.
+//
+// The -check flag verifies the layout of each binary: the sections of a
+// segregated package must start on a page boundary, the sections of two
+// packages cannot share a page, and the sandboxes can only name packages
+// and functions that exist. Each problem is printed on its own line, and
+// gosb exits with status 1 if there is any.
+//
+// The -diff flag prints the packages, sections and sandboxes that differ
+// between two binaries, prefixed with "-" if they are only in old, "+" if
+// they are only in new. Addresses are not compared, only sizes and
+// protections, as any change of the code moves the sections.
+package main
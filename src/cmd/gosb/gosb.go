@@ -0,0 +1,171 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"debug/elf"
+	"flag"
+	"fmt"
+	"gosb/commons"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+const helpText = `usage: go tool gosb [options] binary
+       go tool gosb -check binary...
+       go tool gosb -diff old new
+
+Flags:
+  -pkgs       print the segregated packages and their sections
+  -sandboxes  print the sandboxes and their policies
+  -trusted    print the trusted address space
+  -segment    print the segment holding the sandbox metadata
+  -check      check the layout of the binaries
+  -diff       print the differences between two binaries
+
+Without any of -pkgs, -sandboxes, -trusted and -segment, all are printed.
+`
+
+func usage() {
+	fmt.Fprint(os.Stderr, helpText)
+	os.Exit(2)
+}
+
+var (
+	pkgsFlag      = flag.Bool("pkgs", false, "")
+	sandboxesFlag = flag.Bool("sandboxes", false, "")
+	trustedFlag   = flag.Bool("trusted", false, "")
+	segmentFlag   = flag.Bool("segment", false, "")
+	checkFlag     = flag.Bool("check", false, "")
+	diffFlag      = flag.Bool("diff", false, "")
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("gosb: ")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	switch {
+	case *checkFlag && *diffFlag:
+		usage()
+	case *checkFlag:
+		if len(args) == 0 {
+			usage()
+		}
+		exitCode := 0
+		for _, path := range args {
+			b, err := load(path)
+			if err != nil {
+				log.Print(err)
+				exitCode = 1
+				continue
+			}
+			for _, p := range check(b) {
+				fmt.Printf("%v: %v\n", path, p)
+				exitCode = 1
+			}
+		}
+		os.Exit(exitCode)
+	case *diffFlag:
+		if len(args) != 2 {
+			usage()
+		}
+		old, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		new, err := load(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		diff(os.Stdout, old, new)
+	default:
+		if len(args) != 1 {
+			usage()
+		}
+		b, err := load(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		all := !*pkgsFlag && !*sandboxesFlag && !*trustedFlag && !*segmentFlag
+		w := bufio.NewWriter(os.Stdout)
+		if all || *segmentFlag {
+			printSegment(w, b)
+		}
+		if all || *pkgsFlag {
+			printPkgs(w, b)
+		}
+		if all || *sandboxesFlag {
+			printSandboxes(w, b)
+		}
+		if all || *trustedFlag {
+			printTrusted(w, b)
+		}
+		w.Flush()
+	}
+}
+
+func printSegment(w io.Writer, b *binary) {
+	fmt.Fprintf(w, "segment:\n")
+	for _, s := range b.sects {
+		fmt.Fprintf(w, "\t%-12s %#x-%#x %8d\n", s.Name, s.Addr, s.Addr+s.Size, s.Size)
+	}
+	if len(b.sects) == 0 {
+		return
+	}
+	addr := b.sects[0].Addr
+	for _, p := range b.progs {
+		if p.Type == elf.PT_LOAD && addr >= p.Vaddr && addr < p.Vaddr+p.Memsz {
+			fmt.Fprintf(w, "\t%-12s %#x-%#x %8d %v\n", "PT_LOAD", p.Vaddr, p.Vaddr+p.Memsz, p.Memsz, p.Flags)
+		}
+	}
+}
+
+func printPkgs(w io.Writer, b *binary) {
+	fmt.Fprintf(w, "packages:\n")
+	for _, p := range b.pkgs {
+		fmt.Fprintf(w, "\t%v (id %v)\n", p.Name, p.Id)
+		printSections(w, "\t\t", p.Sects)
+		if len(p.Dynamic) != 0 {
+			fmt.Fprintf(w, "\t\tdynamic:\n")
+			printSections(w, "\t\t", p.Dynamic)
+		}
+	}
+}
+
+func printSections(w io.Writer, indent string, sects []commons.Section) {
+	for _, s := range sects {
+		if s.Size == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%v%#x-%#x %8d %v\n", indent, s.Addr, s.Addr+s.Size, s.Size, protString(s.Prot))
+	}
+}
+
+func printSandboxes(w io.Writer, b *binary) {
+	fmt.Fprintf(w, "sandboxes:\n")
+	for _, d := range b.sandboxes {
+		fmt.Fprintf(w, "\t%v %v\n", d.Id, d.Func)
+		if s, ok := b.syms[d.Func]; ok {
+			fmt.Fprintf(w, "\t\tfunc:  %#x-%#x\n", s.Value, s.Value+s.Size)
+		}
+		fmt.Fprintf(w, "\t\tview:  %q\n", viewString(d))
+		fmt.Fprintf(w, "\t\tsys:   %q\n", commons.SyscallPolicyString(d.Sys, d.Args))
+		fmt.Fprintf(w, "\t\tpkgs:  %v\n", strings.Join(d.Pkgs, " "))
+	}
+}
+
+func printTrusted(w io.Writer, b *binary) {
+	fmt.Fprintf(w, "trusted:\n")
+	b.trusted().Foreach(func(e *commons.ListElem) {
+		v := commons.ToVMA(e)
+		fmt.Fprintf(w, "\t%#x-%#x %8d %v\n", v.Addr, v.Addr+v.Size, v.Size, protString(v.Prot))
+	})
+}
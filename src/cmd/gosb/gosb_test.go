@@ -0,0 +1,597 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"gosb/commons"
+	"internal/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+var testgosbpath string // path to gosb command created for testing purposes
+
+// The TestMain function creates a gosb command for testing purposes and
+// deletes it after the tests have been run.
+func TestMain(m *testing.M) {
+	os.Exit(testMain(m))
+}
+
+func testMain(m *testing.M) int {
+	if !testenv.HasGoBuild() {
+		return 0
+	}
+
+	tmpDir, err := ioutil.TempDir("", "TestGosb")
+	if err != nil {
+		fmt.Println("TempDir failed:", err)
+		return 2
+	}
+	defer os.RemoveAll(tmpDir)
+
+	testgosbpath = filepath.Join(tmpDir, "testgosb.exe")
+	gotool, err := testenv.GoTool()
+	if err != nil {
+		fmt.Println("GoTool failed:", err)
+		return 2
+	}
+	out, err := exec.Command(gotool, "build", "-o", testgosbpath, "cmd/gosb").CombinedOutput()
+	if err != nil {
+		fmt.Printf("go build -o %v cmd/gosb: %v\n%s", testgosbpath, err, string(out))
+		return 2
+	}
+
+	return m.Run()
+}
+
+const testexec = `
+package main
+
+import (
+	"gosb"
+	"gosb/backend"
+	"strings"
+)
+
+var sink int
+
+func main() {
+	gosb.Initialize(backend.SIM_BACKEND)
+	sandbox["strings:R", "file=/tmp"]() { sink += len(strings.ToUpper("a")) }()
+}
+`
+
+func buildSandboxed(t *testing.T, dir, name, src string, flags ...string) string {
+	if err := ioutil.WriteFile(filepath.Join(dir, name+".go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exe := filepath.Join(dir, name+".exe")
+	args := append([]string{"build", "-o", exe}, flags...)
+	cmd := exec.Command(testenv.GoToolPath(t), append(args, name+".go")...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build %v: %v\n%s", name, err, out)
+	}
+	return exe
+}
+
+func TestGosbExec(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestGosbExec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	exe := buildSandboxed(t, tmpdir, "a", testexec)
+
+	out, err := exec.Command(testgosbpath, exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	for _, want := range []string{"segment:", "packages:", "\tstrings (id ", "sandboxes:",
+		"main.main.func1", `view:  "strings:R"`, `sys:   "file=/tmp"`, "trusted:"} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	out, err = exec.Command(testgosbpath, "-check", exe).CombinedOutput()
+	if err != nil {
+		t.Errorf("go tool gosb -check %v: %v\n%s", exe, err, out)
+	}
+
+	other := buildSandboxed(t, tmpdir, "b", strings.Replace(testexec, "file=/tmp", "file=/srv", 1))
+	out, err = exec.Command(testgosbpath, "-diff", exe, other).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb -diff: %v\n%s", err, out)
+	}
+	if !bytes.Contains(out, []byte(`- sandbox`)) || !bytes.Contains(out, []byte(`sys="file=/srv"`)) {
+		t.Errorf("missing sandbox policy change in diff:\n%s", out)
+	}
+}
+
+// The metadata is read from memory, hence a stripped binary runs even if
+// os.Args[0] does not name it.
+func TestGosbStripped(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestGosbStripped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	exe := buildSandboxed(t, tmpdir, "a", testexec, "-ldflags=-s -w")
+
+	cmd := exec.Command(exe)
+	cmd.Args[0] = filepath.Join(tmpdir, "nonexistent")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", exe, err, out)
+	}
+
+	out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	if !bytes.Contains(out, []byte("func:  0x")) {
+		t.Errorf("missing sandbox function in output:\n%s", out)
+	}
+}
+
+const testids = `
+package main
+
+import (
+	"gosb"
+	"gosb/backend"
+	"strings"
+)
+
+var sink int
+
+type T struct{}
+
+func (*T) M() { sandbox["", "", "render"]() { sink++ }() }
+
+func main() {
+	gosb.Initialize(backend.SIM_BACKEND)
+	sandbox["strings:R", "file"]() { sink += len(strings.ToUpper("a")) }()
+	sandbox["", ""]() { sink++ }()
+	new(T).M()
+}
+`
+
+// Sandbox ids only depend on the enclosing function and on the names, and
+// policies refer to them.
+func TestSandboxIds(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestSandboxIds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	ids := []string{"main.main#0 ", "main.main#1 ", "main.(*T).M#render "}
+
+	// An other sandbox and an import before main do not change the ids.
+	other := strings.Replace(testids, "var sink int", `import "fmt"
+
+var sink int
+
+func init() { sandbox["", ""]() { fmt.Println() }() }`, 1)
+	for i, src := range []string{testids, other} {
+		exe := buildSandboxed(t, tmpdir, fmt.Sprintf("ids%d", i), src)
+		out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+		if err != nil {
+			t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+		}
+		for _, want := range ids {
+			if !bytes.Contains(out, []byte(want)) {
+				t.Errorf("missing sandbox %q in output:\n%s", want, out)
+			}
+		}
+	}
+
+	policy := func(name, pol string) string {
+		file := filepath.Join(tmpdir, name)
+		if err := ioutil.WriteFile(file, []byte(pol), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	// The linker applies a policy file.
+	pol := policy("link.json", `{"main.main#0": {"mem": "strings:U", "sys": "file=/tmp"}}`)
+	exe := buildSandboxed(t, tmpdir, "link", testids, "-ldflags=-gosbpolicy="+pol)
+	out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	for _, want := range []string{`view:  "strings:U"`, `sys:   "file=/tmp"`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	// A policy cannot widen a sandbox.
+	for i, c := range []struct {
+		pol  string
+		want string
+	}{
+		{`{"main.main#0": {"sys": "file,net"}}`, "exceed the compiled"},
+		{`{"main.(*T).M#render": {"mem": "main:R"}}`, "not part of the sandbox"},
+	} {
+		pol := policy("wide.json", c.pol)
+		cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(tmpdir, fmt.Sprintf("wide%d.exe", i)), "-ldflags=-gosbpolicy="+pol, "link.go")
+		cmd.Dir = tmpdir
+		if out, err := cmd.CombinedOutput(); err == nil || !bytes.Contains(out, []byte(c.want)) {
+			t.Errorf("go build with policy %v: %v, want %q in output\n%s", c.pol, err, c.want, out)
+		}
+	}
+
+	// gosb.Initialize applies the policy file of GOSB_POLICY.
+	for _, c := range []struct {
+		pol  string
+		want string
+	}{
+		{`{"main.main#1": {"sys": ""}}`, ""},
+		{`{"main.main#2": {"mem": "main:R"}}`, "unknown sandboxes [main.main#2]"},
+		{`{"main.main#1": {"mem": "main:R"`, "invalid policy file"},
+	} {
+		cmd := exec.Command(exe)
+		cmd.Env = append(os.Environ(), "GOSB_POLICY="+policy("run.json", c.pol))
+		out, err := cmd.CombinedOutput()
+		if c.want == "" {
+			if err != nil {
+				t.Errorf("%v: %v\n%s", c.pol, err, out)
+			}
+		} else if err == nil || !bytes.Contains(bytes.ToLower(out), []byte(c.want)) {
+			t.Errorf("%v: got %v, want %q in output:\n%s", c.pol, err, c.want, out)
+		}
+	}
+}
+
+const testconsts = `
+package main
+
+import (
+	"gosb"
+	"gosb/backend"
+	"strings"
+)
+
+type Policy string
+
+const (
+	view          = "strings:R"
+	shared Policy = "file"
+)
+
+var sink int
+
+func main() {
+	const local = ",time"
+	gosb.Initialize(backend.SIM_BACKEND)
+	sandbox[view + ",self:P", shared + local]() { sink += len(strings.ToUpper("a")) }()
+}
+`
+
+const testconstsErrors = `
+package main
+
+const number = 1
+
+var variable = ""
+
+func main() {
+	sandbox[number, ""]() {}()
+	sandbox["", variable]() {}()
+	sandbox["", "file" + ",nett"]() {}()
+}
+`
+
+// The configurations of a sandbox are string constants, resolved by the
+// compiler.
+func TestSandboxConstants(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestSandboxConstants")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	exe := buildSandboxed(t, tmpdir, "consts", testconsts)
+	out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	for _, want := range []string{`view:  "strings:R,self:P"`, `sys:   "file,time"`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "errors.go"), []byte(testconstsErrors), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(tmpdir, "errors.exe"), "errors.go")
+	cmd.Dir = tmpdir
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go build errors.go: missing errors\n%s", out)
+	}
+	for _, want := range []string{
+		"errors.go:9:10: sandbox configuration number is not a string constant",
+		"errors.go:10:14: sandbox configuration variable is not a string constant",
+		`errors.go:11:21: invalid sandbox syscalls "file,nett": unknown syscall class nett`,
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+const testtypes = `
+package main
+
+import (
+	"gosb"
+	"gosb/backend"
+	"strings"
+)
+
+const view = "strings:R"
+
+// Transform only accepts sandboxed callbacks.
+type Transform sandbox[view, "file"](string) string
+
+func apply(t Transform, s string) string { return t(s) }
+
+var sink int
+
+func main() {
+	gosb.Initialize(backend.SIM_BACKEND)
+	upper := sandbox[view, "file"](s string) string { return strings.ToUpper(s) }
+	var plain func(string) string = upper
+	sink += len(apply(upper, "a") + plain("b"))
+	// The order of the entries does not matter.
+	var reordered sandbox["main:R,strings:R", "net,file"]() = sandbox["strings:R,main:R", "file,net"]() {}
+	reordered()
+}
+`
+
+const testtypesErrors = `
+package main
+
+type Transform sandbox["", "file"](string) string
+
+func apply(Transform) {}
+
+func plain(s string) string { return s }
+
+func main() {
+	apply(plain)
+	apply(sandbox["", ""](s string) string { return s })
+	_ = Transform(plain)
+}
+`
+
+// Sandbox types only accept sandbox literals with the same configuration.
+func TestSandboxTypes(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestSandboxTypes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	exe := buildSandboxed(t, tmpdir, "types", testtypes)
+	if out, err := exec.Command(exe).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", exe, err, out)
+	}
+	out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	for _, want := range []string{"main.main#0 ", `view:  "strings:R"`, `sys:   "file"`} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "errors.go"), []byte(testtypesErrors), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(tmpdir, "errors.exe"), "errors.go")
+	cmd.Dir = tmpdir
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go build errors.go: missing errors\n%s", out)
+	}
+	for _, want := range []string{
+		"errors.go:11:7: cannot use plain (type func(string) string) as type Transform in argument to apply",
+		"func(string) string is not a sandbox",
+		`errors.go:12:8: cannot use func literal (type sandbox["", ""](string) string) as type Transform`,
+		"sandbox configurations differ",
+		"errors.go:13:15: cannot convert plain",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+const testpragma = `
+package main
+
+import (
+	"gosb"
+	"gosb/backend"
+	"strings"
+)
+
+type T struct{ s string }
+
+//go:sandbox "strings:R" "file"
+func Upper(s string) string {
+	return strings.ToUpper(s)
+}
+
+//go:sandbox "self:heap=1M" ""
+func (t *T) Len() int {
+	return len(t.s)
+}
+
+var sink int
+
+func main() {
+	gosb.Initialize(backend.SIM_BACKEND)
+	t := &T{Upper("a")}
+	sink += t.Len()
+}
+`
+
+const testpragmaErrors = `
+package main
+
+//go:sandbox "" ""
+var x = 1
+
+//go:sandbox ""
+func a() {}
+
+//go:sandbox "" "nett"
+func b() {}
+
+//go:sandbox "" ""
+func c()
+
+func main() {}
+`
+
+// The //go:sandbox directive sandboxes function and method declarations.
+func TestSandboxPragma(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skipf("sandboxes are not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
+	}
+	tmpdir, err := ioutil.TempDir("", "TestSandboxPragma")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	exe := buildSandboxed(t, tmpdir, "pragma", testpragma)
+	if out, err := exec.Command(exe).CombinedOutput(); err != nil {
+		t.Fatalf("%v: %v\n%s", exe, err, out)
+	}
+	out, err := exec.Command(testgosbpath, "-sandboxes", exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go tool gosb %v: %v\n%s", exe, err, out)
+	}
+	for _, want := range []string{
+		"main.Upper main.Upper\n",
+		`view:  "strings:R"`,
+		`sys:   "file"`,
+		"main.(*T).Len main.(*T).Len\n",
+		`view:  "self:heap=1048576"`,
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(tmpdir, "errors.go"), []byte(testpragmaErrors), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-o", filepath.Join(tmpdir, "errors.exe"), "errors.go")
+	cmd.Dir = tmpdir
+	out, err = cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("go build errors.go: missing errors\n%s", out)
+	}
+	for _, want := range []string{
+		"errors.go:4:3: misplaced //go:sandbox directive",
+		`errors.go:7:3: usage: //go:sandbox "mem" "sys"`,
+		`errors.go:10:3: invalid sandbox syscalls "nett": unknown syscall class nett`,
+		"errors.go:13:3: can only use //go:sandbox on functions with a body",
+	} {
+		if !bytes.Contains(out, []byte(want)) {
+			t.Errorf("missing %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func sect(addr, size uint64, prot uint8) commons.Section {
+	return commons.Section{Addr: addr, Size: size, Prot: prot}
+}
+
+func testBinary() *binary {
+	return &binary{
+		pkgs: []*commons.Package{
+			{Name: "a", Id: 1, Sects: []commons.Section{sect(0x1000, 0x1800, commons.R_VAL|commons.X_VAL)}},
+			{Name: "b", Id: 2, Sects: []commons.Section{sect(0x3000, 0x100, commons.R_VAL)}},
+			{Name: commons.TrustedPkgName, Id: -1, Sects: []commons.Section{sect(0x1000, 0x4000, commons.R_VAL)}},
+		},
+		sandboxes: []*commons.SandboxDomain{
+			{Id: "1:0", Func: "main.main.func1", Sys: commons.RUNTIME_VAL, View: map[string]uint8{"b": commons.R_VAL}, Pkgs: []string{"a"}},
+			{Id: trustedSandbox, Func: trustedSandbox, Pkgs: []string{commons.TrustedPkgName}},
+		},
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b := testBinary()
+	if problems := check(b); len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	// b shares the second page of a and is misaligned.
+	b.pkgs[1].Sects[0].Addr = 0x2800
+	b.sandboxes[0].View["c"] = commons.R_VAL
+	want := []string{
+		"package b: section 0x2800-0x2900 is not page aligned",
+		"packages a and b overlap at 0x2000-0x3000",
+		"sandbox 1:0: view names unknown package c",
+	}
+	problems := check(b)
+	if strings.Join(problems, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got problems\n%v\nwant\n%v", strings.Join(problems, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old, new := testBinary(), testBinary()
+	var buf bytes.Buffer
+	diff(&buf, old, new)
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected diff of identical binaries:\n%s", buf.String())
+	}
+	// Moving a package does not change it, resizing it does.
+	new.pkgs[1].Sects[0].Addr = 0x5000
+	new.pkgs[0].Sects[0].Size = 0x2000
+	new.sandboxes[0].Sys |= commons.FILE_VAL
+	diff(&buf, old, new)
+	want := `- package a: 6144/r-x
++ package a: 8192/r-x
+- sandbox 1:0: main.main.func1 view="b:R" sys="" pkgs=[a]
++ sandbox 1:0: main.main.func1 view="b:R" sys="file" pkgs=[a]
+`
+	if buf.String() != want {
+		t.Errorf("got diff\n%swant\n%s", buf.String(), want)
+	}
+}
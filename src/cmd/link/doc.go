@@ -77,6 +77,12 @@ Flags:
 		Ignore version mismatch in the linked archives.
 	-g
 		Disable Go package data checks.
+	-gosbpolicy file
+		Restrict the sandboxes with the policy file, a JSON object that maps
+		sandbox ids to a memory view and syscall classes, see gosb/commons.
+		A policy can only tighten the compiled configuration of a sandbox.
+		The go command does not track the content of the file, use go build -a
+		after changing it.
 	-importcfg file
 		Read import configuration from file.
 		In the file, set packagefile, packageshlib to specify import resolution.
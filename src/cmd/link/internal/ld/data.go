@@ -1306,6 +1306,7 @@ func (ctxt *Link) dodata() {
 
 	// We reorder symbols
 	bloatData(data)
+	bloatAlign(data, &dataMaxAlign)
 
 	if ctxt.HeadType == objabi.Haix && ctxt.LinkMode == LinkExternal {
 		// These symbols must have the same alignment as their section.
@@ -2031,6 +2032,11 @@ func (ctxt *Link) textaddress() {
 	sect := Segtext.Sections[0]
 
 	sect.Align = int32(Funcalign)
+	if HasSandboxes() {
+		// Keep the bloated packages on their pages when the external
+		// linker moves the section.
+		sect.Align = 0x1000
+	}
 
 	text := ctxt.Syms.Lookup("runtime.text", 0)
 	text.Sect = sect
@@ -2171,6 +2177,8 @@ func assignAddress(ctxt *Link, sect *sym.Section, n int, s *sym.Symbol, va uint6
 func (ctxt *Link) address() []*sym.Segment {
 	var order []*sym.Segment // Layout order
 
+	ctxt.bloatPad()
+
 	va := uint64(*FlagTextAddr)
 	order = append(order, &Segtext)
 	Segtext.Rwx = 05
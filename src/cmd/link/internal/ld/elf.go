@@ -1933,6 +1933,10 @@ func Asmbelf(ctxt *Link, symo int64) {
 		elfphrelro(&Segrelrodata)
 	}
 	elfphload(&Segdata)
+	if Segbloat.Filelen > 0 {
+		// gosb reads the sandbox metadata from memory.
+		elfphload(&Segbloat)
+	}
 
 	/* Dynamic linking sections */
 	if !*FlagD {
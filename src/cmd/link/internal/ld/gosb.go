@@ -24,8 +24,16 @@ var (
 	Segbloat            sym.Segment
 	bloatsyms           []*sym.Symbol
 	EnableHiddenSymbols = false
+
+	// gosbmeta is the variable through which gosb reads the content of
+	// the sections in Segbloat, see gosbMetadata.
+	gosbmeta *sym.Symbol
 )
 
+// metadataSym is the variable declared in package gosb that points to the
+// sections in metaSectNames, in that order, as byte slices.
+const metadataSym = "gosb.metadata"
+
 func bloatText(text *[]*sym.Symbol) {
 	*text = gosb_reorderSymbols(int(sym.STEXT), *text)
 }
@@ -38,12 +46,161 @@ func bloatData(data [sym.SXREF][]*sym.Symbol) {
 	}
 }
 
+// bloatAlign raises the alignment of the data sections to the one of the
+// bloated symbols. Otherwise, a section that does not start on a page, e.g.,
+// .data.rel.ro in PIE, breaks the alignment of the bloated packages.
+func bloatAlign(data [sym.SXREF][]*sym.Symbol, align *[sym.SXREF]int32) {
+	for i := range data {
+		for _, s := range data[i] {
+			if s.Align > align[i] {
+				align[i] = s.Align
+			}
+		}
+	}
+}
+
+// bloatPad rounds the sections holding bloated packages up to a page with
+// an external linker. Otherwise, the external linker appends the same
+// sections of other objects, e.g., runtime/cgo, on the last page of a
+// bloated package.
+func (ctxt *Link) bloatPad() {
+	if !HasSandboxes() || ctxt.LinkMode != LinkExternal {
+		return
+	}
+	for _, seg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata} {
+		for _, sect := range seg.Sections {
+			if sect.Align >= 0x1000 && sect.Name != ".tbss" {
+				sect.Length = uint64(Rnd(int64(sect.Length), 0x1000))
+			}
+		}
+	}
+}
+
 // ignoreSection ignores itablink because all links are by default inside runtime
 // with our fix.
 func ignoreSection(sel int) bool {
 	return sel == int(sym.SITABLINK)
 }
 
+// gosbMetadata turns gosb.metadata into a data symbol, filled once the
+// addresses are known by fillGosbMetadata.
+func (ctxt *Link) gosbMetadata() {
+	if !HasSandboxes() {
+		return
+	}
+	s := ctxt.Syms.ROLookup(metadataSym, 0)
+	if s == nil || !s.Attr.Reachable() {
+		return
+	}
+	if s.Size != metadataSize(ctxt) {
+		Errorf(s, "unexpected size %v for the sandbox metadata", s.Size)
+		return
+	}
+	// The metadata only holds addresses outside of the heap, no need for
+	// the GC to scan it.
+	s.Type = sym.SNOPTRDATA
+	s.Grow(s.Size)
+	gosbmeta = s
+}
+
+// metadataSize is the size of gosb.metadata, i.e., its link-time address,
+// the address and size of each section in metaSectNames, and the table of
+// sections.
+func metadataSize(ctxt *Link) int64 {
+	ptr := int64(ctxt.Arch.PtrSize)
+	return ptr + 2*ptr*int64(len(metaSectNames)) + 3*ptr*maxMetaSects
+}
+
+// maxMetaSects bounds the number of sections described in gosb.metadata,
+// it must match the declaration in package gosb.
+const maxMetaSects = 32
+
+// fillGosbMetadata writes the link-time addresses of the metadata and of
+// the sections of the binary in gosb.metadata. gosb relocates them with the
+// table of sections: with an internal linker, the binary is loaded at a
+// single bias computed from the address of gosb.metadata (e.g., PIE). With
+// an external linker, each section can move independently, and the table
+// records their address at run time through relocations.
+func (ctxt *Link) fillGosbMetadata() {
+	if gosbmeta == nil {
+		return
+	}
+	ptr := int64(ctxt.Arch.PtrSize)
+	gosbmeta.SetUint(ctxt.Arch, 0, uint64(gosbmeta.Value))
+	off := ptr
+	for _, sn := range metaSectNames {
+		s := ctxt.Syms.ROLookup(sn, 0)
+		gosbmeta.SetUint(ctxt.Arch, off, uint64(s.Value))
+		gosbmeta.SetUint(ctxt.Arch, off+ptr, uint64(s.Size))
+		off += 2 * ptr
+	}
+
+	// A symbol in each section, for the relocations. Sections without a
+	// symbol in the ELF symbol table, e.g., Segbloat, are relocated through
+	// an ELF section symbol, see gosbaddelfsectionsyms.
+	first := make(map[*sym.Section]*sym.Symbol)
+	if ctxt.LinkMode == LinkExternal {
+		for _, s := range ctxt.Syms.Allsym {
+			if s.Sect == nil || s.Outer != nil || !s.Attr.Reachable() || s.Attr.NotInSymbolTable() || s.Name == "" || s.Name[0] == '.' {
+				continue
+			}
+			if _, ok := first[s.Sect]; !ok {
+				first[s.Sect] = s
+			}
+		}
+		for _, syms := range [][]*sym.Symbol{datap, bloatsyms} {
+			for _, s := range syms {
+				if s == nil || s.Sect == nil || s.Outer != nil || uint64(s.Value) != s.Sect.Vaddr {
+					continue
+				}
+				if _, ok := first[s.Sect]; !ok {
+					s.Attr |= sym.AttrReachable
+					first[s.Sect] = s
+					gosbsectsyms = append(gosbsectsyms, s)
+				}
+			}
+		}
+	}
+	n := 0
+	for _, seg := range []*sym.Segment{&Segtext, &Segrodata, &Segrelrodata, &Segdata, &Segbloat} {
+		for _, sect := range seg.Sections {
+			if sect.Length == 0 || sect.Name == ".tbss" {
+				continue
+			}
+			if n == maxMetaSects {
+				Errorf(gosbmeta, "too many sections for the sandbox metadata")
+				return
+			}
+			gosbmeta.SetUint(ctxt.Arch, off, sect.Vaddr)
+			gosbmeta.SetUint(ctxt.Arch, off+ptr, sect.Length)
+			if ctxt.LinkMode == LinkExternal {
+				s, ok := first[sect]
+				if !ok {
+					Errorf(gosbmeta, "no symbol to relocate section %v", sect.Name)
+					continue
+				}
+				gosbmeta.SetAddrPlus(ctxt.Arch, off+2*ptr, s, int64(sect.Vaddr)-s.Value)
+			}
+			off += 3 * ptr
+			n++
+		}
+	}
+}
+
+// gosbsectsyms are the symbols relocated through their ELF section symbol.
+var gosbsectsyms []*sym.Symbol
+
+// gosbaddelfsectionsyms adds the section symbols that the relocations of
+// gosb.metadata use with an external linker, see fillGosbMetadata.
+func gosbaddelfsectionsyms(ctxt *Link) {
+	if ctxt.LinkMode != LinkExternal {
+		return
+	}
+	for _, s := range gosbsectsyms {
+		putelfsectionsym(ctxt.Out, s, s.Sect.Elfsect.(*ElfShdr).shnum)
+	}
+}
+
 func (ctxt *Link) dumpGosbSections(order []*sym.Segment, fsize *uint64) {
 	if !HasSandboxes() || fsize == nil {
 		return
@@ -89,6 +246,7 @@ func (ctxt *Link) dumpGosbSections(order []*sym.Segment, fsize *uint64) {
 		elfshbits(ctxt.LinkMode, s)
 	}
 	order = append(order, &Segbloat)
+	ctxt.fillGosbMetadata()
 	// Set the result
 	*fsize = Segbloat.Fileoff + Segbloat.Filelen
 }
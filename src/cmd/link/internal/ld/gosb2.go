@@ -5,6 +5,7 @@ import (
 	"cmd/link/internal/sym"
 	"encoding/json"
 	lb "gosb/commons"
+	"io/ioutil"
 	"log"
 	"sort"
 	"strings"
@@ -17,7 +18,14 @@ var (
 	toSym     map[*lb.Section][]*sym.Symbol
 	lookup    map[int]string
 	domains   []*lb.SandboxDomain
-	sectNames = []string{".fake", ".bloated", ".sandboxes"}
+	sectNames = []string{".fake", ".bloated", ".sandboxes", ".gosbsyms"}
+
+	// The sections that gosb reads through gosb.metadata.
+	metaSectNames = []string{".bloated", ".sandboxes", ".gosbsyms"}
+
+	// The symbols that gosb needs, i.e., the sandboxes, their stack
+	// objects and the pclntab, see gosb_dumpSymbols.
+	gosbsyms = make(map[string]*sym.Symbol)
 )
 
 // computeBloats initializes global state and computes all dependencies for each
@@ -68,6 +76,29 @@ func (ctxt *Link) computeBloats() {
 	ctxt.gosb_generateDomains()
 }
 
+// setPkgIds sets the variable of each package that its allocation sites pass
+// to the runtime to the id of the package in this program, -1 if it has none,
+// for which the runtime unwinds the stack. The ids depend on the program, and
+// cannot be compiled in the packages. The variables belong to the runtime and
+// are read-only: all the sandboxes read them, and none can change them.
+func (ctxt *Link) setPkgIds() {
+	for _, lib := range ctxt.Library {
+		s := ctxt.Syms.ROLookup(lib.Pkg+"."+lb.PkgIdSym, 0)
+		if s == nil {
+			continue
+		}
+		id, ok := ctxt.PackageDecl[lib.Pkg]
+		if !ok {
+			id = -1
+		}
+		// The variable is in the bss, without content.
+		s.P = make([]byte, s.Size)
+		s.Type = sym.SRODATA
+		s.File = "runtime"
+		s.SetUint(ctxt.Arch, 0, uint64(id))
+	}
+}
+
 // addExtraPackages registers packages that are not sandbox dependencies
 // but that we still want to bloat.
 func (ctxt *Link) registerExtraPackages() {
@@ -82,14 +113,12 @@ func (ctxt *Link) registerExtraPackages() {
 	}
 }
 
-func (ctxt *Link) extraDependencies() []string {
-	res := make([]string, len(lb.ExtraDependencies))
-	copy(res, lb.ExtraDependencies)
+// cgoDependencies returns the cgo packages that all the sandboxes depend on.
+func (ctxt *Link) cgoDependencies() []string {
 	if _, ok := ctxt.PackageDecl["runtime/cgo"]; ok {
-		res = append(res, "runtime/cgo")
-		res = append(res, "runtime/cgo2")
+		return []string{"runtime/cgo", "runtime/cgo2"}
 	}
-	return res
+	return nil
 }
 
 func (ctxt *Link) gosb_generateDomains() {
@@ -98,12 +127,14 @@ func (ctxt *Link) gosb_generateDomains() {
 		sb.Id = v.Id
 		sb.Func = v.Func
 		sb.Pristine = v.Pristine
+		sb.Quota = v.Quota
 		var err error
 		sb.Sys, err = lb.ParseSyscalls(v.Sys)
 		sb.View = nil
 		if err != nil {
-			log.Fatalf("Error parsing %v: %v\n", v.Sys, err.Error())
+			log.Fatalf("Error parsing syscalls %v for sandbox %v: %v\n", v.Sys, v.Func, err.Error())
 		}
+		sb.Args, _ = lb.ParseSyscallArgs(v.Sys)
 		visited := make(map[string]*lb.Package)
 		// No op, we don't have to do anything
 		f := func(ctxt *Link, id int, deps []int) {}
@@ -123,11 +154,8 @@ func (ctxt *Link) gosb_generateDomains() {
 			return false
 		}
 		// Add the packages from the view here if we want transitive deps.
-		for _, p := range v.Extras {
-			v.Packages = append(v.Packages, p.Name)
-		}
-		v.Packages = append(v.Packages, ctxt.extraDependencies()...)
-		for _, p := range v.Packages {
+		roots := append(lb.SandboxRoots(v.Packages, v.Extras), ctxt.cgoDependencies()...)
+		for _, p := range roots {
 			if p == "go.itab" || p == "go.runtime" {
 				panic("go.itab and go.runtime should not be here")
 			}
@@ -145,44 +173,64 @@ func (ctxt *Link) gosb_generateDomains() {
 		sb.View = memView
 		domains = append(domains, sb)
 	}
+	// Tighten the sandboxes for this deployment.
+	if *flagGosbPolicy != "" {
+		data, err := ioutil.ReadFile(*flagGosbPolicy)
+		if err != nil {
+			log.Fatalf("Error reading the sandbox policy: %v\n", err)
+		}
+		var pols map[lb.SandId]lb.Policy
+		if err := json.Unmarshal(data, &pols); err != nil {
+			log.Fatalf("invalid policy file %v: %v\n", *flagGosbPolicy, err)
+		}
+		if err := lb.CheckPolicies(pols); err != nil {
+			log.Fatalf("invalid policy file %v: %v\n", *flagGosbPolicy, err)
+		}
+		if err := lb.ApplyPolicies(domains, pols); err != nil {
+			log.Fatalf("Error applying the sandbox policy %v: %v\n", *flagGosbPolicy, err)
+		}
+	}
 	// Create a fake sandbox for the nonbloated domain
 	nonbloatDomain := &lb.SandboxDomain{}
-	nonbloatDomain.Id = "-1"
-	nonbloatDomain.Func = "-1"
+	nonbloatDomain.Id = lb.TrustedSandboxId
+	nonbloatDomain.Func = lb.TrustedSandboxId
 	nonbloatDomain.Sys = 0
 	nonbloatDomain.View = nil
 	nonbloatDomain.Pkgs = []string{nonbloat.Name}
 	domains = append(domains, nonbloatDomain)
 }
 
-// gosb_walkTransDeps allows to follow transitive dependencies applying the given f method.\
+// gosb_walkTransDeps allows to follow transitive dependencies applying the given f method.
 // It is used to 1) generate the list of packages to bloat, and 2) to find all dependencies
-// for sandboxes.
+// for sandboxes. The walk itself is shared with go list, see lb.WalkDeps.
 func (ctxt *Link) gosb_walkTransDeps(top string, f func(ctxt *Link, id int, deps []int), check func(s string) bool) {
-	// We check that the package has a decl
-	// If it does not, it is probably a fake package that is part of the runtime.
-	// Ids in the following steps will correspond to runtime so we're fine.
-	// TODO(aghosn) this prevents type and go.itab, go.runtime from being added
-	// to the deps... Let's see later if there is a problem.
-	id, ok := ctxt.PackageDecl[top]
-	if !ok && top == "type" {
-		return
-	}
-	// Call the check
-	if check(top) {
-		return
-	}
-	// Handle the entry
-	deps, ok := ctxt.PackageDeps[id]
-	f(ctxt, id, deps)
-
-	for _, v := range deps {
-		name, ok := lookup[v]
-		if !ok {
-			log.Fatalf("Missing name for package %v\n\n%v\n", v, lookup)
+	deps := func(pkg string) []string {
+		id := ctxt.PackageDecl[pkg]
+		ids := ctxt.PackageDeps[id]
+		// Handle the entry
+		f(ctxt, id, ids)
+		names := make([]string, 0, len(ids))
+		for _, v := range ids {
+			name, ok := lookup[v]
+			if !ok {
+				log.Fatalf("Missing name for package %v\n\n%v\n", v, lookup)
+			}
+			names = append(names, name)
+		}
+		return names
+	}
+	visited := func(pkg string) bool {
+		// We check that the package has a decl
+		// If it does not, it is probably a fake package that is part of the runtime.
+		// Ids in the following steps will correspond to runtime so we're fine.
+		// TODO(aghosn) this prevents type and go.itab, go.runtime from being added
+		// to the deps... Let's see later if there is a problem.
+		if _, ok := ctxt.PackageDecl[pkg]; !ok && pkg == "type" {
+			return true
 		}
-		ctxt.gosb_walkTransDeps(name, f, check)
+		return check(pkg)
 	}
+	lb.WalkDeps(top, deps, visited)
 }
 
 // gosb_reorderSymbols sorts symbols per package, puts all the bloated packages
@@ -210,10 +258,12 @@ func gosb_reorderSymbols(sel int, syms []*sym.Symbol) []*sym.Symbol {
 		// Sandbox symbol itself needs to be seggragated
 		if _, ok := objfile.SBMap[s.Name]; ok {
 			sandSyms = append(sandSyms, s)
+			gosbsyms[s.Name] = s
 			s.Align = 0x1000
 		} else if isSandboxStkObj(s.Name, s) || s.Name == "main.main.stkobj" {
 			// Isolate stack object for sandbox code
 			sandSyms = append(sandSyms, s)
+			gosbsyms[s.Name] = s
 			s.Align = 0x1000
 			if s.Size < 0x1000 {
 				s.Size = 0x1000
@@ -227,6 +277,7 @@ func gosb_reorderSymbols(sel int, syms []*sym.Symbol) []*sym.Symbol {
 		} else if s.Name == "runtime.pclntab" {
 			s.Align = 0x1000
 			specials = append(specials, s)
+			gosbsyms[s.Name] = s
 		} else {
 			regSyms = append(regSyms, s)
 		}
@@ -270,6 +321,8 @@ func gosb_generateContent(sect string) []byte {
 		return gosb_dumpPackages()
 	case ".sandboxes":
 		return gosb_dumpSandboxes()
+	case ".gosbsyms":
+		return gosb_dumpSymbols()
 	default:
 		panic("Unknown value for gosb_generateContent")
 	}
@@ -359,6 +412,21 @@ func gosb_dumpSandboxes() []byte {
 	return res
 }
 
+// gosb_dumpSymbols returns the marshalled json bytes of the symbols gosb
+// needs, so that it does not depend on the symbol table (e.g., -s).
+func gosb_dumpSymbols() []byte {
+	res := make([]lb.Symbol, 0, len(gosbsyms))
+	for _, s := range gosbsyms {
+		res = append(res, lb.Symbol{Name: s.Name, Value: uint64(s.Value), Size: uint64(s.Size)})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Value < res[j].Value })
+	b, err := json.Marshal(res)
+	if err != nil {
+		log.Fatalf("Error mashalling symbols %v\n", err.Error())
+	}
+	return b
+}
+
 // Translate a section's idx into protection
 func symKindtoProt(s sym.SymKind) uint8 {
 	prot := lb.R_VAL
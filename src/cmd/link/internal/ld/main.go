@@ -91,6 +91,8 @@ var (
 	FlagTextAddr    = flag.Int64("T", -1, "set text segment `address`")
 	flagEntrySymbol = flag.String("E", "", "set `entry` symbol name")
 
+	flagGosbPolicy = flag.String("gosbpolicy", "", "restrict the sandboxes with the policy `file`")
+
 	cpuprofile     = flag.String("cpuprofile", "", "write cpu profile to `file`")
 	memprofile     = flag.String("memprofile", "", "write memory profile to `file`")
 	memprofilerate = flag.Int64("memprofilerate", 0, "set runtime.MemProfileRate to `rate`")
@@ -206,6 +208,7 @@ func Main(arch *sys.Arch, theArch Arch) {
 		addlibpath(ctxt, "command line", "command line", flag.Arg(0), "main", "")
 	}
 	ctxt.loadlib()
+	ctxt.setPkgIds()
 
 	//@aghosn initialize the bloated packages entries.
 	ctxt.computeBloats()
@@ -242,6 +245,7 @@ func Main(arch *sys.Arch, theArch Arch) {
 	ctxt.typelink()
 	ctxt.symtab()
 	ctxt.buildinfo()
+	ctxt.gosbMetadata()
 
 	// Golang generates weird symbols that do not have a package.
 	// This fucks us when we bloat the data. This function fixes this.
@@ -3,8 +3,6 @@ package objfile
 import (
 	gosb "gosb/commons"
 	"io/ioutil"
-	"strconv"
-	"strings"
 )
 
 type SBObjEntry struct {
@@ -15,13 +13,9 @@ type SBObjEntry struct {
 	Packages []string
 	Extras   []gosb.Entry
 	Pristine bool
+	Quota    gosb.Quota
 }
 
-const (
-	sandboxheader = "\xeegosandx\n"
-	sandboxfooter = "\xefgosandx\n"
-)
-
 // Sandboxes we parsed by looking at object files
 var (
 	Sandboxes      []SBObjEntry
@@ -48,60 +42,37 @@ func readSandboxObj(path string) {
 	// Get the entire data.
 	data, err := ioutil.ReadFile(path)
 	assert(err == nil, "Error reading file")
-	file := string(data)
-	content := strings.Split(file, sandboxheader)
-	// filter only the sandboxes entries
-	var sbs []string = nil
-	for i, v := range content {
-		if i%2 == 1 {
-			assert(strings.Contains(v, sandboxfooter), "Malformed sandbox entry: missing footer")
-			split := strings.Split(v, sandboxfooter)
-			assert(len(split) <= 2, "Malformed sandbox entry: more than two elements in split")
-			if len(split[0]) > 0 {
-				sbs = append(sbs, split[0])
-			}
-		}
+	sbs, err := gosb.ParseObjSandboxes(string(data))
+	if err != nil {
+		panic(err.Error())
 	}
 	if len(sbs) > 0 {
 		registerSandboxes(sbs)
 	}
 }
 
-func registerSandboxes(sbs []string) {
+func registerSandboxes(sbs []gosb.ObjSandbox) {
 	if SegregatedPkgs == nil {
 		SegregatedPkgs = make(map[string]bool)
 		SBMap = make(map[string]*SBObjEntry)
 	}
 	for _, v := range sbs {
-		contents := strings.Split(v, "\n")
-		assert(len(contents) > 0, "Empty sandbox entry")
-		size, err := strconv.Atoi(contents[0])
-		assert(err == nil, "error parsing initial size")
-		assert(size > 0, "Malformed sandbox entry")
-		contents = contents[1:]
-		for i := 0; i < size; i++ {
-			content := contents
-			name, content := content[0], content[1:]
-			assert(len(name) > 0, "Empty sandbox name")
-			config, content := strings.Split(content[0], ";"), content[1:]
-			assert(len(config) == 3, "Malformed configuration")
-			nbPkgs, err := strconv.Atoi(content[0])
-			assert(err == nil, "Error parsing number of packages")
-			content = content[1:]
-			// Parse memory view
-			extras, pristine, err := gosb.ParseMemoryView(config[1])
-			if err != nil {
-				panic(err.Error())
-			}
-			pkgs, content := content[:nbPkgs], content[nbPkgs:]
-			Sandboxes = append(Sandboxes, SBObjEntry{name, config[0], config[1], config[2], pkgs, extras, pristine})
-			// Finally add these packages to the ones that need to be bloated
-			for _, e := range extras {
-				pkgs = append(pkgs, e.Name)
-			}
-			SBMap[name] = &Sandboxes[len(Sandboxes)-1]
-			registerPackages(pkgs)
-			contents = content
+		// Parse memory view
+		extras, pristine, err := gosb.ParseSandboxView(v.Mem)
+		if err != nil {
+			panic(err.Error())
+		}
+		quota, err := gosb.ParseQuota(v.Mem)
+		if err != nil {
+			panic(err.Error())
+		}
+		pkgs := v.Packages
+		Sandboxes = append(Sandboxes, SBObjEntry{v.Func, v.Id, v.Mem, v.Sys, pkgs, extras, pristine, quota})
+		// Finally add these packages to the ones that need to be bloated
+		for _, e := range extras {
+			pkgs = append(pkgs, e.Name)
 		}
+		SBMap[v.Func] = &Sandboxes[len(Sandboxes)-1]
+		registerPackages(pkgs)
 	}
 }
@@ -41,6 +41,7 @@ To list the available checks, run "go tool vet help":
     lostcancel   check cancel func returned by context.WithCancel is called
     nilfunc      check for useless comparisons between functions and nil
     printf       check consistency of Printf format strings and arguments
+    sandboxview  check for sandbox memory views that grant unused rights
     shift        check for shifts that equal or exceed the width of the integer
     stdmethods   check signature of methods of well-known interfaces
     structtag    check that struct field tags conform to reflect.StructTag.Get
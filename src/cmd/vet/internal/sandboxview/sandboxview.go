@@ -0,0 +1,99 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sandboxview defines an Analyzer that checks that the memory
+// view of a sandbox only grants rights to packages the sandbox uses.
+package sandboxview
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/types"
+	"gosb/commons"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const Doc = `check for sandbox memory views that grant unused rights
+
+The memory view of a sandbox, i.e., the first string constant in
+sandbox["main:R", ""], refines the access rights of the sandbox.
+Granting rights to a package that the sandbox body never references
+needlessly widens the sandbox.`
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "sandboxview",
+	Doc:      Doc,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	nodeFilter := []ast.Node{
+		(*ast.FuncLit)(nil),
+	}
+	inspect.Preorder(nodeFilter, func(n ast.Node) {
+		lit := n.(*ast.FuncLit)
+		conf := lit.Type.Sandbox
+		if conf == nil {
+			return
+		}
+		// Malformed views are reported by the type checker.
+		tv, ok := pass.TypesInfo.Types[conf.Mem]
+		if !ok || tv.Value == nil || tv.Value.Kind() != constant.String {
+			return
+		}
+		view, _, err := commons.ParseSandboxView(constant.StringVal(tv.Value))
+		if err != nil {
+			return
+		}
+		var used map[string]bool
+		for _, entry := range view {
+			if entry.Perm == commons.U_VAL {
+				continue
+			}
+			if used == nil {
+				used = referenced(pass, lit)
+			}
+			if !used[entry.Name] {
+				pass.Reportf(conf.Mem.Pos(), "sandbox memory view grants rights to package %s that the sandbox never references", entry.Name)
+			}
+		}
+	})
+	return nil, nil
+}
+
+// referenced returns the set of packages whose objects are used by the body
+// of lit. Objects declared inside lit do not count.
+func referenced(pass *analysis.Pass, lit *ast.FuncLit) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		id, ok := n.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		obj := pass.TypesInfo.Uses[id]
+		if obj == nil || obj.Pkg() == nil {
+			return true
+		}
+		if obj.Pkg() == pass.Pkg && lit.Pos() <= obj.Pos() && obj.Pos() < lit.End() {
+			return true
+		}
+		used[pkgName(obj.Pkg())] = true
+		return true
+	})
+	return used
+}
+
+// pkgName returns the name of pkg in a memory view.
+func pkgName(pkg *types.Package) string {
+	if pkg.Name() == "main" {
+		return "main"
+	}
+	return pkg.Path()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"cmd/internal/objabi"
+	"cmd/vet/internal/sandboxview"
 
 	"golang.org/x/tools/go/analysis/unitchecker"
 
@@ -47,6 +48,7 @@ func main() {
 		lostcancel.Analyzer,
 		nilfunc.Analyzer,
 		printf.Analyzer,
+		sandboxview.Analyzer,
 		shift.Analyzer,
 		stdmethods.Analyzer,
 		structtag.Analyzer,
@@ -0,0 +1,41 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file contains tests for the sandboxview checker.
+
+package sandboxview
+
+import (
+	"bytes"
+	"strings"
+)
+
+var global int
+
+const bytesView = "bytes:R"
+
+func Views() {
+	sandbox["strings:R", ""]() {
+		_ = strings.ToUpper("")
+	}()
+	sandbox["cmd/vet/testdata/sandboxview:RW", ""]() {
+		global++
+	}()
+	sandbox["bytes:R", ""]() {
+		var b bytes.Buffer
+		b.Reset()
+	}()
+	sandbox["strings:U,self:P", ""]() {}()
+
+	sandbox["bytes:R", ""]() { // ERROR "sandbox memory view grants rights to package bytes that the sandbox never references"
+		_ = strings.ToLower("")
+	}()
+	sandbox[bytesView, ""]() { // ERROR "grants rights to package bytes"
+		_ = strings.ToLower("")
+	}()
+	sandbox["cmd/vet/testdata/sandboxview:R", ""]() { // ERROR "grants rights to package cmd/vet/testdata/sandboxview"
+		local := 0
+		local++
+	}()
+}
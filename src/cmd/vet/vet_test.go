@@ -94,6 +94,7 @@ func TestVet(t *testing.T) {
 		"nilfunc",
 		"print",
 		"rangeloop",
+		"sandboxview",
 		"shift",
 		"structtag",
 		"testingpkg",
@@ -222,6 +222,22 @@ func (f *FieldList) NumFields() int {
 	return n
 }
 
+// A SandboxConfig represents the configuration of a sandbox literal or
+// type, i.e., the memory view, the system call classes and the optional
+// name in sandbox[mem, sys, "name"]. The memory view and the system call
+// classes are string constant expressions. Only literals have a name.
+type SandboxConfig struct {
+	Sandbox token.Pos // position of "sandbox" keyword
+	Lbrack  token.Pos // position of "["
+	Mem     Expr      // memory view
+	Sys     Expr      // system call classes
+	Name    *BasicLit // sandbox name; or nil
+	Rbrack  token.Pos // position of "]"
+}
+
+func (s *SandboxConfig) Pos() token.Pos { return s.Sandbox }
+func (s *SandboxConfig) End() token.Pos { return s.Rbrack + 1 }
+
 // An expression is represented by a tree consisting of one
 // or more of the following concrete expression nodes.
 //
@@ -390,9 +406,10 @@ type (
 
 	// A FuncType node represents a function type.
 	FuncType struct {
-		Func    token.Pos  // position of "func" keyword (token.NoPos if there is no "func")
-		Params  *FieldList // (incoming) parameters; non-nil
-		Results *FieldList // (outgoing) results; or nil
+		Func    token.Pos      // position of "func" keyword (token.NoPos if there is no "func")
+		Sandbox *SandboxConfig // sandbox configuration; or nil
+		Params  *FieldList     // (incoming) parameters; non-nil
+		Results *FieldList     // (outgoing) results; or nil
 	}
 
 	// An InterfaceType node represents an interface type.
@@ -444,6 +461,9 @@ func (x *KeyValueExpr) Pos() token.Pos   { return x.Key.Pos() }
 func (x *ArrayType) Pos() token.Pos      { return x.Lbrack }
 func (x *StructType) Pos() token.Pos     { return x.Struct }
 func (x *FuncType) Pos() token.Pos {
+	if x.Sandbox != nil {
+		return x.Sandbox.Pos()
+	}
 	if x.Func.IsValid() || x.Params == nil { // see issue 3870
 		return x.Func
 	}
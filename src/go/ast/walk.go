@@ -84,6 +84,13 @@ func Walk(v Visitor, node Node) {
 			Walk(v, f)
 		}
 
+	case *SandboxConfig:
+		Walk(v, n.Mem)
+		Walk(v, n.Sys)
+		if n.Name != nil {
+			Walk(v, n.Name)
+		}
+
 	// Expressions
 	case *BadExpr, *Ident, *BasicLit:
 		// nothing to do
@@ -161,6 +168,9 @@ func Walk(v Visitor, node Node) {
 		Walk(v, n.Fields)
 
 	case *FuncType:
+		if n.Sandbox != nil {
+			Walk(v, n.Sandbox)
+		}
 		if n.Params != nil {
 			Walk(v, n.Params)
 		}
@@ -215,6 +215,9 @@ var pkgDeps = map[string][]string{
 		"time",
 	},
 
+	// Sandbox configurations, shared by the toolchain and the gosb runtime.
+	"gosb/commons": {"L4", "syscall"},
+
 	// Go parser.
 	"go/ast":     {"L4", "OS", "go/scanner", "go/token"},
 	"go/doc":     {"L4", "OS", "go/ast", "go/token", "regexp", "internal/lazyregexp", "text/template"},
@@ -241,7 +244,7 @@ var pkgDeps = map[string][]string{
 	"go/internal/gcimporter":    {"L4", "OS", "go/build", "go/constant", "go/token", "go/types", "text/scanner"},
 	"go/internal/gccgoimporter": {"L4", "OS", "debug/elf", "go/constant", "go/token", "go/types", "internal/xcoff", "text/scanner"},
 	"go/internal/srcimporter":   {"L4", "OS", "fmt", "go/ast", "go/build", "go/parser", "go/token", "go/types", "path/filepath"},
-	"go/types":                  {"L4", "GOPARSER", "container/heap", "go/constant"},
+	"go/types":                  {"L4", "GOPARSER", "container/heap", "go/constant", "gosb/commons"},
 
 	// One of a kind.
 	"archive/tar":                    {"L4", "OS", "syscall", "os/user"},
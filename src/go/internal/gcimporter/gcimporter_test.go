@@ -586,6 +586,39 @@ func TestIssue25596(t *testing.T) {
 	compileAndImportPkg(t, "issue25596")
 }
 
+func TestSandboxTypes(t *testing.T) {
+	skipSpecialPlatforms(t)
+
+	// This package only handles gc export data.
+	if runtime.Compiler != "gc" {
+		t.Skipf("gc-built packages not available (compiler = %s)", runtime.Compiler)
+	}
+
+	// On windows, we have to set the -D option for the compiler to avoid having a drive
+	// letter and an illegal ':' in the import path - just skip it (see also issue #3483).
+	if runtime.GOOS == "windows" {
+		t.Skip("avoid dealing with relative paths/drive letters on windows")
+	}
+
+	pkg := compileAndImportPkg(t, "sandboxtypes")
+	for _, test := range []struct {
+		name, want string
+	}{
+		{"Callback", `sandbox["sandboxtypes:R,self:P", "file"](string) error`},
+		{"Apply", `func(cb Callback, each ...sandbox["", ""]())`},
+		{"Plain", `func(Callback) sandbox["", "net"]() int`},
+	} {
+		obj := pkg.Scope().Lookup(test.name)
+		if obj == nil {
+			t.Errorf("%s not found", test.name)
+			continue
+		}
+		if got := types.TypeString(obj.Type().Underlying(), types.RelativeTo(pkg)); got != test.want {
+			t.Errorf("%s: got %s; want %s", test.name, got, test.want)
+		}
+	}
+}
+
 func importPkg(t *testing.T, path, srcDir string) *types.Package {
 	fset := token.NewFileSet()
 	pkg, err := Import(fset, make(map[string]*types.Package), path, srcDir, nil)
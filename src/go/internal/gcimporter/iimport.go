@@ -54,6 +54,7 @@ const (
 	signatureType
 	structType
 	interfaceType
+	sandboxType
 )
 
 // iImportData imports a package from the serialized package data
@@ -61,7 +62,7 @@ const (
 // If the export data version is not recognized or the format is otherwise
 // compromised, an error is returned.
 func iImportData(fset *token.FileSet, imports map[string]*types.Package, data []byte, path string) (_ int, pkg *types.Package, err error) {
-	const currentVersion = 1
+	const currentVersion = 2
 	version := int64(-1)
 	defer func() {
 		if e := recover(); e != nil {
@@ -77,7 +78,7 @@ func iImportData(fset *token.FileSet, imports map[string]*types.Package, data []
 
 	version = int64(r.uint64())
 	switch version {
-	case currentVersion, 0:
+	case currentVersion, 1, 0:
 	default:
 		errorf("unknown iexport format version %d", version)
 	}
@@ -515,6 +516,15 @@ func (r *importReader) doType(base *types.Named) types.Type {
 		r.currPkg = r.pkg()
 		return r.signature(nil)
 
+	case sandboxType:
+		if r.p.version < 2 {
+			errorf("unexpected sandbox type in version %d", r.p.version)
+		}
+		r.currPkg = r.pkg()
+		mem, sys := r.string(), r.string()
+		sig := r.signature(nil)
+		return types.NewSandboxSignature(sig.Params(), sig.Results(), sig.Variadic(), mem, sys)
+
 	case structType:
 		r.currPkg = r.pkg()
 
@@ -0,0 +1,13 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sandboxtypes
+
+const view = "sandboxtypes:R"
+
+type Callback sandbox[view+",self:P", "file"](string) error
+
+func Apply(cb Callback, each ...sandbox["", ""]()) {}
+
+var Plain func(Callback) sandbox["", "net"]() int
@@ -917,21 +917,68 @@ func (p *parser) parseFuncType() (*ast.FuncType, *ast.Scope) {
 	if p.trace {
 		defer un(trace(p, "FuncType"))
 	}
-	pos := p.pos
+	var (
+		pos  token.Pos
+		sbox *ast.SandboxConfig
+	)
 	if p.tok == token.SANDBOX {
-		p.next() // Consume `sandbox`
-		p.next() // Consume `[`
-		p.next() // Consume `""`
-		p.next() // Consume `,`
-		p.next() // Consume `""`
-		p.next() // Consume `]`
+		sbox = p.parseSandboxConfig()
 	} else {
 		pos = p.expect(token.FUNC)
 	}
 	scope := ast.NewScope(p.topScope) // function scope
 	params, results := p.parseSignature(scope)
 
-	return &ast.FuncType{Func: pos, Params: params, Results: results}, scope
+	return &ast.FuncType{Func: pos, Sandbox: sbox, Params: params, Results: results}, scope
+}
+
+// parseSandboxConfig parses sandbox[mem, sys] or sandbox[mem, sys, "name"],
+// the header of sandbox literals and types.
+func (p *parser) parseSandboxConfig() *ast.SandboxConfig {
+	if p.trace {
+		defer un(trace(p, "SandboxConfig"))
+	}
+
+	pos := p.expect(token.SANDBOX)
+	lbrack := p.expect(token.LBRACK)
+	p.exprLev++
+	mem := p.parseRhs()
+	p.expect(token.COMMA)
+	sys := p.parseRhs()
+	p.exprLev--
+	var name *ast.BasicLit
+	if p.tok == token.COMMA {
+		p.next()
+		name = p.parseSandboxLit()
+	}
+	rbrack := p.expect(token.RBRACK)
+
+	return &ast.SandboxConfig{Sandbox: pos, Lbrack: lbrack, Mem: mem, Sys: sys, Name: name, Rbrack: rbrack}
+}
+
+// checkSandboxType reports names in sandbox types, the name of a sandbox
+// belongs to its literal.
+func (p *parser) checkSandboxType(typ *ast.FuncType) {
+	if typ.Sandbox != nil && typ.Sandbox.Name != nil {
+		p.error(typ.Sandbox.Name.Pos(), "sandbox type cannot have a name")
+	}
+}
+
+func (p *parser) parseSandboxLit() *ast.BasicLit {
+	if p.trace {
+		defer un(trace(p, "SandboxLit"))
+	}
+
+	pos := p.pos
+	value := `""`
+	if p.tok == token.STRING {
+		value = p.lit
+		p.next()
+	} else {
+		p.expect(token.STRING) // use expect() error handling
+	}
+
+	return &ast.BasicLit{ValuePos: pos, Kind: token.STRING, Value: value}
 }
 
 func (p *parser) parseMethodSpec(scope *ast.Scope) *ast.Field {
@@ -1039,6 +1086,10 @@ func (p *parser) tryIdentOrType() ast.Expr {
 	case token.FUNC:
 		typ, _ := p.parseFuncType()
 		return typ
+	case token.SANDBOX:
+		typ, _ := p.parseFuncType()
+		p.checkSandboxType(typ)
+		return typ
 	case token.INTERFACE:
 		return p.parseInterfaceType()
 	case token.MAP:
@@ -1121,6 +1172,7 @@ func (p *parser) parseFuncTypeOrLit() ast.Expr {
 	typ, scope := p.parseFuncType()
 	if p.tok != token.LBRACE {
 		// function type only
+		p.checkSandboxType(typ)
 		return typ
 	}
 
@@ -48,6 +48,13 @@ var valids = []string{
 	`package p; var _ = map[*P]int{&P{}:0, {}:1}`,
 	`package p; type T = int`,
 	`package p; type (T = p.T; _ = struct{}; x = *T)`,
+	`package p; func f() { sandbox["main:R", "file"]() {}() };`,
+	`package p; func f() { _ = sandbox["", ""](x int) int { return x } };`,
+	`package p; func f() { sandbox["", "", "render"]() {}() };`,
+	`package p; const mem = "p:R"; func f() { sandbox[mem + ",self:P", ""]() {}() };`,
+	`package p; type T sandbox["main:R", "file"](int) error`,
+	`package p; func f(cb sandbox["", ""](), _ []sandbox[mem, ""]() int) sandbox["", ""]() { return cb }`,
+	`package p; var _ = (sandbox["", ""]())(nil)`,
 }
 
 func TestValid(t *testing.T) {
@@ -59,6 +66,8 @@ func TestValid(t *testing.T) {
 var invalids = []string{
 	`foo /* ERROR "expected 'package'" */ !`,
 	`package p; func f() { if { /* ERROR "missing condition" */ } };`,
+	`package p; func f() { sandbox["", "", name /* ERROR "expected 'STRING'" */ ]() {}() };`,
+	`package p; type T sandbox["", "", "render" /* ERROR "sandbox type cannot have a name" */ ]()`,
 	`package p; func f() { if ; /* ERROR "missing condition" */ {} };`,
 	`package p; func f() { if f(); /* ERROR "missing condition" */ {} };`,
 	`package p; func f() { if _ = range /* ERROR "expected operand" */ x; true {} };`,
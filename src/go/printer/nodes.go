@@ -401,6 +401,21 @@ func (p *printer) signature(params, result *ast.FieldList) {
 	}
 }
 
+// sandboxConfig prints the [mem, sys] part of a sandbox, the "sandbox"
+// keyword must have been printed already. The expressions are printed as
+// indices.
+func (p *printer) sandboxConfig(s *ast.SandboxConfig) {
+	p.print(s.Lbrack, token.LBRACK)
+	p.expr0(s.Mem, 2)
+	p.print(token.COMMA, blank)
+	p.expr0(s.Sys, 2)
+	if s.Name != nil {
+		p.print(token.COMMA, blank)
+		p.expr(s.Name)
+	}
+	p.print(s.Rbrack, token.RBRACK)
+}
+
 func identListSize(list []*ast.Ident, maxSize int) (size int) {
 	for i, x := range list {
 		if i > 0 {
@@ -794,9 +809,16 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.print(x)
 
 	case *ast.FuncLit:
-		p.print(x.Type.Pos(), token.FUNC)
 		// See the comment in funcDecl about how the header size is computed.
-		startCol := p.out.Column - len("func")
+		var startCol int
+		if x.Type.Sandbox != nil {
+			p.print(x.Type.Pos(), token.SANDBOX)
+			startCol = p.out.Column - len("sandbox")
+			p.sandboxConfig(x.Type.Sandbox)
+		} else {
+			p.print(x.Type.Pos(), token.FUNC)
+			startCol = p.out.Column - len("func")
+		}
 		p.signature(x.Type.Params, x.Type.Results)
 		p.funcBody(p.distanceFrom(x.Type.Pos(), startCol), blank, x.Body)
 
@@ -941,7 +963,12 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 		p.fieldList(x.Fields, true, x.Incomplete)
 
 	case *ast.FuncType:
-		p.print(token.FUNC)
+		if x.Sandbox != nil {
+			p.print(token.SANDBOX)
+			p.sandboxConfig(x.Sandbox)
+		} else {
+			p.print(token.FUNC)
+		}
 		p.signature(x.Params, x.Results)
 
 	case *ast.InterfaceType:
@@ -199,6 +199,7 @@ var data = []entry{
 	{"declarations.input", "declarations.golden", 0},
 	{"statements.input", "statements.golden", 0},
 	{"slow.input", "slow.golden", idempotent},
+	{"sandbox.input", "sandbox.golden", idempotent},
 	{"complit.input", "complit.x", export},
 }
 
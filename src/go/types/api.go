@@ -213,6 +213,11 @@ type Info struct {
 	//
 	Scopes map[ast.Node]*Scope
 
+	// Sandboxes maps sandbox function literals to their parsed
+	// configuration. Literals with an invalid configuration are
+	// omitted.
+	Sandboxes map[*ast.FuncLit]*Sandbox
+
 	// InitOrder is the list of package-level initializers in the order in which
 	// they must be executed. Initializers referring to variables related by an
 	// initialization dependency appear in topological order, the others appear
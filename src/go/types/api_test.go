@@ -753,6 +753,72 @@ func TestInitOrderInfo(t *testing.T) {
 	}
 }
 
+func TestSandboxesInfo(t *testing.T) {
+	var tests = []struct {
+		src  string
+		want string // view, pristine, syscall mask, name
+	}{
+		{`package p0; func _() { sandbox["", ""]() {}() }`, "[] false 0x8000000000000000"},
+		{`package p1; import "strings"; func _() { sandbox["strings:R", "file,net"]() { strings.ToUpper("") }() }`, "[{strings 4}] false 0x8000000000000003"},
+		{`package p2; func _() { _ = sandbox["p2:RW,self:P", "all"]() int { return 0 } }`, "[{p2 6}] true 0x800000000000003f"},
+		{`package main; func _() { sandbox["main:R", ""]() {}() }`, "[{main 4}] false 0x8000000000000000"},
+		{`package p3; func _() { sandbox["fmt:R", ""]() {}() }`, ""},
+		{`package p4; func _() { sandbox["", "none"]() {}() }`, ""},
+		{`package p5; func _() { sandbox["", "", "render"]() {}() }`, "[] false 0x8000000000000000 render"},
+		{`package p6; func _() { sandbox["", "", "a b"]() {}() }`, ""},
+		{`package p7; const mem = "p7:RW"; func _() { sandbox[mem + ",self:P", "file"]() {}() }`, "[{p7 6}] true 0x8000000000000001"},
+	}
+
+	for _, test := range tests {
+		info := Info{Sandboxes: make(map[*ast.FuncLit]*Sandbox)}
+		name := mayTypecheck(t, "SandboxesInfo", test.src, &info)
+
+		var got string
+		for _, sb := range info.Sandboxes {
+			got = fmt.Sprintf("%v %v %#x", sb.View, sb.Pristine, sb.Sys)
+			if sb.Name != "" {
+				got += " " + sb.Name
+			}
+		}
+		if len(info.Sandboxes) > 1 {
+			t.Errorf("package %s: got %d sandboxes; want at most 1", name, len(info.Sandboxes))
+			continue
+		}
+		if got != test.want {
+			t.Errorf("package %s: got %q; want %q", name, got, test.want)
+		}
+	}
+}
+
+func TestSandboxSignature(t *testing.T) {
+	const src = `package p
+const view = "p:R"
+type T sandbox[view + ",self:P", "file"](int) error
+var cb = func() T { return nil }
+`
+	pkg, err := pkgFor("p", src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := pkg.Scope().Lookup("T").Type().Underlying().(*Signature)
+	if mem, sys, ok := sig.Sandbox(); !ok || mem != "p:R,self:P" || sys != "file" {
+		t.Errorf("got %q %q %v; want %q %q true", mem, sys, ok, "p:R,self:P", "file")
+	}
+	if got, want := sig.String(), `sandbox["p:R,self:P", "file"](int) error`; got != want {
+		t.Errorf("got %s; want %s", got, want)
+	}
+	plain := pkg.Scope().Lookup("cb").Type().(*Signature)
+	if _, _, ok := plain.Sandbox(); ok {
+		t.Errorf("%s is not a sandbox type", plain)
+	}
+	if Identical(sig, NewSignature(nil, sig.Params(), sig.Results(), false)) {
+		t.Errorf("%s is identical to a plain function type", sig)
+	}
+	if !Identical(sig, NewSandboxSignature(sig.Params(), sig.Results(), false, "p:R,self:P", "file")) {
+		t.Errorf("%s is not identical to its copy", sig)
+	}
+}
+
 func TestMultiFileInitOrder(t *testing.T) {
 	fset := token.NewFileSet()
 	mustParse := func(src string) *ast.File {
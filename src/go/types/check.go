@@ -93,6 +93,8 @@ type Checker struct {
 	finals   []func()              // list of final actions; processed at the end of type-checking the current set of files
 	objPath  []Object              // path of object dependencies during type inference (for cycle reporting)
 
+	sandboxNames map[*declInfo]map[string]bool // names of the sandboxes of each function
+
 	// context within which the current object is type-checked
 	// (valid only for the duration of type-checking a specific object)
 	context
@@ -205,6 +207,7 @@ func (check *Checker) initFiles(files []*ast.File) {
 	check.untyped = nil
 	check.delayed = nil
 	check.finals = nil
+	check.sandboxNames = nil
 
 	// determine package name and collect valid files
 	pkg := check.pkg
@@ -399,6 +402,13 @@ func (check *Checker) recordSelection(x *ast.SelectorExpr, kind SelectionKind, r
 	}
 }
 
+func (check *Checker) recordSandbox(e *ast.FuncLit, sb *Sandbox) {
+	assert(e != nil && sb != nil)
+	if m := check.Sandboxes; m != nil {
+		m[e] = sb
+	}
+}
+
 func (check *Checker) recordScope(node ast.Node, scope *Scope) {
 	assert(node != nil)
 	assert(scope != nil)
@@ -93,6 +93,12 @@ func (x *operand) convertibleTo(check *Checker, T Type) bool {
 		return true
 	}
 
+	// "x's type is a sandbox type and T is a plain function type
+	// with an identical signature"
+	if check.sandboxAssignable(V, T, nil) {
+		return true
+	}
+
 	// "x's type and T are unnamed pointer types and their pointer base types
 	// have identical underlying types if tags are ignored"
 	if V, ok := V.(*Pointer); ok {
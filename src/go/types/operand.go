@@ -274,5 +274,12 @@ func (x *operand) assignableTo(check *Checker, T Type, reason *string) bool {
 		}
 	}
 
+	// x's type V is a sandbox type, T is a plain function type
+	// with an identical signature, and at least one of V or T
+	// is not a named type
+	if check.sandboxAssignable(V, T, reason) {
+		return !isNamed(V) || !isNamed(T)
+	}
+
 	return false
 }
@@ -0,0 +1,239 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// This file implements the checking of sandbox configurations,
+// i.e., sandbox[mem, sys] func() {...} and sandbox[mem, sys, "name"]
+// func() {...}, where mem and sys are string constants, and of the
+// sandbox[mem, sys] func() types of these literals.
+
+package types
+
+import (
+	"go/ast"
+	"go/constant"
+	"gosb/commons"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Sandbox describes the configuration of a sandbox function literal.
+type Sandbox struct {
+	View     []commons.Entry     // memory view, in source order (self excluded)
+	Pristine bool                // set if the view contains "self:P"
+	Quota    commons.Quota       // resource quotas, e.g., "self:heap=16M"
+	Sys      commons.SyscallMask // whitelisted syscall classes
+	Args     commons.SyscallArgs // constraints on the syscall arguments, e.g., "file=/tmp"
+	Name     string              // name of the sandbox in its function, or ""
+}
+
+// sandboxConfig is the configuration of a sandbox type, i.e., of the
+// signature of sandbox[mem, sys] func types and literals.
+type sandboxConfig struct {
+	mem, sys string
+	valid    bool // set if mem and sys are valid configurations
+}
+
+// NewSandboxSignature returns a new sandbox function type with the memory
+// view mem and the syscall classes sys, see NewSignature.
+func NewSandboxSignature(params, results *Tuple, variadic bool, mem, sys string) *Signature {
+	sig := NewSignature(nil, params, results, variadic)
+	sig.sbox = &sandboxConfig{mem, sys, true}
+	return sig
+}
+
+// Sandbox returns the memory view and the syscall classes of the sandbox
+// function type s. ok is false if s is a plain function type.
+func (s *Signature) Sandbox() (mem, sys string, ok bool) {
+	if s.sbox == nil {
+		return "", "", false
+	}
+	return s.sbox.mem, s.sbox.sys, true
+}
+
+// identical reports whether sandbox configurations s and x are identical,
+// i.e., whether they are equivalent regardless of the order of their
+// entries. Both are nil for plain function types.
+func (s *sandboxConfig) identical(x *sandboxConfig) bool {
+	if s == nil || x == nil {
+		return s == x
+	}
+	return commons.CanonicalMemoryView(s.mem) == commons.CanonicalMemoryView(x.mem) &&
+		commons.CanonicalSyscalls(s.sys) == commons.CanonicalSyscalls(x.sys)
+}
+
+// sandboxType evaluates and checks the configuration of a sandbox type or
+// literal.
+func (check *Checker) sandboxType(conf *ast.SandboxConfig) *sandboxConfig {
+	mem, valid := check.sandboxConst(conf.Mem)
+	if _, _, err := commons.ParseSandboxView(mem); err != nil {
+		check.errorf(conf.Mem.Pos(), "invalid sandbox memory view %q: %s", mem, sandboxError(err))
+		valid = false
+	}
+	sys, ok := check.sandboxConst(conf.Sys)
+	valid = valid && ok
+	if _, err := commons.ParseSyscalls(sys); err != nil {
+		check.errorf(conf.Sys.Pos(), "invalid sandbox syscalls %q: %s", sys, sandboxError(err))
+		valid = false
+	}
+	return &sandboxConfig{mem, sys, valid}
+}
+
+// sandboxAssignable reports whether a value of the sandbox type V can be
+// used as the plain function type T, i.e., whether they have identical
+// signatures. Plain functions, and sandboxes with a different
+// configuration, cannot be used as sandboxes.
+func (check *Checker) sandboxAssignable(V, T Type, reason *string) bool {
+	Vs, _ := V.Underlying().(*Signature)
+	Ts, _ := T.Underlying().(*Signature)
+	if Vs == nil || Ts == nil || Vs.sbox == nil && Ts.sbox == nil {
+		return false
+	}
+	plainV, plainT := *Vs, *Ts
+	plainV.sbox, plainT.sbox = nil, nil
+	if !check.identical(&plainV, &plainT) {
+		return false
+	}
+	switch {
+	case Ts.sbox == nil:
+		return true
+	case Vs.sbox == nil:
+		if reason != nil {
+			*reason = "plain function is not a sandbox"
+		}
+	default:
+		if reason != nil {
+			*reason = "sandbox configurations differ"
+		}
+	}
+	return false
+}
+
+// sandboxLit checks the configuration of the sandbox function literal e,
+// of type sig, and records it if it is valid.
+func (check *Checker) sandboxLit(e *ast.FuncLit, sig *Signature) {
+	conf := e.Type.Sandbox
+	if check.sig == nil {
+		check.errorf(conf.Pos(), "sandbox literal outside of a function body")
+		return
+	}
+	if sig.sbox == nil || !sig.sbox.valid {
+		// Errors are reported by sandboxType.
+		return
+	}
+
+	valid := true
+	sb := new(Sandbox)
+	mem, sys := sig.sbox.mem, sig.sbox.sys
+	sb.View, sb.Pristine, _ = commons.ParseSandboxView(mem)
+	for _, entry := range sb.View {
+		if !check.sandboxVisible(entry.Name) {
+			check.errorf(conf.Mem.Pos(), "sandbox memory view names package %q that is not imported", entry.Name)
+			valid = false
+		}
+	}
+	sb.Quota, _ = commons.ParseQuota(mem)
+	sb.Sys, _ = commons.ParseSyscalls(sys)
+	sb.Args, _ = commons.ParseSyscallArgs(sys)
+
+	if conf.Name != nil {
+		var ok bool
+		sb.Name, ok = check.sandboxName(conf.Name)
+		valid = valid && ok
+	}
+
+	if valid {
+		check.recordSandbox(e, sb)
+	}
+}
+
+// sandboxConst evaluates a memory view or syscalls expression e, that must
+// be a string constant. It returns "" if e is invalid.
+func (check *Checker) sandboxConst(e ast.Expr) (string, bool) {
+	var x operand
+	check.expr(&x, e)
+	if x.mode == invalid {
+		return "", false
+	}
+	if x.mode != constant_ || !isString(x.typ) {
+		check.errorf(x.pos(), "sandbox configuration %s is not a string constant", &x)
+		return "", false
+	}
+	return constant.StringVal(x.val), true
+}
+
+// sandboxName checks the name of a sandbox. Names are identifiers, unique
+// in the enclosing function, as they are part of the sandbox ids.
+func (check *Checker) sandboxName(lit *ast.BasicLit) (string, bool) {
+	name, err := strconv.Unquote(lit.Value)
+	if err != nil {
+		// The parser already reported the error.
+		return "", false
+	}
+	if !isSandboxName(name) {
+		check.errorf(lit.Pos(), "invalid sandbox name %s: must be an identifier", lit.Value)
+		return "", false
+	}
+	if check.sandboxNames == nil {
+		check.sandboxNames = make(map[*declInfo]map[string]bool)
+	}
+	names := check.sandboxNames[check.decl]
+	if names == nil {
+		names = make(map[string]bool)
+		check.sandboxNames[check.decl] = names
+	}
+	if names[name] {
+		check.errorf(lit.Pos(), "duplicate sandbox name %s", lit.Value)
+		return "", false
+	}
+	names[name] = true
+	return name, true
+}
+
+// isSandboxName reports whether name can name a sandbox, see
+// cmd/compile/internal/syntax.IsSandboxName.
+func isSandboxName(name string) bool {
+	if name == "" || name == "_" {
+		return false
+	}
+	for i, c := range name {
+		if !unicode.IsLetter(c) && c != '_' && (i == 0 || !unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sandboxVisible reports whether path denotes the package being checked
+// or one of its (transitive) imports. The main package is always named
+// "main" in a memory view.
+func (check *Checker) sandboxVisible(path string) bool {
+	if path == check.pkg.path || (path == "main" && check.pkg.name == "main") {
+		return true
+	}
+	seen := make(map[*Package]bool)
+	var visit func(pkgs []*Package) bool
+	visit = func(pkgs []*Package) bool {
+		for _, pkg := range pkgs {
+			if seen[pkg] {
+				continue
+			}
+			seen[pkg] = true
+			if pkg.path == path || visit(pkg.imports) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(check.pkg.imports)
+}
+
+// sandboxError formats an error produced by the gosb/commons parsers.
+func sandboxError(err error) string {
+	msg := strings.TrimSpace(err.Error())
+	if msg != "" {
+		msg = strings.ToLower(msg[:1]) + msg[1:]
+	}
+	return msg
+}
@@ -140,7 +140,11 @@ func writeType(buf *bytes.Buffer, typ Type, qf Qualifier, visited []Type) {
 		writeTuple(buf, t, false, qf, visited)
 
 	case *Signature:
-		buf.WriteString("func")
+		if sb := t.sbox; sb != nil {
+			fmt.Fprintf(buf, "sandbox[%q, %q]", sb.mem, sb.sys)
+		} else {
+			buf.WriteString("func")
+		}
 		writeSignature(buf, t, qf, visited)
 
 	case *Interface:
@@ -151,6 +151,9 @@ func (check *Checker) funcType(sig *Signature, recvPar *ast.FieldList, ftyp *ast
 	recvList, _ := check.collectParams(scope, recvPar, false)
 	params, variadic := check.collectParams(scope, ftyp.Params, true)
 	results, _ := check.collectParams(scope, ftyp.Results, false)
+	if ftyp.Sandbox != nil {
+		sig.sbox = check.sandboxType(ftyp.Sandbox)
+	}
 
 	if recvPar != nil {
 		// recv parameter list present (may be empty)
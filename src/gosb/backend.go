@@ -4,6 +4,7 @@ import (
 	be "gosb/backend"
 	"gosb/benchmark"
 	"gosb/mpk"
+	"gosb/mprotect"
 	"gosb/sim"
 	"gosb/vtx"
 )
@@ -11,9 +12,47 @@ import (
 // Configurations
 var (
 	configBackends = [be.BACKEND_SIZE]be.BackendConfig{
-		be.BackendConfig{be.SIM_BACKEND, sim.Init, sim.Prolog, sim.Epilog, sim.Transfer, sim.Register, sim.Execute, nil, nil, nil},
-		be.BackendConfig{be.VTX_BACKEND, vtx.Init, vtx.Prolog, vtx.Epilog, vtx.Transfer, vtx.Register, vtx.Execute, nil, vtx.RuntimeGrowth, vtx.Stats},
-		be.BackendConfig{be.MPK_BACKEND, mpk.Init, mpk.Prolog, mpk.Epilog, mpk.Transfer, mpk.Register, mpk.Execute, mpk.MStart, nil, nil},
+		be.BackendConfig{
+			Tpe:      be.SIM_BACKEND,
+			Init:     sim.Init,
+			Prolog:   sim.Prolog,
+			Epilog:   sim.Epilog,
+			Transfer: sim.Transfer,
+			Register: sim.Register,
+			Execute:  sim.Execute,
+		},
+		be.BackendConfig{
+			Tpe:           be.VTX_BACKEND,
+			Init:          vtx.Init,
+			Prolog:        vtx.Prolog,
+			Epilog:        vtx.Epilog,
+			Transfer:      vtx.Transfer,
+			Register:      vtx.Register,
+			Execute:       vtx.Execute,
+			RuntimeGrowth: vtx.RuntimeGrowth,
+			Stats:         vtx.Stats,
+		},
+		be.BackendConfig{
+			Tpe:      be.MPK_BACKEND,
+			Init:     mpk.Init,
+			Prolog:   mpk.Prolog,
+			Epilog:   mpk.Epilog,
+			Transfer: mpk.Transfer,
+			Register: mpk.Register,
+			Execute:  mpk.Execute,
+			Mstart:   mpk.MStart,
+			Stats:    mpk.Stats,
+		},
+		be.BackendConfig{
+			Tpe:      be.MPROTECT_BACKEND,
+			Init:     mprotect.Init,
+			Prolog:   mprotect.Prolog,
+			Epilog:   mprotect.Epilog,
+			Transfer: mprotect.Transfer,
+			Register: mprotect.Register,
+			Execute:  mprotect.Execute,
+			Stats:    mprotect.Stats,
+		},
 	}
 )
 
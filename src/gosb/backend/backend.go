@@ -1,7 +1,9 @@
 package backend
 
 import (
+	"fmt"
 	c "gosb/commons"
+	"strings"
 )
 
 type Backend = int
@@ -21,8 +23,44 @@ type BackendConfig struct {
 }
 
 const (
-	SIM_BACKEND  Backend = iota
-	VTX_BACKEND  Backend = iota
-	MPK_BACKEND  Backend = iota
-	BACKEND_SIZE Backend = iota
+	SIM_BACKEND      Backend = iota
+	VTX_BACKEND      Backend = iota
+	MPK_BACKEND      Backend = iota
+	MPROTECT_BACKEND Backend = iota
+	BACKEND_SIZE     Backend = iota
 )
+
+// DEFAULT_BACKEND isolates the sandboxes in a KVM virtual machine. The
+// mprotect backend, which needs neither KVM nor PKU support, is best-effort
+// and must be selected explicitly.
+const DEFAULT_BACKEND Backend = VTX_BACKEND
+
+// Names are the names of the backends, e.g., for the -gosb build flag.
+var Names = [BACKEND_SIZE]string{"sim", "vtx", "mpk", "mprotect"}
+
+// recorded is the backend selected with the -gosb build flag. The go command
+// sets it with the linker's -X flag.
+var recorded string
+
+// Parse returns the backend called name, regardless of the case.
+func Parse(name string) (Backend, error) {
+	for i, v := range Names {
+		if strings.EqualFold(name, v) {
+			return i, nil
+		}
+	}
+	return BACKEND_SIZE, fmt.Errorf("Unknown backend %q, expected one of %v\n", name, strings.Join(Names[:], ", "))
+}
+
+// Recorded returns the backend selected with the -gosb build flag, ok is
+// false if the program was built without it.
+func Recorded() (b Backend, ok bool) {
+	if recorded == "" {
+		return DEFAULT_BACKEND, false
+	}
+	b, err := Parse(recorded)
+	if err != nil {
+		return DEFAULT_BACKEND, false
+	}
+	return b, true
+}
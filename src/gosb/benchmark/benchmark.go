@@ -32,35 +32,43 @@ type Benchmark struct {
 }
 
 var (
-	backends = [backend.BACKEND_SIZE]string{"SIM", "VTX", "MPK"}
-	Bench    *Benchmark
+	Bench *Benchmark
 )
 
-func ParseBenchConfig() (backend.Backend, bool, int, int) {
-	befl := os.Getenv(BE_FLAG)
-	bench := os.Getenv(BENCH_FLAG)
-	arg1 := os.Getenv(ARG1_FLAG)
-	arg2 := os.Getenv(ARG2_FLAG)
-	be := backend.BACKEND_SIZE
-	for i, v := range backends {
-		if befl == v {
-			be = i
-			break
+// ParseBenchConfig returns the backend, whether to instrument, and the two
+// arguments of a benchmark, from the environment. The backend defaults to the
+// one selected with the -gosb build flag, and the arguments to 0.
+func ParseBenchConfig() (backend.Backend, bool, int, int, error) {
+	be, _ := backend.Recorded()
+	if befl := os.Getenv(BE_FLAG); befl != "" {
+		var err error
+		if be, err = backend.Parse(befl); err != nil {
+			return be, false, 0, 0, err
 		}
 	}
-	if be == backend.BACKEND_SIZE {
-		panic("unrecognized backend")
+	a1, err := parseBenchArg(ARG1_FLAG)
+	if err != nil {
+		return be, false, 0, 0, err
 	}
-	a1, err := strconv.Atoi(arg1)
-	a2, err2 := strconv.Atoi(arg2)
-	if err != nil || err2 != nil {
-		panic("error with arg1 or arg2")
+	a2, err := parseBenchArg(ARG2_FLAG)
+	if err != nil {
+		return be, false, 0, 0, err
 	}
-	instr := false
-	if bench != "" {
-		instr = true
+	instr := os.Getenv(BENCH_FLAG) != ""
+	return be, instr, a1, a2, nil
+}
+
+// parseBenchArg returns the value of the environment variable flag, or 0.
+func parseBenchArg(flag string) (int, error) {
+	arg := os.Getenv(flag)
+	if arg == "" {
+		return 0, nil
+	}
+	v, err := strconv.Atoi(arg)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %v %q: %v\n", flag, arg, err)
 	}
-	return be, instr, a1, a2
+	return v, nil
 }
 
 //go:nosplit
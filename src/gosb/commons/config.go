@@ -2,6 +2,7 @@ package commons
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -19,6 +20,11 @@ import (
 // entry := name:rights
 // config := entry1,entry2,... // separated by commas
 //
+// The self entries also bound the resources of the sandbox:
+// quota := self:heap=size || self:copies=n || self:warm=n
+// where size is a number of bytes with an optional K, M or G suffix, and
+// warm is the number of pristine copies created at initialization.
+//
 // The second argument represent syscall classes that are whitelisted for this sandbox.
 
 type Entry struct {
@@ -30,6 +36,16 @@ const (
 	DELIMITER_PKGS  = ","
 	DELIMITER_ENTRY = ":"
 	SELF_IDENTIFIER = "self"
+	DELIMITER_QUOTA = "="
+
+	// Quotas
+	QUOTA_HEAP   = "heap"
+	QUOTA_COPIES = "copies"
+	QUOTA_WARM   = "warm"
+
+	// Limits set at run time, see gosb.WithDeadline.
+	QUOTA_DEADLINE = "deadline"
+	QUOTA_CPU      = "cpu"
 
 	// Permissions
 	UNMAP    = "U"
@@ -57,7 +73,30 @@ const (
 	HEAP_VAL  = R_VAL | W_VAL | USER_VAL
 )
 
-func ParseMemoryView(memc string) ([]Entry, bool, error) {
+// ParseMemoryView parses the entries of a memory view, the self entries
+// excluded. It only checks the syntax of the view, see ParseSandboxView.
+func ParseMemoryView(memc string) ([]Entry, error) {
+	res, _, err := parseMemoryView(memc)
+	return res, err
+}
+
+// ParseSandboxView parses and validates the memory view of a sandbox. It
+// returns the entries, the self entries excluded, and whether the sandbox is
+// pristine, i.e., has a self:P entry. Only self can be pristine.
+func ParseSandboxView(memc string) ([]Entry, bool, error) {
+	res, pristine, err := parseMemoryView(memc)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, e := range res {
+		if e.Perm == P_VAL {
+			return nil, false, fmt.Errorf("Pristine applied to non self package %v\n", e.Name)
+		}
+	}
+	return res, pristine, nil
+}
+
+func parseMemoryView(memc string) ([]Entry, bool, error) {
 	pristine := false
 	mem, err := strconv.Unquote(memc)
 	if err != nil {
@@ -69,7 +108,14 @@ func ParseMemoryView(memc string) ([]Entry, bool, error) {
 	entries := strings.Split(mem, DELIMITER_PKGS)
 	res := make([]Entry, 0)
 	uniq := make(map[string]bool)
+	quota := Quota{}
 	for _, v := range entries {
+		if isQuotaEntry(v) {
+			if err := parseQuotaEntry(v, &quota); err != nil {
+				return nil, false, err
+			}
+			continue
+		}
 		e, err := parseEntry(v)
 		if err != nil {
 			return res, false, err
@@ -89,9 +135,148 @@ func ParseMemoryView(memc string) ([]Entry, bool, error) {
 		uniq[e.Name] = true
 		res = append(res, e)
 	}
+	if err := quota.validate(); err != nil {
+		return nil, false, err
+	}
 	return res, pristine, nil
 }
 
+// CanonicalMemoryView formats the memory view memc with its entries sorted
+// and its permissions and quotas in canonical form, such that equivalent
+// views have the same canonical form. Invalid views are returned unchanged.
+func CanonicalMemoryView(memc string) string {
+	view, pristine, err := parseMemoryView(memc)
+	if err != nil {
+		return memc
+	}
+	q, err := ParseQuota(memc)
+	if err != nil {
+		return memc
+	}
+	entries := make([]string, 0, len(view)+4)
+	for _, e := range view {
+		entries = append(entries, e.Name+DELIMITER_ENTRY+PermString(e.Perm))
+	}
+	self := SELF_IDENTIFIER + DELIMITER_ENTRY
+	if pristine {
+		entries = append(entries, self+PRISTINE)
+	}
+	if q.Heap != 0 {
+		entries = append(entries, self+QUOTA_HEAP+DELIMITER_QUOTA+strconv.FormatUint(q.Heap, 10))
+	}
+	if q.Copies != 0 {
+		entries = append(entries, self+QUOTA_COPIES+DELIMITER_QUOTA+strconv.Itoa(q.Copies))
+	}
+	if q.Warm != 0 {
+		entries = append(entries, self+QUOTA_WARM+DELIMITER_QUOTA+strconv.Itoa(q.Warm))
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, DELIMITER_PKGS)
+}
+
+// ParseQuota returns the resource quotas declared in a memory view.
+func ParseQuota(memc string) (Quota, error) {
+	q := Quota{}
+	mem, err := strconv.Unquote(memc)
+	if err != nil {
+		mem = memc
+	}
+	if len(mem) == 0 {
+		return q, nil
+	}
+	for _, v := range strings.Split(mem, DELIMITER_PKGS) {
+		if !isQuotaEntry(v) {
+			continue
+		}
+		if err := parseQuotaEntry(v, &q); err != nil {
+			return Quota{}, err
+		}
+	}
+	if err := q.validate(); err != nil {
+		return Quota{}, err
+	}
+	return q, nil
+}
+
+// validate checks the consistency of the quotas declared by several entries.
+func (q *Quota) validate() error {
+	if q.Copies != 0 && q.Warm > q.Copies {
+		return fmt.Errorf("Warm copies %v exceed the copies quota %v\n", q.Warm, q.Copies)
+	}
+	return nil
+}
+
+func isQuotaEntry(entry string) bool {
+	split := strings.Split(entry, DELIMITER_ENTRY)
+	return len(split) == 2 && strings.TrimSpace(split[0]) == SELF_IDENTIFIER &&
+		strings.Contains(split[1], DELIMITER_QUOTA)
+}
+
+// parseQuotaEntry parses self:resource=value into q.
+func parseQuotaEntry(entry string, q *Quota) error {
+	value := strings.Split(entry, DELIMITER_ENTRY)[1]
+	split := strings.Split(value, DELIMITER_QUOTA)
+	if len(split) != 2 {
+		return fmt.Errorf("Parsing error: expected resource=value, got [%v]\n", value)
+	}
+	resource, amount := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+	switch resource {
+	case QUOTA_HEAP:
+		if q.Heap != 0 {
+			return fmt.Errorf("Duplicated %v quota\n", resource)
+		}
+		size, err := parseSize(amount)
+		if err != nil {
+			return err
+		}
+		q.Heap = size
+	case QUOTA_COPIES:
+		if q.Copies != 0 {
+			return fmt.Errorf("Duplicated %v quota\n", resource)
+		}
+		n, err := strconv.Atoi(amount)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("Invalid number of copies %v\n", amount)
+		}
+		q.Copies = n
+	case QUOTA_WARM:
+		if q.Warm != 0 {
+			return fmt.Errorf("Duplicated %v quota\n", resource)
+		}
+		n, err := strconv.Atoi(amount)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("Invalid number of copies %v\n", amount)
+		}
+		q.Warm = n
+	default:
+		return fmt.Errorf("Unknown quota %v\n", resource)
+	}
+	return nil
+}
+
+// parseSize parses a number of bytes, with an optional K, M or G suffix.
+func parseSize(amount string) (uint64, error) {
+	digits, shift := amount, uint(0)
+	if l := len(amount); l > 0 {
+		switch amount[l-1] {
+		case 'K':
+			shift = 10
+		case 'M':
+			shift = 20
+		case 'G':
+			shift = 30
+		}
+		if shift != 0 {
+			digits = amount[:l-1]
+		}
+	}
+	size, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil || size == 0 || size > (^uint64(0))>>shift {
+		return 0, fmt.Errorf("Invalid size %v\n", amount)
+	}
+	return size << shift, nil
+}
+
 func parseEntry(entry string) (Entry, error) {
 	split := strings.Split(entry, DELIMITER_ENTRY)
 	if len(split) != 2 {
@@ -105,9 +290,6 @@ func parseEntry(entry string) (Entry, error) {
 	if err != nil {
 		return Entry{}, err
 	}
-	if perm == P_VAL && name != SELF_IDENTIFIER {
-		return Entry{}, fmt.Errorf("Pristine applied to non self package")
-	}
 	return Entry{name, perm}, nil
 }
 
@@ -149,6 +331,27 @@ func parsePerm(entry string) (uint8, error) {
 	return perm, nil
 }
 
+// PermString formats perm as it appears in a memory view, e.g., "RW".
+func PermString(perm uint8) string {
+	switch perm {
+	case U_VAL:
+		return UNMAP
+	case P_VAL:
+		return PRISTINE
+	}
+	res := ""
+	if perm&R_VAL != 0 {
+		res += READ
+	}
+	if perm&W_VAL != 0 {
+		res += WRITE
+	}
+	if perm&X_VAL != 0 {
+		res += EXECUTE
+	}
+	return res
+}
+
 //go:nosplit
 func Round(addr uint64, up bool) uint64 {
 	res := addr - (addr % _PageSize)
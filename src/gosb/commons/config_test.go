@@ -102,3 +102,117 @@ func TestMultipleMemoryViews(t *testing.T) {
 		}
 	}
 }
+
+func TestPermString(t *testing.T) {
+	for _, s := range []string{"U", "P", "R", "RW", "RX", "RWX"} {
+		perm, err := parsePerm(s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if res := PermString(perm); res != s {
+			t.Errorf("Invalid string for %v: got %v\n", s, res)
+		}
+	}
+}
+
+func TestCanonicalMemoryView(t *testing.T) {
+	same := [][]string{
+		{"", "\"\""},
+		{"a:R,b:RW", "b:RW,a:R", "\"b:WR,a:R\""},
+		{"self:P,a:R,self:heap=1K,self:copies=2", "self:copies=2,self:heap=1024,a:R,self:P"},
+	}
+	for _, views := range same {
+		want := CanonicalMemoryView(views[0])
+		for _, v := range views[1:] {
+			if res := CanonicalMemoryView(v); res != want {
+				t.Errorf("Invalid canonical view for %v: got %v expected %v\n", v, res, want)
+			}
+		}
+	}
+	if a, b := CanonicalMemoryView("a:R,b:R"), CanonicalMemoryView("a:R,b:RW"); a == b {
+		t.Errorf("Different views have the same canonical view %v\n", a)
+	}
+	if res := CanonicalMemoryView("a:R,a:R"); res != "a:R,a:R" {
+		t.Errorf("Invalid view should be unchanged: got %v\n", res)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	correct := []struct {
+		s    string
+		want Quota
+	}{
+		{"", Quota{}},
+		{"foo:R", Quota{}},
+		{"self:heap=4096", Quota{Heap: 4096}},
+		{"foo:R,self:heap=64K", Quota{Heap: 64 << 10}},
+		{"self:heap=16M,self:copies=2", Quota{Heap: 16 << 20, Copies: 2}},
+		{"self:P,self:copies=4,self:heap=1G", Quota{Heap: 1 << 30, Copies: 4}},
+		{"self:P,self:copies=4,self:warm=2", Quota{Copies: 4, Warm: 2}},
+		{"self:P,self:warm=8", Quota{Warm: 8}},
+	}
+	incorrect := []string{
+		"self:heap=",
+		"self:heap=0",
+		"self:heap=12T",
+		"self:heap=-1",
+		"self:copies=0",
+		"self:copies=1K",
+		"self:stack=4096",
+		"self:heap=1,self:heap=2",
+		"self:heap=1=2",
+		"self:warm=0",
+		"self:copies=2,self:warm=3",
+		"self:warm=3,self:copies=2",
+	}
+	for _, c := range correct {
+		q, err := ParseQuota(c.s)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if q != c.want {
+			t.Errorf("Invalid quota for %v, got %v\n", c.s, q)
+		}
+		if _, _, err := ParseSandboxView(c.s); err != nil {
+			t.Errorf("Memory view %v should be valid: %v\n", c.s, err)
+		}
+	}
+	for _, c := range incorrect {
+		if _, err := ParseQuota(c); err == nil {
+			t.Errorf("Failed to catch bad quota %v\n", c)
+		}
+		if _, _, err := ParseSandboxView(c); err == nil {
+			t.Errorf("Failed to catch bad memory view %v\n", c)
+		}
+	}
+}
+
+func TestSandboxView(t *testing.T) {
+	correct := []struct {
+		s        string
+		pristine bool
+	}{
+		{"foo:R", false},
+		{"self:P", true},
+		{"self:P,foo:RW", true},
+	}
+	incorrect := []string{
+		"foo:P",
+		"self:R",
+		"self:P,foo:P",
+	}
+	for _, c := range correct {
+		_, pristine, err := ParseSandboxView(c.s)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if pristine != c.pristine {
+			t.Errorf("Invalid pristine for %v, got %v\n", c.s, pristine)
+		}
+	}
+	for _, c := range incorrect {
+		if _, _, err := ParseSandboxView(c); err == nil {
+			t.Errorf("Failed to catch bad sandbox view %v\n", c)
+		}
+	}
+}
@@ -14,6 +14,65 @@ const (
 	Limit39bits = uintptr(1 << 39)
 )
 
+// The signal handlers of the backends and their seccomp filters, on x86_64.
+
+// Layouts of the structures the signal handlers access.
+const (
+	SiginfoCodeOffset    = 8
+	SiginfoAddrOffset    = 16
+	SiginfoSyscallOffset = 24
+
+	UcontextRegsOffset   = 40
+	UcontextFpregsOffset = UcontextRegsOffset + 23*8
+
+	SeccompDataNrOffset   = 0
+	SeccompDataArchOffset = 4
+	SeccompDataIPOffset   = 8
+)
+
+// Offsets of the general purpose registers inside the ucontext.
+const (
+	RegR8 = iota
+	RegR9
+	RegR10
+	RegR11
+	RegR12
+	RegR13
+	RegR14
+	RegR15
+	RegRdi
+	RegRsi
+	RegRbp
+	RegRbx
+	RegRdx
+	RegRax
+	RegRcx
+	RegRsp
+	RegRip
+	RegEfl
+	RegCsgsfs
+	RegErr
+)
+
+// Seccomp and bpf.
+const (
+	sysSeccomp             = 317
+	prSetNoNewPrivs        = 38
+	seccompSetModeFilter   = 1
+	seccompFilterFlagTsync = 1
+
+	SeccompRetKillProcess = 0x80000000
+	SeccompRetTrap        = 0x00030000
+	SeccompRetAllow       = 0x7fff0000
+	AuditArchX86_64       = 0xc000003e
+
+	BpfLdAbsW = 0x20
+	BpfJeqK   = 0x15
+	BpfJgtK   = 0x25
+	BpfJgeK   = 0x35
+	BpfRetK   = 0x06
+)
+
 //go:nosplit
 func Ioctl(fd int, op, arg uintptr) (int, sc.Errno) {
 	r1, _, err := sc.RawSyscall(sc.SYS_IOCTL, uintptr(fd), op, arg)
@@ -100,3 +159,51 @@ func ReplaceSignalHandler(sig sc.Signal, handler uintptr, previous *uintptr) err
 
 	return nil
 }
+
+// CtxReg returns a pointer to the saved register r in the ucontext.
+//
+//go:nosplit
+func CtxReg(ctx, r uintptr) *uint64 {
+	return (*uint64)(unsafe.Pointer(ctx + UcontextRegsOffset + r*8))
+}
+
+// SockFilter is a struct sock_filter, i.e., a bpf instruction.
+type SockFilter struct {
+	Code uint16
+	Jt   uint8
+	Jf   uint8
+	K    uint32
+}
+
+// BpfStmt returns the bpf instruction, as BPF_STMT.
+func BpfStmt(code uint16, k uint32) SockFilter {
+	return SockFilter{Code: code, K: k}
+}
+
+// BpfJump returns the bpf jump, as BPF_JUMP.
+func BpfJump(code uint16, k uint32, jt, jf uint8) SockFilter {
+	return SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
+
+// sockFprog is a struct sock_fprog, i.e., a bpf program.
+type sockFprog struct {
+	len    uint16
+	filter *SockFilter
+}
+
+// InstallFilter installs the bpf program on all the threads. It sets
+// no_new_privs.
+func InstallFilter(filter []SockFilter) error {
+	prog := sockFprog{uint16(len(filter)), &filter[0]}
+	if _, _, err := sc.RawSyscall6(sc.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); err != 0 {
+		return err
+	}
+	r, _, err := sc.RawSyscall(sysSeccomp, seccompSetModeFilter, seccompFilterFlagTsync, uintptr(unsafe.Pointer(&prog)))
+	if err != 0 {
+		return err
+	}
+	if r != 0 {
+		return fmt.Errorf("could not synchronize the seccomp filter on all threads")
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package commons
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ObjHeader = "\xeegosandx"
+	ObjFooter = "\xefgosandx"
+
+	// ObjEntry is the name of the archive entry with the sandboxes of a
+	// package, between ObjHeader and ObjFooter lines.
+	ObjEntry = "__.SANDBOX"
+
+	arMagic     = "!<arch>\n"
+	arHdrSize   = 60
+	arNameSize  = 16
+	arSizeStart = 48
+	arSizeEnd   = 58
+)
+
+// ObjSandbox is a sandbox entry that the compiler writes in the object files.
+// The configuration is quoted.
+type ObjSandbox struct {
+	Func     string   // symbol of the sandbox function
+	Id       string   // id of the sandbox
+	Mem      string   // memory view
+	Sys      string   // syscall classes
+	Packages []string // packages referenced by the sandbox
+}
+
+// ParseObjSandboxes returns the sandbox entries of the object file data, i.e.,
+// of its ObjEntry archive entries.
+func ParseObjSandboxes(data string) ([]ObjSandbox, error) {
+	if !strings.HasPrefix(data, arMagic) {
+		return nil, fmt.Errorf("Malformed object file: not an archive\n")
+	}
+	data = data[len(arMagic):]
+	var res []ObjSandbox
+	for len(data) > 0 {
+		if len(data) < arHdrSize {
+			return nil, fmt.Errorf("Malformed object file: truncated archive header\n")
+		}
+		name := strings.TrimSpace(data[:arNameSize])
+		size, err := strconv.Atoi(strings.TrimSpace(data[arSizeStart:arSizeEnd]))
+		if err != nil || size < 0 || len(data) < arHdrSize+size {
+			return nil, fmt.Errorf("Malformed object file: invalid size for %v\n", name)
+		}
+		entry := data[arHdrSize : arHdrSize+size]
+		data = data[arHdrSize+size:]
+		// Entries are 2-byte aligned.
+		if size%2 == 1 && len(data) > 0 {
+			data = data[1:]
+		}
+		if name != ObjEntry {
+			continue
+		}
+		sbs, err := parseObjEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sbs...)
+	}
+	return res, nil
+}
+
+// parseObjEntry parses the sandboxes of a package, i.e., their number and,
+// for each of them, the function, the configuration and the packages, one
+// per line.
+func parseObjEntry(entry string) ([]ObjSandbox, error) {
+	contents := strings.Split(strings.TrimSuffix(entry, "\n"), "\n")
+	if len(contents) < 3 || contents[0] != ObjHeader || contents[len(contents)-1] != ObjFooter {
+		return nil, fmt.Errorf("Malformed sandbox entry: missing header or footer\n")
+	}
+	contents = contents[1 : len(contents)-1]
+	size, err := strconv.Atoi(contents[0])
+	if err != nil || size <= 0 {
+		return nil, fmt.Errorf("Malformed sandbox entry: invalid size %v\n", contents[0])
+	}
+	contents = contents[1:]
+	res := make([]ObjSandbox, 0, size)
+	for i := 0; i < size; i++ {
+		if len(contents) < 3 || len(contents[0]) == 0 {
+			return nil, fmt.Errorf("Malformed sandbox entry: missing sandbox %v\n", i)
+		}
+		name := contents[0]
+		config := strings.Split(contents[1], ";")
+		if len(config) != 3 {
+			return nil, fmt.Errorf("Malformed configuration for %v: %v\n", name, contents[1])
+		}
+		nbPkgs, err := strconv.Atoi(contents[2])
+		if err != nil || nbPkgs < 0 || len(contents) < 3+nbPkgs {
+			return nil, fmt.Errorf("Malformed packages for %v: %v\n", name, contents[2])
+		}
+		contents = contents[3:]
+		// Cap pkgs, appending to them must not overwrite the next entries.
+		pkgs := contents[:nbPkgs:nbPkgs]
+		contents = contents[nbPkgs:]
+		res = append(res, ObjSandbox{name, config[0], config[1], config[2], pkgs})
+	}
+	return res, nil
+}
+
+// SandboxRoots returns the packages from which to walk the transitive
+// dependencies of a sandbox, i.e., the packages it references, the ones in
+// its memory view and the ExtraDependencies.
+func SandboxRoots(pkgs []string, view []Entry) []string {
+	res := make([]string, 0, len(pkgs)+len(view)+len(ExtraDependencies))
+	res = append(res, pkgs...)
+	for _, e := range view {
+		res = append(res, e.Name)
+	}
+	return append(res, ExtraDependencies...)
+}
+
+// WalkDeps walks the transitive dependencies of the package top, depth first.
+// deps returns the direct dependencies of a package, and the walk does not go
+// past the packages for which visited returns true.
+func WalkDeps(top string, deps func(pkg string) []string, visited func(pkg string) bool) {
+	if visited(top) {
+		return
+	}
+	for _, d := range deps(top) {
+		WalkDeps(d, deps, visited)
+	}
+}
@@ -0,0 +1,82 @@
+package commons
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// archive returns an archive with the entries, in the format of the compiler.
+func archive(entries ...string) string {
+	res := "!<arch>\n"
+	for i := 0; i+1 < len(entries); i += 2 {
+		res += fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10d`\n", entries[i], 0, 0, 0, 0644, len(entries[i+1]))
+		res += entries[i+1]
+		if len(entries[i+1])%2 == 1 {
+			res += "\x00"
+		}
+	}
+	return res
+}
+
+func TestParseObjSandboxes(t *testing.T) {
+	entry := ObjHeader + "\n2\n" +
+		"main.main.func1\n\"main.main#0\";\"\";\"file\"\n2\nstrings\nfmt\n" +
+		"main.F\n\"main.F\";\"strings:R\";\"\"\n0\n" +
+		ObjFooter + "\n"
+	// The header and the footer in other entries are ignored.
+	data := archive("__.PKGDEF", "go object "+ObjHeader+"\n", "_go_.o", ObjFooter+"\n1\n", ObjEntry, entry)
+	sbs, err := ParseObjSandboxes(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []ObjSandbox{
+		{"main.main.func1", "\"main.main#0\"", "\"\"", "\"file\"", []string{"strings", "fmt"}},
+		{"main.F", "\"main.F\"", "\"strings:R\"", "\"\"", []string{}},
+	}
+	if !reflect.DeepEqual(sbs, want) {
+		t.Errorf("got %v, want %v", sbs, want)
+	}
+
+	if sbs, err := ParseObjSandboxes(archive("_go_.o", "x")); err != nil || sbs != nil {
+		t.Errorf("got %v %v for an object without sandboxes", sbs, err)
+	}
+	incorrect := []string{
+		"not an archive",
+		archive(ObjEntry, ObjHeader+"\n1\nmain.F\n"+ObjFooter+"\n"),
+		archive(ObjEntry, ObjHeader+"\n1\nmain.F\n\"main.F\";\"\"\n0\n"+ObjFooter+"\n"),
+		archive(ObjEntry, ObjHeader+"\n1\nmain.F\n\"main.F\";\"\";\"\"\n3\nfmt\n"+ObjFooter+"\n"),
+		archive(ObjEntry, "1\nmain.F\n\"main.F\";\"\";\"\"\n0\n"),
+	}
+	for _, data := range incorrect {
+		if _, err := ParseObjSandboxes(data); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestWalkDeps(t *testing.T) {
+	graph := map[string][]string{
+		"main":    {"strings", "fmt"},
+		"fmt":     {"strings", "os"},
+		"strings": {"unicode"},
+	}
+	visited := make(map[string]bool)
+	var order []string
+	WalkDeps("main", func(pkg string) []string { return graph[pkg] }, func(pkg string) bool {
+		if visited[pkg] {
+			return true
+		}
+		visited[pkg] = true
+		order = append(order, pkg)
+		return false
+	})
+	want := []string{"main", "strings", "unicode", "fmt", "os"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("got %v, want %v", order, want)
+	}
+	roots := SandboxRoots([]string{"fmt"}, []Entry{{Name: "os", Perm: R_VAL}})
+	if want := append([]string{"fmt", "os"}, ExtraDependencies...); !reflect.DeepEqual(roots, want) {
+		t.Errorf("got roots %v, want %v", roots, want)
+	}
+}
@@ -0,0 +1,199 @@
+package commons
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// This file defines the policy files that tighten the sandboxes of a binary
+// per deployment, without recompiling it. A policy file maps sandbox ids to
+// a memory view and syscall classes in the sandbox configuration grammar:
+//
+//	{
+//		"main.main#render": {"mem": "main:R,self:heap=1M", "sys": "file=/srv/templates"},
+//		"main.serve#0": {"sys": "net=10.0.0.1:443"}
+//	}
+//
+// A missing field keeps the compiled configuration. A policy never widens a
+// sandbox: every entry of its memory view names a package of the sandbox with
+// a subset of the compiled rights, quotas can only be lowered, and its syscall
+// classes and constraints must be allowed by the compiled ones. Packages that
+// the policy does not name keep their rights.
+//
+// The toolchain depends on this package, which therefore does not decode the
+// files: the linker and package gosb unmarshal them into a map[SandId]Policy.
+
+// Policy restricts the configuration of a sandbox.
+type Policy struct {
+	Mem *string `json:"mem,omitempty"`
+	Sys *string `json:"sys,omitempty"`
+}
+
+// CheckPolicies checks the configurations of a decoded policy file.
+func CheckPolicies(pols map[SandId]Policy) error {
+	for id, p := range pols {
+		if p.Mem != nil {
+			if _, _, err := ParseSandboxView(*p.Mem); err != nil {
+				return fmt.Errorf("invalid memory view for %v: %v", id, err)
+			}
+			if q, _ := ParseQuota(*p.Mem); q.Warm != 0 {
+				return fmt.Errorf("policy for %v cannot set warm copies", id)
+			}
+		}
+		if p.Sys != nil {
+			if _, err := ParseSyscalls(*p.Sys); err != nil {
+				return fmt.Errorf("invalid syscalls for %v: %v", id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyPolicies restricts the domains with pols. The ids of the domains can
+// be quoted, as in the object files. It fails if a policy names an unknown
+// sandbox or widens one.
+func ApplyPolicies(domains []*SandboxDomain, pols map[SandId]Policy) error {
+	seen := make(map[SandId]bool)
+	for _, d := range domains {
+		id := d.Id
+		if nid, err := strconv.Unquote(id); err == nil {
+			id = nid
+		}
+		p, ok := pols[id]
+		if !ok {
+			continue
+		}
+		if err := d.Restrict(&p); err != nil {
+			return fmt.Errorf("policy for %v: %v", id, err)
+		}
+		seen[id] = true
+	}
+	unknown := make([]string, 0)
+	for id := range pols {
+		if !seen[id] {
+			unknown = append(unknown, id)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("policy for unknown sandboxes %v", unknown)
+	}
+	return nil
+}
+
+// Restrict tightens the configuration of d with p.
+func (d *SandboxDomain) Restrict(p *Policy) error {
+	if d.Id == TrustedSandboxId {
+		return fmt.Errorf("cannot restrict the trusted domain")
+	}
+	if p.Mem != nil {
+		if err := d.restrictMemory(*p.Mem); err != nil {
+			return err
+		}
+	}
+	if p.Sys != nil {
+		if err := d.restrictSyscalls(*p.Sys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restrictMemory applies the memory view mem to d.
+func (d *SandboxDomain) restrictMemory(mem string) error {
+	view, pristine, err := ParseSandboxView(mem)
+	if err != nil {
+		return err
+	}
+	q, err := ParseQuota(mem)
+	if err != nil {
+		return err
+	}
+	pkgs := make(map[string]bool)
+	for _, p := range d.Pkgs {
+		pkgs[p] = true
+	}
+	const rights = R_VAL | W_VAL | X_VAL
+	res := make(map[string]uint8)
+	for _, e := range view {
+		if !pkgs[e.Name] {
+			return fmt.Errorf("package %v is not part of the sandbox", e.Name)
+		}
+		compiled := rights
+		if perm, ok := d.View[e.Name]; ok {
+			compiled = perm & rights
+		}
+		if e.Perm&^compiled != 0 {
+			return fmt.Errorf("rights %v on %v exceed the compiled %v",
+				PermString(e.Perm), e.Name, PermString(compiled))
+		}
+		res[e.Name] = e.Perm
+	}
+	quota := d.Quota
+	if q.Heap != 0 {
+		if d.Quota.Heap != 0 && q.Heap > d.Quota.Heap {
+			return fmt.Errorf("heap quota %v exceeds the compiled %v", q.Heap, d.Quota.Heap)
+		}
+		quota.Heap = q.Heap
+	}
+	if q.Copies != 0 {
+		if d.Quota.Copies != 0 && q.Copies > d.Quota.Copies {
+			return fmt.Errorf("copies quota %v exceeds the compiled %v", q.Copies, d.Quota.Copies)
+		}
+		quota.Copies = q.Copies
+	}
+	if err := quota.validate(); err != nil {
+		return err
+	}
+
+	if d.View == nil {
+		d.View = make(map[string]uint8)
+	}
+	for k, v := range res {
+		d.View[k] = v
+	}
+	d.Quota = quota
+	d.Pristine = d.Pristine || pristine
+	return nil
+}
+
+// restrictSyscalls applies the syscall classes sys to d.
+func (d *SandboxDomain) restrictSyscalls(sys string) error {
+	mask, args, err := parseSyscallPolicy(sys)
+	if err != nil {
+		return err
+	}
+	if extra := mask &^ d.Sys; extra != 0 {
+		return fmt.Errorf("syscalls %v exceed the compiled %v",
+			SyscallPolicyString(mask, args), SyscallPolicyString(d.Sys, d.Args))
+	}
+	if d.Args.Paths != nil && mask&FILE_VAL != 0 {
+		for _, p := range args.Paths {
+			if !prefixAllowed(d.Args.Paths, p) {
+				return fmt.Errorf("path prefix %v is not allowed by the compiled %v", p, d.Args.Paths)
+			}
+		}
+	}
+	if d.Args.Addrs != nil && mask&NET_VAL != 0 {
+		for _, a := range args.Addrs {
+			if !d.Args.addrAllowed(a) {
+				return fmt.Errorf("address %v is not allowed by the compiled %v", a, d.Args.Addrs)
+			}
+		}
+	}
+	d.Sys = mask
+	d.Args = d.Args.Intersect(&args)
+	return nil
+}
+
+// addrAllowed reports whether a is one of Addrs, a port 0 in a only matches
+// a port 0.
+func (a *SyscallArgs) addrAllowed(x SockAddr) bool {
+	for _, y := range a.Addrs {
+		if x.IP == y.IP && (y.Port == 0 || x.Port == y.Port) {
+			return true
+		}
+	}
+	return false
+}
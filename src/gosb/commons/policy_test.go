@@ -0,0 +1,148 @@
+package commons
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// parsePolicies decodes and checks a policy file, as the linker does.
+func parsePolicies(data []byte) (map[SandId]Policy, error) {
+	var pols map[SandId]Policy
+	if err := json.Unmarshal(data, &pols); err != nil {
+		return nil, err
+	}
+	return pols, CheckPolicies(pols)
+}
+
+func testDomain(mem, sys string) *SandboxDomain {
+	view, pristine, err := ParseSandboxView(mem)
+	if err != nil {
+		panic(err)
+	}
+	d := &SandboxDomain{
+		Id:       "\"main.main#0\"",
+		Func:     "main.main.func1",
+		View:     make(map[string]uint8),
+		Pkgs:     []string{"main", "fmt", "strings"},
+		Pristine: pristine,
+	}
+	for _, e := range view {
+		d.View[e.Name] = e.Perm
+	}
+	d.Quota, _ = ParseQuota(mem)
+	d.Sys, _ = ParseSyscalls(sys)
+	d.Args, _ = ParseSyscallArgs(sys)
+	return d
+}
+
+func TestRestrict(t *testing.T) {
+	str := func(s string) *string { return &s }
+	correct := []struct {
+		mem, sys string
+		pol      Policy
+		view     map[string]uint8
+		pristine bool
+		quota    Quota
+		policy   string
+	}{
+		{"", "", Policy{}, map[string]uint8{}, false, Quota{}, ""},
+		{"main:RW", "file,net", Policy{Mem: str("main:R,fmt:U")},
+			map[string]uint8{"main": R_VAL, "fmt": U_VAL}, false, Quota{}, "file,net"},
+		{"main:R", "", Policy{Mem: str("self:P,self:heap=1M,self:copies=2")},
+			map[string]uint8{"main": R_VAL}, true, Quota{Heap: 1 << 20, Copies: 2}, ""},
+		{"self:heap=2M", "", Policy{Mem: str("self:heap=1M")},
+			map[string]uint8{}, false, Quota{Heap: 1 << 20}, ""},
+		{"", "file,net,time", Policy{Sys: str("file=/tmp,time")},
+			map[string]uint8{}, false, Quota{}, "time,file=/tmp"},
+		{"", "file=/srv", Policy{Sys: str("file=/srv/templates")},
+			map[string]uint8{}, false, Quota{}, "file=/srv/templates"},
+		{"", "file=/srv,net=10.0.0.1", Policy{Sys: str("file,net=10.0.0.1:443")},
+			map[string]uint8{}, false, Quota{}, "file=/srv,net=10.0.0.1:443"},
+		{"", "all", Policy{Sys: str("")}, map[string]uint8{}, false, Quota{}, ""},
+	}
+	for _, c := range correct {
+		d := testDomain(c.mem, c.sys)
+		if err := d.Restrict(&c.pol); err != nil {
+			t.Errorf("%q %q: unexpected error %v", c.mem, c.sys, err)
+			continue
+		}
+		if !reflect.DeepEqual(d.View, c.view) {
+			t.Errorf("%q %q: got view %v; want %v", c.mem, c.sys, d.View, c.view)
+		}
+		if d.Pristine != c.pristine || d.Quota != c.quota {
+			t.Errorf("%q %q: got %v %+v; want %v %+v", c.mem, c.sys, d.Pristine, d.Quota, c.pristine, c.quota)
+		}
+		if got := SyscallPolicyString(d.Sys, d.Args); got != c.policy {
+			t.Errorf("%q %q: got syscalls %q; want %q", c.mem, c.sys, got, c.policy)
+		}
+	}
+
+	incorrect := []struct {
+		mem, sys string
+		pol      Policy
+	}{
+		{"main:R", "", Policy{Mem: str("main:RW")}},
+		{"main:U", "", Policy{Mem: str("main:R")}},
+		{"", "", Policy{Mem: str("os:R")}},
+		{"self:heap=1M", "", Policy{Mem: str("self:heap=2M")}},
+		{"self:copies=2", "", Policy{Mem: str("self:copies=3")}},
+		{"self:copies=4,self:warm=2", "", Policy{Mem: str("self:copies=1")}},
+		{"", "file", Policy{Sys: str("file,net")}},
+		{"", "file=/srv", Policy{Sys: str("file=/tmp")}},
+		{"", "file=/srv", Policy{Sys: str("file=/")}},
+		{"", "net=10.0.0.1:443", Policy{Sys: str("net=10.0.0.1")}},
+		{"", "net=10.0.0.1", Policy{Sys: str("net=10.0.0.2")}},
+	}
+	for _, c := range incorrect {
+		d := testDomain(c.mem, c.sys)
+		if err := d.Restrict(&c.pol); err == nil {
+			t.Errorf("%q %q %v: missing error", c.mem, c.sys, c.pol)
+		}
+	}
+}
+
+func TestApplyPolicies(t *testing.T) {
+	pols, err := parsePolicies([]byte(`{"main.main#0": {"mem": "main:R", "sys": ""}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := testDomain("", "file")
+	trusted := &SandboxDomain{Id: TrustedSandboxId, Func: TrustedSandboxId}
+	if err := ApplyPolicies([]*SandboxDomain{d, trusted}, pols); err != nil {
+		t.Fatal(err)
+	}
+	if d.View["main"] != R_VAL || d.Sys != RUNTIME_VAL {
+		t.Errorf("got view %v and syscalls %#x", d.View, d.Sys)
+	}
+
+	for _, c := range []struct {
+		policy string
+		err    string
+	}{
+		{`{"main.main#1": {"mem": "main:R"}}`, "unknown sandboxes [main.main#1]"},
+		{`{"-1": {"mem": ""}}`, "trusted domain"},
+	} {
+		pols, err := parsePolicies([]byte(c.policy))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := testDomain("", "")
+		err = ApplyPolicies([]*SandboxDomain{d, trusted}, pols)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%v: got error %v; want %q", c.policy, err, c.err)
+		}
+	}
+
+	for _, policy := range []string{
+		`["main.main#0"]`,
+		`{"main.main#0": {"mem": "main:Z"}}`,
+		`{"main.main#0": {"mem": "self:copies=2,self:warm=1"}}`,
+		`{"main.main#0": {"sys": "nett"}}`,
+	} {
+		if _, err := parsePolicies([]byte(policy)); err == nil {
+			t.Errorf("%v: missing error", policy)
+		}
+	}
+}
@@ -1,8 +1,167 @@
 package commons
 
+import (
+	"strings"
+)
+
+// This file defines the syscall classes that can be whitelisted for a sandbox,
+// i.e., the second string in sandbox["main:R", "file,net"].
+// The grammar is:
+// config := class1,class2,... // separated by commas
+// class := file | net | mem | time | proc | signal | all
+//	| file=prefix | net=address // see sysargs.go
+//
+// Each class is a bit in the SyscallMask. A sandbox is always allowed to
+// perform the system calls required by the go runtime (see runtimeSyscalls),
+// and the ones the runtime performs depending on their arguments, e.g.,
+// writes to stdout and stderr (see RuntimeSyscall).
+// The syscalls of each class are listed in seccomp_linux_amd64.go, the only
+// platform the backends support.
+
 type SyscallMask = uint64
 
-func ParseSyscalls(s string) (SyscallMask, error) {
-	//TODO(aghosn) implement.
-	return 0, nil
+const (
+	DELIMITER_SYSCALLS = ","
+
+	// Syscall classes
+	SYS_FILE   = "file"
+	SYS_NET    = "net"
+	SYS_MEM    = "mem"
+	SYS_TIME   = "time"
+	SYS_PROC   = "proc"
+	SYS_SIGNAL = "signal"
+	SYS_ALL    = "all"
+
+	// Upper bound on syscall numbers we track.
+	MaxSyscallNumber = 512
+)
+
+const (
+	FILE_VAL   = SyscallMask(1 << 0)
+	NET_VAL    = SyscallMask(1 << 1)
+	MEM_VAL    = SyscallMask(1 << 2)
+	TIME_VAL   = SyscallMask(1 << 3)
+	PROC_VAL   = SyscallMask(1 << 4)
+	SIGNAL_VAL = SyscallMask(1 << 5)
+	// Implicit class for the go runtime, cannot be named in a configuration.
+	RUNTIME_VAL = SyscallMask(1 << 63)
+	ALL_VAL     = FILE_VAL | NET_VAL | MEM_VAL | TIME_VAL | PROC_VAL | SIGNAL_VAL
+)
+
+var (
+	SyscallClasses = map[string]SyscallMask{
+		SYS_FILE:   FILE_VAL,
+		SYS_NET:    NET_VAL,
+		SYS_MEM:    MEM_VAL,
+		SYS_TIME:   TIME_VAL,
+		SYS_PROC:   PROC_VAL,
+		SYS_SIGNAL: SIGNAL_VAL,
+		SYS_ALL:    ALL_VAL,
+	}
+
+	// classOrder is the order in which classes are printed.
+	classOrder = []string{SYS_FILE, SYS_NET, SYS_MEM, SYS_TIME, SYS_PROC, SYS_SIGNAL}
+
+	// syscallToClasses maps a syscall number to the classes that allow it.
+	syscallToClasses [MaxSyscallNumber]SyscallMask
+)
+
+func init() {
+	register := func(class SyscallMask, nrs []uintptr) {
+		for _, nr := range nrs {
+			syscallToClasses[nr] |= class
+		}
+	}
+	register(FILE_VAL, fileSyscalls)
+	register(NET_VAL, netSyscalls)
+	register(MEM_VAL, memSyscalls)
+	register(TIME_VAL, timeSyscalls)
+	register(PROC_VAL, procSyscalls)
+	register(SIGNAL_VAL, signalSyscalls)
+	register(RUNTIME_VAL, runtimeSyscalls)
+}
+
+// ParseSyscalls translates a comma separated list of syscall classes into
+// a SyscallMask. Unknown or duplicated classes are rejected. A constrained
+// class, e.g., file=/tmp, allows the class (see ParseSyscallArgs).
+func ParseSyscalls(sysc string) (SyscallMask, error) {
+	mask, _, err := parseSyscallPolicy(sysc)
+	return mask, err
+}
+
+// SyscallAllowed checks whether the syscall nr is part of the mask.
+//
+//go:nosplit
+func SyscallAllowed(mask SyscallMask, nr uint64) bool {
+	if nr >= MaxSyscallNumber {
+		return false
+	}
+	return syscallToClasses[nr]&mask != 0
+}
+
+// RuntimeMemory reports whether the runtime owns [addr, addr+size) and no
+// object uses it, e.g., heap pages that the runtime maps or releases. Package
+// gosb sets it, the memory syscalls of the runtime are denied without it.
+var RuntimeMemory func(addr, size uintptr) bool
+
+// RuntimeSyscall checks whether the syscall nr, with args, is one that the
+// runtime performs for any goroutine, and that the runtime class allows
+// depending on its arguments: a write to stdout or stderr, e.g., to print a
+// panic, a non-executable anonymous mapping, e.g., to grow the heap, or
+// releasing memory with munmap and the advices of the runtime. A mapping at
+// a fixed address, munmap and the advices that discard memory are limited to
+// RuntimeMemory. The mem class allows the others.
+//
+//go:nosplit
+func RuntimeSyscall(nr uint64, args *[6]uintptr) bool {
+	switch nr {
+	case sysWrite:
+		return args[0] == 1 || args[0] == 2
+	case sysMmap:
+		if args[3]&mapAnonymous == 0 || args[2]&protExec != 0 {
+			return false
+		}
+		// A fixed mapping replaces the pages at its address.
+		return args[3]&mapFixed == 0 || runtimeMemory(args[0], args[1])
+	case sysMunmap:
+		return runtimeMemory(args[0], args[1])
+	case sysMadvise:
+		switch args[2] {
+		case madvHugepage, madvNohugepage:
+			return true
+		case madvDontneed, madvFree:
+			return runtimeMemory(args[0], args[1])
+		}
+	}
+	return false
+}
+
+//go:nosplit
+func runtimeMemory(addr, size uintptr) bool {
+	return RuntimeMemory != nil && addr+size > addr && RuntimeMemory(addr, size)
+}
+
+// SyscallClassesOf returns the classes that allow the syscall nr.
+//
+//go:nosplit
+func SyscallClassesOf(nr uint64) SyscallMask {
+	if nr >= MaxSyscallNumber {
+		return 0
+	}
+	return syscallToClasses[nr]
+}
+
+// SyscallString formats the mask as a list of syscall classes that can be
+// parsed by ParseSyscalls. The implicit runtime class is omitted.
+func SyscallString(mask SyscallMask) string {
+	if mask&ALL_VAL == ALL_VAL {
+		return SYS_ALL
+	}
+	names := make([]string, 0, len(classOrder))
+	for _, name := range classOrder {
+		if mask&SyscallClasses[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, DELIMITER_SYSCALLS)
 }
@@ -0,0 +1,98 @@
+package commons
+
+import (
+	sc "syscall"
+)
+
+// The syscalls of each class, see seccomp.go.
+
+const (
+	sysWrite   = sc.SYS_WRITE
+	sysMmap    = sc.SYS_MMAP
+	sysMunmap  = sc.SYS_MUNMAP
+	sysMadvise = sc.SYS_MADVISE
+
+	mapAnonymous = sc.MAP_ANONYMOUS
+	mapFixed     = sc.MAP_FIXED
+	protExec     = sc.PROT_EXEC
+
+	madvDontneed   = sc.MADV_DONTNEED
+	madvFree       = 8
+	madvHugepage   = sc.MADV_HUGEPAGE
+	madvNohugepage = sc.MADV_NOHUGEPAGE
+)
+
+var (
+	fileSyscalls = []uintptr{
+		sc.SYS_READ, sc.SYS_WRITE, sc.SYS_OPEN, sc.SYS_OPENAT, sc.SYS_CLOSE,
+		sc.SYS_STAT, sc.SYS_FSTAT, sc.SYS_LSTAT, sc.SYS_NEWFSTATAT, sc.SYS_LSEEK,
+		sc.SYS_PREAD64, sc.SYS_PWRITE64, sc.SYS_READV, sc.SYS_WRITEV,
+		sc.SYS_ACCESS, sc.SYS_FACCESSAT, sc.SYS_PIPE, sc.SYS_PIPE2, sc.SYS_DUP,
+		sc.SYS_DUP2, sc.SYS_DUP3, sc.SYS_FCNTL, sc.SYS_FLOCK, sc.SYS_FSYNC,
+		sc.SYS_FDATASYNC, sc.SYS_TRUNCATE, sc.SYS_FTRUNCATE, sc.SYS_GETDENTS,
+		sc.SYS_GETDENTS64, sc.SYS_GETCWD, sc.SYS_CHDIR, sc.SYS_FCHDIR,
+		sc.SYS_RENAME, sc.SYS_RENAMEAT, sc.SYS_MKDIR, sc.SYS_MKDIRAT,
+		sc.SYS_RMDIR, sc.SYS_CREAT, sc.SYS_LINK, sc.SYS_LINKAT, sc.SYS_UNLINK,
+		sc.SYS_UNLINKAT, sc.SYS_SYMLINK, sc.SYS_SYMLINKAT, sc.SYS_READLINK,
+		sc.SYS_READLINKAT, sc.SYS_CHMOD, sc.SYS_FCHMOD, sc.SYS_FCHMODAT,
+		sc.SYS_CHOWN, sc.SYS_FCHOWN, sc.SYS_LCHOWN, sc.SYS_FCHOWNAT,
+		sc.SYS_UMASK, sc.SYS_STATFS, sc.SYS_FSTATFS, sc.SYS_UTIMENSAT,
+		sc.SYS_IOCTL, sc.SYS_EPOLL_CREATE, sc.SYS_EPOLL_CREATE1,
+		sc.SYS_EPOLL_CTL, sc.SYS_EPOLL_WAIT, sc.SYS_EPOLL_PWAIT, sc.SYS_SELECT,
+		sc.SYS_PSELECT6, sc.SYS_POLL, sc.SYS_PPOLL, sc.SYS_SENDFILE,
+		sc.SYS_SPLICE, sc.SYS_TEE, sc.SYS_FADVISE64, sc.SYS_FALLOCATE,
+	}
+
+	netSyscalls = []uintptr{
+		sc.SYS_SOCKET, sc.SYS_SOCKETPAIR, sc.SYS_CONNECT, sc.SYS_ACCEPT,
+		sc.SYS_ACCEPT4, sc.SYS_BIND, sc.SYS_LISTEN, sc.SYS_SENDTO,
+		sc.SYS_RECVFROM, sc.SYS_SENDMSG, sc.SYS_RECVMSG,
+		sc.SYS_RECVMMSG, sc.SYS_SHUTDOWN, sc.SYS_GETSOCKNAME,
+		sc.SYS_GETPEERNAME, sc.SYS_GETSOCKOPT, sc.SYS_SETSOCKOPT,
+	}
+
+	memSyscalls = []uintptr{
+		sc.SYS_MMAP, sc.SYS_MUNMAP, sc.SYS_MPROTECT, sc.SYS_MREMAP,
+		sc.SYS_MADVISE, sc.SYS_BRK, sc.SYS_MSYNC, sc.SYS_MINCORE, sc.SYS_MLOCK,
+		sc.SYS_MUNLOCK, sc.SYS_MLOCKALL, sc.SYS_MUNLOCKALL,
+	}
+
+	timeSyscalls = []uintptr{
+		sc.SYS_CLOCK_GETTIME, sc.SYS_CLOCK_GETRES, sc.SYS_CLOCK_NANOSLEEP,
+		sc.SYS_GETTIMEOFDAY, sc.SYS_TIME, sc.SYS_NANOSLEEP, sc.SYS_TIMES,
+		sc.SYS_TIMER_CREATE, sc.SYS_TIMER_SETTIME, sc.SYS_TIMER_GETTIME,
+		sc.SYS_TIMER_GETOVERRUN, sc.SYS_TIMER_DELETE, sc.SYS_SETITIMER,
+		sc.SYS_GETITIMER, sc.SYS_ALARM, sc.SYS_TIMERFD_CREATE,
+		sc.SYS_TIMERFD_SETTIME, sc.SYS_TIMERFD_GETTIME,
+	}
+
+	procSyscalls = []uintptr{
+		sc.SYS_CLONE, sc.SYS_FORK, sc.SYS_VFORK, sc.SYS_EXECVE, sc.SYS_WAIT4,
+		sc.SYS_WAITID, sc.SYS_KILL, sc.SYS_GETPPID, sc.SYS_GETUID,
+		sc.SYS_GETEUID, sc.SYS_GETGID, sc.SYS_GETEGID, sc.SYS_GETGROUPS,
+		sc.SYS_SETUID, sc.SYS_SETGID, sc.SYS_SETSID, sc.SYS_SETPGID,
+		sc.SYS_GETPGID, sc.SYS_GETPGRP, sc.SYS_GETSID, sc.SYS_PRCTL,
+		sc.SYS_GETRLIMIT, sc.SYS_SETRLIMIT, sc.SYS_PRLIMIT64, sc.SYS_GETRUSAGE,
+		sc.SYS_UNAME, sc.SYS_SCHED_GETAFFINITY, sc.SYS_SCHED_SETAFFINITY,
+	}
+
+	signalSyscalls = []uintptr{
+		sc.SYS_RT_SIGACTION, sc.SYS_RT_SIGPENDING, sc.SYS_RT_SIGSUSPEND,
+		sc.SYS_RT_SIGTIMEDWAIT, sc.SYS_RT_SIGQUEUEINFO, sc.SYS_PAUSE,
+		sc.SYS_SIGNALFD, sc.SYS_SIGNALFD4,
+	}
+
+	// runtimeSyscalls are the system calls the go runtime performs on behalf
+	// of any goroutine, e.g., for scheduling, including the usleep and
+	// osyield backoffs and the netpoller, which the scheduler and the
+	// collector poll on the thread of a sandbox. The writes and the memory
+	// management of the runtime depend on their arguments, see
+	// RuntimeSyscall.
+	runtimeSyscalls = []uintptr{
+		sc.SYS_FUTEX, sc.SYS_SCHED_YIELD, sc.SYS_NANOSLEEP, sc.SYS_CLOCK_GETTIME,
+		sc.SYS_EPOLL_PWAIT,
+		sc.SYS_GETTID, sc.SYS_GETPID, sc.SYS_TGKILL, sc.SYS_TKILL,
+		sc.SYS_RT_SIGPROCMASK, sc.SYS_RT_SIGRETURN, sc.SYS_SIGALTSTACK,
+		sc.SYS_EXIT, sc.SYS_EXIT_GROUP,
+	}
+)
@@ -0,0 +1,91 @@
+package commons
+
+import (
+	sc "syscall"
+	"testing"
+)
+
+func TestSyscallAllowed(t *testing.T) {
+	mask, err := ParseSyscalls("file")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	allowed := []uint64{sc.SYS_OPENAT, sc.SYS_READ, sc.SYS_FUTEX}
+	denied := []uint64{sc.SYS_SOCKET, sc.SYS_CONNECT, sc.SYS_EXECVE, sc.SYS_MMAP, sc.SYS_MPROTECT, MaxSyscallNumber}
+	for _, nr := range allowed {
+		if !SyscallAllowed(mask, nr) {
+			t.Errorf("Syscall %v should be allowed\n", nr)
+		}
+	}
+	for _, nr := range denied {
+		if SyscallAllowed(mask, nr) {
+			t.Errorf("Syscall %v should not be allowed\n", nr)
+		}
+	}
+}
+
+func TestSyscallClassesOf(t *testing.T) {
+	if SyscallClassesOf(sc.SYS_CONNECT) != NET_VAL {
+		t.Errorf("Invalid classes for connect: %x\n", SyscallClassesOf(sc.SYS_CONNECT))
+	}
+}
+
+func TestRuntimeSyscall(t *testing.T) {
+	mask, err := ParseSyscalls("")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	for _, nr := range []uint64{sc.SYS_WRITE, sc.SYS_MMAP, sc.SYS_MUNMAP, sc.SYS_MADVISE} {
+		if SyscallAllowed(mask, nr) {
+			t.Errorf("Syscall %v should not be allowed without a class\n", nr)
+		}
+	}
+	for _, nr := range []uint64{sc.SYS_NANOSLEEP, sc.SYS_CLOCK_GETTIME, sc.SYS_SCHED_YIELD, sc.SYS_EPOLL_PWAIT} {
+		if !SyscallAllowed(mask, nr) {
+			t.Errorf("Syscall %v of the runtime should be allowed\n", nr)
+		}
+	}
+	for fd, want := range []bool{false, true, true, false} {
+		if res := RuntimeSyscall(sc.SYS_WRITE, &[6]uintptr{uintptr(fd)}); res != want {
+			t.Errorf("Invalid runtime write on fd %v: got %v\n", fd, res)
+		}
+	}
+	// The runtime owns [0x10000, 0x20000).
+	saved := RuntimeMemory
+	defer func() { RuntimeMemory = saved }()
+	RuntimeMemory = func(addr, size uintptr) bool {
+		return addr >= 0x10000 && addr+size <= 0x20000
+	}
+	tests := []struct {
+		nr   uint64
+		args [6]uintptr
+		want bool
+	}{
+		{sc.SYS_READ, [6]uintptr{1}, false},
+		{sc.SYS_MMAP, [6]uintptr{0, 4096, sc.PROT_READ | sc.PROT_WRITE, sc.MAP_ANONYMOUS | sc.MAP_PRIVATE}, true},
+		{sc.SYS_MMAP, [6]uintptr{0x10000, 4096, sc.PROT_READ | sc.PROT_WRITE, sc.MAP_ANONYMOUS | sc.MAP_PRIVATE | sc.MAP_FIXED}, true},
+		{sc.SYS_MMAP, [6]uintptr{0x1000, 4096, sc.PROT_NONE, sc.MAP_ANONYMOUS | sc.MAP_PRIVATE | sc.MAP_FIXED}, false},
+		{sc.SYS_MMAP, [6]uintptr{0x1f000, 8192, sc.PROT_NONE, sc.MAP_ANONYMOUS | sc.MAP_PRIVATE | sc.MAP_FIXED}, false},
+		{sc.SYS_MMAP, [6]uintptr{0, 4096, sc.PROT_READ | sc.PROT_EXEC, sc.MAP_ANONYMOUS | sc.MAP_PRIVATE}, false},
+		{sc.SYS_MMAP, [6]uintptr{0, 4096, sc.PROT_READ, sc.MAP_PRIVATE, 3}, false},
+		{sc.SYS_MUNMAP, [6]uintptr{0x10000, 4096}, true},
+		{sc.SYS_MUNMAP, [6]uintptr{0x1000, 4096}, false},
+		{sc.SYS_MUNMAP, [6]uintptr{0x10000, ^uintptr(0)}, false},
+		{sc.SYS_MADVISE, [6]uintptr{0x10000, 4096, sc.MADV_DONTNEED}, true},
+		{sc.SYS_MADVISE, [6]uintptr{0x10000, 4096, 8}, true},
+		{sc.SYS_MADVISE, [6]uintptr{0x1000, 4096, sc.MADV_DONTNEED}, false},
+		{sc.SYS_MADVISE, [6]uintptr{0x1000, 4096, 8}, false},
+		{sc.SYS_MADVISE, [6]uintptr{0x1000, 4096, sc.MADV_NOHUGEPAGE}, true},
+		{sc.SYS_MADVISE, [6]uintptr{0x1000, 4096, sc.MADV_DONTFORK}, false},
+		{sc.SYS_MPROTECT, [6]uintptr{0x1000, 4096, sc.PROT_EXEC}, false},
+	}
+	for _, tt := range tests {
+		if res := RuntimeSyscall(tt.nr, &tt.args); res != tt.want {
+			t.Errorf("Invalid runtime syscall %v %v: got %v\n", tt.nr, tt.args, res)
+		}
+	}
+	RuntimeMemory = nil
+	if RuntimeSyscall(sc.SYS_MUNMAP, &[6]uintptr{0x10000, 4096}) {
+		t.Errorf("munmap should be denied without RuntimeMemory\n")
+	}
+}
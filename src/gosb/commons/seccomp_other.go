@@ -0,0 +1,32 @@
+// +build !linux !amd64
+
+package commons
+
+// The backends only support linux/amd64, no syscall belongs to a class on
+// other platforms.
+
+// These are not syscall numbers.
+const (
+	sysWrite   = ^uint64(0)
+	sysMmap    = ^uint64(0) - 1
+	sysMunmap  = ^uint64(0) - 2
+	sysMadvise = ^uint64(0) - 3
+
+	mapAnonymous   = 0
+	mapFixed       = 0
+	protExec       = 0
+	madvDontneed   = 1
+	madvFree       = 2
+	madvHugepage   = 3
+	madvNohugepage = 4
+)
+
+var (
+	fileSyscalls    []uintptr
+	netSyscalls     []uintptr
+	memSyscalls     []uintptr
+	timeSyscalls    []uintptr
+	procSyscalls    []uintptr
+	signalSyscalls  []uintptr
+	runtimeSyscalls []uintptr
+)
@@ -0,0 +1,56 @@
+package commons
+
+import (
+	"testing"
+)
+
+func TestParseSyscalls(t *testing.T) {
+	correct := []struct {
+		s    string
+		want SyscallMask
+	}{
+		{"", RUNTIME_VAL},
+		{"\"\"", RUNTIME_VAL},
+		{"file", RUNTIME_VAL | FILE_VAL},
+		{"\"mem,net\"", RUNTIME_VAL | MEM_VAL | NET_VAL},
+		{"file, time ,signal", RUNTIME_VAL | FILE_VAL | TIME_VAL | SIGNAL_VAL},
+		{"proc", RUNTIME_VAL | PROC_VAL},
+		{"all", RUNTIME_VAL | ALL_VAL},
+	}
+	incorrect := []string{
+		",",
+		"file,",
+		"fil",
+		"file,file",
+		"runtime",
+		"\"net,disk\"",
+	}
+
+	for _, c := range correct {
+		res, err := ParseSyscalls(c.s)
+		if err != nil {
+			t.Errorf(err.Error())
+		}
+		if res != c.want {
+			t.Errorf("Invalid mask for %v: got %x expected %x\n", c.s, res, c.want)
+		}
+	}
+
+	for _, c := range incorrect {
+		if _, err := ParseSyscalls(c); err == nil {
+			t.Errorf("Failed to catch bad entry %v\n", c)
+		}
+	}
+}
+
+func TestSyscallString(t *testing.T) {
+	for _, s := range []string{"", "file", "file,net", "mem,time,signal", "all"} {
+		mask, err := ParseSyscalls(s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if res := SyscallString(mask); res != s {
+			t.Errorf("Invalid string for %v: got %v\n", s, res)
+		}
+	}
+}
@@ -10,6 +10,13 @@ const (
 const (
 	TrustedPkgName = "non-bloat"
 	StmpPkgName    = "shared-stmp"
+
+	// Id of the domain of the non-bloated packages.
+	TrustedSandboxId = "-1"
+
+	// PkgIdSym is the variable of each package that holds its id, which the
+	// allocation sites pass to the runtime. The linker sets it.
+	PkgIdSym = ".gosbpkgid"
 )
 
 var (
@@ -0,0 +1,490 @@
+package commons
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// This file defines the constraints on the arguments of the system calls
+// of a sandbox, e.g., sandbox["", "file=/srv/templates,net=10.0.0.1:443"].
+// The grammar extends the syscall classes:
+// class := ... || file=prefix || net=address
+// address := ipv4 || ipv4:port || ipv6 || [ipv6]:port
+//
+// A constrained class is whitelisted, but the syscalls that name a path,
+// execve included, can only name paths under one of the prefixes, and
+// connect, sendto and sendmsg can only reach one of the addresses. Prefixes
+// are absolute and clean. They are matched lexically: the paths must be
+// absolute and cannot contain "..". Symbolic links under a prefix are
+// followed by the kernel. The VTX and MPK backends enforce the constraints.
+
+const (
+	DELIMITER_ARG = "="
+
+	// Sizes of the arguments copied by CheckArgs.
+	PathMax     = 4096
+	SockaddrMax = 128
+	msghdrSize  = 56
+)
+
+// SockAddr is an address that a sandbox can reach. IPv4 addresses are
+// IPv4-mapped IPv6 addresses, Port 0 matches any port.
+type SockAddr struct {
+	IP   [16]byte
+	Port uint16
+}
+
+// SyscallArgs constrains the arguments of the syscalls of a sandbox.
+// A nil field is unconstrained, an empty one denies the syscalls.
+type SyscallArgs struct {
+	Paths []string
+	Addrs []SockAddr
+}
+
+// ArgBuf holds the copies of the checked arguments of a syscall.
+type ArgBuf struct {
+	Path [2][PathMax]byte
+	Addr [SockaddrMax]byte
+	Msg  [msghdrSize]byte
+}
+
+// ArgReader copies the bytes of the sandbox at addr into dst, and returns
+// the number of bytes it copied. It copies less than len(dst) bytes if the
+// sandbox cannot read them.
+type ArgReader func(ctx uintptr, dst []byte, addr uintptr) int
+
+var (
+	// pathSyscalls are the positions, plus one, of the path arguments of
+	// each syscall, 0 if none. See sysargs_linux_amd64.go.
+	pathSyscalls [MaxSyscallNumber][2]int8
+
+	v4InV6Prefix = [12]byte{10: 0xff, 11: 0xff}
+)
+
+// ParseSyscallArgs returns the constraints declared in a syscall
+// configuration.
+func ParseSyscallArgs(sysc string) (SyscallArgs, error) {
+	_, args, err := parseSyscallPolicy(sysc)
+	return args, err
+}
+
+// parseSyscallPolicy parses the classes and the constraints of a syscall
+// configuration.
+func parseSyscallPolicy(sysc string) (SyscallMask, SyscallArgs, error) {
+	args := SyscallArgs{}
+	sys, err := strconv.Unquote(sysc)
+	if err != nil {
+		sys = sysc
+	}
+	mask := RUNTIME_VAL
+	if len(strings.TrimSpace(sys)) == 0 {
+		return mask, args, nil
+	}
+	uniq := make(map[string]bool)
+	plain := SyscallMask(0)
+	for _, v := range strings.Split(sys, DELIMITER_SYSCALLS) {
+		entry := strings.TrimSpace(v)
+		if len(entry) == 0 {
+			return 0, args, fmt.Errorf("Empty syscall class in %v\n", sys)
+		}
+		if _, ok := uniq[entry]; ok {
+			return 0, args, fmt.Errorf("Duplicated syscall class %v\n", entry)
+		}
+		uniq[entry] = true
+		if strings.Contains(entry, DELIMITER_ARG) {
+			class, err := parseSyscallArg(entry, &args)
+			if err != nil {
+				return 0, args, err
+			}
+			mask |= class
+			continue
+		}
+		class, ok := SyscallClasses[entry]
+		if !ok {
+			return 0, args, fmt.Errorf("Unknown syscall class %v\n", entry)
+		}
+		mask |= class
+		plain |= class
+	}
+	if (args.Paths != nil && plain&FILE_VAL != 0) || (args.Addrs != nil && plain&NET_VAL != 0) {
+		return 0, args, fmt.Errorf("Syscall class both constrained and unconstrained in %v\n", sys)
+	}
+	return mask, args, nil
+}
+
+// parseSyscallArg parses class=constraint into args, and returns the class.
+func parseSyscallArg(entry string, args *SyscallArgs) (SyscallMask, error) {
+	split := strings.SplitN(entry, DELIMITER_ARG, 2)
+	class, value := strings.TrimSpace(split[0]), strings.TrimSpace(split[1])
+	switch class {
+	case SYS_FILE:
+		if len(value) == 0 || value[0] != '/' || path.Clean(value) != value {
+			return 0, fmt.Errorf("Invalid path prefix %v: expected a clean absolute path\n", value)
+		}
+		if len(value) >= PathMax {
+			return 0, fmt.Errorf("Path prefix too long %v\n", value)
+		}
+		args.Paths = append(args.Paths, value)
+		return FILE_VAL, nil
+	case SYS_NET:
+		addr, err := parseSockAddr(value)
+		if err != nil {
+			return 0, err
+		}
+		args.Addrs = append(args.Addrs, addr)
+		return NET_VAL, nil
+	}
+	return 0, fmt.Errorf("Syscall class %v cannot be constrained\n", class)
+}
+
+// parseSockAddr parses an IP address with an optional port.
+func parseSockAddr(value string) (SockAddr, error) {
+	addr := SockAddr{}
+	host, port := value, ""
+	if strings.HasPrefix(value, "[") {
+		end := strings.Index(value, "]")
+		if end == -1 || (end != len(value)-1 && value[end+1] != ':') {
+			return addr, fmt.Errorf("Invalid address %v\n", value)
+		}
+		host = value[1:end]
+		if end != len(value)-1 {
+			port = value[end+2:]
+		}
+	} else if strings.Count(value, ":") == 1 {
+		i := strings.Index(value, ":")
+		host, port = value[:i], value[i+1:]
+	}
+	ok := false
+	if strings.Contains(host, ":") {
+		addr.IP, ok = parseIPv6(host)
+	} else {
+		copy(addr.IP[:], v4InV6Prefix[:])
+		ok = parseIPv4(host, addr.IP[12:])
+	}
+	if !ok {
+		return addr, fmt.Errorf("Invalid IP address %v\n", host)
+	}
+	if port != "" {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return addr, fmt.Errorf("Invalid port %v\n", port)
+		}
+		addr.Port = uint16(p)
+	}
+	return addr, nil
+}
+
+// parseIPv4 parses a dotted IPv4 address into ip.
+func parseIPv4(s string, ip []byte) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return false
+	}
+	for i, p := range parts {
+		n, err := strconv.ParseUint(p, 10, 8)
+		if err != nil || (len(p) > 1 && p[0] == '0') {
+			return false
+		}
+		ip[i] = byte(n)
+	}
+	return true
+}
+
+// parseIPv6 parses an IPv6 address made of hexadecimal groups.
+func parseIPv6(s string) ([16]byte, bool) {
+	var ip [16]byte
+	head, tail := s, ""
+	elided := strings.Contains(s, "::")
+	if elided {
+		split := strings.SplitN(s, "::", 2)
+		head, tail = split[0], split[1]
+	}
+	groups := func(s string) ([]uint16, bool) {
+		if s == "" {
+			return nil, true
+		}
+		var res []uint16
+		for _, g := range strings.Split(s, ":") {
+			n, err := strconv.ParseUint(g, 16, 16)
+			if err != nil || len(g) > 4 {
+				return nil, false
+			}
+			res = append(res, uint16(n))
+		}
+		return res, true
+	}
+	h, ok := groups(head)
+	t, ok1 := groups(tail)
+	if !ok || !ok1 || len(h)+len(t) > 8 || (!elided && len(h) != 8) || (elided && len(h)+len(t) == 8) {
+		return ip, false
+	}
+	for i, g := range h {
+		ip[2*i], ip[2*i+1] = byte(g>>8), byte(g)
+	}
+	for i, g := range t {
+		j := 8 - len(t) + i
+		ip[2*j], ip[2*j+1] = byte(g>>8), byte(g)
+	}
+	return ip, true
+}
+
+// SyscallPolicyString formats the classes and the constraints of a sandbox
+// as a configuration that can be parsed by ParseSyscalls.
+func SyscallPolicyString(mask SyscallMask, args SyscallArgs) string {
+	if args.Paths != nil {
+		mask &^= FILE_VAL
+	}
+	if args.Addrs != nil {
+		mask &^= NET_VAL
+	}
+	var entries []string
+	if classes := SyscallString(mask); classes != "" {
+		entries = append(entries, classes)
+	}
+	for _, p := range args.Paths {
+		entries = append(entries, SYS_FILE+DELIMITER_ARG+p)
+	}
+	for _, a := range args.Addrs {
+		entries = append(entries, SYS_NET+DELIMITER_ARG+a.String())
+	}
+	return strings.Join(entries, DELIMITER_SYSCALLS)
+}
+
+// CanonicalSyscalls formats the syscall configuration sysc with its classes
+// and constraints sorted, such that equivalent configurations have the same
+// canonical form. Invalid configurations are returned unchanged.
+func CanonicalSyscalls(sysc string) string {
+	mask, args, err := parseSyscallPolicy(sysc)
+	if err != nil {
+		return sysc
+	}
+	paths := append([]string(nil), args.Paths...)
+	sort.Strings(paths)
+	addrs := append([]SockAddr(nil), args.Addrs...)
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].String() < addrs[j].String() })
+	return SyscallPolicyString(mask, SyscallArgs{paths, addrs})
+}
+
+// String formats the address as it appears in a configuration.
+func (a SockAddr) String() string {
+	var host string
+	if string(a.IP[:12]) == string(v4InV6Prefix[:]) {
+		host = fmt.Sprintf("%d.%d.%d.%d", a.IP[12], a.IP[13], a.IP[14], a.IP[15])
+		if a.Port != 0 {
+			return fmt.Sprintf("%v:%d", host, a.Port)
+		}
+		return host
+	}
+	groups := make([]string, 8)
+	for i := range groups {
+		groups[i] = strconv.FormatUint(uint64(a.IP[2*i])<<8|uint64(a.IP[2*i+1]), 16)
+	}
+	host = strings.Join(groups, ":")
+	if a.Port != 0 {
+		return fmt.Sprintf("[%v]:%d", host, a.Port)
+	}
+	return host
+}
+
+// Intersect returns the constraints that satisfy both a and b, e.g., for
+// a sandbox nested in another one.
+func (a *SyscallArgs) Intersect(b *SyscallArgs) SyscallArgs {
+	res := SyscallArgs{Paths: a.Paths, Addrs: a.Addrs}
+	if a.Paths == nil {
+		res.Paths = b.Paths
+	} else if b.Paths != nil {
+		res.Paths = make([]string, 0)
+		for _, p := range a.Paths {
+			if prefixAllowed(b.Paths, p) {
+				res.Paths = append(res.Paths, p)
+			}
+		}
+		for _, p := range b.Paths {
+			if prefixAllowed(a.Paths, p) && !prefixAllowed(res.Paths, p) {
+				res.Paths = append(res.Paths, p)
+			}
+		}
+	}
+	if a.Addrs == nil {
+		res.Addrs = b.Addrs
+	} else if b.Addrs != nil {
+		res.Addrs = make([]SockAddr, 0)
+		for _, x := range a.Addrs {
+			for _, y := range b.Addrs {
+				if x.IP != y.IP || (x.Port != 0 && y.Port != 0 && x.Port != y.Port) {
+					continue
+				}
+				if x.Port == 0 {
+					x.Port = y.Port
+				}
+				res.Addrs = append(res.Addrs, x)
+			}
+		}
+	}
+	return res
+}
+
+// Constrains reports whether the arguments of syscall nr are checked.
+//
+//go:nosplit
+func (a *SyscallArgs) Constrains(nr uint64) bool {
+	if nr >= MaxSyscallNumber {
+		return false
+	}
+	if a.Paths != nil && pathSyscalls[nr][0] != 0 {
+		return true
+	}
+	return a.Addrs != nil && (nr == sysConnect || nr == sysSendto || nr == sysSendmsg)
+}
+
+// CheckArgs checks the arguments of syscall nr against the constraints. The
+// memory it checks is copied into buf with read, and the arguments point to
+// the copies once it returns, which the sandbox cannot modify.
+//
+//go:nosplit
+func (a *SyscallArgs) CheckArgs(nr uint64, args *[6]uintptr, buf *ArgBuf, read ArgReader, ctx uintptr) bool {
+	if !a.Constrains(nr) {
+		return true
+	}
+	if a.Paths != nil {
+		for i, p := range pathSyscalls[nr] {
+			if p == 0 || args[p-1] == 0 {
+				continue
+			}
+			n := readString(buf.Path[i][:], args[p-1], read, ctx)
+			if n < 0 || !prefixAllowedBytes(a.Paths, buf.Path[i][:n]) {
+				return false
+			}
+			args[p-1] = uintptr(unsafe.Pointer(&buf.Path[i][0]))
+		}
+	}
+	if a.Addrs == nil {
+		return true
+	}
+	var addr, size *uintptr
+	var msgSize uintptr
+	switch nr {
+	case sysConnect:
+		addr, size = &args[1], &args[2]
+	case sysSendto:
+		addr, size = &args[4], &args[5]
+	case sysSendmsg:
+		if read(ctx, buf.Msg[:], args[1]) != msghdrSize {
+			return false
+		}
+		args[1] = uintptr(unsafe.Pointer(&buf.Msg[0]))
+		addr = (*uintptr)(unsafe.Pointer(&buf.Msg[0]))
+		msgSize = uintptr(*(*uint32)(unsafe.Pointer(&buf.Msg[8])))
+		size = &msgSize
+	default:
+		return true
+	}
+	if *addr == 0 {
+		// A connected socket, its address was checked by connect.
+		return nr != sysConnect
+	}
+	if *size > SockaddrMax || read(ctx, buf.Addr[:*size], *addr) != int(*size) {
+		return false
+	}
+	if !a.sockaddrAllowed(buf.Addr[:*size]) {
+		return false
+	}
+	*addr = uintptr(unsafe.Pointer(&buf.Addr[0]))
+	return true
+}
+
+// readString copies the NUL terminated string at addr into dst, and returns
+// its length, -1 if it does not fit or cannot be read.
+//
+//go:nosplit
+func readString(dst []byte, addr uintptr, read ArgReader, ctx uintptr) int {
+	n := 0
+	for n < len(dst) {
+		// Do not read across a page we might not be allowed to read.
+		chunk := int(_PageSize - (uint64(addr)+uint64(n))%_PageSize)
+		if n+chunk > len(dst) {
+			chunk = len(dst) - n
+		}
+		got := read(ctx, dst[n:n+chunk], addr+uintptr(n))
+		for i := n; i < n+got; i++ {
+			if dst[i] == 0 {
+				return i
+			}
+		}
+		if got != chunk {
+			return -1
+		}
+		n += chunk
+	}
+	return -1
+}
+
+// prefixAllowed reports whether the clean path p is under one of prefixes.
+func prefixAllowed(prefixes []string, p string) bool {
+	return prefixAllowedBytes(prefixes, []byte(p))
+}
+
+// prefixAllowedBytes reports whether p is an absolute path without ".."
+// under one of the prefixes.
+//
+//go:nosplit
+func prefixAllowedBytes(prefixes []string, p []byte) bool {
+	if len(p) == 0 || p[0] != '/' {
+		return false
+	}
+	for i := 0; i+1 < len(p); i++ {
+		if p[i] == '.' && p[i+1] == '.' && (i == 0 || p[i-1] == '/') && (i+2 == len(p) || p[i+2] == '/') {
+			return false
+		}
+	}
+	for _, prefix := range prefixes {
+		if len(p) < len(prefix) {
+			continue
+		}
+		match := true
+		for i := 0; i < len(prefix) && match; i++ {
+			match = p[i] == prefix[i]
+		}
+		if match && (len(p) == len(prefix) || prefix == "/" || p[len(prefix)] == '/') {
+			return true
+		}
+	}
+	return false
+}
+
+// sockaddrAllowed reports whether the socket address is one of Addrs.
+//
+//go:nosplit
+func (a *SyscallArgs) sockaddrAllowed(sa []byte) bool {
+	if len(sa) < 2 {
+		return false
+	}
+	var ip [16]byte
+	var port uint16
+	switch uint16(sa[0]) | uint16(sa[1])<<8 {
+	case afInet:
+		if len(sa) < 8 {
+			return false
+		}
+		copy(ip[:], v4InV6Prefix[:])
+		copy(ip[12:], sa[4:8])
+	case afInet6:
+		if len(sa) < 24 {
+			return false
+		}
+		copy(ip[:], sa[8:24])
+	default:
+		return false
+	}
+	port = uint16(sa[2])<<8 | uint16(sa[3])
+	for _, s := range a.Addrs {
+		if s.IP == ip && (s.Port == 0 || s.Port == port) {
+			return true
+		}
+	}
+	return false
+}
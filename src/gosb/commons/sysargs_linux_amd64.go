@@ -0,0 +1,40 @@
+package commons
+
+import (
+	sc "syscall"
+)
+
+const (
+	sysConnect = sc.SYS_CONNECT
+	sysSendto  = sc.SYS_SENDTO
+	sysSendmsg = sc.SYS_SENDMSG
+
+	afInet  = sc.AF_INET
+	afInet6 = sc.AF_INET6
+)
+
+// init fills pathSyscalls.
+func init() {
+	for _, nr := range []uintptr{
+		sc.SYS_OPEN, sc.SYS_CREAT, sc.SYS_STAT, sc.SYS_LSTAT, sc.SYS_ACCESS,
+		sc.SYS_TRUNCATE, sc.SYS_CHDIR, sc.SYS_MKDIR, sc.SYS_RMDIR,
+		sc.SYS_UNLINK, sc.SYS_READLINK, sc.SYS_CHMOD, sc.SYS_CHOWN,
+		sc.SYS_LCHOWN, sc.SYS_STATFS, sc.SYS_EXECVE,
+	} {
+		pathSyscalls[nr][0] = 1
+	}
+	for _, nr := range []uintptr{sc.SYS_RENAME, sc.SYS_LINK, sc.SYS_SYMLINK} {
+		pathSyscalls[nr] = [2]int8{1, 2}
+	}
+	for _, nr := range []uintptr{
+		sc.SYS_OPENAT, sc.SYS_NEWFSTATAT, sc.SYS_FACCESSAT, sc.SYS_MKDIRAT,
+		sc.SYS_UNLINKAT, sc.SYS_READLINKAT, sc.SYS_FCHMODAT, sc.SYS_FCHOWNAT,
+		sc.SYS_UTIMENSAT,
+	} {
+		pathSyscalls[nr][0] = 2
+	}
+	for _, nr := range []uintptr{sc.SYS_RENAMEAT, sc.SYS_LINKAT} {
+		pathSyscalls[nr] = [2]int8{2, 4}
+	}
+	pathSyscalls[sc.SYS_SYMLINKAT] = [2]int8{1, 3}
+}
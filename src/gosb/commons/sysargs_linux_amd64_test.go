@@ -0,0 +1,117 @@
+package commons
+
+import (
+	sc "syscall"
+	"testing"
+	"unsafe"
+)
+
+func readMem(ctx uintptr, dst []byte, addr uintptr) int {
+	n := 0
+	for n < len(dst) && (ctx == 0 || addr+uintptr(n) < ctx) {
+		dst[n] = *(*byte)(unsafe.Pointer(addr + uintptr(n)))
+		n++
+	}
+	return n
+}
+
+func cstring(s string) uintptr {
+	b := append([]byte(s), 0)
+	return uintptr(unsafe.Pointer(&b[0]))
+}
+
+func TestCheckPaths(t *testing.T) {
+	args, err := ParseSyscallArgs("file=/srv/templates,file=/tmp")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	allowed := []string{"/srv/templates", "/srv/templates/a.html", "/tmp/./x", "/tmp/..x"}
+	denied := []string{"/srv/templatesX", "/srv", "templates/a.html", "/tmp/../etc/passwd", "/tmp/..", ""}
+	buf := &ArgBuf{}
+	for _, p := range allowed {
+		regs := [6]uintptr{atFdcwd, cstring(p)}
+		if !args.CheckArgs(sc.SYS_OPENAT, &regs, buf, readMem, 0) {
+			t.Errorf("Path %v should be allowed\n", p)
+		}
+		if regs[1] != uintptr(unsafe.Pointer(&buf.Path[0][0])) {
+			t.Errorf("Path %v was not copied\n", p)
+		}
+	}
+	for _, p := range denied {
+		regs := [6]uintptr{atFdcwd, cstring(p)}
+		if args.CheckArgs(sc.SYS_OPENAT, &regs, buf, readMem, 0) {
+			t.Errorf("Path %v should be denied\n", p)
+		}
+	}
+	// Both paths of a rename are checked.
+	regs := [6]uintptr{cstring("/tmp/a"), cstring("/etc/a")}
+	if args.CheckArgs(sc.SYS_RENAME, &regs, buf, readMem, 0) {
+		t.Errorf("Rename outside of the prefixes should be denied\n")
+	}
+	// A path the sandbox cannot read entirely is denied.
+	p := cstring("/tmp/abc")
+	regs = [6]uintptr{p}
+	if args.CheckArgs(sc.SYS_OPEN, &regs, buf, readMem, p+4) {
+		t.Errorf("Unreadable path should be denied\n")
+	}
+	// Syscalls without paths are not constrained.
+	if args.Constrains(sc.SYS_READ) || args.Constrains(sc.SYS_CONNECT) || !args.Constrains(sc.SYS_UNLINKAT) {
+		t.Errorf("Invalid constrained syscalls\n")
+	}
+}
+
+func TestCheckAddrs(t *testing.T) {
+	args, err := ParseSyscallArgs("net=10.0.0.1:443,net=[::1]")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	in4 := func(ip [4]byte, port uint16) []byte {
+		sa := make([]byte, 16)
+		sa[0], sa[2], sa[3] = sc.AF_INET, byte(port>>8), byte(port)
+		copy(sa[4:], ip[:])
+		return sa
+	}
+	in6 := func(ip [16]byte, port uint16) []byte {
+		sa := make([]byte, 28)
+		sa[0], sa[2], sa[3] = sc.AF_INET6, byte(port>>8), byte(port)
+		copy(sa[8:], ip[:])
+		return sa
+	}
+	loopback6 := [16]byte{15: 1}
+	correct := []struct {
+		sa   []byte
+		want bool
+	}{
+		{in4([4]byte{10, 0, 0, 1}, 443), true},
+		{in4([4]byte{10, 0, 0, 1}, 80), false},
+		{in4([4]byte{10, 0, 0, 2}, 443), false},
+		{in6(loopback6, 80), true},
+		{in6(loopback6, 8080), true},
+		{in6([16]byte{15: 2}, 80), false},
+		{[]byte{sc.AF_UNIX, 0, '/', 't', 'm', 'p', 0}, false},
+	}
+	buf := &ArgBuf{}
+	for _, c := range correct {
+		regs := [6]uintptr{3, uintptr(unsafe.Pointer(&c.sa[0])), uintptr(len(c.sa))}
+		if res := args.CheckArgs(sc.SYS_CONNECT, &regs, buf, readMem, 0); res != c.want {
+			t.Errorf("Invalid check for connect to %v: got %v\n", c.sa, res)
+		}
+		regs = [6]uintptr{3, 0, 0, 0, uintptr(unsafe.Pointer(&c.sa[0])), uintptr(len(c.sa))}
+		if res := args.CheckArgs(sc.SYS_SENDTO, &regs, buf, readMem, 0); res != c.want {
+			t.Errorf("Invalid check for sendto to %v: got %v\n", c.sa, res)
+		}
+		msg := sc.Msghdr{Name: &c.sa[0], Namelen: uint32(len(c.sa))}
+		regs = [6]uintptr{3, uintptr(unsafe.Pointer(&msg))}
+		if res := args.CheckArgs(sc.SYS_SENDMSG, &regs, buf, readMem, 0); res != c.want {
+			t.Errorf("Invalid check for sendmsg to %v: got %v\n", c.sa, res)
+		}
+	}
+	// Connected sockets send without an address, but cannot connect to NULL.
+	regs := [6]uintptr{3}
+	if !args.CheckArgs(sc.SYS_SENDTO, &regs, buf, readMem, 0) {
+		t.Errorf("Sendto on a connected socket should be allowed\n")
+	}
+	if args.CheckArgs(sc.SYS_CONNECT, &regs, buf, readMem, 0) {
+		t.Errorf("Connect to NULL should be denied\n")
+	}
+}
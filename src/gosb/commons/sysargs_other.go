@@ -0,0 +1,17 @@
+// +build !linux !amd64
+
+package commons
+
+// The backends only support linux/amd64, the constraints do not apply to any
+// syscall on other platforms.
+
+const (
+	// Not syscall numbers, see Constrains.
+	sysConnect = MaxSyscallNumber + iota
+	sysSendto
+	sysSendmsg
+
+	// Not address families.
+	afInet  = 0xfffe
+	afInet6 = 0xffff
+)
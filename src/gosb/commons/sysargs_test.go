@@ -0,0 +1,138 @@
+package commons
+
+import (
+	"testing"
+)
+
+func TestParseSyscallArgs(t *testing.T) {
+	correct := []struct {
+		s    string
+		mask SyscallMask
+	}{
+		{"file=/srv/templates", RUNTIME_VAL | FILE_VAL},
+		{"\"file=/srv/templates, file=/tmp,time\"", RUNTIME_VAL | FILE_VAL | TIME_VAL},
+		{"net=10.0.0.1:443", RUNTIME_VAL | NET_VAL},
+		{"net=10.0.0.1,net=[::1]:80,net=fe80::1", RUNTIME_VAL | NET_VAL},
+		{"file=/,net=127.0.0.1,mem", RUNTIME_VAL | FILE_VAL | NET_VAL | MEM_VAL},
+	}
+	incorrect := []string{
+		"file=",
+		"file=tmp",
+		"file=/tmp/",
+		"file=/tmp/../etc",
+		"file=/tmp,file=/tmp",
+		"file=/tmp,file",
+		"file=/tmp,all",
+		"mem=/tmp",
+		"net=10.0.0",
+		"net=10.0.0.256",
+		"net=10.0.0.1:0",
+		"net=10.0.0.1:65536",
+		"net=[::1]:x",
+		"net=[::1]80",
+		"net=1::2::3",
+		"net=1:2:3:4:5:6:7:8:9",
+		"net=localhost",
+	}
+	for _, c := range correct {
+		mask, err := ParseSyscalls(c.s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		if mask != c.mask {
+			t.Errorf("Invalid mask for %v: got %x expected %x\n", c.s, mask, c.mask)
+		}
+	}
+	for _, c := range incorrect {
+		if _, err := ParseSyscallArgs(c); err == nil {
+			t.Errorf("Failed to catch bad entry %v\n", c)
+		}
+	}
+
+	args, err := ParseSyscallArgs("file=/srv,net=10.0.0.1:443,net=[2001:db8::1]")
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	v4 := SockAddr{Port: 443}
+	copy(v4.IP[:], v4InV6Prefix[:])
+	copy(v4.IP[12:], []byte{10, 0, 0, 1})
+	v6 := SockAddr{IP: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}
+	if len(args.Paths) != 1 || args.Paths[0] != "/srv" {
+		t.Errorf("Invalid paths %v\n", args.Paths)
+	}
+	if len(args.Addrs) != 2 || args.Addrs[0] != v4 || args.Addrs[1] != v6 {
+		t.Errorf("Invalid addresses %v\n", args.Addrs)
+	}
+	if args, _ := ParseSyscallArgs("file,net"); args.Paths != nil || args.Addrs != nil {
+		t.Errorf("Unconstrained classes have constraints %v\n", args)
+	}
+}
+
+const atFdcwd = ^uintptr(99) // -100
+
+// readMem reads the memory of the process, up to ctx.
+func TestIntersectArgs(t *testing.T) {
+	a, _ := ParseSyscallArgs("file=/srv,file=/tmp/a,net=10.0.0.1,net=10.0.0.2:80")
+	b, _ := ParseSyscallArgs("file=/srv/templates,file=/tmp,net=10.0.0.1:443")
+	res := a.Intersect(&b)
+	if len(res.Paths) != 2 || res.Paths[0] != "/tmp/a" || res.Paths[1] != "/srv/templates" {
+		t.Errorf("Invalid intersection of paths %v\n", res.Paths)
+	}
+	if len(res.Addrs) != 1 || res.Addrs[0].Port != 443 {
+		t.Errorf("Invalid intersection of addresses %v\n", res.Addrs)
+	}
+	none := SyscallArgs{}
+	if res := none.Intersect(&b); len(res.Paths) != 2 || len(res.Addrs) != 1 {
+		t.Errorf("Invalid intersection with unconstrained %v\n", res)
+	}
+	c, _ := ParseSyscallArgs("file=/etc")
+	if res := c.Intersect(&b); res.Paths == nil || len(res.Paths) != 0 || res.Addrs == nil {
+		t.Errorf("Invalid disjoint intersection %v\n", res)
+	}
+}
+
+func TestSyscallPolicyString(t *testing.T) {
+	correct := []struct {
+		s    string
+		want string
+	}{
+		{"", ""},
+		{"file,net", "file,net"},
+		{"mem,file=/srv,net=10.0.0.1:443", "mem,file=/srv,net=10.0.0.1:443"},
+		{"net=[::1]:80,net=fe80::1,time", "time,net=[0:0:0:0:0:0:0:1]:80,net=fe80:0:0:0:0:0:0:1"},
+	}
+	for _, c := range correct {
+		mask, err := ParseSyscalls(c.s)
+		if err != nil {
+			t.Fatalf(err.Error())
+		}
+		args, _ := ParseSyscallArgs(c.s)
+		res := SyscallPolicyString(mask, args)
+		if res != c.want {
+			t.Errorf("Invalid string for %v: got %v expected %v\n", c.s, res, c.want)
+		}
+		if mask2, err := ParseSyscalls(res); err != nil || mask2 != mask {
+			t.Errorf("Unable to parse back %v: %v\n", res, err)
+		}
+	}
+}
+
+func TestCanonicalSyscalls(t *testing.T) {
+	same := [][]string{
+		{"", "\"\""},
+		{"file,net", "net,file", "\"net, file\""},
+		{"file=/tmp,file=/srv,time", "time,file=/srv,file=/tmp"},
+		{"net=10.0.0.2,net=10.0.0.1:443", "net=10.0.0.1:443,net=10.0.0.2"},
+	}
+	for _, classes := range same {
+		want := CanonicalSyscalls(classes[0])
+		for _, c := range classes[1:] {
+			if res := CanonicalSyscalls(c); res != want {
+				t.Errorf("Invalid canonical syscalls for %v: got %v expected %v\n", c, res, want)
+			}
+		}
+	}
+	if a, b := CanonicalSyscalls("file"), CanonicalSyscalls("file=/tmp"); a == b {
+		t.Errorf("Different syscalls have the same canonical form %v\n", a)
+	}
+}
@@ -6,9 +6,25 @@ type SandboxDomain struct {
 	Id       SandId
 	Func     string
 	Sys      SyscallMask
+	Args     SyscallArgs
 	View     map[string]uint8
 	Pkgs     []string
 	Pristine bool
+	Quota    Quota
+}
+
+// Quota bounds the resources of a sandbox, 0 means unlimited.
+type Quota struct {
+	Heap   uint64 // bytes of heap spans owned by the sandbox's packages
+	Copies int    // pristine copies of the sandbox
+	Warm   int    // pristine copies created at initialization
+}
+
+// Symbol is a symbol of the binary that gosb needs, e.g., a sandbox function.
+type Symbol struct {
+	Name  string
+	Value uint64
+	Size  uint64
 }
 
 type Package struct {
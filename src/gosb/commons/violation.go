@@ -0,0 +1,67 @@
+package commons
+
+import (
+	"fmt"
+	"time"
+)
+
+// Violation describes an illegal memory access or system call performed
+// from within a sandbox. It is delivered as a panic to the goroutine that
+// executed the sandbox, which allows the trusted caller to recover from it.
+type Violation struct {
+	// Sandbox is the id of the sandbox that performed the access.
+	Sandbox SandId
+	// PC is the address of the faulting instruction.
+	PC uintptr
+	// Addr is the faulting address for memory violations.
+	Addr uintptr
+	// Access is the attempted access (R_VAL, W_VAL, X_VAL), 0 for syscalls.
+	Access uint8
+	// Syscall is the number of the denied system call, -1 for memory faults.
+	Syscall int
+	// Pkg is the package that owns Addr, or PC for system calls.
+	Pkg string
+	// Symbol is the name of the function that contains PC.
+	Symbol string
+	// Quota is the exhausted resource (QUOTA_HEAP, QUOTA_COPIES,
+	// QUOTA_DEADLINE, QUOTA_CPU) for resource violations, "" otherwise.
+	Quota string
+	// Limit is the quota that the sandbox would have exceeded, in
+	// nanoseconds for QUOTA_CPU and in Unix nanoseconds for QUOTA_DEADLINE.
+	Limit uint64
+}
+
+func (v *Violation) Error() string {
+	if v.Quota != "" {
+		var msg string
+		switch v.Quota {
+		case QUOTA_DEADLINE:
+			msg = fmt.Sprintf("sandbox %v: deadline exceeded", v.Sandbox)
+		case QUOTA_CPU:
+			msg = fmt.Sprintf("sandbox %v: %v quota of %v exceeded", v.Sandbox, v.Quota, time.Duration(v.Limit))
+		default:
+			msg = fmt.Sprintf("sandbox %v: %v quota of %v exceeded", v.Sandbox, v.Quota, v.Limit)
+		}
+		if v.PC != 0 {
+			msg += fmt.Sprintf(" at %x (%v in %v)", v.PC, v.Symbol, v.Pkg)
+		}
+		return msg
+	}
+	if v.Syscall != -1 {
+		return fmt.Sprintf("sandbox %v: unallowed system call %v at %x (%v in %v)",
+			v.Sandbox, v.Syscall, v.PC, v.Symbol, v.Pkg)
+	}
+	return fmt.Sprintf("sandbox %v: unallowed %v access to %x [%v] at %x (%v)",
+		v.Sandbox, accessName(v.Access), v.Addr, v.Pkg, v.PC, v.Symbol)
+}
+
+func accessName(access uint8) string {
+	switch {
+	case access&W_VAL != 0:
+		return "write"
+	case access&X_VAL != 0:
+		return "execute"
+	default:
+		return "read"
+	}
+}
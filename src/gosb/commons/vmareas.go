@@ -209,6 +209,30 @@ func (vs *VMAreas) Copy() *VMAreas {
 	return doppler
 }
 
+// Intersect returns the address space mapped in both vs and o, with the
+// protections of both.
+func (vs *VMAreas) Intersect(o *VMAreas) *VMAreas {
+	acc := make([]*VMArea, 0)
+	for v := ToVMA(vs.First); v != nil; v = ToVMA(v.Next) {
+		for w := ToVMA(o.First); w != nil; w = ToVMA(w.Next) {
+			if !v.intersect(w) {
+				continue
+			}
+			start, end := v.Addr, v.Addr+v.Size
+			if w.Addr > start {
+				start = w.Addr
+			}
+			if e := w.Addr + w.Size; e < end {
+				end = e
+			}
+			if prot := v.Prot & w.Prot; prot != 0 {
+				acc = append(acc, &VMArea{ListElem{}, Section{start, end - start, prot}})
+			}
+		}
+	}
+	return Convert(acc)
+}
+
 func (vs *VMAreas) Print() {
 	for v := ToVMA(vs.First); v != nil; v = ToVMA(v.Next) {
 		fmt.Printf("%x -+- %x (%x)\n", v.Addr, v.Addr+v.Size, v.Prot)
@@ -0,0 +1,41 @@
+package commons
+
+import (
+	"testing"
+)
+
+func areas(secs ...Section) *VMAreas {
+	acc := make([]*VMArea, 0, len(secs))
+	for _, s := range secs {
+		acc = append(acc, &VMArea{ListElem{}, s})
+	}
+	return Convert(acc)
+}
+
+func TestIntersect(t *testing.T) {
+	a := areas(
+		Section{0x1000, 0x3000, R_VAL | W_VAL},
+		Section{0x5000, 0x2000, R_VAL | X_VAL},
+	)
+	b := areas(
+		Section{0x2000, 0x4000, R_VAL},
+		Section{0x8000, 0x1000, R_VAL},
+	)
+	expected := []Section{
+		{0x2000, 0x2000, R_VAL},
+		{0x5000, 0x1000, R_VAL},
+	}
+	i := 0
+	for v := ToVMA(a.Intersect(b).First); v != nil; v = ToVMA(v.Next) {
+		if i >= len(expected) {
+			t.Fatalf("Too many areas, unexpected %x-%x", v.Addr, v.Addr+v.Size)
+		}
+		if v.Section != expected[i] {
+			t.Errorf("Expected %v, got %v", expected[i], v.Section)
+		}
+		i++
+	}
+	if i != len(expected) {
+		t.Errorf("Expected %v areas, got %v", len(expected), i)
+	}
+}
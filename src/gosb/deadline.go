@@ -0,0 +1,71 @@
+package gosb
+
+import (
+	"context"
+	"gosb/commons"
+	"gosb/globals"
+	"runtime"
+	"time"
+)
+
+// WithDeadline bounds the sandboxes that the goroutine enters to the
+// deadline of ctx, e.g.,
+//
+//	defer gosb.WithDeadline(ctx)()
+//	sandbox["", ""]() {
+//		...
+//	}()
+//
+// A sandbox that is still running at the deadline is interrupted and
+// aborted with a *Violation. The returned function restores the previous
+// deadline. It does nothing if ctx has no deadline.
+func WithDeadline(ctx context.Context) func() {
+	d, ok := ctx.Deadline()
+	if !ok {
+		return func() {}
+	}
+	deadline, budget := runtime.SbLimits()
+	if deadline == 0 || d.UnixNano() < deadline {
+		runtime.SetSbLimits(d.UnixNano(), budget)
+	}
+	return func() {
+		_, budget := runtime.SbLimits()
+		runtime.SetSbLimits(deadline, budget)
+	}
+}
+
+// WithCPUBudget bounds the CPU time of each sandbox that the goroutine
+// enters to d. A sandbox that exceeds it is aborted with a *Violation.
+// The returned function restores the previous budget.
+func WithCPUBudget(d time.Duration) func() {
+	deadline, budget := runtime.SbLimits()
+	runtime.SetSbLimits(deadline, int64(d))
+	return func() {
+		deadline, _ := runtime.SbLimits()
+		runtime.SetSbLimits(deadline, budget)
+	}
+}
+
+func initDeadlines() {
+	runtime.RegisterOverrunHook(overrunViolation)
+}
+
+// overrunViolation is called by the runtime on the goroutine of a sandbox
+// that overran its deadline or CPU budget.
+func overrunViolation(id string, pc uintptr, cpu bool, limit int64) {
+	v := &commons.Violation{
+		Sandbox: id,
+		PC:      pc,
+		Syscall: -1,
+		Quota:   commons.QUOTA_DEADLINE,
+		Limit:   uint64(limit),
+	}
+	if cpu {
+		v.Quota = commons.QUOTA_CPU
+	}
+	if f := runtime.FuncForPC(pc); f != nil {
+		v.Symbol = f.Name()
+	}
+	v.Pkg = globals.PkgOfPC(pc)
+	panic(v)
+}
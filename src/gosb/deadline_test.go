@@ -0,0 +1,120 @@
+package gosb
+
+import (
+	"gosb/internal/gosbtest"
+	"testing"
+)
+
+const deadlineLib = `package lib
+
+var Counter int
+
+//go:noinline
+func Spin() {
+	for {
+		Counter++
+	}
+}
+
+func Set(v int) { Counter = v }
+
+func Wait(ready, done chan bool) {
+	ready <- true
+	<-done
+}
+`
+
+const deadlineMain = `package main
+
+import (
+	"context"
+	"fmt"
+	"gosb"
+	"prog/lib"
+	"sync"
+	"time"
+)
+
+func spin() {
+	sandbox["prog/lib:RWX", "", "spin"]() {
+		lib.Spin()
+	}()
+}
+
+func main() {
+	gosb.InitializeDefault()
+
+	// The busy loop is interrupted at the deadline, the next entry is
+	// interrupted as well.
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		restore := gosb.WithDeadline(ctx)
+		start := time.Now()
+		err := try(spin)
+		d := time.Since(start)
+		fmt.Println("spin:", err, d >= 40*time.Millisecond && d < 5*time.Second)
+		restore()
+		cancel()
+	}
+
+	// The busy loop is interrupted once it used its CPU budget.
+	restore := gosb.WithCPUBudget(50 * time.Millisecond)
+	fmt.Println("budget:", try(spin))
+	restore()
+
+	// The number of goroutines with armed limits is not bounded. The
+	// time they spend blocked does not count against their budget.
+	const n = 1000
+	ready, done := make(chan bool), make(chan bool)
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer gosb.WithCPUBudget(50 * time.Millisecond)()
+			errs <- try(func() {
+				sandbox["prog/lib:RWX", "", "wait"]() {
+					lib.Wait(ready, done)
+				}()
+			})
+		}()
+	}
+	for i := 0; i < n; i++ {
+		<-ready
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(done)
+	wg.Wait()
+	close(errs)
+	failed := 0
+	for err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	fmt.Println("wait:", failed)
+
+	// Without a deadline, the sandbox runs to completion.
+	fmt.Println("set:", try(func() {
+		sandbox["prog/lib:RWX", "", "set"]() {
+			lib.Set(3)
+		}()
+	}), lib.Counter)
+}
+`
+
+const deadlineWant = `spin: deadline of main.spin#spin in prog/lib.Spin true
+spin: deadline of main.spin#spin in prog/lib.Spin true
+budget: cpu of main.spin#spin in prog/lib.Spin
+wait: 0
+set: <nil> 3
+`
+
+func TestWithDeadline(t *testing.T) {
+	for _, backend := range []string{"sim", "mprotect"} {
+		t.Run(backend, func(t *testing.T) {
+			gosbtest.Run(t, backend, map[string]string{"main.go": deadlineMain, "lib/lib.go": deadlineLib}, deadlineWant)
+		})
+	}
+}
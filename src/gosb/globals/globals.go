@@ -7,25 +7,32 @@ package globals
 * We have to isolate them to allow multi-package access to them.
  */
 import (
-	"debug/elf"
 	"fmt"
 	c "gosb/commons"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 const (
 	BackendPrefix = "gosb"
 
+	// Prefix of the packages that hold the heap spans shared with a sandbox.
+	SharePrefix = "share:"
+
 	// Non-mappable sandbox.
-	TrustedSandbox  = "-1"
+	TrustedSandbox  = c.TrustedSandboxId
 	TrustedPackages = "non-bloat"
 )
 
 var (
 
 	// Symbols
-	Symbols   []elf.Symbol
-	NameToSym map[string]*elf.Symbol
+	Symbols   []c.Symbol
+	NameToSym map[string]*c.Symbol
 
 	// Packages
 	AllPackages     []*c.Package
@@ -53,12 +60,159 @@ var (
 	// Pristine Information
 	IsPristine map[c.SandId]bool
 
+	// The sandbox of each pristine copy, by pristine package id.
+	pristineMu    sync.Mutex
+	pristineOwner map[int]c.SandId
+
 	// Dependencies
 	PkgDeps map[int][]c.SandId
+
+	// The packages of the spans shared with each sandbox, read-only and
+	// read-write.
+	SharePkgs map[c.SandId][2]int
 )
 
+// SharePkg returns the package of the spans shared with sandbox id, with
+// write access if write is set.
+func SharePkg(id c.SandId, write bool) (int, bool) {
+	pkgs, ok := SharePkgs[id]
+	if !ok {
+		return 0, false
+	}
+	if write {
+		return pkgs[1], true
+	}
+	return pkgs[0], true
+}
+
+// ShareSandbox returns the sandbox that package pkg shares spans with.
+func ShareSandbox(pkg int) (c.SandId, bool) {
+	for id, pkgs := range SharePkgs {
+		if pkgs[0] == pkg || pkgs[1] == pkg {
+			return id, true
+		}
+	}
+	return "", false
+}
+
 // PristineId generates a new pristine id for the sandbox.
 func PristineId(id string) (string, int) {
 	pid := atomic.AddUint32(&NextPkgId, 1)
+	pristineMu.Lock()
+	if pristineOwner == nil {
+		pristineOwner = make(map[int]c.SandId)
+	}
+	pristineOwner[int(pid)] = id
+	pristineMu.Unlock()
+	// The copy shares the heap quota of the sandbox.
+	if sb, ok := Sandboxes[id]; ok && sb.Config.Quota.Heap != 0 {
+		ApplyHeapQuota(id)
+	}
 	return fmt.Sprintf("p:%v:%v", pid, id), int(pid)
 }
+
+// PristineOwner returns the sandbox of the pristine copy with package id pid.
+func PristineOwner(pid int) (c.SandId, bool) {
+	pristineMu.Lock()
+	defer pristineMu.Unlock()
+	id, ok := pristineOwner[pid]
+	return id, ok
+}
+
+// ReleasePristine forgets the pristine copy with package id pid, once its
+// machine is destroyed, and removes it from the heap quota of its sandbox.
+func ReleasePristine(pid int) {
+	pristineMu.Lock()
+	id, ok := pristineOwner[pid]
+	delete(pristineOwner, pid)
+	pristineMu.Unlock()
+	if sb, ok1 := Sandboxes[id]; ok && ok1 && sb.Config.Quota.Heap != 0 {
+		ApplyHeapQuota(id)
+	}
+}
+
+// ApplyHeapQuota installs the heap quota of the sandbox in the runtime.
+// It covers the packages of the sandbox and its pristine copies, but not
+// the runtime and the backend, which allocate on behalf of every sandbox.
+func ApplyHeapQuota(id c.SandId) {
+	sb, ok := Sandboxes[id]
+	if !ok {
+		return
+	}
+	pkgs := make([]int, 0, len(sb.View))
+	for pid := range sb.View {
+		p, ok := IdToPkg[pid]
+		if !ok || p.Name == TrustedPackages || strings.HasPrefix(p.Name, BackendPrefix) ||
+			strings.HasPrefix(p.Name, SharePrefix) ||
+			p.Name == "runtime" || strings.HasPrefix(p.Name, "runtime/") {
+			continue
+		}
+		pkgs = append(pkgs, pid)
+	}
+	pristineMu.Lock()
+	for pid, owner := range pristineOwner {
+		if owner == id {
+			pkgs = append(pkgs, pid)
+		}
+	}
+	pristineMu.Unlock()
+	runtime.SetHeapQuota(id, pkgs, uintptr(sb.Config.Quota.Heap))
+}
+
+// CPUStats formats the CPU time consumed by each sandbox, including the
+// time of its pristine copies and of its entries nested in other sandboxes.
+func CPUStats() string {
+	times := make(map[c.SandId]time.Duration)
+	for id, ns := range runtime.SandboxCPUTimes() {
+		if i := strings.LastIndex(id, ">"); i != -1 {
+			id = id[i+1:]
+		}
+		// Pristine copies are named p:pid:owner, and may be released.
+		if strings.HasPrefix(id, "p:") {
+			if i := strings.Index(id[2:], ":"); i != -1 {
+				id = id[2+i+1:]
+			}
+		}
+		times[id] += time.Duration(ns)
+	}
+	ids := make([]string, 0, len(times))
+	for id := range times {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	stats := make([]string, len(ids))
+	for i, id := range ids {
+		stats[i] = fmt.Sprintf("%v: %v", id, times[id])
+	}
+	return strings.Join(stats, ", ")
+}
+
+// PkgOfPC finds the package that contains the given instruction.
+func PkgOfPC(pc uintptr) string {
+	for _, p := range PcToPkg {
+		sec := p.Sects[0]
+		if sec.Addr <= uint64(pc) && sec.Addr+sec.Size > uint64(pc) {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// PkgOfAddr finds the package that owns the given address, either through
+// the heap span or the static sections.
+func PkgOfAddr(addr uintptr) string {
+	if id := runtime.SpanIdOf(addr); id != runtime.SbNoPkg {
+		if p, ok := IdToPkg[id]; ok {
+			return p.Name
+		}
+		return ""
+	}
+	for _, p := range AllPackages {
+		for _, s := range p.Sects {
+			if s.Addr <= uint64(addr) && s.Addr+s.Size > uint64(addr) {
+				return p.Name
+			}
+		}
+	}
+	return ""
+}
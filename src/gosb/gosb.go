@@ -1,24 +1,40 @@
+// Package gosb loads the sandboxes of the program and enforces them with
+// one of the backends of gosb/backend:
+//
+//	vtx      runs the sandboxes in a KVM virtual machine, the default.
+//	mpk      tags the memory with protection keys, and dispatches the
+//	         syscalls of the sandboxes, it needs PKU and Linux 5.11.
+//	mprotect mprotects the memory that the running sandbox must not
+//	         access. It is best-effort: it does not filter syscalls, and a
+//	         sandbox can undo its protections with mprotect.
+//	sim      does not isolate the sandboxes, it can learn their
+//	         configurations.
 package gosb
 
 import (
-	"debug/elf"
 	"encoding/json"
 	"fmt"
 	"gosb/backend"
 	"gosb/commons"
 	"gosb/globals"
 	"gosb/vtx"
+	"io/ioutil"
 	"os"
 	"runtime"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+// POLICY_FLAG names a policy file that tightens the sandboxes when the
+// program starts, see commons.Policy.
+const POLICY_FLAG = "GOSB_POLICY"
+
 var (
 	once    sync.Once
-	SbPkgId int = -10
+	SbPkgId int = runtime.SbNoPkg - 1
 )
 
 // Initialize loads the sandbox and package information from the binary.
@@ -30,11 +46,20 @@ func Initialize(b backend.Backend) {
 		initBackend(b)
 		initPcToPkg()
 		initRuntime()
+		initQuotas()
+		initDeadlines()
 		finalizeBackend(b)
 		//PrintInformation()
 	})
 }
 
+// InitializeDefault is Initialize with the backend selected with the -gosb
+// build flag, or backend.DEFAULT_BACKEND.
+func InitializeDefault() {
+	b, _ := backend.Recorded()
+	Initialize(b)
+}
+
 func initRuntime() {
 	globals.NameToId = make(map[string]int)
 	for k, d := range globals.NameToPkg {
@@ -52,6 +77,7 @@ func initRuntime() {
 		currBackend.Epilog,
 		currBackend.Mstart,
 	)
+	commons.RuntimeMemory = runtime.SbRuntimeMemory
 }
 func finalizeBackend(b backend.Backend) {
 	if b != backend.VTX_BACKEND {
@@ -76,21 +102,16 @@ func getPkgName(name string) string {
 }
 
 func loadPackages() {
-	// Load information from the elf.
-	file, err := elf.Open(os.Args[0])
-	commons.CheckE(err)
-	defer func() { commons.CheckE(file.Close()) }()
-	section := file.Section(".bloated")
-	if section == nil {
+	data := metaSection(metaBloated)
+	if data == nil {
 		// No bloat section
 		return
 	}
-	data, err := section.Data()
-	commons.CheckE(err)
 
 	// Initialize globals.
 	globals.AllPackages = make([]*commons.Package, 0)
-	err = json.Unmarshal(data, &globals.AllPackages)
+	err := json.Unmarshal(data, &globals.AllPackages)
+	commons.CheckE(err)
 
 	// Generate maps for packages.
 	globals.NameToPkg = make(map[string]*commons.Package)
@@ -100,6 +121,7 @@ func loadPackages() {
 	nextPkgId := -1000
 
 	for _, v := range globals.AllPackages {
+		relocatePackage(v)
 		if nextPkgId <= v.Id {
 			nextPkgId = v.Id + 1
 		}
@@ -116,11 +138,10 @@ func loadPackages() {
 				v.Sects[i].Size = commons.Round(s.Size, true)
 				v.Sects[i].Prot = s.Prot | commons.USER_VAL
 				globals.TrustedSpace.Map(&commons.VMArea{
-					commons.ListElem{},
-					commons.Section{
-						commons.Round(s.Addr, false),
-						commons.Round(s.Size, true),
-						s.Prot | commons.USER_VAL,
+					Section: commons.Section{
+						Addr: commons.Round(s.Addr, false),
+						Size: commons.Round(s.Size, true),
+						Prot: s.Prot | commons.USER_VAL,
 					},
 				})
 			}
@@ -154,36 +175,36 @@ func loadPackages() {
 	}
 
 	// Initialize the symbols.
-	globals.Symbols, err = file.Symbols()
+	err = json.Unmarshal(metaSection(metaSymbols), &globals.Symbols)
 	commons.CheckE(err)
+	for i := range globals.Symbols {
+		globals.Symbols[i].Value = relocate(globals.Symbols[i].Value)
+	}
 	sort.Slice(globals.Symbols, func(i, j int) bool {
 		return globals.Symbols[i].Value < globals.Symbols[j].Value
 	})
-	globals.NameToSym = make(map[string]*elf.Symbol)
+	globals.NameToSym = make(map[string]*commons.Symbol)
 	for i, s := range globals.Symbols {
 		globals.NameToSym[s.Name] = &globals.Symbols[i]
 		if s.Name == "runtime.pclntab" {
 			runtimePkg := globals.NameToPkg["runtime"]
 			runtimePkg.Sects = append(runtimePkg.Sects, commons.Section{
-				commons.Round(s.Value, false),
-				commons.Round(s.Size, true),
-				commons.R_VAL | commons.USER_VAL,
+				Addr: commons.Round(s.Value, false),
+				Size: commons.Round(s.Size, true),
+				Prot: commons.R_VAL | commons.USER_VAL,
 			})
 			globals.CommonVMAs.Map(commons.SectVMA(&commons.Section{
-				commons.Round(s.Value, false),
-				commons.Round(s.Size, true),
-				commons.R_VAL | commons.USER_VAL,
+				Addr: commons.Round(s.Value, false),
+				Size: commons.Round(s.Size, true),
+				Prot: commons.R_VAL | commons.USER_VAL,
 			}))
 		}
 	}
 }
 
 func loadSandboxes() {
-	file, err := elf.Open(os.Args[0])
-	commons.CheckE(err)
-	defer func() { commons.CheckE(file.Close()) }()
-	section := file.Section(".sandboxes")
-	if section == nil {
+	data := metaSection(metaSandboxes)
+	if data == nil {
 		// No sboxes
 		return
 	}
@@ -192,10 +213,9 @@ func loadSandboxes() {
 	globals.Configurations = make([]*commons.SandboxDomain, 0)
 	globals.Sandboxes = make(map[commons.SandId]*commons.SandboxMemory)
 	globals.IsPristine = make(map[commons.SandId]bool)
+	globals.SharePkgs = make(map[commons.SandId][2]int)
 
-	data, err := section.Data()
-	commons.CheckE(err)
-	err = json.Unmarshal(data, &globals.Configurations)
+	err := json.Unmarshal(data, &globals.Configurations)
 	commons.CheckE(err)
 
 	// Use the configurations to create fake packages
@@ -203,6 +223,14 @@ func loadSandboxes() {
 		createFakePackage(d)
 	}
 
+	// Tighten the sandboxes for this deployment.
+	if file := os.Getenv(POLICY_FLAG); file != "" {
+		if err := applyPolicyFile(file); err != nil {
+			fmt.Fprintf(os.Stderr, "gosb: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
 	// Generate internal data
 	for _, d := range globals.Configurations {
 		_, ok := globals.Sandboxes[d.Id]
@@ -212,11 +240,13 @@ func loadSandboxes() {
 		if nid, err := strconv.Unquote(d.Id); err == nil {
 			d.Id = nid
 		}
+		createSharePackages(d)
+
 		// Create the sbox memory
 		sbox := &commons.SandboxMemory{
-			new(commons.VMAreas),
-			d,
-			make(map[int]uint8),
+			Static: new(commons.VMAreas),
+			Config: d,
+			View:   make(map[int]uint8),
 		}
 		var statics []*commons.VMArea = nil
 
@@ -282,9 +312,9 @@ func updateTrusted() {
 		globals.TrustedSpace.Foreach(func(e *commons.ListElem) {
 			vma := commons.ToVMA(e)
 			pkg.Sects = append(pkg.Sects, commons.Section{
-				vma.Addr,
-				vma.Size,
-				vma.Prot,
+				Addr: vma.Addr,
+				Size: vma.Size,
+				Prot: vma.Prot,
 			})
 		})
 	}
@@ -294,33 +324,33 @@ func createFakePackage(d *commons.SandboxDomain) {
 	if d.Id == globals.TrustedSandbox {
 		return
 	}
-	p := &commons.Package{d.Func, SbPkgId, nil, nil}
+	p := &commons.Package{Name: d.Func, Id: SbPkgId}
 	SbPkgId--
 	// sandbox function
 	sf, ok := globals.NameToSym[d.Func]
 	commons.Check(ok)
 	p.Sects = make([]commons.Section, 1)
 	p.Sects[0] = commons.Section{
-		commons.Round(sf.Value, false),
-		commons.Round(sf.Size, true),
-		commons.X_VAL | commons.R_VAL | commons.USER_VAL,
+		Addr: commons.Round(sf.Value, false),
+		Size: commons.Round(sf.Size, true),
+		Prot: commons.X_VAL | commons.R_VAL | commons.USER_VAL,
 	}
 
 	// stack object for sandbox
 	if stkobj, ok := globals.NameToSym[d.Func+".stkobj"]; ok {
 		p.Sects = append(p.Sects, commons.Section{
-			commons.Round(stkobj.Value, false),
-			commons.Round(sf.Size, true),
-			commons.R_VAL | commons.USER_VAL,
+			Addr: commons.Round(stkobj.Value, false),
+			Size: commons.Round(sf.Size, true),
+			Prot: commons.R_VAL | commons.USER_VAL,
 		})
 	}
 
 	// stack object from main
 	if stkobj, ok := globals.NameToSym["main.main.stkobj"]; ok {
 		p.Sects = append(p.Sects, commons.Section{
-			commons.Round(stkobj.Value, false),
-			commons.Round(sf.Size, true),
-			commons.R_VAL | commons.USER_VAL,
+			Addr: commons.Round(stkobj.Value, false),
+			Size: commons.Round(sf.Size, true),
+			Prot: commons.R_VAL | commons.USER_VAL,
 		})
 	}
 
@@ -334,13 +364,54 @@ func createFakePackage(d *commons.SandboxDomain) {
 	globals.SandboxFuncs[d.Id] = function
 }
 
+// applyPolicyFile tightens the sandboxes with the policy file at path.
+func applyPolicyFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var pols map[commons.SandId]commons.Policy
+	if err := json.Unmarshal(data, &pols); err != nil {
+		return fmt.Errorf("invalid policy file %v: %v", path, err)
+	}
+	if err := commons.CheckPolicies(pols); err != nil {
+		return fmt.Errorf("invalid policy file %v: %v", path, err)
+	}
+	return commons.ApplyPolicies(globals.Configurations, pols)
+}
+
+// createSharePackages adds the packages of the heap spans shared with the
+// sandbox to its view, see Share.
+func createSharePackages(d *commons.SandboxDomain) {
+	if d.Id == globals.TrustedSandbox {
+		return
+	}
+	var pkgs [2]int
+	perms := []uint8{commons.R_VAL, commons.R_VAL | commons.W_VAL}
+	for i, suffix := range []string{"R", "RW"} {
+		id := int(atomic.AddUint32(&globals.NextPkgId, 1))
+		name := fmt.Sprintf("%v%v:%v", globals.SharePrefix, d.Id, suffix)
+		p := &commons.Package{Name: name, Id: id}
+		globals.NameToPkg[name] = p
+		globals.IdToPkg[id] = p
+		globals.AllPackages = append(globals.AllPackages, p)
+		d.Pkgs = append(d.Pkgs, name)
+		if d.View == nil {
+			d.View = make(map[string]uint8)
+		}
+		d.View[name] = perms[i]
+		pkgs[i] = id
+	}
+	globals.SharePkgs[d.Id] = pkgs
+}
+
 func initPcToPkg() {
 	for _, p := range globals.AllPackages {
 		for _, s := range p.Sects {
 			if s.Prot&commons.X_VAL == 0 || (s.Addr == 0 && s.Size == 0) {
 				continue
 			}
-			fp := &commons.Package{p.Name, p.Id, []commons.Section{s}, nil}
+			fp := &commons.Package{Name: p.Name, Id: p.Id, Sects: []commons.Section{s}}
 			globals.PcToPkg = append(globals.PcToPkg, fp)
 		}
 	}
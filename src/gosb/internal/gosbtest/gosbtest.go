@@ -0,0 +1,87 @@
+// Package gosbtest builds and runs the sandboxed programs of the gosb tests.
+package gosbtest
+
+import (
+	"internal/testenv"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Try is added to every program. It declares try, which runs f and
+// returns the violation it panics with, formatted so that the output of
+// the program does not depend on addresses.
+const Try = `package main
+
+import (
+	"fmt"
+	"gosb/commons"
+)
+
+func try(f func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			v, ok := r.(*commons.Violation)
+			if !ok {
+				panic(r)
+			}
+			if v.Quota != "" {
+				err = fmt.Errorf("%v of %v in %v", v.Quota, v.Sandbox, v.Symbol)
+				return
+			}
+			access := map[uint8]string{commons.R_VAL: "R", commons.W_VAL: "W", commons.X_VAL: "X"}
+			err = fmt.Errorf("violation %v in %v", access[v.Access], v.Pkg)
+		}
+	}()
+	f()
+	return nil
+}
+`
+
+// Build builds the program prog of the files, by path relative to prog,
+// with the backend, and returns the path of its binary, in dir.
+func Build(t *testing.T, dir, backend string, files map[string]string) string {
+	all := map[string]string{"try.go": Try}
+	for name, src := range files {
+		all[name] = src
+	}
+	for name, src := range all {
+		path := filepath.Join(dir, "src", "prog", name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exe := filepath.Join(dir, "prog.exe")
+	cmd := exec.Command(testenv.GoToolPath(t), "build", "-gosb="+backend, "-o", exe, "prog")
+	cmd.Env = append(os.Environ(), "GOPATH="+dir, "GO111MODULE=off")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, out)
+	}
+	return exe
+}
+
+// Run builds the program of the files with the backend, runs it, and
+// checks that its output ends with want.
+func Run(t *testing.T, backend string, files map[string]string, want string) {
+	testenv.MustHaveGoBuild(t)
+
+	dir, err := ioutil.TempDir("", "gosb-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	exe := Build(t, dir, backend, files)
+	out, err := exec.Command(exe).CombinedOutput()
+	if err != nil {
+		t.Fatalf("program failed: %v\n%s", err, out)
+	}
+	if got := string(out); !strings.HasSuffix(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
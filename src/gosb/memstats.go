@@ -0,0 +1,73 @@
+package gosb
+
+import (
+	"gosb/commons"
+	"gosb/globals"
+	"runtime"
+	"sort"
+)
+
+// PkgMemStats is the heap usage of a package.
+type PkgMemStats struct {
+	Name string
+	runtime.PkgMemStats
+}
+
+// SandboxMemStats is the heap usage of the packages of a sandbox, and of its
+// pristine copies. Packages can be shared by several sandboxes, their usage
+// is then counted in each of them.
+type SandboxMemStats struct {
+	Id          commons.SandId
+	HeapAlloc   uint64
+	HeapInuse   uint64
+	Spans       uint64
+	HeapObjects uint64
+	Mallocs     uint64
+}
+
+// ReadMemStats returns the heap usage of the packages, sorted by id, and of
+// the sandboxes, sorted by id. The runtime and the allocations that are not
+// attributed to a package are reported under id 0, and are not counted in
+// the sandboxes.
+func ReadMemStats() ([]PkgMemStats, []SandboxMemStats) {
+	pstats := runtime.ReadPkgMemStats()
+	pkgs := make([]PkgMemStats, 0, len(pstats))
+	sbs := make(map[commons.SandId]*SandboxMemStats)
+	for _, ps := range pstats {
+		p := PkgMemStats{PkgMemStats: ps}
+		if pkg, ok := globals.IdToPkg[ps.Id]; ok {
+			p.Name = pkg.Name
+		}
+		pkgs = append(pkgs, p)
+
+		if ps.Id <= 0 {
+			continue
+		}
+		owners := globals.PkgDeps[ps.Id]
+		if sb, ok := globals.PristineOwner(ps.Id); ok {
+			owners = []commons.SandId{sb}
+		}
+		for _, id := range owners {
+			// Skip the trusted and the backends' internal sandboxes.
+			if _, ok := globals.Sandboxes[id]; !ok || id == globals.TrustedSandbox {
+				continue
+			}
+			s, ok := sbs[id]
+			if !ok {
+				s = &SandboxMemStats{Id: id}
+				sbs[id] = s
+			}
+			s.HeapAlloc += ps.HeapAlloc
+			s.HeapInuse += ps.HeapInuse
+			s.Spans += ps.Spans
+			s.HeapObjects += ps.HeapObjects
+			s.Mallocs += ps.Mallocs
+		}
+	}
+	sandboxes := make([]SandboxMemStats, 0, len(sbs))
+	for _, s := range sbs {
+		sandboxes = append(sandboxes, *s)
+	}
+	sort.Slice(sandboxes, func(i, j int) bool { return sandboxes[i].Id < sandboxes[j].Id })
+	return pkgs, sandboxes
+}
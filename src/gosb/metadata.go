@@ -0,0 +1,67 @@
+package gosb
+
+import (
+	"gosb/commons"
+	"unsafe"
+)
+
+// metadata is filled by the linker, see cmd/link/internal/ld/gosb.go.
+// It locates the .bloated, .sandboxes and .gosbsyms sections, reading them
+// from memory works for stripped binaries and does not depend on os.Args[0].
+//
+// All the addresses in the metadata are the ones at link time, sects allows
+// to relocate them. With the internal linker, the binary is loaded at a
+// single bias, e.g., for PIE. An external linker, e.g., for c-shared and
+// c-archive, moves each section independently, the linker then records the
+// address at run time of each section in addr.
+var metadata struct {
+	self  uintptr
+	meta  [3]struct{ addr, size uintptr }
+	sects [32]struct{ link, size, addr uintptr }
+}
+
+// Indices in metadata.meta.
+const (
+	metaBloated = iota
+	metaSandboxes
+	metaSymbols
+)
+
+// relocate translates a link-time address into its address at run time.
+func relocate(addr uint64) uint64 {
+	bias := uint64(uintptr(unsafe.Pointer(&metadata)) - metadata.self)
+	for _, s := range metadata.sects {
+		if s.size == 0 {
+			break
+		}
+		if addr < uint64(s.link) || addr >= uint64(s.link+s.size) {
+			continue
+		}
+		if s.addr != 0 {
+			return addr - uint64(s.link) + uint64(s.addr)
+		}
+		return addr + bias
+	}
+	return addr
+}
+
+// metaSection returns the content of the metadata section i.
+func metaSection(i int) []byte {
+	m := metadata.meta[i]
+	if m.size == 0 {
+		return nil
+	}
+	addr := uintptr(relocate(uint64(m.addr)))
+	return (*[1 << 30]byte)(unsafe.Pointer(addr))[:m.size:m.size]
+}
+
+// relocatePackage moves the sections of p to their address at run time.
+func relocatePackage(p *commons.Package) {
+	for _, sects := range [][]commons.Section{p.Sects, p.Dynamic} {
+		for i := range sects {
+			if sects[i].Size != 0 {
+				sects[i].Addr = relocate(sects[i].Addr)
+			}
+		}
+	}
+}
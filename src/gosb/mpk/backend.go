@@ -6,7 +6,6 @@ package mpk
  */
 
 import (
-	"errors"
 	// "fmt"
 	c "gosb/commons"
 	g "gosb/globals"
@@ -14,9 +13,6 @@ import (
 )
 
 var (
-	sbPKRU  map[c.SandId]PKRU
-	pkgKeys map[int]Pkey
-
 	// Statistics
 	entries uint64
 	exits   uint64
@@ -31,41 +27,56 @@ func MStart() {
 // Execute turns on sandbox isolation
 func Execute(id c.SandId) {
 	cid := runtime.GetmSbIds()
+	if cid != "" {
+		// The thread stops running the previous sandbox.
+		if d, ok := sbDomain[cid]; ok {
+			leave(&domains[d])
+		}
+	}
 	if id == "" {
 		if cid != id {
 			escapes++
 		}
 		WritePKRU(AllRightsPKRU)
+		allowSyscalls()
 		runtime.AssignSbId(id, 0)
 		return
 	}
-	pkru, ok := sbPKRU[id]
+	d, ok := sbDomain[id]
 	if !ok {
 		println("[MPK BACKEND]: Could not find pkru")
 		return
 	}
 	entries++
+	pkru := enter(&domains[d], false)
+	blockSyscalls()
 	WritePKRU(pkru)
 	runtime.AssignSbId(id, 0)
 }
 
 // Prolog initialize isolation of the sandbox
 func Prolog(id c.SandId) {
-	pkru, ok := sbPKRU[id]
+	d, ok := sbDomain[id]
 	if !ok {
 		println("[MPK BACKEND]: Sandbox PKRU not found in prolog")
 		return
 	}
+	pkru := enter(&domains[d], true)
 	entries++
 	runtime.AssignSbId(id, 0)
+	blockSyscalls()
 	WritePKRU(pkru)
 }
 
 // Epilog is called at the end of the execution of a given sandbox
 func Epilog(id c.SandId) {
+	if d, ok := sbDomain[id]; ok {
+		leave(&domains[d])
+	}
 	runtime.AssignSbId("", 0)
 	// Clean PKRU
 	WritePKRU(AllRightsPKRU)
+	allowSyscalls()
 	exits++
 }
 
@@ -75,12 +86,15 @@ func Register(id int, start, size uintptr) {
 		return
 	}
 
-	key, ok := pkgKeys[id]
+	gi, ok := pkgGroup[id]
 	if !ok {
 		println("[MPK BACKEND]: Register key not found")
 		return
 	}
-	PkeyMprotect(start, uint64(size), SysProtRW, key)
+	lockKeys()
+	key := trackSpan(gi, start, size)
+	pkeyMprotect(start, size, SysProtRW, key)
+	unlockKeys()
 }
 
 // Transfer a page from one package to another
@@ -89,51 +103,21 @@ func Transfer(oldid, newid int, start, size uintptr) {
 		return
 	}
 
-	if newid == 0 { // Runtime
-		PkeyMprotect(start, uint64(size), SysProtRW, 0)
+	gi, ok := pkgGroup[newid]
+	if newid == 0 || !ok { // Runtime or a package outside of the sandboxes
+		lockKeys()
+		untrackSpan(start)
+		pkeyMprotect(start, size, SysProtRW, 0)
+		unlockKeys()
 		return
 	}
-	key, ok := pkgKeys[newid]
-	if !ok {
-		return
-	}
-	oldKey, ok := pkgKeys[oldid]
-	if !ok || oldKey != key {
-		PkeyMprotect(start, uint64(size), SysProtRW, key)
-	}
-}
-
-// allocateKey allocates MPK keys and tag sections with those keys
-func allocateKey(sandboxKeys map[c.SandId][]int, pkgGroups [][]int) []Pkey {
-	keys := make([]Pkey, 0, len(pkgGroups))
-	for _, pkgGroup := range pkgGroups {
-		key, err := PkeyAlloc()
-		if err != nil {
-			panic(err)
-		}
-		keys = append(keys, key)
-
-		for _, pkgID := range pkgGroup {
-			tagPackage(pkgID, key)
-		}
-	}
-
-	return keys
-}
-
-func tagPackage(id int, key Pkey) {
-	pkg, ok := g.IdToPkg[id]
-	if !ok {
-		panic(errors.New("Package not found"))
-	}
-
-	for _, section := range pkg.Sects {
-		if section.Size > 0 {
-			// fmt.Printf("section %06x + %06x -- pkg %02d ~ %s\n", section.Addr, section.Addr+section.Size, id, pkg.Name)
-			sysProt := getSectionProt(section)
-			PkeyMprotect(uintptr(section.Addr), section.Size, sysProt, key)
-		}
+	oi, ok := pkgGroup[oldid]
+	lockKeys()
+	key := trackSpan(gi, start, size)
+	if !ok || oi != gi || key != groups[gi].key {
+		pkeyMprotect(start, size, SysProtRW, key)
 	}
+	unlockKeys()
 }
 
 func getSectionProt(section c.Section) SysProt {
@@ -147,23 +131,6 @@ func getSectionProt(section c.Section) SysProt {
 	return prot
 }
 
-func getGroupProt(p int)
-
-// computePKRU initializes `sbPKRU` with corresponding PKRUs
-func computePKRU(sandboxKeys map[c.SandId][]int, sandboxProt map[c.SandId][]Prot, keys []Pkey) {
-	sbPKRU = make(map[c.SandId]PKRU, len(sandboxKeys))
-	for sbID, keyIDs := range sandboxKeys {
-		sbProts := sandboxProt[sbID]
-		pkru := NoRightsPKRU
-		for idx, keyID := range keyIDs {
-			key := keys[keyID]
-			prot := sbProts[idx]
-			pkru = pkru.Update(key, prot)
-		}
-		sbPKRU[sbID] = pkru
-	}
-}
-
 // Init relies on domains and packages, they must be initialized before the call
 func Init() {
 	WritePKRU(AllRightsPKRU)
@@ -228,17 +195,12 @@ func Init() {
 		pkgGroups = append(pkgGroups, group)
 	}
 
-	// We have an allocation for the keys!
-	keys := allocateKey(sbKeys, pkgGroups)
-	computePKRU(sbKeys, sbProts, keys)
+	// Enforce the syscall classes of each sandbox, the sandboxes need the
+	// dispatch key.
+	initDispatch()
 
-	pkgKeys = make(map[int]Pkey, len(pkgAppearsIn))
-	for idx, group := range pkgGroups {
-		key := keys[idx]
-		for _, pkg := range group {
-			pkgKeys[pkg] = key
-		}
-	}
+	// We have an allocation for the keys!
+	initKeys(pkgGroups, sbKeys, sbProts)
 }
 
 func testCompatibility(aID, bID int, a, b []c.SandId, pkgSbProt map[int]map[c.SandId]Prot) bool {
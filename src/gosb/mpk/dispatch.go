@@ -0,0 +1,620 @@
+package mpk
+
+/*
+* @author: aghosn
+*
+* Syscall user dispatch enforcement of the sandboxes' syscall classes.
+*
+* A thread blocks its syscalls while it runs a sandbox. On each syscall, the
+* kernel reads the selector of the thread, and delivers a SIGSYS instead of
+* performing the syscall if it is blocked. Trusted threads are never trapped.
+* The selectors are tagged with dispatchKey, on which the sandboxes only have
+* read rights. Only the runtime's signal restorer is excluded from the
+* dispatch, a thread must return from its signal handlers. A seccomp filter,
+* installed for all the threads at Init, kills the process if anything but
+* rt_sigreturn is performed from the restorer. It sets no_new_privs.
+*
+* The kernel does not enable the dispatch in the tasks a thread creates. The
+* runtime creates the threads of the sandboxes from its template thread, see
+* runtime.newm, and the sandboxes cannot create threads themselves. They can
+* only create processes if they can execute any program.
+*
+* The SIGSYS handler recovers the PKRU of the interrupted thread from the
+* xsave area of the signal frame, maps it to a sandbox syscall mask, and
+* performs the syscall on its behalf if it is allowed. It restores the PKRU
+* of the sandbox to perform the syscall: the kernel only accesses the memory
+* the sandbox can access.
+*
+* The handler copies the constrained arguments with process_vm_writev, which
+* reads them with the rights of the sandbox and does not fault on bad
+* pointers, checks the copies, and performs the syscall with them.
+*
+* The syscalls that change the signal state of the thread, or create a task,
+* cannot be performed from inside the handler. The handler allows the syscalls
+* of the thread and makes it perform the syscall again with the trap flag.
+* The SIGTRAP that follows blocks the syscalls of the thread again.
+*
+* Syscall user dispatch requires Linux 5.11. As for the rest of the backend,
+* the isolation relies on the sandboxes not hijacking the control flow: WRPKRU
+* is not privileged.
+ */
+
+import (
+	"errors"
+	c "gosb/commons"
+	g "gosb/globals"
+	"log"
+	"reflect"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Syscall numbers and flags on x86_64
+const (
+	prSetSyscallUserDispatch = 59
+	prSysDispatchOff         = 0
+	prSysDispatchOn          = 1
+	dispatchAllow            = 0
+	dispatchBlock            = 1
+	sysUserDispatchCode      = 2
+
+	sysProcessVMWritev = 311
+
+	mapFixed          = 0x10
+	mapFixedNoreplace = 0x100000
+	mremapFixed       = 0x2
+)
+
+// Layouts of the structures we access
+const (
+	xsavePKRUComponent = 9
+	xsaveHeaderOffset  = 512
+
+	// The size of the SYSCALL instruction.
+	syscallInsnLen = 2
+
+	// The size of the runtime's signal restorer.
+	restorerLen = 16
+
+	eflagsTF = 0x100
+
+	// Upper bound on the number of sandbox PKRUs.
+	maxPKRUs = 1024
+
+	// Upper bound on the argument constraints that share a PKRU.
+	maxPKRUArgs = 4
+
+	// Number of argument buffers shared by the SIGSYS handlers.
+	maxArgBufs = 32
+
+	// Upper bound on the number of threads that run a sandbox, the default
+	// limit of the runtime on the number of threads.
+	maxThreads = 10000
+)
+
+// pkruMask associates a sandbox PKRU with its syscall mask and the
+// constraints on the syscalls arguments. A syscall must satisfy all of them.
+type pkruMask struct {
+	pkru  PKRU
+	sys   c.SyscallMask
+	args  [maxPKRUArgs]*c.SyscallArgs
+	nargs int
+}
+
+// iovec is a struct iovec for process_vm_writev.
+type iovec struct {
+	base uintptr
+	len  uintptr
+}
+
+// dispatchMem is the memory tagged with dispatchKey.
+type dispatchMem struct {
+	// The selectors of the threads, indexed by their slot.
+	selectors [maxThreads]byte
+	// The argument copies of the handlers, a handler locks a buffer.
+	argBufs [maxArgBufs]c.ArgBuf
+}
+
+var (
+	// pkruToSys is read by the SIGSYS handler and cannot be a map.
+	pkruToSys  [maxPKRUs]pkruMask
+	npkruToSys int32
+
+	// xsavePKRUOffset is the offset of the PKRU inside the xsave area.
+	xsavePKRUOffset uintptr
+
+	// The runtime's signal handlers.
+	savedSigsysHandler  uintptr
+	savedSigtrapHandler uintptr
+
+	// dmem is nil if there is no sandbox to enforce.
+	dmem        *dispatchMem
+	dispatchKey Pkey = -1
+	argBufLock  [maxArgBufs]uint32
+
+	// The threads that own a slot, 0 if the slot is free, and whether they
+	// perform a syscall again.
+	threadTids [maxThreads]int32
+	reblocks   [maxThreads]bool
+
+	// The runtime's signal restorer.
+	restorer uintptr
+
+	// selfPid is the pid for process_vm_writev.
+	selfPid uintptr
+
+	// Statistics
+	emulated    uint64
+	passthrough uint64
+	denied      uint64
+)
+
+// sigsysHandler is the SIGSYS entry point, it calls handleSigsys.
+func sigsysHandler()
+
+// sigtrapHandler is the SIGTRAP entry point, it calls handleSigtrap.
+func sigtrapHandler()
+
+// sigsysSyscall performs a syscall with the given PKRU, and restores all the
+// rights once it returns.
+func sigsysSyscall(pkru PKRU, trap, a1, a2, a3, a4, a5, a6 uintptr) (r1 uintptr, errno uintptr)
+
+// cpuid executes the cpuid instruction.
+func cpuid(eax, ecx uint32) (a, b, c, d uint32)
+
+// initDispatch allocates the key and the memory of the SIGSYS handlers, and
+// installs them. It must be called before initKeys.
+func initDispatch() {
+	enforced := false
+	for id := range g.Sandboxes {
+		enforced = enforced || id != g.TrustedSandbox
+	}
+	// No sandbox, nothing to enforce.
+	if !enforced {
+		return
+	}
+	if _, _, err := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSyscallUserDispatch, prSysDispatchOff, 0, 0, 0, 0); err != 0 {
+		log.Fatalf("Syscall user dispatch is not supported, it requires Linux 5.11: %v", err)
+	}
+	_, b, _, _ := cpuid(0xd, xsavePKRUComponent)
+	xsavePKRUOffset = uintptr(b)
+	selfPid = uintptr(syscall.Getpid())
+
+	key, err := PkeyAlloc()
+	if err != nil {
+		log.Fatalf("Unable to allocate the dispatch key: %v", err)
+	}
+	mem, err := syscall.Mmap(-1, 0, int(unsafe.Sizeof(dispatchMem{})), syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS)
+	if err != nil {
+		log.Fatalf("Unable to map the dispatch memory: %v", err)
+	}
+	if err := PkeyMprotect(uintptr(unsafe.Pointer(&mem[0])), uint64(len(mem)), SysProtRW, key); err != nil {
+		log.Fatalf("Unable to tag the dispatch memory: %v", err)
+	}
+	dispatchKey, dmem = key, (*dispatchMem)(unsafe.Pointer(&mem[0]))
+
+	runtime.InstallSigHandler(uint32(syscall.SIGSYS))
+	runtime.InstallSigHandler(uint32(syscall.SIGTRAP))
+	if err := c.ReplaceSignalHandler(syscall.SIGSYS, reflect.ValueOf(sigsysHandler).Pointer(), &savedSigsysHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGSYS, err)
+	}
+	if err := c.ReplaceSignalHandler(syscall.SIGTRAP, reflect.ValueOf(sigtrapHandler).Pointer(), &savedSigtrapHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGTRAP, err)
+	}
+	restorer = signalRestorer(syscall.SIGSYS)
+	filter, err := buildRestorerFilter(uint64(restorer))
+	if err != nil {
+		log.Fatalf("Unable to build the seccomp filter: %v", err)
+	}
+	if err := c.InstallFilter(filter); err != nil {
+		log.Fatalf("Unable to install the seccomp filter: %v", err)
+	}
+
+	// The threads that run a sandbox hand the creation of threads to the
+	// template thread, which locking a thread starts.
+	runtime.LockOSThread()
+	runtime.UnlockOSThread()
+}
+
+// buildRestorerFilter generates a bpf program that kills the process if a
+// syscall other than rt_sigreturn is performed from the restorer, which is
+// excluded from the dispatch. It allows every other syscall.
+func buildRestorerFilter(restorer uint64) ([]c.SockFilter, error) {
+	lo, hi := uint32(restorer), uint32(restorer>>32)
+	if lo+restorerLen < lo {
+		return nil, errors.New("the signal restorer crosses a 4GB boundary")
+	}
+	allow := c.BpfStmt(c.BpfRetK, c.SeccompRetAllow)
+	kill := c.BpfStmt(c.BpfRetK, c.SeccompRetKillProcess)
+	return []c.SockFilter{
+		// Kill anything that is not x86_64.
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataArchOffset),
+		c.BpfJump(c.BpfJeqK, c.AuditArchX86_64, 1, 0),
+		kill,
+		// Allow the syscalls outside of the restorer.
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataIPOffset+4),
+		c.BpfJump(c.BpfJeqK, hi, 1, 0),
+		allow,
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataIPOffset),
+		c.BpfJump(c.BpfJgeK, lo, 1, 0),
+		allow,
+		c.BpfJump(c.BpfJgtK, lo+restorerLen-1, 0, 1),
+		allow,
+		// The restorer only returns from signal handlers.
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataNrOffset),
+		c.BpfJump(c.BpfJeqK, syscall.SYS_RT_SIGRETURN, 1, 0),
+		kill,
+		allow,
+	}, nil
+}
+
+// signalRestorer returns the restorer of the handler of sig.
+func signalRestorer(sig syscall.Signal) uintptr {
+	var sa struct {
+		handler  uintptr
+		flags    uint64
+		restorer uintptr
+		mask     uint64
+	}
+	if _, _, e := syscall.RawSyscall6(syscall.SYS_RT_SIGACTION, uintptr(sig), 0, uintptr(unsafe.Pointer(&sa)), 8, 0, 0); e != 0 {
+		log.Fatalf("Unable to read the handler for signal %d: %v", sig, e)
+	}
+	return sa.restorer
+}
+
+// blockSyscalls blocks the syscalls of the current thread, which is about to
+// run a sandbox. Syscall user dispatch is enabled the first time the thread
+// runs a sandbox. It is called by the scheduler.
+//
+//go:nosplit
+func blockSyscalls() {
+	if dmem == nil {
+		return
+	}
+	slot := runtime.GetmSbSlot()
+	if slot < 0 {
+		slot = allocSlot()
+		if _, _, err := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSyscallUserDispatch, prSysDispatchOn,
+			restorer, restorerLen, uintptr(unsafe.Pointer(&dmem.selectors[slot])), 0); err != 0 {
+			runtime.SbThrow("unable to enable syscall user dispatch")
+		}
+		runtime.SetmSbSlot(slot)
+	}
+	// The thread might still run with the rights of its previous sandbox.
+	WritePKRU(AllRightsPKRU)
+	dmem.selectors[slot] = dispatchBlock
+}
+
+// allowSyscalls allows the syscalls of the current thread, which stopped
+// running a sandbox.
+//
+//go:nosplit
+func allowSyscalls() {
+	if slot := runtime.GetmSbSlot(); slot >= 0 {
+		dmem.selectors[slot] = dispatchAllow
+	}
+}
+
+// allocSlot allocates a slot for the current thread. The slots of the
+// threads that exited are reclaimed when there are no free slots.
+//
+//go:nosplit
+func allocSlot() int {
+	tid, _, _ := syscall.RawSyscall(syscall.SYS_GETTID, 0, 0, 0)
+	for reclaim := false; ; reclaim = true {
+		for i := range threadTids {
+			if t := atomic.LoadInt32(&threadTids[i]); reclaim && t != 0 && threadExited(t) {
+				atomic.CompareAndSwapInt32(&threadTids[i], t, 0)
+			}
+			if atomic.CompareAndSwapInt32(&threadTids[i], 0, int32(tid)) {
+				reblocks[i] = false
+				return i
+			}
+		}
+		if reclaim {
+			runtime.SbThrow("too many threads run a sandbox")
+		}
+	}
+}
+
+// threadExited reports whether the thread tid exited.
+//
+//go:nosplit
+func threadExited(tid int32) bool {
+	_, _, err := syscall.RawSyscall(syscall.SYS_TGKILL, selfPid, uintptr(tid), 0)
+	return err == syscall.ESRCH
+}
+
+// handleSigsys is called by sigsysHandler on the signal stack.
+// It returns false if the signal was not generated by syscall user dispatch.
+//
+//go:nosplit
+func handleSigsys(info, ctx uintptr) bool {
+	slot := runtime.GetmSbSlot()
+	if *(*int32)(unsafe.Pointer(info + c.SiginfoCodeOffset)) != sysUserDispatchCode || slot < 0 {
+		return false
+	}
+	// The handler performs the syscalls.
+	dmem.selectors[slot] = dispatchAllow
+	nr := uint64(*(*int32)(unsafe.Pointer(info + c.SiginfoSyscallOffset)))
+	var (
+		r1    uintptr
+		errno uintptr = uintptr(syscall.EPERM)
+	)
+	args := [6]uintptr{uintptr(*c.CtxReg(ctx, c.RegRdi)), uintptr(*c.CtxReg(ctx, c.RegRsi)), uintptr(*c.CtxReg(ctx, c.RegRdx)),
+		uintptr(*c.CtxReg(ctx, c.RegR10)), uintptr(*c.CtxReg(ctx, c.RegR8)), uintptr(*c.CtxReg(ctx, c.RegR9))}
+	pkru := savedPKRU(ctx)
+	e := pkruEntry(pkru)
+	if !syscallAllowed(pkru, e, nr, &args) {
+		denied++
+	} else if passthroughSyscall(nr) {
+		// The thread performs the syscall again, handleSigtrap blocks its
+		// syscalls once it returns.
+		passthrough++
+		reblocks[slot] = true
+		*c.CtxReg(ctx, c.RegRip) -= syscallInsnLen
+		*c.CtxReg(ctx, c.RegRax) = nr
+		*c.CtxReg(ctx, c.RegEfl) |= eflagsTF
+		return true
+	} else if e == nil || !constrained(e, nr) {
+		emulated++
+		r1, errno = sigsysSyscall(pkru, uintptr(nr), args[0], args[1], args[2], args[3], args[4], args[5])
+	} else {
+		i := lockArgBuf()
+		if checkArgs(e, pkru, nr, &args, &dmem.argBufs[i]) {
+			emulated++
+			r1, errno = sigsysSyscall(pkru, uintptr(nr), args[0], args[1], args[2], args[3], args[4], args[5])
+		} else {
+			denied++
+		}
+		atomic.StoreUint32(&argBufLock[i], 0)
+	}
+	if errno != 0 {
+		*c.CtxReg(ctx, c.RegRax) = uint64(-errno)
+	} else {
+		*c.CtxReg(ctx, c.RegRax) = uint64(r1)
+	}
+	dmem.selectors[slot] = dispatchBlock
+	return true
+}
+
+// handleSigtrap is called by sigtrapHandler on the signal stack, once the
+// thread performed a syscall again. It returns false if the thread does not
+// perform a syscall again.
+//
+// The trap flag is inherited by the task the syscall creates, which does not
+// use syscall user dispatch and only clears the flag. The task can share the
+// TLS, and therefore the slot, of the thread until the runtime sets up its
+// own, which is why the slot is checked against the tid.
+//
+//go:nosplit
+func handleSigtrap(info, ctx uintptr) bool {
+	if *c.CtxReg(ctx, c.RegEfl)&eflagsTF == 0 {
+		return false
+	}
+	*c.CtxReg(ctx, c.RegEfl) &^= eflagsTF
+	slot := runtime.GetmSbSlot()
+	if slot < 0 || !reblocks[slot] {
+		return true
+	}
+	// The selector of the thread allows its syscalls, and the task has none.
+	tid, _ := sigsysSyscall(AllRightsPKRU, syscall.SYS_GETTID, 0, 0, 0, 0, 0, 0)
+	if int32(tid) == atomic.LoadInt32(&threadTids[slot]) {
+		reblocks[slot] = false
+		dmem.selectors[slot] = dispatchBlock
+	}
+	return true
+}
+
+// passthroughSyscall reports whether nr changes the signal state of the
+// thread or creates a task, and cannot be performed by the handler.
+//
+//go:nosplit
+func passthroughSyscall(nr uint64) bool {
+	switch nr {
+	case syscall.SYS_RT_SIGPROCMASK, syscall.SYS_RT_SIGSUSPEND, syscall.SYS_SIGALTSTACK,
+		syscall.SYS_CLONE, syscall.SYS_FORK, syscall.SYS_VFORK:
+		return true
+	}
+	return false
+}
+
+// savedPKRU reads the PKRU of the interrupted thread from the signal frame.
+//
+//go:nosplit
+func savedPKRU(ctx uintptr) PKRU {
+	fpregs := *(*uintptr)(unsafe.Pointer(ctx + c.UcontextFpregsOffset))
+	if fpregs == 0 || xsavePKRUOffset == 0 {
+		return AllRightsPKRU
+	}
+	// The component is in its init state, i.e., all rights.
+	xstateBv := *(*uint64)(unsafe.Pointer(fpregs + xsaveHeaderOffset))
+	if xstateBv&(1<<xsavePKRUComponent) == 0 {
+		return AllRightsPKRU
+	}
+	return *(*PKRU)(unsafe.Pointer(fpregs + xsavePKRUOffset))
+}
+
+// registerPKRU associates a sandbox PKRU with its syscall mask and the
+// constraints on its syscalls arguments, nil if none. It does not read
+// the constraints, the sandbox might not see them. Sandboxes sharing a PKRU get the
+// intersection of their masks and all their constraints. With virtualized
+// keys, a PKRU can be reused by another sandbox later on, which only makes
+// the mask more restrictive.
+//
+//go:nosplit
+func registerPKRU(pkru PKRU, sys c.SyscallMask, args *c.SyscallArgs) {
+	n := atomic.LoadInt32(&npkruToSys)
+	for i := int32(0); i < n; i++ {
+		e := &pkruToSys[i]
+		if e.pkru != pkru {
+			continue
+		}
+		e.sys &= sys
+		if args == nil {
+			return
+		}
+		for j := 0; j < e.nargs; j++ {
+			if e.args[j] == args {
+				return
+			}
+		}
+		if e.nargs == maxPKRUArgs {
+			// The sandboxes will not be allowed any constrained syscall.
+			e.args[maxPKRUArgs-1] = &denyArgs
+			return
+		}
+		e.args[e.nargs] = args
+		e.nargs++
+		return
+	}
+	if n == maxPKRUs {
+		// The sandbox will not be allowed any trapped syscall.
+		return
+	}
+	pkruToSys[n] = pkruMask{pkru: pkru, sys: sys}
+	if args != nil {
+		pkruToSys[n].args[0] = args
+		pkruToSys[n].nargs = 1
+	}
+	atomic.StoreInt32(&npkruToSys, n+1)
+}
+
+// denyArgs denies all the syscalls with arguments that can be constrained.
+var denyArgs = c.SyscallArgs{Paths: []string{}, Addrs: []c.SockAddr{}}
+
+// pkruEntry returns the entry of the sandbox that owns the pkru, nil if
+// there is none.
+//
+//go:nosplit
+func pkruEntry(pkru PKRU) *pkruMask {
+	n := atomic.LoadInt32(&npkruToSys)
+	for i := int32(0); i < n; i++ {
+		if pkruToSys[i].pkru == pkru {
+			return &pkruToSys[i]
+		}
+	}
+	return nil
+}
+
+// syscallAllowed checks the syscall against the mask of e, the entry of the
+// sandbox that owns the pkru. The trusted domain is allowed everything, the
+// sandboxes the syscalls of the runtime, see c.RuntimeSyscall. The sandboxes
+// cannot disable the dispatch, replace its handlers, or modify its memory.
+// They cannot create threads, the kernel would not trap them, and can only
+// create processes if they can execute any program.
+//
+//go:nosplit
+func syscallAllowed(pkru PKRU, e *pkruMask, nr uint64, args *[6]uintptr) bool {
+	if pkru == AllRightsPKRU {
+		return true
+	}
+	if e == nil {
+		return false
+	}
+	a0 := args[0]
+	switch {
+	case nr == syscall.SYS_PRCTL && a0 == prSetSyscallUserDispatch:
+		return false
+	case nr == syscall.SYS_RT_SIGACTION && (a0 == uintptr(syscall.SIGSYS) || a0 == uintptr(syscall.SIGTRAP)):
+		return false
+	case touchesDispatchMem(nr, args):
+		return false
+	case nr == syscall.SYS_CLONE && a0&syscall.CLONE_THREAD != 0:
+		return false
+	case nr == syscall.SYS_CLONE || nr == syscall.SYS_FORK || nr == syscall.SYS_VFORK:
+		return c.SyscallAllowed(e.sys, nr) && c.SyscallAllowed(e.sys, syscall.SYS_EXECVE) &&
+			!constrained(e, syscall.SYS_EXECVE)
+	}
+	return c.SyscallAllowed(e.sys, nr) || c.RuntimeSyscall(nr, args)
+}
+
+// touchesDispatchMem reports whether nr unmaps, remaps, protects or discards
+// the dispatch memory. A discarded selector allows the syscalls.
+//
+//go:nosplit
+func touchesDispatchMem(nr uint64, args *[6]uintptr) bool {
+	switch nr {
+	case syscall.SYS_MMAP:
+		return args[3]&(mapFixed|mapFixedNoreplace) != 0 && overlapsDispatchMem(args[0], args[1])
+	case syscall.SYS_MREMAP:
+		return overlapsDispatchMem(args[0], args[1]) || (args[3]&mremapFixed != 0 && overlapsDispatchMem(args[4], args[2]))
+	case syscall.SYS_MUNMAP, syscall.SYS_MPROTECT, sysPkeyMprotect, syscall.SYS_MADVISE:
+		return overlapsDispatchMem(args[0], args[1])
+	}
+	return false
+}
+
+// overlapsDispatchMem reports whether [addr, addr+n) overlaps the dispatch
+// memory, or wraps around.
+//
+//go:nosplit
+func overlapsDispatchMem(addr, n uintptr) bool {
+	if dmem == nil {
+		return false
+	}
+	start := uintptr(unsafe.Pointer(dmem))
+	end := start + unsafe.Sizeof(dispatchMem{})
+	return addr+n < addr || (addr < end && addr+n > start)
+}
+
+// constrained reports whether one of the constraints of e applies to nr.
+//
+//go:nosplit
+func constrained(e *pkruMask, nr uint64) bool {
+	for i := 0; i < e.nargs; i++ {
+		if e.args[i].Constrains(nr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkArgs checks the arguments of nr against all the constraints of e,
+// the arguments are read with the pkru. The arguments point to the copies
+// in buf once it returns.
+//
+//go:nosplit
+func checkArgs(e *pkruMask, pkru PKRU, nr uint64, args *[6]uintptr, buf *c.ArgBuf) bool {
+	for i := 0; i < e.nargs; i++ {
+		if !e.args[i].CheckArgs(nr, args, buf, readSelf, uintptr(pkru)) {
+			return false
+		}
+	}
+	return true
+}
+
+// lockArgBuf locks an argument buffer and returns its index.
+//
+//go:nosplit
+func lockArgBuf() int {
+	for {
+		for i := range argBufLock {
+			if atomic.CompareAndSwapUint32(&argBufLock[i], 0, 1) {
+				return i
+			}
+		}
+		sigsysSyscall(AllRightsPKRU, syscall.SYS_SCHED_YIELD, 0, 0, 0, 0, 0, 0)
+	}
+}
+
+// readSelf copies the memory at addr into dst with the rights of the PKRU
+// in ctx, it stops at the first page that the sandbox cannot read.
+//
+//go:nosplit
+func readSelf(ctx uintptr, dst []byte, addr uintptr) int {
+	if len(dst) == 0 {
+		return 0
+	}
+	local := iovec{addr, uintptr(len(dst))}
+	remote := iovec{uintptr(unsafe.Pointer(&dst[0])), uintptr(len(dst))}
+	r, errno := sigsysSyscall(PKRU(ctx), sysProcessVMWritev, selfPid, uintptr(unsafe.Pointer(&local)), 1,
+		uintptr(unsafe.Pointer(&remote)), 1, 0)
+	if errno != 0 {
+		return 0
+	}
+	return int(r)
+}
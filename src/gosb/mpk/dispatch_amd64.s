@@ -0,0 +1,122 @@
+#include "textflag.h"
+
+// sigsysHandler: see dispatch.go for documentation.
+//
+// The arguments are the following:
+//
+// 	DI - The signal number.
+// 	SI - Pointer to siginfo_t structure.
+// 	DX - Pointer to ucontext structure.
+//
+TEXT ·sigsysHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	// The kernel resets the PKRU on signal delivery, and our data is tagged.
+	// Sigreturn restores the interrupted thread's PKRU.
+	XORQ AX, AX
+	XORQ CX, CX
+	XORQ DX, DX
+	BYTE $0x0f; BYTE $0x01; BYTE $0xef // WRPKRU
+	MOVQ 0(SP), DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigsys(SB)      // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ sigsysFallback
+	RET
+
+sigsysFallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigsysHandler(SB), AX
+	JMP AX
+
+// sigtrapHandler: see dispatch.go for documentation.
+//
+// The arguments are the following:
+//
+// 	DI - The signal number.
+// 	SI - Pointer to siginfo_t structure.
+// 	DX - Pointer to ucontext structure.
+//
+TEXT ·sigtrapHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	// The kernel resets the PKRU on signal delivery, and our data is tagged.
+	// Sigreturn restores the interrupted thread's PKRU.
+	XORQ AX, AX
+	XORQ CX, CX
+	XORQ DX, DX
+	BYTE $0x0f; BYTE $0x01; BYTE $0xef // WRPKRU
+	MOVQ 0(SP), DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigtrap(SB)     // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ sigtrapFallback
+	RET
+
+sigtrapFallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigtrapHandler(SB), AX
+	JMP AX
+
+// func sigsysSyscall(pkru PKRU, trap, a1, a2, a3, a4, a5, a6 uintptr) (r1 uintptr, errno uintptr)
+TEXT ·sigsysSyscall(SB),NOSPLIT,$0-80
+	MOVL pkru+0(FP), AX
+	XORQ CX, CX
+	XORQ DX, DX
+	BYTE $0x0f; BYTE $0x01; BYTE $0xef // WRPKRU
+	MOVQ a1+16(FP), DI
+	MOVQ a2+24(FP), SI
+	MOVQ a3+32(FP), DX
+	MOVQ a4+40(FP), R10
+	MOVQ a5+48(FP), R8
+	MOVQ a6+56(FP), R9
+	MOVQ trap+8(FP), AX
+	SYSCALL
+	MOVQ AX, R12
+	XORQ AX, AX
+	XORQ CX, CX
+	XORQ DX, DX
+	BYTE $0x0f; BYTE $0x01; BYTE $0xef // WRPKRU
+	CMPQ R12, $0xfffffffffffff001
+	JLS ok
+	MOVQ $-1, r1+64(FP)
+	NEGQ R12
+	MOVQ R12, errno+72(FP)
+	RET
+ok:
+	MOVQ R12, r1+64(FP)
+	MOVQ $0, errno+72(FP)
+	RET
+
+// func cpuid(eax, ecx uint32) (a, b, c, d uint32)
+TEXT ·cpuid(SB),NOSPLIT,$0-24
+	MOVL eax+0(FP), AX
+	MOVL ecx+4(FP), CX
+	CPUID
+	MOVL AX, a+8(FP)
+	MOVL BX, b+12(FP)
+	MOVL CX, c+16(FP)
+	MOVL DX, d+20(FP)
+	RET
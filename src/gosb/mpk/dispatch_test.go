@@ -0,0 +1,115 @@
+package mpk
+
+import (
+	c "gosb/commons"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// runFilter interprets the bpf program on a seccomp_data.
+func runFilter(filter []c.SockFilter, nr, arch uint32, ip uint64) uint32 {
+	data := [4]uint32{nr, arch, uint32(ip), uint32(ip >> 32)}
+	var acc uint32
+	for pc := 0; pc < len(filter); pc++ {
+		f := filter[pc]
+		switch f.Code {
+		case c.BpfLdAbsW:
+			acc = data[f.K/4]
+		case c.BpfRetK:
+			return f.K
+		case c.BpfJeqK, c.BpfJgtK, c.BpfJgeK:
+			taken := (f.Code == c.BpfJeqK && acc == f.K) || (f.Code == c.BpfJgtK && acc > f.K) ||
+				(f.Code == c.BpfJgeK && acc >= f.K)
+			if taken {
+				pc += int(f.Jt)
+			} else {
+				pc += int(f.Jf)
+			}
+		default:
+			panic("unknown bpf instruction")
+		}
+	}
+	panic("bpf program without return")
+}
+
+func TestRestorerFilter(t *testing.T) {
+	const rstr = 0x7f0000001000
+	filter, err := buildRestorerFilter(rstr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		nr   uint32
+		arch uint32
+		ip   uint64
+		want uint32
+	}{
+		{syscall.SYS_RT_SIGRETURN, c.AuditArchX86_64, rstr + 9, c.SeccompRetAllow},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr + 9, c.SeccompRetKillProcess},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr, c.SeccompRetKillProcess},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr + restorerLen - 1, c.SeccompRetKillProcess},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr + restorerLen, c.SeccompRetAllow},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr - 1, c.SeccompRetAllow},
+		{syscall.SYS_GETPID, c.AuditArchX86_64, rstr + 9 + 1<<32, c.SeccompRetAllow},
+		{syscall.SYS_GETPID, 0x40000003, 0x1000, c.SeccompRetKillProcess},
+	}
+	for _, tt := range tests {
+		if got := runFilter(filter, tt.nr, tt.arch, tt.ip); got != tt.want {
+			t.Errorf("syscall %d from %#x: got %#x, want %#x\n", tt.nr, tt.ip, got, tt.want)
+		}
+	}
+	if _, err := buildRestorerFilter(0x7ffffffffff8); err == nil {
+		t.Errorf("a restorer across 4GB should be rejected\n")
+	}
+}
+
+func TestSyscallAllowed(t *testing.T) {
+	saved := dmem
+	defer func() { dmem = saved }()
+	dmem = new(dispatchMem)
+	sel := uintptr(unsafe.Pointer(&dmem.selectors[0]))
+
+	sys := func(classes string) *pkruMask {
+		mask, err := c.ParseSyscalls(classes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pkruMask{pkru: 0x55555554, sys: mask}
+	}
+	tests := []struct {
+		e    *pkruMask
+		nr   uint64
+		args [6]uintptr
+		want bool
+	}{
+		{sys("file"), syscall.SYS_OPENAT, [6]uintptr{}, true},
+		{sys(""), syscall.SYS_OPENAT, [6]uintptr{}, false},
+		{sys(""), syscall.SYS_WRITE, [6]uintptr{1}, true},
+		{sys("all"), syscall.SYS_PRCTL, [6]uintptr{prSetSyscallUserDispatch, prSysDispatchOff}, false},
+		{sys("all"), syscall.SYS_RT_SIGACTION, [6]uintptr{uintptr(syscall.SIGSYS)}, false},
+		{sys("all"), syscall.SYS_RT_SIGACTION, [6]uintptr{uintptr(syscall.SIGTRAP)}, false},
+		{sys("all"), syscall.SYS_RT_SIGACTION, [6]uintptr{uintptr(syscall.SIGUSR1)}, true},
+		{sys("all"), syscall.SYS_CLONE, [6]uintptr{syscall.CLONE_VM | syscall.CLONE_THREAD}, false},
+		{sys("all"), syscall.SYS_CLONE, [6]uintptr{uintptr(syscall.SIGCHLD)}, true},
+		{sys("proc"), syscall.SYS_FORK, [6]uintptr{}, true},
+		{sys("file"), syscall.SYS_FORK, [6]uintptr{}, false},
+		{sys("all"), syscall.SYS_MUNMAP, [6]uintptr{sel, 4096}, false},
+		{sys("all"), syscall.SYS_MADVISE, [6]uintptr{sel &^ 4095, 4096, 4}, false},
+		{sys("all"), syscall.SYS_MPROTECT, [6]uintptr{sel, 4096, syscall.PROT_NONE}, false},
+		{sys("all"), syscall.SYS_MMAP, [6]uintptr{sel, 4096, 0, mapFixed | syscall.MAP_ANONYMOUS}, false},
+		{sys("all"), syscall.SYS_MMAP, [6]uintptr{sel, 4096, 0, syscall.MAP_ANONYMOUS}, true},
+		{sys("all"), syscall.SYS_MREMAP, [6]uintptr{0x1000, 4096, 4096, mremapFixed, sel}, false},
+		{sys("all"), syscall.SYS_MUNMAP, [6]uintptr{sel - 8192, 4096}, true},
+		{nil, syscall.SYS_GETPID, [6]uintptr{}, false},
+	}
+	for _, tt := range tests {
+		pkru := PKRU(0x55555554)
+		if got := syscallAllowed(pkru, tt.e, tt.nr, &tt.args); got != tt.want {
+			t.Errorf("syscall %d %v: got %v, want %v\n", tt.nr, tt.args, got, tt.want)
+		}
+	}
+	if !syscallAllowed(AllRightsPKRU, nil, syscall.SYS_PRCTL, &[6]uintptr{prSetSyscallUserDispatch}) {
+		t.Errorf("the trusted domain should be allowed everything\n")
+	}
+}
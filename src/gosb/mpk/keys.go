@@ -0,0 +1,442 @@
+package mpk
+
+/*
+* @author: aghosn
+*
+* Protection key virtualization.
+*
+* The hardware provides 15 usable pkeys. When there are more package groups
+* than keys, keys are cached in the spirit of libmpk: a group only owns a key
+* while it is resident, and the pages of evicted groups are tagged with a
+* reserved key on which no sandbox has rights. Entering a sandbox makes its
+* groups resident, evicting the least recently used groups that are not
+* pinned by a thread running a sandbox, and re-tags the pages with
+* pkey_mprotect.
+*
+* A sandbox that cannot get its keys waits in its prolog. When it is
+* rescheduled and cannot get them, it runs without rights on its evicted
+* groups: the program is slower, or faults, but isolation is preserved.
+*
+* The heap spans of the groups are kept in a hash table indexed by their
+* base. The hooks that record them run inside the allocator and cannot
+* allocate, the table is mmapped and grows by doubling. A span that cannot
+* be recorded is tagged with the reserved key: it cannot be re-tagged on
+* evictions, and no sandbox gets rights on it.
+ */
+
+import (
+	"fmt"
+	c "gosb/commons"
+	g "gosb/globals"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// Initial number of slots of the span table, a power of 2.
+	minSpanSlots = 1 << 10
+)
+
+// sect is a page range tagged with the key of its group.
+type sect struct {
+	addr uintptr
+	size uintptr
+	prot SysProt
+}
+
+// group is a set of packages that share a protection key.
+type group struct {
+	sects []sect
+	key   Pkey   // evictedKey when the group is not resident
+	pins  int32  // threads running a sandbox that uses the group
+	used  uint64 // last use, for the LRU
+	doms  []int  // domains that use the group
+}
+
+// domain holds the keys of a sandbox.
+type domain struct {
+	id     c.SandId
+	groups []int
+	prots  []Prot
+	sys    c.SyscallMask
+	args   *c.SyscallArgs // nil if the arguments are not constrained
+	pkru   PKRU
+	valid  bool // all the groups are resident and pkru is up to date
+}
+
+// heapSpan is a heap span owned by a group.
+type heapSpan struct {
+	start uintptr // 0 if the slot was never used
+	size  uintptr
+	group int // index in groups + 1, 0 if the slot is free
+}
+
+// spanTable is an open addressing hash table of heap spans, indexed by their
+// base, with linear probing. Freed slots keep their base until the table is
+// rehashed, so that the probe sequences that go through them are not cut.
+type spanTable struct {
+	slots []heapSpan // mmapped, nil until the first span
+	live  int        // slots holding a span
+	used  int        // slots with a base
+}
+
+var (
+	groups   []group
+	domains  []domain
+	sbDomain map[c.SandId]int
+	pkgGroup map[int]int
+
+	// The key cache, only used when there are more groups than keys.
+	virtualized bool
+	evictedKey  Pkey = -1
+	clock       uint64
+	kmu         uint32
+
+	// Heap spans of the groups, to re-tag them on eviction.
+	heapSpans spanTable
+
+	// Key metrics
+	keyHits      uint64
+	keyMisses    uint64
+	keyEvictions uint64
+	keyWaits     uint64
+	keyFailures  uint64
+	untracked    uint64
+)
+
+// initKeys allocates the hardware keys, and virtualizes them if there are
+// not enough for all the groups.
+func initKeys(pkgGroups [][]int, sbGroups map[c.SandId][]int, sbProts map[c.SandId][]Prot) {
+	groups = make([]group, len(pkgGroups))
+	pkgGroup = make(map[int]int)
+	for i, pkgs := range pkgGroups {
+		for _, id := range pkgs {
+			pkgGroup[id] = i
+			groups[i].sects = append(groups[i].sects, packageSects(id)...)
+		}
+	}
+
+	keys := make([]Pkey, 0, len(groups))
+	for len(keys) < len(groups) {
+		key, err := PkeyAlloc()
+		if err != nil {
+			if len(keys) == 0 {
+				panic(err)
+			}
+			break
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) < len(groups) {
+		// Reserve a key for the evicted groups.
+		if len(keys) < 2 {
+			panic("Not enough protection keys to virtualize them")
+		}
+		virtualized = true
+		evictedKey, keys = keys[len(keys)-1], keys[:len(keys)-1]
+	}
+	for i := range groups {
+		key := evictedKey
+		if i < len(keys) {
+			key = keys[i]
+		}
+		retag(i, key)
+	}
+
+	sbDomain = make(map[c.SandId]int, len(g.Sandboxes))
+	for id, sb := range g.Sandboxes {
+		var args *c.SyscallArgs
+		if a := &sb.Config.Args; a.Paths != nil || a.Addrs != nil {
+			args = a
+		}
+		domains = append(domains, domain{id: id, groups: sbGroups[id], prots: sbProts[id], sys: sb.Config.Sys, args: args})
+		sbDomain[id] = len(domains) - 1
+	}
+	for i := range domains {
+		d := &domains[i]
+		for _, gi := range d.groups {
+			groups[gi].doms = append(groups[gi].doms, i)
+		}
+		computePKRU(d)
+	}
+}
+
+// packageSects returns the sections of the package.
+func packageSects(id int) []sect {
+	pkg, ok := g.IdToPkg[id]
+	if !ok {
+		panic("Package not found")
+	}
+	sects := make([]sect, 0, len(pkg.Sects))
+	for _, section := range pkg.Sects {
+		if section.Size > 0 {
+			sects = append(sects, sect{uintptr(section.Addr), uintptr(section.Size), getSectionProt(section)})
+		}
+	}
+	return sects
+}
+
+//go:nosplit
+func lockKeys() {
+	for !atomic.CompareAndSwapUint32(&kmu, 0, 1) {
+		syscall.RawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+	}
+}
+
+//go:nosplit
+func unlockKeys() {
+	atomic.StoreUint32(&kmu, 0)
+}
+
+// enter makes the groups of the domain resident, pins them, and returns
+// the PKRU of the domain. If wait is set, it yields until the keys are
+// available. Otherwise, the returned PKRU has no rights on the groups that
+// are not resident.
+func enter(d *domain, wait bool) PKRU {
+	for {
+		lockKeys()
+		ok := acquire(d)
+		if ok || !wait {
+			if !ok {
+				keyFailures++
+			}
+			pin(d, 1)
+			pkru := d.pkru
+			unlockKeys()
+			return pkru
+		}
+		unlockKeys()
+		keyWaits++
+		runtime.Gosched()
+	}
+}
+
+// leave unpins the groups of the domain.
+func leave(d *domain) {
+	lockKeys()
+	pin(d, -1)
+	unlockKeys()
+}
+
+//go:nosplit
+func pin(d *domain, delta int32) {
+	if !virtualized {
+		return
+	}
+	for _, gi := range d.groups {
+		groups[gi].pins += delta
+	}
+}
+
+// acquire makes the groups of the domain resident.
+// It must be called with kmu held.
+//
+//go:nosplit
+func acquire(d *domain) bool {
+	if !virtualized {
+		return true
+	}
+	clock++
+	for _, gi := range d.groups {
+		groups[gi].used = clock
+	}
+	ok := true
+	for _, gi := range d.groups {
+		if groups[gi].key != evictedKey {
+			keyHits++
+			continue
+		}
+		keyMisses++
+		victim := -1
+		for i := range groups {
+			v := &groups[i]
+			if v.key == evictedKey || v.pins != 0 || v.used == clock {
+				continue
+			}
+			if victim == -1 || v.used < groups[victim].used {
+				victim = i
+			}
+		}
+		if victim == -1 {
+			ok = false
+			continue
+		}
+		keyEvictions++
+		key := groups[victim].key
+		retag(victim, evictedKey)
+		retag(gi, key)
+	}
+	if !d.valid {
+		computePKRU(d)
+	}
+	return ok
+}
+
+// retag tags the memory of the group with the key.
+//
+//go:nosplit
+func retag(gi int, key Pkey) {
+	gr := &groups[gi]
+	gr.key = key
+	for _, s := range gr.sects {
+		pkeyMprotect(s.addr, s.size, s.prot, key)
+	}
+	for i := range heapSpans.slots {
+		if s := &heapSpans.slots[i]; s.group == gi+1 {
+			pkeyMprotect(s.start, s.size, SysProtRW, key)
+		}
+	}
+	for _, di := range gr.doms {
+		domains[di].valid = false
+	}
+}
+
+// computePKRU computes the PKRU of the domain from the current keys.
+//
+//go:nosplit
+func computePKRU(d *domain) {
+	pkru := uint32(NoRightsPKRU)
+	if dispatchKey != -1 {
+		// The kernel reads the syscall selector of the thread.
+		pkru &^= 3 << (2 * uint32(dispatchKey))
+		pkru |= uint32(ProtRX) << (2 * uint32(dispatchKey))
+	}
+	d.valid = true
+	for i, gi := range d.groups {
+		key := groups[gi].key
+		if key == evictedKey {
+			d.valid = false
+			continue
+		}
+		pkru &^= 3 << (2 * uint32(key))
+		pkru |= uint32(d.prots[i]) << (2 * uint32(key))
+	}
+	d.pkru = PKRU(pkru)
+	if d.id != g.TrustedSandbox {
+		registerPKRU(d.pkru, d.sys, d.args)
+	}
+}
+
+// trackSpan records the group of a heap span, and returns the key to tag
+// it with. It must be called with kmu held.
+//
+//go:nosplit
+func trackSpan(gi int, start, size uintptr) Pkey {
+	if !virtualized {
+		return groups[gi].key
+	}
+	t := &heapSpans
+	if (t.used+1)*2 > len(t.slots) && !t.grow() {
+		// The span cannot be re-tagged, fail closed.
+		untracked++
+		t.remove(start)
+		return evictedKey
+	}
+	s := t.lookup(start)
+	if s.group == 0 {
+		t.live++
+	}
+	if s.start == 0 {
+		t.used++
+	}
+	*s = heapSpan{start, size, gi + 1}
+	return groups[gi].key
+}
+
+// untrackSpan forgets a heap span. It must be called with kmu held.
+//
+//go:nosplit
+func untrackSpan(start uintptr) {
+	if virtualized {
+		heapSpans.remove(start)
+	}
+}
+
+// lookup returns the slot of the span at start, or the slot to record it
+// in. The table must have a free slot.
+//
+//go:nosplit
+func (t *spanTable) lookup(start uintptr) *heapSpan {
+	mask := uintptr(len(t.slots) - 1)
+	free := (*heapSpan)(nil)
+	for i := spanHash(start) & mask; ; i = (i + 1) & mask {
+		s := &t.slots[i]
+		if s.start == start {
+			return s
+		}
+		if s.group == 0 && free == nil {
+			free = s
+		}
+		if s.start == 0 {
+			return free
+		}
+	}
+}
+
+// remove frees the slot of the span at start, if any.
+//
+//go:nosplit
+func (t *spanTable) remove(start uintptr) {
+	if t.slots == nil {
+		return
+	}
+	if s := t.lookup(start); s.start == start && s.group != 0 {
+		s.group = 0
+		t.live--
+	}
+}
+
+// grow rehashes the table into a new one, twice as large unless most of
+// its used slots are free. It returns false if the memory cannot be mapped.
+//
+//go:nosplit
+func (t *spanTable) grow() bool {
+	n := minSpanSlots
+	for n < 4*(t.live+1) {
+		n *= 2
+	}
+	size := uintptr(n) * unsafe.Sizeof(heapSpan{})
+	p, _, err := syscall.RawSyscall6(syscall.SYS_MMAP, 0, size, syscall.PROT_READ|syscall.PROT_WRITE,
+		syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS, ^uintptr(0), 0)
+	if err != 0 {
+		return false
+	}
+	old := t.slots
+	t.slots = (*[1 << 30]heapSpan)(unsafe.Pointer(p))[:n:n]
+	t.live, t.used = 0, 0
+	for i := range old {
+		if s := &old[i]; s.group != 0 {
+			*t.lookup(s.start) = *s
+			t.live++
+			t.used++
+		}
+	}
+	if old != nil {
+		syscall.RawSyscall(syscall.SYS_MUNMAP, uintptr(unsafe.Pointer(&old[0])), uintptr(len(old))*unsafe.Sizeof(heapSpan{}), 0)
+	}
+	return true
+}
+
+// spanHash hashes the base of a span, spans are page aligned.
+//
+//go:nosplit
+func spanHash(start uintptr) uintptr {
+	return (start >> 12) * 0x9e3779b97f4a7c15 >> 32
+}
+
+//go:nosplit
+func pkeyMprotect(addr, size uintptr, prot SysProt, key Pkey) {
+	syscall.RawSyscall6(sysPkeyMprotect, addr, size, uintptr(prot), uintptr(key), 0, 0)
+}
+
+// Stats prints the statistics of the backend.
+func Stats() {
+	fmt.Printf("entries: %v, exits: %v, escapes: %v\n", entries, exits, escapes)
+	fmt.Printf("cpu: %v\n", g.CPUStats())
+	if virtualized {
+		fmt.Printf("keys: %v groups, hits: %v, misses: %v, evictions: %v, waits: %v, failures: %v, untracked spans: %v\n",
+			len(groups), keyHits, keyMisses, keyEvictions, keyWaits, keyFailures, untracked)
+	}
+}
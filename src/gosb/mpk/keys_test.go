@@ -0,0 +1,55 @@
+package mpk
+
+import "testing"
+
+func TestSpanTable(t *testing.T) {
+	defer func(v bool, gs []group, hs spanTable) {
+		virtualized, groups, heapSpans = v, gs, hs
+	}(virtualized, groups, heapSpans)
+	virtualized, heapSpans = true, spanTable{}
+	groups = []group{{key: 1}, {key: 2}}
+
+	// More spans than the former fixed table could hold.
+	const n, page = 1 << 15, 1 << 13
+	base := uintptr(0xc000000000)
+	for i := uintptr(0); i < n; i++ {
+		if key := trackSpan(int(i%2), base+i*page, page); key != groups[i%2].key {
+			t.Fatalf("span %d: got key %d, want %d", i, key, groups[i%2].key)
+		}
+	}
+	// Transfers and frees.
+	for i := uintptr(0); i < n; i += 4 {
+		trackSpan(1, base+i*page, 2*page)
+		untrackSpan(base + (i+1)*page)
+	}
+	if heapSpans.live != 3*n/4 {
+		t.Errorf("got %d live spans, want %d", heapSpans.live, 3*n/4)
+	}
+	for i := uintptr(0); i < n; i++ {
+		s := heapSpans.lookup(base + i*page)
+		want := int(i%2) + 1
+		switch i % 4 {
+		case 0:
+			want = 2
+		case 1:
+			want = 0
+		}
+		if s.group != want || (want != 0 && s.start != base+i*page) {
+			t.Fatalf("span %d: got group %d at %#x, want %d", i, s.group, s.start, want)
+		}
+	}
+	// Freed slots are reused.
+	slots := len(heapSpans.slots)
+	for j := 0; j < 4; j++ {
+		for i := uintptr(1); i < n; i += 4 {
+			trackSpan(0, base+i*page, page)
+			untrackSpan(base + i*page)
+		}
+	}
+	if len(heapSpans.slots) != slots {
+		t.Errorf("table grew from %d to %d slots without new spans", slots, len(heapSpans.slots))
+	}
+	if untracked != 0 {
+		t.Errorf("%d spans were not tracked", untracked)
+	}
+}
@@ -0,0 +1,102 @@
+package mpk
+
+import (
+	"bytes"
+	"gosb/internal/gosbtest"
+	"io/ioutil"
+	"syscall"
+	"testing"
+)
+
+const progLib = `package lib
+
+var Keep [][]byte
+
+func Alloc(n int) {
+	for i := 0; i < n; i++ {
+		Keep = append(Keep, make([]byte, 4096))
+	}
+}
+`
+
+const progMain = `package main
+
+import (
+	"fmt"
+	"gosb"
+	"os"
+	"prog/lib"
+	"syscall"
+)
+
+func main() {
+	gosb.InitializeDefault()
+	sandbox["prog/lib:RW", "file"]() {
+		lib.Alloc(10)
+		f, err := os.Open("/etc/hosts")
+		fmt.Println("open file:", err)
+		if f != nil {
+			f.Close()
+		}
+	}()
+	sandbox["prog/lib:RW", ""]() {
+		_, err := os.Open("/etc/hosts")
+		fmt.Println("open:", err)
+		_, _, e := syscall.RawSyscall6(syscall.SYS_PRCTL, 59, 0, 0, 0, 0, 0)
+		fmt.Println("dispatch off:", e)
+		_, _, e = syscall.RawSyscall(syscall.SYS_CLONE, syscall.CLONE_THREAD, 0, 0)
+		fmt.Println("thread:", e)
+		// The runtime grows the heap, the sandbox cannot map code.
+		lib.Alloc(4096)
+		_, err = syscall.Mmap(-1, 0, 4096, syscall.PROT_READ|syscall.PROT_EXEC, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+		fmt.Println("mmap exec:", err)
+		// The runtime creates threads for the goroutines, the sandbox
+		// cannot.
+		done := make(chan int)
+		for i := 0; i < 4; i++ {
+			go func(i int) {
+				n := 0
+				for j := 0; j < 1e7; j++ {
+					n += j % (i + 1)
+				}
+				done <- n
+			}(i)
+		}
+		for i := 0; i < 4; i++ {
+			<-done
+		}
+		fmt.Println("goroutines: done")
+	}()
+	f, err := os.Open("/etc/hosts")
+	fmt.Println("trusted:", err)
+	if f != nil {
+		f.Close()
+	}
+}
+`
+
+const progWant = `open file: <nil>
+open: open /etc/hosts: operation not permitted
+dispatch off: operation not permitted
+thread: operation not permitted
+mmap exec: operation not permitted
+goroutines: done
+trusted: <nil>
+`
+
+// mustHaveMPK skips the test if the machine does not support MPK or
+// syscall user dispatch.
+func mustHaveMPK(t *testing.T) {
+	cpuinfo, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil || !bytes.Contains(cpuinfo, []byte(" pku")) {
+		t.Skip("skipping: no MPK support")
+	}
+	if _, _, e := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetSyscallUserDispatch, prSysDispatchOff, 0, 0, 0, 0); e != 0 {
+		t.Skip("skipping: no syscall user dispatch")
+	}
+}
+
+func TestSyscallEnforcement(t *testing.T) {
+	mustHaveMPK(t)
+	gosbtest.Run(t, "mpk", map[string]string{"main.go": progMain, "lib/lib.go": progLib}, progWant)
+}
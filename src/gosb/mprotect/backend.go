@@ -0,0 +1,480 @@
+package mprotect
+
+/*
+* @author: aghosn
+*
+* Pure software backend, for machines without KVM or PKU support.
+*
+* The memory of the bloated packages is split into regions, so that each
+* region has a uniform protection in every sandbox's SandboxMemory.Static.
+* When a sandbox starts executing, the regions are mprotected according to
+* its view, and restored to their original protections when it returns.
+* Heap spans registered for those packages are handled the same way, using
+* the sandbox's view of their owner.
+*
+* Protections are process-wide: only one sandbox view can be applied at a
+* time, so the entry of a sandbox waits until the other ones have returned.
+* Trusted threads that fault on a protected region are let through for one
+* instruction, by unprotecting the region and single-stepping the thread.
+* The threads of the sandbox are paused while the region is open, see
+* pauseSandbox. Sandbox threads that perform an illegal access get a
+* recoverable commons.Violation.
+*
+* Differences with the VTX backend:
+* - The runtime, internal packages and the backend are never protected.
+*   The sandbox can call into them, e.g., to copy memory, but they are not
+*   in the view of the sandbox with VTX either.
+* - The heap that has no package, e.g., the one of the trusted packages,
+*   is not protected: the runtime does not know its owner.
+* - Sandboxes with different views do not run concurrently, trusted
+*   threads are slowed down by every access to a protected region.
+* - Syscalls and their arguments are not filtered, and the kernel returns EFAULT instead of
+*   faulting when it accesses protected memory on the sandbox's behalf.
+* - Goroutines spawned by a sandbox are isolated only while the sandbox
+*   that spawned them is running.
+*
+* The backend is best-effort: a sandbox can undo its protections with
+* mprotect. The state the signal handlers trust, i.e., the regions, their
+* protections in each sandbox, and the active sandbox, is mapped on pages
+* of its own, which are read-only while a sandbox view is applied, see seal.
+* The memory of the runtime and of the rest of the backend is writable.
+ */
+
+import (
+	"fmt"
+	c "gosb/commons"
+	g "gosb/globals"
+	"log"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// Upper bound on the number of threads we track.
+	maxThreads = 1024
+
+	// Upper bound on the number of heap spans we protect.
+	maxHeapRegions = 1 << 14
+
+	// Upper bound on the regions opened for a single instruction.
+	maxPending = 4
+)
+
+// region is a page-aligned range of memory owned by a bloated package.
+type region struct {
+	addr uintptr
+	size uintptr
+	end  uintptr // end of the package's content, the last page can be shared
+	prot uint8   // original protection
+	pkg  int     // id of the owner
+	idx  int     // index in regions, -1 for the heap
+}
+
+// thread associates a thread with the sandbox it executes.
+type thread struct {
+	tid     int32
+	sb      int32 // index in sbIds + 1, 0 when trusted
+	parked  int32 // the pause it is parked for, see pauseSandbox
+	npend   int32
+	pending [maxPending]*region // regions opened for the current instruction
+}
+
+// sealed is the state that the signal handlers trust. It is mapped on pages
+// of its own, read-only while a sandbox view is applied. It is only written
+// with mu held.
+type sealed struct {
+	// Static regions and their protection in each sandbox, targets is
+	// indexed by (sandbox index - 1) * len(regions) + region index.
+	regions []region
+	targets []uint8
+
+	// Heap regions and the view of each sandbox on the packages, views is
+	// indexed by (sandbox index - 1) * npkgs + package id.
+	heap  [maxHeapRegions]region
+	nheap int32
+	views []uint8
+
+	// The sandbox whose view is applied.
+	active int32
+}
+
+var (
+	st       *sealed
+	stSize   uintptr
+	stSealed bool
+
+	npkgs      int
+	pkgManaged []bool
+
+	sbIds   []c.SandId
+	sbIndex map[c.SandId]int32
+
+	// The number of active entries of the sandbox whose view is applied,
+	// and the lock that protects them and the sealed state.
+	users int32
+	mu    uint32
+
+	// threads is read by the signal handlers and cannot be a map.
+	threads [maxThreads]thread
+
+	// The lock of the thread that opened regions, and the current pause.
+	stepMu  uint32
+	stepGen int32
+
+	// Pointers to the runtime's handlers.
+	savedSigsegvHandler uintptr
+	savedSigtrapHandler uintptr
+
+	violationTrampolineAddr uintptr
+
+	// selfPid is the pid for tgkill.
+	selfPid uintptr
+
+	// Statistics
+	entries    uint64
+	exits      uint64
+	escapes    uint64
+	faults     uint64
+	violations uint64
+)
+
+// Init relies on domains and packages, they must be initialized before the call
+func Init() {
+	initRegions()
+	selfPid, _ = rawSyscall(syscall.SYS_GETPID, 0, 0, 0)
+	violationTrampolineAddr = reflect.ValueOf(violationTrampoline).Pointer()
+	if err := c.ReplaceSignalHandler(syscall.SIGSEGV, reflect.ValueOf(sigsegvHandler).Pointer(), &savedSigsegvHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGSEGV, err)
+	}
+	runtime.InstallSigHandler(uint32(syscall.SIGTRAP))
+	if err := c.ReplaceSignalHandler(syscall.SIGTRAP, reflect.ValueOf(sigtrapHandler).Pointer(), &savedSigtrapHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGTRAP, err)
+	}
+}
+
+// initRegions splits the sections of the managed packages at the
+// boundaries of the sandboxes' static views, and computes the protection
+// of every region in every sandbox.
+func initRegions() {
+	sbIndex = make(map[c.SandId]int32)
+	for id := range g.Sandboxes {
+		if id != g.TrustedSandbox {
+			sbIds = append(sbIds, id)
+		}
+	}
+	sort.Strings(sbIds)
+	for i, id := range sbIds {
+		sbIndex[id] = int32(i + 1)
+	}
+
+	npkgs = int(atomic.LoadUint32(&g.NextPkgId)) + 1
+	pkgManaged = make([]bool, npkgs)
+	var regions []region
+	for _, p := range g.AllPackages {
+		if !managed(p) {
+			continue
+		}
+		if p.Id >= 0 && p.Id < npkgs {
+			pkgManaged[p.Id] = true
+		}
+		for _, s := range p.Sects {
+			if s.Size == 0 {
+				continue
+			}
+			start := uintptr(c.Round(s.Addr, false))
+			end := uintptr(c.Round(s.Addr+s.Size, true))
+			cuts := []uintptr{start, end}
+			for _, id := range sbIds {
+				static := g.Sandboxes[id].Static
+				for v := c.ToVMA(static.First); v != nil; v = c.ToVMA(v.Next) {
+					for _, b := range []uintptr{uintptr(v.Addr), uintptr(v.Addr + v.Size)} {
+						if start < b && b < end {
+							cuts = append(cuts, b)
+						}
+					}
+				}
+			}
+			sort.Slice(cuts, func(i, j int) bool { return cuts[i] < cuts[j] })
+			prot := s.Prot & (c.R_VAL | c.W_VAL | c.X_VAL)
+			for i := 0; i < len(cuts)-1; i++ {
+				if cuts[i] == cuts[i+1] {
+					continue
+				}
+				r := region{cuts[i], cuts[i+1] - cuts[i], cuts[i+1], prot, p.Id, len(regions)}
+				if last := uintptr(s.Addr + s.Size); r.end > last {
+					r.end = last
+				}
+				regions = append(regions, r)
+			}
+		}
+	}
+
+	allocSealed(len(regions), len(sbIds)*len(regions), len(sbIds)*npkgs)
+	copy(st.regions, regions)
+	regions, targets, views := st.regions, st.targets, st.views
+	for i, id := range sbIds {
+		sb := g.Sandboxes[id]
+		for j := range regions {
+			targets[i*len(regions)+j] = staticProt(sb.Static, &regions[j])
+		}
+		for pkg, view := range sb.View {
+			if pkg >= 0 && pkg < npkgs {
+				views[i*npkgs+pkg] = view & c.HEAP_VAL &^ c.USER_VAL
+			}
+		}
+	}
+}
+
+// allocSealed maps the sealed state, with the room for the regions, targets
+// and views.
+func allocSealed(nregions, ntargets, nviews int) {
+	rsize := unsafe.Sizeof(region{})
+	size := unsafe.Sizeof(sealed{}) + uintptr(nregions)*rsize + uintptr(ntargets+nviews)
+	size = uintptr(c.Round(uint64(size), true))
+	p, err := c.Mmap(0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_PRIVATE|syscall.MAP_ANONYMOUS, -1, 0)
+	if err != 0 {
+		log.Fatalf("Unable to map the state of the backend: %v", err)
+	}
+	st, stSize = (*sealed)(unsafe.Pointer(p)), size
+	p += unsafe.Sizeof(sealed{})
+	if nregions != 0 {
+		st.regions = (*[1 << 30]region)(unsafe.Pointer(p))[:nregions:nregions]
+		p += uintptr(nregions) * rsize
+	}
+	if ntargets != 0 {
+		st.targets = (*[1 << 40]uint8)(unsafe.Pointer(p))[:ntargets:ntargets]
+		p += uintptr(ntargets)
+	}
+	if nviews != 0 {
+		st.views = (*[1 << 40]uint8)(unsafe.Pointer(p))[:nviews:nviews]
+	}
+}
+
+// seal makes the sealed state read-only if a sandbox view is applied.
+// It must be called with mu held.
+//
+//go:nosplit
+func seal() {
+	if st.active != 0 && !stSealed {
+		mprotect(uintptr(unsafe.Pointer(st)), stSize, c.R_VAL)
+		stSealed = true
+	}
+}
+
+// unseal makes the sealed state writable. It must be called with mu held.
+//
+//go:nosplit
+func unseal() {
+	if stSealed {
+		mprotect(uintptr(unsafe.Pointer(st)), stSize, c.R_VAL|c.W_VAL)
+		stSealed = false
+	}
+}
+
+// managed reports whether we protect the memory of the package.
+// The runtime and the backend are used by the signal handlers, sandbox
+// functions are part of their sandbox's static view. The trusted packages
+// are in no view.
+func managed(p *c.Package) bool {
+	switch {
+	case p.Name == g.TrustedPackages:
+		return true
+	case p.Id < 0:
+		return false
+	case p.Name == "runtime" || strings.HasPrefix(p.Name, "runtime/"):
+		return false
+	case strings.HasPrefix(p.Name, "internal/"):
+		return false
+	case strings.HasPrefix(p.Name, g.BackendPrefix):
+		return false
+	}
+	return true
+}
+
+// staticProt returns the protection of r in the static view.
+func staticProt(static *c.VMAreas, r *region) uint8 {
+	for v := c.ToVMA(static.First); v != nil; v = c.ToVMA(v.Next) {
+		if uintptr(v.Addr) <= r.addr && r.addr < uintptr(v.Addr+v.Size) {
+			return v.Prot & r.prot
+		}
+	}
+	return 0
+}
+
+// target returns the protection of r when sandbox sb is executing.
+//
+//go:nosplit
+func target(r *region, sb int32) uint8 {
+	if sb == 0 {
+		return r.prot
+	}
+	if r.idx != -1 {
+		return st.targets[int(sb-1)*len(st.regions)+r.idx]
+	}
+	return st.views[int(sb-1)*npkgs+r.pkg] & r.prot
+}
+
+// protect sets the protection of r.
+//
+//go:nosplit
+func protect(r *region, prot uint8) {
+	mprotect(r.addr, r.size, prot)
+}
+
+// apply enforces the view of sandbox sb, or restores the original
+// protections if sb is 0. It must be called with mu held.
+//
+//go:nosplit
+func apply(sb int32) {
+	unseal()
+	atomic.StoreInt32(&st.active, sb)
+	for i := range st.regions {
+		protect(&st.regions[i], target(&st.regions[i], sb))
+	}
+	n := atomic.LoadInt32(&st.nheap)
+	for i := int32(0); i < n; i++ {
+		if r := &st.heap[i]; r.pkg != 0 {
+			protect(r, target(r, sb))
+		}
+	}
+	seal()
+}
+
+//go:nosplit
+func lock() {
+	for !atomic.CompareAndSwapUint32(&mu, 0, 1) {
+		rawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+	}
+}
+
+//go:nosplit
+func unlock() {
+	atomic.StoreUint32(&mu, 0)
+}
+
+// Prolog applies the view of the sandbox, once no other sandbox is running.
+func Prolog(id c.SandId) {
+	sb, ok := sbIndex[id]
+	if !ok {
+		println("[MPROTECT BACKEND]: Sandbox not found in prolog")
+		return
+	}
+	for {
+		lock()
+		if st.active == 0 {
+			apply(sb)
+		}
+		if st.active == sb {
+			users++
+			unlock()
+			break
+		}
+		unlock()
+		runtime.Gosched()
+	}
+	entries++
+	runtime.AssignSbId(id, 0)
+	setThread(gettid(), sb)
+}
+
+// Epilog is called at the end of the execution of a given sandbox
+func Epilog(id c.SandId) {
+	setThread(gettid(), 0)
+	runtime.AssignSbId("", 0)
+	lock()
+	if users--; users == 0 {
+		apply(0)
+	}
+	unlock()
+	exits++
+}
+
+// Execute marks the thread as executing the sandbox, if its view is the one
+// currently applied.
+func Execute(id c.SandId) {
+	sb := sbIndex[id]
+	if sb != 0 && sb != atomic.LoadInt32(&st.active) {
+		// The sandbox that spawned the goroutine has returned.
+		escapes++
+		sb = 0
+	}
+	setThread(gettid(), sb)
+	runtime.AssignSbId(id, 0)
+}
+
+// Register a heap span for a given package
+func Register(id int, start, size uintptr) {
+	if id < 0 || id >= npkgs || !pkgManaged[id] {
+		return
+	}
+	lock()
+	unseal()
+	if r := addHeapRegion(id, start, size); r != nil {
+		protect(r, target(r, st.active))
+	}
+	seal()
+	unlock()
+}
+
+// Transfer a heap span from one package to another
+func Transfer(oldid, newid int, start, size uintptr) {
+	if oldid == newid {
+		return
+	}
+	lock()
+	unseal()
+	r := findHeapRegion(start)
+	if r == nil && newid >= 0 && newid < npkgs && pkgManaged[newid] {
+		r = addHeapRegion(newid, start, size)
+	}
+	if r != nil {
+		if newid < 0 || newid >= npkgs || !pkgManaged[newid] {
+			// The span is not ours anymore.
+			protect(r, r.prot)
+			r.pkg = 0
+		} else {
+			r.pkg, r.size, r.end = newid, size, start+size
+			protect(r, target(r, st.active))
+		}
+	}
+	seal()
+	unlock()
+}
+
+// addHeapRegion must be called with mu held, and the state unsealed.
+func addHeapRegion(id int, start, size uintptr) *region {
+	if r := findHeapRegion(start); r != nil {
+		r.pkg, r.size, r.end = id, size, start+size
+		return r
+	}
+	n := atomic.LoadInt32(&st.nheap)
+	if n == maxHeapRegions {
+		println("[MPROTECT BACKEND]: too many heap regions")
+		return nil
+	}
+	st.heap[n] = region{start, size, start + size, c.R_VAL | c.W_VAL, id, -1}
+	atomic.StoreInt32(&st.nheap, n+1)
+	return &st.heap[n]
+}
+
+//go:nosplit
+func findHeapRegion(start uintptr) *region {
+	n := atomic.LoadInt32(&st.nheap)
+	for i := int32(0); i < n; i++ {
+		if st.heap[i].addr == start {
+			return &st.heap[i]
+		}
+	}
+	return nil
+}
+
+func Stats() {
+	fmt.Printf("entries: %v, exits: %v, escapes: %v, faults: %v, violations: %v\n",
+		entries, exits, escapes, atomic.LoadUint64(&faults), atomic.LoadUint64(&violations))
+	fmt.Printf("cpu: %v\n", g.CPUStats())
+}
@@ -0,0 +1,303 @@
+package mprotect
+
+/*
+* @author: aghosn
+*
+* Fault handling for the mprotect backend.
+*
+* The SIGSEGV handler distinguishes three cases for a fault on a region:
+* - the faulting thread executes the active sandbox and the access is not in
+*   its view: the thread is redirected to violationHandler, which panics with
+*   a commons.Violation on the sandbox's goroutine;
+* - the faulting thread executes the active sandbox and the region is stale:
+*   its protection is fixed and the access retried;
+* - the faulting thread is trusted: the region is opened and the thread
+*   single-stepped, the SIGTRAP handler then protects the region again.
+*
+* The region is opened for the whole process. The trusted thread first pauses
+* the threads that execute a sandbox: it sends them a SIGTRAP, whose handler
+* parks them until the region is protected again.
+ */
+
+import (
+	c "gosb/commons"
+	g "gosb/globals"
+	"runtime"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// Layouts of the structures we access
+const (
+	segvAccErrCode = 2
+	siTkill        = -6
+
+	// Page fault error code bits.
+	pfWrite = 1 << 1
+	pfFetch = 1 << 4
+
+	// The trap flag in rflags.
+	eflTF = 1 << 8
+)
+
+// sigsegvHandler is the SIGSEGV entry point, it calls handleSigsegv.
+func sigsegvHandler()
+
+// sigtrapHandler is the SIGTRAP entry point, it calls handleSigtrap.
+func sigtrapHandler()
+
+// violationTrampoline calls violationHandler with the arguments that
+// handleSigsegv put in AX (pc), BX (addr) and CX (access).
+func violationTrampoline()
+
+// rawSyscall performs a syscall without going through the syscall package,
+// whose memory might be protected.
+func rawSyscall(trap, a1, a2, a3 uintptr) (r1, errno uintptr)
+
+//go:nosplit
+func gettid() int32 {
+	tid, _ := rawSyscall(syscall.SYS_GETTID, 0, 0, 0)
+	return int32(tid)
+}
+
+//go:nosplit
+func mprotect(addr, size uintptr, prot uint8) {
+	sysProt := uintptr(0)
+	if prot&c.R_VAL != 0 {
+		sysProt |= syscall.PROT_READ
+	}
+	if prot&c.W_VAL != 0 {
+		sysProt |= syscall.PROT_WRITE
+	}
+	if prot&c.X_VAL != 0 {
+		sysProt |= syscall.PROT_EXEC
+	}
+	rawSyscall(syscall.SYS_MPROTECT, addr, size, sysProt)
+}
+
+// lookupThread returns the entry of the thread, allocating it if needed.
+//
+//go:nosplit
+func lookupThread(tid int32) *thread {
+	for i := range threads {
+		t := &threads[i]
+		if atomic.LoadInt32(&t.tid) == tid || atomic.CompareAndSwapInt32(&t.tid, 0, tid) {
+			return t
+		}
+	}
+	return nil
+}
+
+// setThread records that the thread executes sandbox sb. A thread that
+// enters a sandbox waits for the regions opened for trusted threads, it
+// might not have been paused.
+//
+//go:nosplit
+func setThread(tid, sb int32) {
+	t := lookupThread(tid)
+	if t == nil {
+		println("[MPROTECT BACKEND]: too many threads")
+		return
+	}
+	atomic.StoreInt32(&t.sb, sb)
+	for sb != 0 && atomic.LoadUint32(&stepMu) != 0 {
+		rawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+	}
+}
+
+// pauseSandbox parks the other threads that execute a sandbox in their
+// SIGTRAP handler, and keeps them there until resumeSandbox. The threads
+// that wait to pause the sandbox are in a handler as well.
+//
+//go:nosplit
+func pauseSandbox(self *thread) {
+	atomic.StoreInt32(&self.parked, -1)
+	for !atomic.CompareAndSwapUint32(&stepMu, 0, 1) {
+		rawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+	}
+	atomic.StoreInt32(&self.parked, 0)
+	// Only the owner of stepMu changes the generation, 0 and -1 are not one.
+	gen := atomic.LoadInt32(&stepGen) + 1
+	if gen <= 0 {
+		gen = 1
+	}
+	atomic.StoreInt32(&stepGen, gen)
+	for i := range threads {
+		t := &threads[i]
+		if tid := atomic.LoadInt32(&t.tid); t != self && tid != 0 && atomic.LoadInt32(&t.sb) != 0 {
+			rawSyscall(syscall.SYS_TGKILL, selfPid, uintptr(tid), uintptr(syscall.SIGTRAP))
+		}
+	}
+	for i := range threads {
+		t := &threads[i]
+		for {
+			tid := atomic.LoadInt32(&t.tid)
+			if t == self || tid == 0 || atomic.LoadInt32(&t.sb) == 0 {
+				break
+			}
+			if p := atomic.LoadInt32(&t.parked); p == gen || p == -1 {
+				break
+			}
+			// The thread exited.
+			if _, errno := rawSyscall(syscall.SYS_TGKILL, selfPid, uintptr(tid), 0); errno == uintptr(syscall.ESRCH) {
+				break
+			}
+			rawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+		}
+	}
+}
+
+// resumeSandbox releases the threads that pauseSandbox parked.
+//
+//go:nosplit
+func resumeSandbox() {
+	atomic.StoreUint32(&stepMu, 0)
+}
+
+// park keeps the thread in its handler while a trusted thread pauses the
+// sandbox. A thread that observes the current pause stays until its end.
+//
+//go:nosplit
+func park(t *thread) {
+	for {
+		atomic.StoreInt32(&t.parked, atomic.LoadInt32(&stepGen))
+		if atomic.LoadUint32(&stepMu) == 0 {
+			break
+		}
+		rawSyscall(syscall.SYS_SCHED_YIELD, 0, 0, 0)
+	}
+	atomic.StoreInt32(&t.parked, 0)
+}
+
+//go:nosplit
+func findRegion(addr uintptr) *region {
+	for i := range st.regions {
+		if r := &st.regions[i]; r.addr <= addr && addr < r.addr+r.size {
+			return r
+		}
+	}
+	n := atomic.LoadInt32(&st.nheap)
+	for i := int32(0); i < n; i++ {
+		if r := &st.heap[i]; r.pkg != 0 && r.addr <= addr && addr < r.addr+r.size {
+			return r
+		}
+	}
+	return nil
+}
+
+// handleSigsegv is called by sigsegvHandler on the signal stack.
+// It returns false if the fault was not caused by a protected region.
+//
+//go:nosplit
+func handleSigsegv(info, ctx uintptr) bool {
+	if *(*int32)(unsafe.Pointer(info + c.SiginfoCodeOffset)) != segvAccErrCode {
+		return false
+	}
+	addr := *(*uintptr)(unsafe.Pointer(info + c.SiginfoAddrOffset))
+	r := findRegion(addr)
+	if r == nil {
+		return false
+	}
+	access := c.R_VAL
+	if err := *c.CtxReg(ctx, c.RegErr); err&pfFetch != 0 {
+		access = c.X_VAL
+	} else if err&pfWrite != 0 {
+		access = c.W_VAL
+	}
+	// A genuine fault, let the runtime handle it.
+	if access&r.prot == 0 {
+		return false
+	}
+	t := lookupThread(gettid())
+	if t == nil {
+		return false
+	}
+	atomic.AddUint64(&faults, 1)
+	sb := atomic.LoadInt32(&st.active)
+	if sb != 0 && atomic.LoadInt32(&t.sb) == sb && addr < r.end {
+		prot := target(r, sb)
+		if access&prot == 0 {
+			atomic.AddUint64(&violations, 1)
+			violate(ctx, addr, access)
+			return true
+		}
+		protect(r, prot)
+		return true
+	}
+	// Open the region for one instruction.
+	if t.npend == maxPending {
+		return false
+	}
+	if t.npend == 0 {
+		pauseSandbox(t)
+	}
+	t.pending[t.npend] = r
+	t.npend++
+	protect(r, r.prot)
+	*c.CtxReg(ctx, c.RegEfl) |= eflTF
+	return true
+}
+
+// handleSigtrap is called by sigtrapHandler on the signal stack.
+// It parks the thread if it was sent by pauseSandbox, or protects the
+// regions opened for the instruction that just executed.
+//
+//go:nosplit
+func handleSigtrap(info, ctx uintptr) bool {
+	t := lookupThread(gettid())
+	if t != nil && *(*int32)(unsafe.Pointer(info + c.SiginfoCodeOffset)) == siTkill {
+		park(t)
+		return true
+	}
+	if t == nil || t.npend == 0 {
+		return false
+	}
+	*c.CtxReg(ctx, c.RegEfl) &^= eflTF
+	sb := atomic.LoadInt32(&st.active)
+	for i := int32(0); i < t.npend; i++ {
+		r := t.pending[i]
+		t.pending[i] = nil
+		protect(r, target(r, sb))
+	}
+	t.npend = 0
+	resumeSandbox()
+	return true
+}
+
+// violate sets the thread up to call violationTrampoline as if it was
+// called from the faulting instruction.
+//
+//go:nosplit
+func violate(ctx, addr uintptr, access uint8) {
+	pc := *c.CtxReg(ctx, c.RegRip)
+	sp := *c.CtxReg(ctx, c.RegRsp) - 8
+	*(*uint64)(unsafe.Pointer(uintptr(sp))) = pc
+	*c.CtxReg(ctx, c.RegRsp) = sp
+	*c.CtxReg(ctx, c.RegRax) = pc
+	*c.CtxReg(ctx, c.RegRbx) = uint64(addr)
+	*c.CtxReg(ctx, c.RegRcx) = uint64(access)
+	*c.CtxReg(ctx, c.RegRip) = uint64(violationTrampolineAddr)
+}
+
+// violationHandler is called by violationTrampoline, on the goroutine that
+// executed the sandbox. It raises the violation as a panic that can be
+// recovered by the trusted caller of the sandbox, the deferred epilog of the
+// sandbox restores the protections.
+func violationHandler(pc, addr, access uintptr) {
+	// The sandbox is aborted, the thread is now trusted.
+	setThread(gettid(), 0)
+
+	v := &c.Violation{
+		Sandbox: runtime.GetmSbIds(),
+		PC:      pc,
+		Addr:    addr,
+		Access:  uint8(access),
+		Syscall: -1,
+	}
+	if f := runtime.FuncForPC(pc); f != nil {
+		v.Symbol = f.Name()
+	}
+	v.Pkg = g.PkgOfAddr(addr)
+	panic(v)
+}
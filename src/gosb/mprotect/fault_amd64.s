@@ -0,0 +1,91 @@
+#include "funcdata.h"
+#include "textflag.h"
+
+// sigsegvHandler: see fault.go for documentation.
+//
+// The arguments are the following:
+//
+// 	DI - The signal number.
+// 	SI - Pointer to siginfo_t structure.
+// 	DX - Pointer to ucontext structure.
+//
+TEXT ·sigsegvHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigsegv(SB)     // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ fallback
+	RET
+
+fallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigsegvHandler(SB), AX
+	JMP AX
+
+// sigtrapHandler: see fault.go for documentation.
+//
+// It uses the same calling convention as sigsegvHandler.
+TEXT ·sigtrapHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigtrap(SB)     // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ fallback
+	RET
+
+fallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigtrapHandler(SB), AX
+	JMP AX
+
+// violationTrampoline: see fault.go for documentation.
+//
+// handleSigsegv pushed the faulting RIP, so that this looks like a call
+// performed by the faulting instruction.
+TEXT ·violationTrampoline(SB),NOSPLIT,$24-0
+	NO_LOCAL_POINTERS
+	MOVQ AX, 0(SP)              // First argument (pc).
+	MOVQ BX, 8(SP)              // Second argument (addr).
+	MOVQ CX, 16(SP)             // Third argument (access).
+	CALL ·violationHandler(SB)  // Does not return.
+	INT $3
+
+// func rawSyscall(trap, a1, a2, a3 uintptr) (r1, errno uintptr)
+TEXT ·rawSyscall(SB),NOSPLIT,$0-48
+	MOVQ a1+8(FP), DI
+	MOVQ a2+16(FP), SI
+	MOVQ a3+24(FP), DX
+	MOVQ trap+0(FP), AX
+	SYSCALL
+	CMPQ AX, $0xfffffffffffff001
+	JLS ok
+	MOVQ $-1, r1+32(FP)
+	NEGQ AX
+	MOVQ AX, errno+40(FP)
+	RET
+ok:
+	MOVQ AX, r1+32(FP)
+	MOVQ $0, errno+40(FP)
+	RET
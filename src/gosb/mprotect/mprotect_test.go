@@ -0,0 +1,138 @@
+package mprotect
+
+import (
+	"fmt"
+	c "gosb/commons"
+	"gosb/internal/gosbtest"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+const progLib = `package lib
+
+var Counter int
+
+func Set(v int) { Counter = v }
+
+func Add(v int) { Counter += v }
+`
+
+const progMain = `package main
+
+import (
+	"fmt"
+	"gosb"
+	"prog/lib"
+	"sync"
+)
+
+var secret = 1
+
+func main() {
+	gosb.InitializeDefault()
+
+	// A write outside of the view is recovered, the next entry works.
+	fmt.Println("write:", try(func() {
+		sandbox["prog/lib:R", "", "ro"]() {
+			lib.Set(1)
+		}()
+	}), lib.Counter)
+	fmt.Println("again:", try(func() {
+		sandbox["prog/lib:RW", "", "rw"]() {
+			lib.Set(2)
+		}()
+	}), lib.Counter)
+
+	// The trusted packages are in no view.
+	fmt.Println("main:", try(func() {
+		sandbox["", "", "main"]() {
+			secret++
+		}()
+	}), secret)
+
+	// Concurrent entries, while trusted threads access the protected memory.
+	var wg sync.WaitGroup
+	stop := make(chan bool)
+	var mu sync.Mutex
+	for i := 0; i < 4; i++ {
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					secret++
+				}
+			}
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				sandbox["prog/lib:RW", "", "conc"]() {
+					mu.Lock()
+					lib.Add(1)
+					mu.Unlock()
+				}()
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+	fmt.Println("concurrent:", lib.Counter)
+}
+`
+
+const progWant = `write: violation W in prog/lib 0
+again: <nil> 2
+main: violation W in non-bloat 1
+concurrent: 802
+`
+
+func TestIsolation(t *testing.T) {
+	gosbtest.Run(t, "mprotect", map[string]string{"main.go": progMain, "lib/lib.go": progLib}, progWant)
+}
+
+// statePerms returns the permissions of the mapping of the sealed state.
+func statePerms(t *testing.T) string {
+	maps, err := ioutil.ReadFile("/proc/self/maps")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := uintptr(unsafe.Pointer(st))
+	for _, line := range strings.Split(string(maps), "\n") {
+		var start, end uintptr
+		var perms string
+		if n, _ := fmt.Sscanf(line, "%x-%x %s", &start, &end, &perms); n == 3 && start <= addr && addr < end {
+			return perms
+		}
+	}
+	t.Fatalf("no mapping for the state at %#x", addr)
+	return ""
+}
+
+func TestSealedState(t *testing.T) {
+	allocSealed(3, 6, 8)
+	if len(st.regions) != 3 || len(st.targets) != 6 || len(st.views) != 8 {
+		t.Fatalf("got %d regions, %d targets, %d views", len(st.regions), len(st.targets), len(st.views))
+	}
+	st.views[7] = c.R_VAL
+	seal()
+	if got := statePerms(t); got[:2] != "rw" {
+		t.Errorf("without sandbox, got %s, want it writable", got)
+	}
+	st.active = 1
+	seal()
+	if got := statePerms(t); got[:2] != "r-" {
+		t.Errorf("with a sandbox, got %s, want it read-only", got)
+	}
+	unseal()
+	if got := statePerms(t); got[:2] != "rw" {
+		t.Errorf("unsealed, got %s, want it writable", got)
+	}
+	st.active = 0
+}
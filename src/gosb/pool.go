@@ -0,0 +1,33 @@
+package gosb
+
+import (
+	"fmt"
+	"gosb/backend"
+	"gosb/commons"
+	"gosb/vtx"
+	"time"
+)
+
+// PoolStats are the statistics of the pristine copies of a sandbox.
+type PoolStats = vtx.PoolStats
+
+// SetPool sets the policy of the pristine copies of sandbox id, whose
+// number is bounded by its copies quota. If wait is set, an entry that
+// finds all the copies in use blocks until one is released, instead of
+// raising a *Violation. If idle is not 0, the copies beyond the warm ones
+// are destroyed once they are idle for that long. Only the VTX backend
+// makes copies.
+func SetPool(id commons.SandId, wait bool, idle time.Duration) error {
+	if currBackend == nil || currBackend.Tpe != backend.VTX_BACKEND {
+		return fmt.Errorf("gosb: pristine pools require the VTX backend")
+	}
+	return vtx.SetPool(id, wait, idle)
+}
+
+// ReadPoolStats returns the statistics of the pristine copies of sandbox id.
+func ReadPoolStats(id commons.SandId) (PoolStats, bool) {
+	if currBackend == nil || currBackend.Tpe != backend.VTX_BACKEND {
+		return PoolStats{}, false
+	}
+	return vtx.ReadPoolStats(id)
+}
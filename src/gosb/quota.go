@@ -0,0 +1,68 @@
+package gosb
+
+import (
+	"fmt"
+	"gosb/commons"
+	"gosb/globals"
+	"runtime"
+)
+
+// Quota bounds the heap and the pristine copies of a sandbox. It is
+// declared in the memory view of the sandbox, e.g.,
+//
+//	sandbox["self:heap=16M,self:copies=4", ""]
+//
+// An allocation that would exceed the heap quota, or an entry that would
+// exceed the pristine copies, raises a *Violation. The warm copies, e.g.,
+// self:warm=2, are created at initialization, see SetPool.
+type Quota = commons.Quota
+
+// SetQuota replaces the quota of the sandbox, a zero field removes the
+// bound. Lowering the heap quota below the current usage does not reclaim
+// memory, it makes the next heap growth of the sandbox fail.
+func SetQuota(id commons.SandId, q Quota) error {
+	sb, ok := globals.Sandboxes[id]
+	if !ok || id == globals.TrustedSandbox {
+		return fmt.Errorf("gosb: unknown sandbox %v", id)
+	}
+	sb.Config.Quota = q
+	globals.ApplyHeapQuota(id)
+	return nil
+}
+
+// GetQuota returns the quota of the sandbox.
+func GetQuota(id commons.SandId) (Quota, bool) {
+	sb, ok := globals.Sandboxes[id]
+	if !ok || id == globals.TrustedSandbox {
+		return Quota{}, false
+	}
+	return sb.Config.Quota, true
+}
+
+func initQuotas() {
+	runtime.RegisterQuotaHook(quotaViolation)
+	for id, sb := range globals.Sandboxes {
+		if id != globals.TrustedSandbox && sb.Config.Quota.Heap != 0 {
+			globals.ApplyHeapQuota(id)
+		}
+	}
+}
+
+// quotaViolation is called by the runtime when an allocation of package
+// pkg would exceed the heap quota of the sandbox.
+func quotaViolation(id string, pkg int, pc, limit uintptr) {
+	v := &commons.Violation{
+		Sandbox: id,
+		PC:      pc,
+		Syscall: -1,
+		Quota:   commons.QUOTA_HEAP,
+		Limit:   uint64(limit),
+	}
+	if f := runtime.FuncForPC(pc); f != nil {
+		v.Symbol = f.Name()
+	}
+	if p, ok := globals.IdToPkg[pkg]; ok {
+		v.Pkg = p.Name
+	}
+	panic(v)
+}
@@ -0,0 +1,89 @@
+package gosb
+
+import (
+	"gosb/internal/gosbtest"
+	"testing"
+)
+
+const quotaLib = `package lib
+
+import "sync"
+
+var Keep [][]byte
+
+func Alloc(n int) {
+	for i := 0; i < n; i++ {
+		Keep = append(Keep, make([]byte, 64<<10))
+	}
+}
+
+func Get(pools []*sync.Pool) {
+	for _, p := range pools {
+		p.Get()
+	}
+}
+`
+
+// The quotas of the sandboxes of a program cover the same packages, each
+// program declares a single sandbox.
+
+const quotaAllocMain = `package main
+
+import (
+	"fmt"
+	"gosb"
+	"prog/lib"
+)
+
+func alloc() {
+	sandbox["prog/lib:RWX,self:heap=1M", "", "alloc"]() {
+		lib.Alloc(100)
+	}()
+}
+
+func main() {
+	gosb.InitializeDefault()
+	fmt.Println("alloc:", try(alloc))
+}
+`
+
+// sync allocates the per-P pools while it is pinned to its P, with
+// preemption disabled: the violation is raised once it is unpinned.
+const quotaLockedMain = `package main
+
+import (
+	"fmt"
+	"gosb"
+	"prog/lib"
+	"sync"
+)
+
+func get(pools []*sync.Pool) {
+	sandbox["prog/lib:RWX,self:heap=1M", "", "get"]() {
+		lib.Get(pools)
+	}()
+}
+
+func main() {
+	gosb.InitializeDefault()
+	pools := make([]*sync.Pool, 100000)
+	for i := range pools {
+		pools[i] = new(sync.Pool)
+	}
+	fmt.Println("locked:", try(func() { get(pools) }))
+}
+`
+
+func TestHeapQuota(t *testing.T) {
+	progs := []struct{ main, want string }{
+		{quotaAllocMain, "alloc: heap of main.alloc#alloc in prog/lib.Alloc\n"},
+		{quotaLockedMain, "locked: heap of main.get#get in sync.(*Pool).pinSlow\n"},
+	}
+	for _, backend := range []string{"sim", "mprotect"} {
+		t.Run(backend, func(t *testing.T) {
+			for _, p := range progs {
+				gosbtest.Run(t, backend, map[string]string{"main.go": p.main, "lib/lib.go": quotaLib}, p.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package gosb
+
+import (
+	"fmt"
+	"gosb/commons"
+	"gosb/globals"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// Heap sharing.
+//
+// A sandbox sees the heap spans owned by the packages in its view. Share
+// hands the spans that back an object over to a package that only the
+// sandbox sees, with read or read-write access, e.g.,
+//
+//	buf := make([]byte, 64<<10)
+//	gosb.Share(unsafe.Pointer(&buf[0]), uintptr(len(buf)), "parser", commons.R_VAL)
+//	sandbox["parser", ""]() { ... }()
+//	gosb.Revoke(unsafe.Pointer(&buf[0]), uintptr(len(buf)), "parser")
+//
+// The backends map the spans through their transfer hook, as for any
+// change of owner. Spans are the unit of sharing, only large objects,
+// i.e., larger than 32KB, can be shared: they have spans of their own,
+// and no other object is allocated in them. A span is shared with one
+// sandbox at a time.
+//
+// The garbage collector does not move objects, the spans stay shared as
+// long as their object is reachable. Once it is freed, the spans are
+// handed over to the next package that allocates from them, which revokes
+// the access of the sandbox. The caller must keep the object alive while
+// it is shared.
+
+// share records the previous owner of a shared span.
+type share struct {
+	sb    commons.SandId
+	pkg   int // the share package that owns the span
+	owner int // the package that owned the span before
+}
+
+var (
+	shareMu sync.Mutex
+	shares  map[uintptr]share // by span address
+)
+
+// Share gives sandbox id access to the heap spans that hold the size bytes
+// at ptr. perm is commons.R_VAL, with commons.W_VAL for write access.
+func Share(ptr unsafe.Pointer, size uintptr, id commons.SandId, perm uint8) error {
+	pkg, ok := globals.SharePkg(id, perm&commons.W_VAL != 0)
+	if !ok {
+		return fmt.Errorf("gosb: unknown sandbox %v", id)
+	}
+	if perm&commons.R_VAL == 0 || perm&^(commons.R_VAL|commons.W_VAL) != 0 {
+		return fmt.Errorf("gosb: invalid share permission %x", perm)
+	}
+	if size == 0 {
+		return fmt.Errorf("gosb: empty share")
+	}
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	if shares == nil {
+		shares = make(map[uintptr]share)
+	}
+	// We do not share part of the object, the spans shared before a
+	// failure are handed back.
+	type undo struct {
+		start  uintptr
+		old    int   // the owner of the span before
+		prev   share // the previous share of the span, if shared
+		shared bool
+	}
+	var (
+		done []undo
+		err  error
+	)
+	start, end := uintptr(ptr), uintptr(ptr)+size
+	for addr := start; addr < end; {
+		owner := runtime.SpanIdOf(addr)
+		sstart, ssize, large, ok := runtime.HeapSpanOf(addr)
+		if owner == runtime.SbNoPkg || !ok {
+			err = fmt.Errorf("gosb: %#x is not in the heap", addr)
+			break
+		}
+		if !large {
+			err = fmt.Errorf("gosb: %#x is not a large object", addr)
+			break
+		}
+		if sb, ok := globals.ShareSandbox(owner); ok && sb != id {
+			err = fmt.Errorf("gosb: %#x is shared with %v", addr, sb)
+			break
+		}
+		_, _, old, ok := runtime.TransferSpan(sstart, owner, pkg)
+		if !ok {
+			err = fmt.Errorf("gosb: unable to share %#x with %v", addr, id)
+			break
+		}
+		prev, shared := shares[sstart]
+		done = append(done, undo{sstart, old, prev, shared})
+		s := share{id, pkg, old}
+		if shared && prev.pkg == old {
+			// A new permission for a shared span.
+			s.owner = prev.owner
+		}
+		shares[sstart] = s
+		addr = sstart + ssize
+	}
+	if err != nil {
+		for i := len(done) - 1; i >= 0; i-- {
+			u := done[i]
+			runtime.TransferSpan(u.start, pkg, u.old)
+			if u.shared {
+				shares[u.start] = u.prev
+			} else {
+				delete(shares, u.start)
+			}
+		}
+	}
+	return err
+}
+
+// Revoke hands the spans that hold the size bytes at ptr, shared with
+// sandbox id, back to their previous owners. The spans that were freed
+// since they were shared are already revoked.
+func Revoke(ptr unsafe.Pointer, size uintptr, id commons.SandId) error {
+	shareMu.Lock()
+	defer shareMu.Unlock()
+	found := false
+	start, end := uintptr(ptr), uintptr(ptr)+size
+	for addr := start; addr < end; {
+		sstart, ssize, _, ok := runtime.HeapSpanOf(addr)
+		if !ok {
+			return fmt.Errorf("gosb: %#x is not in the heap", addr)
+		}
+		if s, ok := shares[sstart]; ok && s.sb == id {
+			found = true
+			delete(shares, sstart)
+			// Nothing to do if the span was reused.
+			runtime.TransferSpan(sstart, s.pkg, s.owner)
+		}
+		addr = sstart + ssize
+	}
+	if !found {
+		return fmt.Errorf("gosb: %p is not shared with %v", ptr, id)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package gosb
+
+import (
+	"gosb/internal/gosbtest"
+	"testing"
+)
+
+const shareLib = `package lib
+
+// Alloc is not inlined, the allocation belongs to lib.
+//
+//go:noinline
+func Alloc(n int) []byte { return make([]byte, n) }
+
+func Fill(b []byte, v byte) {
+	for i := range b {
+		b[i] = v
+	}
+}
+`
+
+const shareMain = `package main
+
+import (
+	"fmt"
+	"gosb"
+	"gosb/commons"
+	"prog/lib"
+	"strings"
+	"unsafe"
+)
+
+func shared(buf []byte, write bool) (sum int) {
+	sandbox["", "", "share"]() {
+		if write {
+			buf[0] = 2
+		}
+		for _, v := range buf {
+			sum += int(v)
+		}
+	}()
+	return sum
+}
+
+func other(buf []byte) (sum int) {
+	sandbox["prog/lib:R", "", "other"]() {
+		for _, v := range buf {
+			sum += int(v)
+		}
+	}()
+	return sum
+}
+
+// adjacent returns two large buffers of lib, the second one right after
+// the first one.
+func adjacent(n int) ([]byte, []byte) {
+	var bufs [][]byte
+	for {
+		b := lib.Alloc(n)
+		for _, c := range bufs {
+			if uintptr(unsafe.Pointer(&c[0]))+uintptr(n) == uintptr(unsafe.Pointer(&b[0])) {
+				return c, b
+			}
+			if uintptr(unsafe.Pointer(&b[0]))+uintptr(n) == uintptr(unsafe.Pointer(&c[0])) {
+				return b, c
+			}
+		}
+		bufs = append(bufs, b)
+	}
+}
+
+func main() {
+	gosb.InitializeDefault()
+
+	buf := lib.Alloc(1 << 16)
+	lib.Fill(buf, 1)
+	p, n := unsafe.Pointer(&buf[0]), uintptr(len(buf))
+	sum := 0
+	fmt.Println("other:", try(func() { sum = other(buf) }), sum)
+
+	// Share a buffer of a package the sandbox does not see, read-only.
+	fmt.Println("share:", gosb.Share(p, n, "main.shared#share", commons.R_VAL))
+	fmt.Println("read:", try(func() { sum = shared(buf, false) }), sum)
+	fmt.Println("write:", try(func() { shared(buf, true) }), buf[0])
+	// The sandboxes that see the package lose access to the buffer.
+	fmt.Println("other shared:", try(func() { other(buf) }))
+
+	fmt.Println("revoke:", gosb.Revoke(p, n, "main.shared#share"))
+	fmt.Println("read revoked:", try(func() { shared(buf, false) }))
+	fmt.Println("other revoked:", try(func() { sum = other(buf) }), sum)
+	fmt.Println("revoke again:", gosb.Revoke(p, n, "main.shared#share") != nil)
+
+	// Small objects share their spans with other objects.
+	small := lib.Alloc(64)
+	fmt.Println("share small:", gosb.Share(unsafe.Pointer(&small[0]), 64, "main.shared#share", commons.R_VAL) != nil)
+
+	// A share that fails midway hands the spans shared before back.
+	x, y := adjacent(1 << 16)
+	lib.Fill(x, 1)
+	px, py := unsafe.Pointer(&x[0]), unsafe.Pointer(&y[0])
+	fmt.Println("share next:", gosb.Share(py, n, "main.other#other", commons.R_VAL))
+	err := gosb.Share(px, 2*n, "main.shared#share", commons.R_VAL)
+	fmt.Println("share both:", err != nil && strings.Contains(err.Error(), "is shared with main.other#other"))
+	fmt.Println("read rolled back:", try(func() { shared(x, false) }))
+	fmt.Println("other rolled back:", try(func() { sum = other(x) }), sum)
+	fmt.Println("revoke rolled back:", gosb.Revoke(px, n, "main.shared#share") != nil)
+	fmt.Println("revoke next:", gosb.Revoke(py, n, "main.other#other"))
+}
+`
+
+const shareWant = `other: <nil> 65536
+share: <nil>
+read: <nil> 65536
+write: violation W in share:main.shared#share:R 1
+other shared: violation R in share:main.shared#share:R
+revoke: <nil>
+read revoked: violation R in prog/lib
+other revoked: <nil> 65536
+revoke again: true
+share small: true
+share next: <nil>
+share both: true
+read rolled back: violation R in prog/lib
+other rolled back: <nil> 65536
+revoke rolled back: true
+revoke next: <nil>
+`
+
+func TestShare(t *testing.T) {
+	gosbtest.Run(t, "mprotect", map[string]string{"main.go": shareMain, "lib/lib.go": shareLib}, shareWant)
+}
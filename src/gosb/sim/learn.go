@@ -0,0 +1,441 @@
+package sim
+
+/*
+* @author: aghosn
+*
+* Learning mode of the simulation backend.
+*
+* When GOSB_LEARN is set, the backend still lets every access through, but it
+* records, for each sandbox, the packages whose memory it touches, with what
+* rights, and the syscalls it issues. At exit, it prints a suggested
+* sandbox["mem", "sys"] configuration for each sandbox function.
+*
+* Memory accesses are observed with tripwires: the sections of the bloated
+* packages are mprotected whenever a sandbox starts executing, and the SIGSEGV
+* handler records the access of the faulting thread before restoring the
+* rights the access needs. Syscalls that are not implicitly allowed are trapped
+* by a seccomp filter and performed on the thread's behalf by the SIGSYS
+* handler.
+*
+* The result is a best-effort: heap accesses are not observed, and a section
+* unprotected because of one thread is not observed for the others until the
+* next sandbox entry.
+ */
+
+import (
+	"fmt"
+	c "gosb/commons"
+	g "gosb/globals"
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	// LEARN_FLAG enables the learning mode.
+	LEARN_FLAG = "GOSB_LEARN"
+
+	// Upper bound on the number of threads we track.
+	maxThreads = 1024
+)
+
+// Signal codes
+const (
+	sysSeccompCode = 1
+	segvAccErrCode = 2
+)
+
+// Layouts of the structures we access
+const (
+	// Page fault error code bits.
+	pfWrite = 1 << 1
+	pfFetch = 1 << 4
+
+	// The size of the SYSCALL instruction in learnTrampoline.
+	learnTrampolineIPOffset = 2
+)
+
+// tripwire is a package section that faults on the first access of a kind.
+type tripwire struct {
+	addr  uintptr
+	size  uintptr
+	end   uintptr // end of the package's content, the last page can be shared
+	prot  uint8   // original protection
+	armed uint8   // current protection
+	pkg   int     // index in learnPkgs
+}
+
+// profile is what we learned about a sandbox.
+type profile struct {
+	config *c.SandboxDomain
+	pkgs   []uint8 // rights used, indexed like learnPkgs
+	sys    [c.MaxSyscallNumber / 64]uint64
+}
+
+// thread associates a thread with the profile of the sandbox it executes.
+type thread struct {
+	tid int32
+	sb  int32 // index in profiles + 1, 0 when trusted
+}
+
+var (
+	learning bool
+
+	// Packages we observe and their sections.
+	learnPkgs []*c.Package
+	wires     []tripwire
+
+	// Sandbox functions, their code lives in the sections of their package.
+	sbFuncs []*c.VMArea
+
+	profiles    []*profile
+	sbToProfile map[c.SandId]int32
+
+	// threads is read by the signal handlers and cannot be a map.
+	threads [maxThreads]thread
+
+	// Pointers to the runtime's handlers.
+	savedSigsegvHandler uintptr
+	savedSigsysHandler  uintptr
+)
+
+// sigsegvHandler is the SIGSEGV entry point, it calls handleSigsegv.
+func sigsegvHandler()
+
+// sigsysHandler is the SIGSYS entry point, it calls handleSigsys.
+func sigsysHandler()
+
+// learnTrampoline performs the SYSCALL instruction on behalf of learnSyscall.
+// Its address is whitelisted by the filter.
+func learnTrampoline()
+
+// learnSyscall performs a syscall through learnTrampoline.
+func learnSyscall(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1 uintptr, errno uintptr)
+
+// initLearning sets up the tripwires, the profiles, and the handlers.
+func initLearning() {
+	sbToProfile = make(map[c.SandId]int32)
+	for _, p := range g.AllPackages {
+		if !observable(p) {
+			continue
+		}
+		idx := len(learnPkgs)
+		for _, s := range p.Sects {
+			if s.Size == 0 {
+				continue
+			}
+			start := c.Round(s.Addr, false)
+			size := c.Round(s.Addr+s.Size, true) - start
+			prot := s.Prot &^ c.USER_VAL
+			wires = append(wires, tripwire{uintptr(start), uintptr(size), uintptr(s.Addr + s.Size), prot, prot, idx})
+		}
+		learnPkgs = append(learnPkgs, p)
+	}
+	for _, f := range g.SandboxFuncs {
+		sbFuncs = append(sbFuncs, f)
+	}
+	for id, sb := range g.Sandboxes {
+		if id == g.TrustedSandbox {
+			continue
+		}
+		profiles = append(profiles, &profile{config: sb.Config, pkgs: make([]uint8, len(learnPkgs))})
+		sbToProfile[id] = int32(len(profiles))
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].config.Func < profiles[j].config.Func
+	})
+	for i, p := range profiles {
+		sbToProfile[p.config.Id] = int32(i + 1)
+	}
+
+	if err := c.ReplaceSignalHandler(syscall.SIGSEGV, reflect.ValueOf(sigsegvHandler).Pointer(), &savedSigsegvHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGSEGV, err)
+	}
+	runtime.InstallSigHandler(uint32(syscall.SIGSYS))
+	if err := c.ReplaceSignalHandler(syscall.SIGSYS, reflect.ValueOf(sigsysHandler).Pointer(), &savedSigsysHandler); err != nil {
+		log.Fatalf("Unable to set handler for signal %d: %v", syscall.SIGSYS, err)
+	}
+	ip := uint64(reflect.ValueOf(learnTrampoline).Pointer()) + learnTrampolineIPOffset
+	if err := c.InstallFilter(buildFilter(ip)); err != nil {
+		log.Fatalf("Unable to install seccomp filter: %v", err)
+	}
+	learning = true
+	runtime.RegisterExitHook(report)
+}
+
+// observable reports whether we can set tripwires on the package.
+// The runtime and the backend are used by the signal handlers, and sandbox
+// functions are part of their sandbox.
+func observable(p *c.Package) bool {
+	switch {
+	case p.Id < 0:
+		return false
+	case p.Name == g.TrustedPackages:
+		return false
+	case p.Name == "runtime" || strings.HasPrefix(p.Name, "runtime/"):
+		return false
+	case strings.HasPrefix(p.Name, "internal/"):
+		return false
+	case strings.HasPrefix(p.Name, g.BackendPrefix):
+		return false
+	}
+	return true
+}
+
+// buildFilter generates a bpf program that allows syscalls performed by the
+// handlers, the passthrough ones, and the ones implicitly allowed to every
+// sandbox. Every other syscall is trapped.
+func buildFilter(ip uint64) []c.SockFilter {
+	allow := c.BpfStmt(c.BpfRetK, c.SeccompRetAllow)
+	prog := []c.SockFilter{
+		// Kill anything that is not x86_64.
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataArchOffset),
+		c.BpfJump(c.BpfJeqK, c.AuditArchX86_64, 1, 0),
+		c.BpfStmt(c.BpfRetK, c.SeccompRetKillProcess),
+		// Allow the handler's syscalls.
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataIPOffset),
+		c.BpfJump(c.BpfJeqK, uint32(ip), 0, 3),
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataIPOffset+4),
+		c.BpfJump(c.BpfJeqK, uint32(ip>>32), 0, 1),
+		allow,
+		c.BpfStmt(c.BpfLdAbsW, c.SeccompDataNrOffset),
+	}
+	// These cannot be performed from a signal handler.
+	passthrough := []uint64{syscall.SYS_CLONE, syscall.SYS_FORK, syscall.SYS_VFORK, syscall.SYS_RT_SIGRETURN}
+	for _, nr := range passthrough {
+		prog = append(prog, c.BpfJump(c.BpfJeqK, uint32(nr), 0, 1), allow)
+	}
+	for nr := uint64(0); nr < c.MaxSyscallNumber; nr++ {
+		if c.SyscallAllowed(c.RUNTIME_VAL, nr) {
+			prog = append(prog, c.BpfJump(c.BpfJeqK, uint32(nr), 0, 1), allow)
+		}
+	}
+	return append(prog, c.BpfStmt(c.BpfRetK, c.SeccompRetTrap))
+}
+
+// learnEnter associates the current thread with the sandbox id, and arms
+// the tripwires if it is a sandbox.
+func learnEnter(id c.SandId) {
+	sb := sbToProfile[id]
+	tid, _ := learnSyscall(syscall.SYS_GETTID, 0, 0, 0, 0, 0, 0)
+	setThread(int32(tid), sb)
+	if sb != 0 {
+		arm()
+	}
+}
+
+func setThread(tid, sb int32) {
+	for i := range threads {
+		t := &threads[i]
+		if atomic.LoadInt32(&t.tid) == tid || atomic.CompareAndSwapInt32(&t.tid, 0, tid) {
+			atomic.StoreInt32(&t.sb, sb)
+			return
+		}
+	}
+	println("[SIM BACKEND]: too many threads to learn from")
+}
+
+// threadProfile returns the profile of the sandbox executed by the current
+// thread, or nil if the thread is trusted.
+//
+//go:nosplit
+func threadProfile() *profile {
+	tid, _ := learnSyscall(syscall.SYS_GETTID, 0, 0, 0, 0, 0, 0)
+	for i := range threads {
+		t := &threads[i]
+		if t.tid == 0 {
+			break
+		}
+		if t.tid == int32(tid) {
+			if t.sb == 0 {
+				return nil
+			}
+			return profiles[t.sb-1]
+		}
+	}
+	return nil
+}
+
+// arm removes all the rights on the tripwires.
+func arm() {
+	for i := range wires {
+		w := &wires[i]
+		if w.armed != 0 {
+			w.armed = 0
+			mprotect(w.addr, w.size, 0)
+		}
+	}
+}
+
+// disarm restores the original rights on the tripwires.
+//
+//go:nosplit
+func disarm() {
+	for i := range wires {
+		w := &wires[i]
+		if w.armed != w.prot {
+			w.armed = w.prot
+			mprotect(w.addr, w.size, w.prot)
+		}
+	}
+}
+
+//go:nosplit
+func mprotect(addr, size uintptr, prot uint8) {
+	sysProt := uintptr(0)
+	if prot&c.R_VAL != 0 {
+		sysProt |= syscall.PROT_READ
+	}
+	if prot&c.W_VAL != 0 {
+		sysProt |= syscall.PROT_WRITE
+	}
+	if prot&c.X_VAL != 0 {
+		sysProt |= syscall.PROT_EXEC
+	}
+	learnSyscall(syscall.SYS_MPROTECT, addr, size, sysProt, 0, 0, 0)
+}
+
+// handleSigsegv is called by sigsegvHandler on the signal stack.
+// It returns false if the fault was not caused by a tripwire.
+//
+//go:nosplit
+func handleSigsegv(info, ctx uintptr) bool {
+	if *(*int32)(unsafe.Pointer(info + c.SiginfoCodeOffset)) != segvAccErrCode {
+		return false
+	}
+	addr := *(*uintptr)(unsafe.Pointer(info + c.SiginfoAddrOffset))
+	var w *tripwire
+	for i := range wires {
+		if wires[i].addr <= addr && addr < wires[i].addr+wires[i].size {
+			w = &wires[i]
+			break
+		}
+	}
+	if w == nil {
+		return false
+	}
+	access := c.R_VAL
+	if err := *c.CtxReg(ctx, c.RegErr); err&pfFetch != 0 {
+		access = c.X_VAL
+	} else if err&pfWrite != 0 {
+		access = c.W_VAL
+	}
+	// A genuine fault, let the runtime handle it.
+	if access&w.prot == 0 {
+		return false
+	}
+	w.armed |= access | c.R_VAL
+	mprotect(w.addr, w.size, w.armed)
+	if p := threadProfile(); p != nil && addr < w.end && !inSandboxFunc(addr) {
+		p.pkgs[w.pkg] |= access
+	}
+	return true
+}
+
+//go:nosplit
+func inSandboxFunc(addr uintptr) bool {
+	for _, f := range sbFuncs {
+		if f.Addr <= uint64(addr) && uint64(addr) < f.Addr+f.Size {
+			return true
+		}
+	}
+	return false
+}
+
+// handleSigsys is called by sigsysHandler on the signal stack.
+// It returns false if the signal was not generated by seccomp.
+//
+//go:nosplit
+func handleSigsys(info, ctx uintptr) bool {
+	if *(*int32)(unsafe.Pointer(info + c.SiginfoCodeOffset)) != sysSeccompCode {
+		return false
+	}
+	nr := uint64(*(*int32)(unsafe.Pointer(info + c.SiginfoSyscallOffset)))
+	// The syscalls of the runtime are allowed without a class.
+	args := [6]uintptr{uintptr(*c.CtxReg(ctx, c.RegRdi)), uintptr(*c.CtxReg(ctx, c.RegRsi)), uintptr(*c.CtxReg(ctx, c.RegRdx)),
+		uintptr(*c.CtxReg(ctx, c.RegR10)), uintptr(*c.CtxReg(ctx, c.RegR8)), uintptr(*c.CtxReg(ctx, c.RegR9))}
+	if p := threadProfile(); p != nil && nr < c.MaxSyscallNumber && !c.RuntimeSyscall(nr, &args) {
+		p.sys[nr/64] |= 1 << (nr % 64)
+	}
+	r1, errno := emulate(nr, ctx)
+	if errno == uintptr(syscall.EFAULT) {
+		// The kernel accessed a tripwire on the thread's behalf.
+		disarm()
+		r1, errno = emulate(nr, ctx)
+	}
+	if errno != 0 {
+		*c.CtxReg(ctx, c.RegRax) = uint64(-errno)
+	} else {
+		*c.CtxReg(ctx, c.RegRax) = uint64(r1)
+	}
+	return true
+}
+
+//go:nosplit
+func emulate(nr uint64, ctx uintptr) (uintptr, uintptr) {
+	return learnSyscall(uintptr(nr),
+		uintptr(*c.CtxReg(ctx, c.RegRdi)), uintptr(*c.CtxReg(ctx, c.RegRsi)), uintptr(*c.CtxReg(ctx, c.RegRdx)),
+		uintptr(*c.CtxReg(ctx, c.RegR10)), uintptr(*c.CtxReg(ctx, c.RegR8)), uintptr(*c.CtxReg(ctx, c.RegR9)))
+}
+
+// suggest generates the minimal configuration that allows what we observed.
+// Dependencies that were never touched are unmapped. It also returns the
+// syscalls that do not belong to any class.
+func (p *profile) suggest() (string, string, []uint64) {
+	deps := make(map[string]bool)
+	for _, name := range p.config.Pkgs {
+		deps[name] = true
+	}
+	entries := make([]string, 0)
+	for i, perm := range p.pkgs {
+		name := learnPkgs[i].Name
+		if perm != 0 {
+			entries = append(entries, name+c.DELIMITER_ENTRY+c.PermString(perm|c.R_VAL))
+		} else if deps[name] {
+			entries = append(entries, name+c.DELIMITER_ENTRY+c.UNMAP)
+		}
+	}
+	sort.Strings(entries)
+	if p.config.Pristine {
+		entries = append(entries, c.SELF_IDENTIFIER+c.DELIMITER_ENTRY+c.PRISTINE)
+	}
+
+	classes := c.SyscallMask(0)
+	var unknown []uint64
+	for nr := uint64(0); nr < c.MaxSyscallNumber; nr++ {
+		if p.sys[nr/64]&(1<<(nr%64)) == 0 {
+			continue
+		}
+		cl := c.SyscallClassesOf(nr)
+		switch {
+		case cl == 0:
+			unknown = append(unknown, nr)
+		case cl&(classes|c.RUNTIME_VAL) == 0:
+			// Pick the first class that allows it.
+			classes |= cl & (^cl + 1)
+		}
+	}
+	return strings.Join(entries, c.DELIMITER_PKGS), c.SyscallString(classes), unknown
+}
+
+// report prints the suggested configurations.
+func report() {
+	if !learning {
+		return
+	}
+	learning = false
+	disarm()
+	for _, p := range profiles {
+		mem, sys, unknown := p.suggest()
+		fmt.Fprintf(os.Stderr, "[gosb learn] %v: sandbox[%q, %q]\n", p.config.Func, mem, sys)
+		if len(unknown) != 0 {
+			fmt.Fprintf(os.Stderr, "[gosb learn] %v: unclassified syscalls %v\n", p.config.Func, unknown)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+#include "textflag.h"
+
+// sigsegvHandler: see learn.go for documentation.
+//
+// The arguments are the following:
+//
+// 	DI - The signal number.
+// 	SI - Pointer to siginfo_t structure.
+// 	DX - Pointer to ucontext structure.
+//
+TEXT ·sigsegvHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigsegv(SB)     // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ fallback
+	RET
+
+fallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigsegvHandler(SB), AX
+	JMP AX
+
+// sigsysHandler: see learn.go for documentation.
+//
+// It uses the same calling convention as sigsegvHandler.
+TEXT ·sigsysHandler(SB),NOSPLIT,$0
+	PUSHQ DI
+	PUSHQ SI
+	PUSHQ DX
+
+	SUBQ $24, SP
+	MOVQ SI, 0(SP)              // First argument (info).
+	MOVQ DX, 8(SP)              // Second argument (context).
+	CALL ·handleSigsys(SB)      // Call the handler.
+	MOVB 16(SP), AX             // Did we handle the signal?
+	ADDQ $24, SP
+	POPQ DX
+	POPQ SI
+	POPQ DI
+	CMPB AX, $0
+	JEQ fallback
+	RET
+
+fallback:
+	// Jump to the previous signal handler.
+	XORQ CX, CX
+	MOVQ ·savedSigsysHandler(SB), AX
+	JMP AX
+
+// learnTrampoline must start with the SYSCALL instruction.
+TEXT ·learnTrampoline(SB),NOSPLIT,$0
+	SYSCALL
+	RET
+
+// func learnSyscall(trap, a1, a2, a3, a4, a5, a6 uintptr) (r1 uintptr, errno uintptr)
+TEXT ·learnSyscall(SB),NOSPLIT,$0-72
+	MOVQ a1+8(FP), DI
+	MOVQ a2+16(FP), SI
+	MOVQ a3+24(FP), DX
+	MOVQ a4+32(FP), R10
+	MOVQ a5+40(FP), R8
+	MOVQ a6+48(FP), R9
+	MOVQ trap+0(FP), AX
+	CALL ·learnTrampoline(SB)
+	CMPQ AX, $0xfffffffffffff001
+	JLS ok
+	MOVQ $-1, r1+56(FP)
+	NEGQ AX
+	MOVQ AX, errno+64(FP)
+	RET
+ok:
+	MOVQ AX, r1+56(FP)
+	MOVQ $0, errno+64(FP)
+	RET
@@ -2,6 +2,8 @@ package sim
 
 import (
 	c "gosb/commons"
+	"os"
+	"runtime"
 	//	g "gosb/globals"
 	//	"log"
 )
@@ -13,6 +15,9 @@ var (
 //go:noinline
 //go:nosplit
 func Init() {
+	if os.Getenv(LEARN_FLAG) != "" {
+		initLearning()
+	}
 	/*log.Println("Init simulation backend.")
 	countEntries = make(map[c.SandId]int)
 	for _, d := range g.Sandboxes {
@@ -23,6 +28,11 @@ func Init() {
 //go:noinline
 //go:nosplit
 func Prolog(id c.SandId) {
+	if learning {
+		learnEnter(id)
+	}
+	// Track the sandbox on the goroutine, e.g., for its heap quota.
+	runtime.PushSbId(id, 0)
 	/*	if _, ok := g.Sandboxes[id]; ok {
 			log.Printf("Prolog sandbox %v\n", id)
 			count, _ := countEntries[id]
@@ -40,6 +50,10 @@ func Prolog(id c.SandId) {
 //go:noinline
 //go:nosplit
 func Epilog(id c.SandId) {
+	if learning {
+		learnEnter("")
+	}
+	runtime.PopSbId()
 	/*if _, ok := g.Sandboxes[id]; ok {
 		log.Printf("Epilog sandbox %v\n", id)
 		count, _ := countEntries[id]
@@ -137,6 +151,9 @@ func Register(id int, start, size uintptr) {
 
 //go:nosplit
 func Execute(id c.SandId) {
+	if learning {
+		learnEnter(id)
+	}
 	return
 	/*if _, ok := g.Domains[id]; ok {
 		log.Printf("Execute sandbox %v\n", id)
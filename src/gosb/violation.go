@@ -0,0 +1,16 @@
+package gosb
+
+import (
+	"gosb/commons"
+)
+
+// Violation is the value of the panic raised when a sandbox performs an
+// unallowed memory access or system call.
+// It can be recovered by the trusted caller of the sandbox, e.g.,
+//
+//	defer func() {
+//		if v, ok := recover().(*gosb.Violation); ok {
+//			...
+//		}
+//	}()
+type Violation = commons.Violation
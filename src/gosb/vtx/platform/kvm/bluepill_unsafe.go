@@ -86,6 +86,15 @@ func bluepillHandler(context unsafe.Pointer) {
 				throw("unexpected signal")
 			}
 
+			// The sandbox overran its limits, abort it.
+			if atomic.SwapUint32(&c.stop, 0) != 0 {
+				bluepillArchExit(c, bluepillArchContext(context))
+				c.recordViolation(uintptr(bluepillArchContext(context).Rip), 0, 0, -1)
+				c.stopped = true
+				c.violate(bluepillArchContext(context), "sandbox stopped")
+				return
+			}
+
 			// Check whether the current state of the vCPU is ready
 			// for interrupt injection. Because we don't have a
 			// PIC, we can't inject an interrupt while they are
@@ -168,10 +177,10 @@ func bluepillHandler(context unsafe.Pointer) {
 				c.die(bluepillArchContext(context), "Not a syscall")
 				return
 			case syshandlerPFW:
-				c.die(bluepillArchContext(context), "PF trying to do a write")
+				c.violate(bluepillArchContext(context), "PF trying to do a write")
 				return
 			case syshandlerPF:
-				c.die(bluepillArchContext(context), "PF trying to do a read or exec")
+				c.violate(bluepillArchContext(context), "PF trying to do a read or exec")
 				return
 			case syshandlerSNF:
 				c.die(bluepillArchContext(context), "Should not page fault!")
@@ -179,6 +188,9 @@ func bluepillHandler(context unsafe.Pointer) {
 			case syshandlerException:
 				c.die(bluepillArchContext(context), "Received an exception")
 				return
+			case syshandlerInvalid:
+				c.violate(bluepillArchContext(context), "Unallowed system call")
+				return
 			default:
 				throw("Something went wrong not identified")
 			}
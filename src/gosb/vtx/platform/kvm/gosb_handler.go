@@ -3,7 +3,6 @@ package kvm
 import (
 	c "gosb/commons"
 	"gosb/vtx/platform/ring0"
-	"runtime"
 	"syscall"
 	"unsafe"
 )
@@ -26,18 +25,6 @@ const (
 	syshandlerBail      sysHType = iota // redpill
 )
 
-var (
-	MRTRip    uint64  = 0
-	MRTFsbase uint64  = 0
-	MRTFault  uintptr = 0
-	MRTSpanId int     = 0
-	MRTEntry  uintptr = 0
-	MRTAddr   uintptr = 0
-	MRTFd     int     = 0
-	MRTMaped  bool    = false
-	MRTValid  bool    = false
-)
-
 //go:nosplit
 func kvmSyscallHandler(vcpu *vCPU) sysHType {
 	regs := vcpu.Registers()
@@ -57,11 +44,30 @@ func kvmSyscallHandler(vcpu *vCPU) sysHType {
 			return syshandlerBail
 		}
 
+		// Check the syscall is whitelisted for this sandbox, the syscall
+		// uses our copies of the arguments.
+		args := [6]uintptr{uintptr(regs.Rdi), uintptr(regs.Rsi), uintptr(regs.Rdx),
+			uintptr(regs.R10), uintptr(regs.R8), uintptr(regs.R9)}
+		if !c.SyscallAllowed(vcpu.machine.Sys, regs.Rax) && !c.RuntimeSyscall(regs.Rax, &args) {
+			vcpu.recordViolation(uintptr(regs.Rip-2), 0, 0, int(regs.Rax))
+			return syshandlerInvalid
+		}
+
+		// Check the arguments.
+		if m := vcpu.machine; m.Args.Constrains(regs.Rax) {
+			m.Mu.Lock()
+			ok := m.Args.CheckArgs(regs.Rax, &args, &vcpu.args, readGuest, uintptr(unsafe.Pointer(m)))
+			m.Mu.Unlock()
+			if !ok {
+				vcpu.recordViolation(uintptr(regs.Rip-2), 0, 0, int(regs.Rax))
+				return syshandlerInvalid
+			}
+		}
+
 		// Perform the syscall, here we will interpose.
 		// 3. Do a raw syscall now.
 		r1, r2, err := syscall.RawSyscall6(uintptr(regs.Rax),
-			uintptr(regs.Rdi), uintptr(regs.Rsi), uintptr(regs.Rdx),
-			uintptr(regs.R10), uintptr(regs.R8), uintptr(regs.R9))
+			args[0], args[1], args[2], args[3], args[4], args[5])
 		if err != 0 {
 			regs.Rax = uint64(-err)
 		} else {
@@ -89,24 +95,20 @@ func kvmSyscallHandler(vcpu *vCPU) sysHType {
 		// mapped and hence we should go back.
 		if vcpu.machine.ValidAddress(uint64(vcpu.FaultAddr)) {
 			if vcpu.machine.MemView.HasRights(uint64(vcpu.FaultAddr), c.R_VAL|c.USER_VAL|c.W_VAL) {
-				MRTRip = vcpu.Registers().Rip
-				MRTFsbase = vcpu.Registers().Fs_base
-				MRTFault = vcpu.FaultAddr
-				MRTAddr, _, MRTEntry = vcpu.machine.MemView.Tables.FindMapping(MRTFault)
 				vcpu.machine.Mu.Unlock()
 				return syshandlerSNF
 			}
 			if vcpu.machine.MemView.HasRights(uint64(vcpu.FaultAddr), c.R_VAL) {
+				vcpu.recordViolation(uintptr(regs.Rip), vcpu.FaultAddr, c.W_VAL, -1)
 				vcpu.machine.Mu.Unlock()
 				return syshandlerPFW
 			}
 		}
-		MRTFault = vcpu.FaultAddr
-		MRTAddr, _, MRTEntry = vcpu.machine.MemView.Tables.FindMapping(MRTFault)
-		MRTSpanId = runtime.SpanIdOf(vcpu.FaultAddr)
-		MRTFd = vcpu.machine.fd
-		MRTMaped = vcpu.machine.MemView.Tables.IsMapped(MRTFault)
-		MRTValid = vcpu.machine.ValidAddress(uint64(MRTFault))
+		access := c.R_VAL
+		if uint64(vcpu.FaultAddr) == regs.Rip {
+			access = c.X_VAL
+		}
+		vcpu.recordViolation(uintptr(regs.Rip), vcpu.FaultAddr, access, -1)
 		vcpu.machine.Mu.Unlock()
 		return syshandlerPF
 	}
@@ -115,3 +117,28 @@ func kvmSyscallHandler(vcpu *vCPU) sysHType {
 	}
 	return syshandlerErr2
 }
+
+// readGuest copies the guest memory at addr into dst, as long as the sandbox
+// of the machine ctx can read it. It must be called with Mu held.
+//
+//go:nosplit
+func readGuest(ctx uintptr, dst []byte, addr uintptr) int {
+	m := (*Machine)(unsafe.Pointer(ctx))
+	n := 0
+	for n < len(dst) {
+		a := addr + uintptr(n)
+		if !m.MemView.HasRights(uint64(a), c.R_VAL|c.USER_VAL) {
+			break
+		}
+		end := (a | (c.PageSize - 1)) + 1
+		chunk := len(dst) - n
+		if uintptr(chunk) > end-a {
+			chunk = int(end - a)
+		}
+		for i := 0; i < chunk; i++ {
+			dst[n+i] = *(*byte)(unsafe.Pointer(a + uintptr(i)))
+		}
+		n += chunk
+	}
+	return n
+}
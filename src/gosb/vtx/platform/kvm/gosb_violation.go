@@ -0,0 +1,81 @@
+package kvm
+
+import (
+	"gosb/commons"
+	"gosb/globals"
+	"gosb/vtx/arch"
+	"reflect"
+	"runtime"
+)
+
+// violationTrampoline is the assembly trampoline. This calls violationHandler.
+//
+// It uses the same calling convention as dieTrampoline.
+func violationTrampoline()
+
+var (
+	// violationTrampolineAddr is the address of violationTrampoline.
+	violationTrampolineAddr uintptr
+)
+
+func init() {
+	violationTrampolineAddr = reflect.ValueOf(violationTrampoline).Pointer()
+}
+
+// recordViolation saves the information about a sandbox fault.
+// It is called from the signal handler and cannot allocate.
+//
+//go:nosplit
+func (c *vCPU) recordViolation(pc, addr uintptr, access uint8, sysno int) {
+	c.violation.PC = pc
+	c.violation.Addr = addr
+	c.violation.Access = access
+	c.violation.Syscall = sysno
+}
+
+// violate is called to set the vCPU up to panic with a violation.
+//
+// The vCPU is released by violationHandler, once the violation is copied.
+//
+//go:nosplit
+func (c *vCPU) violate(context *arch.SignalContext64, msg string) {
+	// Thrown if we are unable to setup the trampoline.
+	c.dieState.message = msg
+
+	dieArchSetup(c, context, &c.dieState.guestRegs)
+	context.Rip = uint64(violationTrampolineAddr)
+}
+
+// violationHandler is called by violationTrampoline, on the goroutine that
+// executed the sandbox, as if it was called from the faulting instruction.
+// It releases the vCPU and raises the violation as a panic that can be
+// recovered by the trusted caller of the sandbox.
+func violationHandler(c *vCPU) {
+	v := new(commons.Violation)
+	*v = c.violation
+	stopped := c.stopped
+	c.stopped = false
+
+	// We are back in the host, release the vCPU.
+	c.unlock()
+
+	// The sandbox is aborted, the goroutine is now trusted.
+	v.Sandbox = runtime.GetmSbIds()
+	runtime.SetmSbId("")
+
+	// The runtime raises the overrun of the goroutine.
+	if stopped {
+		runtime.SbOverrun(v.PC)
+	}
+
+	// Identify the culprit.
+	if f := runtime.FuncForPC(v.PC); f != nil {
+		v.Symbol = f.Name()
+	}
+	if v.Syscall != -1 {
+		v.Pkg = globals.PkgOfPC(v.PC)
+	} else {
+		v.Pkg = globals.PkgOfAddr(v.Addr)
+	}
+	panic(v)
+}
@@ -37,6 +37,10 @@ type KVM struct {
 	// Id for the sandbox, this is important for pristine
 	Id  commons.SandId
 	Pid int
+
+	// LastUsed is the time, in Unix nanoseconds, at which a pristine copy
+	// was last released.
+	LastUsed int64
 }
 
 // Copy allows to duplicate a sandbox for pristine execution.
@@ -47,6 +51,11 @@ func (k *KVM) Copy(fd int) *KVM {
 	return v
 }
 
+// Destroy releases the VM of a copy, see Machine.Destroy.
+func (k *KVM) Destroy() bool {
+	return k.Machine.Destroy()
+}
+
 // New creates a VM with KVM, and initializes its machine and pagetables.
 func New(fd int, d *commons.SandboxMemory, template *mv.AddressSpace) *KVM {
 	// Create a new VM fd.
@@ -78,6 +87,9 @@ func New(fd int, d *commons.SandboxMemory, template *mv.AddressSpace) *KVM {
 
 //go:nosplit
 func (k *KVM) Map(start, size uintptr, prot uint8) {
+	if k.Machine.Released {
+		return
+	}
 	k.Machine.MemView.Toggle(true, start, size, prot)
 }
 
@@ -86,6 +98,9 @@ func (k *KVM) Map(start, size uintptr, prot uint8) {
 //go:nosplit
 func (k *KVM) ExtendRuntime(heap bool, start, size uintptr, prot uint8) {
 	size = uintptr(commons.Round(uint64(size), true))
+	if k.Machine.Released {
+		return
+	}
 	if k.Machine.MemView.ContainsRegion(start, size) {
 		// Nothing to do, we already mapped it.
 		return
@@ -106,6 +121,9 @@ func (k *KVM) ExtendRuntime(heap bool, start, size uintptr, prot uint8) {
 
 //go:nosplit
 func (k *KVM) Unmap(start, size uintptr) {
+	if k.Machine.Released {
+		return
+	}
 	k.Machine.MemView.Toggle(false, start, size, commons.UNMAP_VAL)
 }
 
@@ -126,7 +144,7 @@ func (k *KVM) SwitchToUser() {
 		runtime.RegisterPthread(c.id)
 	}
 	commons.Check(k.Id != "")
-	runtime.AssignSbId(k.Id, k.Pid)
+	runtime.SetmSbId(k.Id)
 	if !c.entered {
 		c.SwitchToUser(opts)
 		return
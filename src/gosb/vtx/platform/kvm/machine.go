@@ -12,6 +12,7 @@ import (
 	"runtime"
 	"sync/atomic"
 	"syscall"
+	"unsafe"
 )
 
 type Machine struct {
@@ -40,6 +41,16 @@ type Machine struct {
 
 	// For address space extension.
 	Mu runtime.GosbMutex
+
+	// Sys is the set of syscall classes the sandbox is allowed to perform.
+	Sys commons.SyscallMask
+
+	// Args constrains the arguments of the allowed syscalls.
+	Args commons.SyscallArgs
+
+	// Released is set once the machine is destroyed, the updates of its
+	// address space are ignored. Protected by Mu.
+	Released bool
 }
 
 const (
@@ -94,6 +105,18 @@ type vCPU struct {
 
 	dieState dieState
 
+	// violation records the sandbox fault that will be raised as a panic.
+	violation commons.Violation
+
+	// args holds the checked arguments of the current syscall.
+	args commons.ArgBuf
+
+	// stop is set when the sandbox overran its limits, see Stop.
+	stop uint32
+
+	// stopped is set when the vCPU exited because of stop.
+	stopped bool
+
 	// let's us decide whether the vcpu should be changed.
 	entered bool
 
@@ -141,6 +164,7 @@ func (m *Machine) newVCPU() *vCPU {
 	}
 	c.CPU.Init(&m.kernel, c)
 	m.vcpus[c.id] = c
+	registerVCPU(c)
 
 	// Ensure the signal mask is correct.
 	if err := c.setSignalMask(); err != nil {
@@ -209,6 +233,8 @@ func newMachine(vm int, d *commons.SandboxMemory, template *mv.AddressSpace) (*M
 		fd:      vm,
 		MemView: memview,
 		vcpus:   make(map[int]*vCPU),
+		Sys:     d.Config.Sys,
+		Args:    d.Config.Args,
 	}
 	memview.RegisterGrowth(
 		//go:nosplit
@@ -256,6 +282,7 @@ func (m *Machine) Get() *vCPU {
 	for _, c := range m.vcpus {
 		if atomic.CompareAndSwapUint32(&c.state, vCPUReady, vCPUUser) {
 			m.mu.Unlock()
+			atomic.StoreUint32(&c.stop, 0)
 			tid := procid.Current()
 			c.loadSegments(tid)
 			return c
@@ -293,6 +320,84 @@ func (c *vCPU) unlock() {
 	atomic.SwapUint32(&c.state, vCPUReady)
 }
 
+// Upper bound on the vCPUs that Stop can interrupt.
+const maxStoppable = 1024
+
+var (
+	// stoppable are the vCPUs of all the machines. Stop is called by the
+	// runtime without a P and cannot iterate over the machines' maps.
+	stoppable  [maxStoppable]*vCPU
+	nstoppable int32
+)
+
+func registerVCPU(c *vCPU) {
+	n := atomic.LoadInt32(&nstoppable)
+	for i := int32(0); i < n; i++ {
+		if stoppable[i] == nil {
+			stoppable[i] = c
+			return
+		}
+	}
+	if n == maxStoppable {
+		log.Printf("too many vCPUs, %v cannot be stopped\n", c.id)
+		return
+	}
+	stoppable[n] = c
+	atomic.StoreInt32(&nstoppable, n+1)
+}
+
+// Stop interrupts the vCPU that executes in guest mode on thread tid, and
+// reports whether there is one. The vCPU exits to the host, and the sandbox
+// is aborted with the overrun of its goroutine, see bluepillHandler.
+//
+//go:nosplit
+func Stop(tid uint64) bool {
+	n := atomic.LoadInt32(&nstoppable)
+	for i := int32(0); i < n; i++ {
+		c := stoppable[i]
+		if c == nil || atomic.LoadUint64(&c.tid) != tid || atomic.LoadUint32(&c.state)&vCPUGuest == 0 {
+			continue
+		}
+		atomic.StoreUint32(&c.stop, 1)
+		pid, _, _ := syscall.RawSyscall(syscall.SYS_GETPID, 0, 0, 0)
+		syscall.RawSyscall(syscall.SYS_TGKILL, pid, uintptr(tid), uintptr(bounceSignal))
+		return true
+	}
+	return false
+}
+
+// Destroy releases the vCPUs, the page tables and the VM. It fails if one
+// of the vCPUs is in use, the machine cannot be used once it succeeds.
+// It must be called with Mu held.
+func (m *Machine) Destroy() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	locked := make([]*vCPU, 0, len(m.vcpus))
+	for _, c := range m.vcpus {
+		if !atomic.CompareAndSwapUint32(&c.state, vCPUReady, vCPUUser) {
+			for _, l := range locked {
+				l.unlock()
+			}
+			return false
+		}
+		locked = append(locked, c)
+	}
+	for _, c := range locked {
+		for i := range stoppable {
+			if stoppable[i] == c {
+				stoppable[i] = nil
+			}
+		}
+		commons.Munmap(uintptr(unsafe.Pointer(c.runData)), uintptr(runDataSize))
+		syscall.Close(c.fd)
+	}
+	m.vcpus = make(map[int]*vCPU)
+	m.Released = true
+	m.MemView.Release()
+	syscall.Close(m.fd)
+	return true
+}
+
 func (m *Machine) CollectStats() (uint64, uint64, uint64) {
 	e, ex, es := uint64(0), uint64(0), uint64(0)
 	for _, v := range m.vcpus {
@@ -188,6 +188,15 @@ func (pga *PageTableAllocator) FreePTEs(ptes *pg.PTEs) {
 	// Nothing to do, we do not free them.
 }
 
+// Release unmaps all the arenas, the page tables cannot be used afterwards.
+func (pga *PageTableAllocator) Release() {
+	for v := ToArena(pga.All.First); v != nil; v = ToArena(v.Next) {
+		commons.Munmap(uintptr(v.HVA), ARENA_TOTAL_SIZE)
+	}
+	pga.All.Init()
+	pga.Current = nil
+}
+
 /*				Arena methods				*/
 //go:nosplit
 func ToArena(e *commons.ListElem) *Arena {
@@ -75,6 +75,12 @@ func (a *AddressSpace) Copy() *AddressSpace {
 	return doppler
 }
 
+// Release frees the page tables of a copy that is not used anymore.
+func (a *AddressSpace) Release() {
+	a.PTEAllocator.Release()
+	a.Tables = nil
+}
+
 func (a *AddressSpace) Initialize(procmap *commons.VMAreas) {
 	// Start by finding out the free portions in the (1 << 39) space.
 	free := procmap.Mirror()
@@ -0,0 +1,334 @@
+package vtx
+
+/*
+* Pools of pristine copies.
+*
+* A pristine sandbox runs each entry in a copy of its machine that no other
+* entry uses at the same time. The copies of a sandbox form its pool: an
+* entry locks an idle copy, or creates one if the pool holds less than the
+* copies quota of the sandbox. When the pool is exhausted, the entry either
+* fails with a *Violation or, if the pool waits, blocks until a copy is
+* released. Only the outermost entries block, a goroutine that is inside a
+* sandbox cannot park in the host.
+*
+* The warm copies of the quota are created at initialization. The copies
+* beyond them are reclaimed once they have been idle for the idle delay of
+* the pool: their machines are destroyed, their dependencies removed, and
+* their heap spans handed over to the trusted code. The nested machines
+* whose outer or inner sandbox is a reclaimed copy are destroyed with it.
+ */
+
+import (
+	"fmt"
+	"gosb/commons"
+	"gosb/globals"
+	"gosb/vtx/platform/kvm"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// PoolStats are the statistics of the pristine copies of a sandbox.
+type PoolStats struct {
+	Copies    int    // copies in the pool
+	InUse     int    // copies locked by an entry
+	Created   uint64 // copies created, the warm ones included
+	Reclaimed uint64 // idle copies destroyed
+	Hits      uint64 // entries that reused an idle copy
+	Waits     uint64 // entries that waited for a copy
+	Failures  uint64 // entries that failed on an exhausted pool
+}
+
+// pool holds the pristine copies of a sandbox.
+type pool struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	sb     *kvm.KVM // the machine of the sandbox, copied for each entry
+	copies []*kvm.KVM
+
+	// Policy, see SetPool.
+	wait       bool
+	idle       time.Duration
+	reclaiming bool
+
+	stats PoolStats
+}
+
+var (
+	// pools are created at initialization, the map is never modified.
+	pools map[commons.SandId]*pool
+
+	// machinesMu serializes the updates of machines, nests,
+	// globals.PkgDeps and globals.IsPristine. The runtime hooks read them
+	// without locks: we publish modified copies instead of modifying them.
+	machinesMu sync.Mutex
+)
+
+// initPools creates the pools of the pristine sandboxes and their warm
+// copies. It is called once the machines are created.
+func initPools() {
+	pools = make(map[commons.SandId]*pool)
+	for id, sb := range loadMachines() {
+		if !sb.Sand.Config.Pristine {
+			continue
+		}
+		p := &pool{sb: sb}
+		p.cond = sync.NewCond(&p.mu)
+		pools[id] = p
+		for i := 0; i < sb.Sand.Config.Quota.Warm; i++ {
+			p.create().Locked = kvm.VM_UNLOCKED
+		}
+	}
+}
+
+// acquire locks a copy for an entry, and returns its id. It returns "" if
+// the pool is exhausted and the entry cannot wait for a copy.
+func (p *pool) acquire(wait bool) commons.SandId {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		for _, v := range p.copies {
+			if atomic.CompareAndSwapUint32(&v.Locked, kvm.VM_UNLOCKED, kvm.VM_LOCKED) {
+				p.stats.Hits++
+				return v.Id
+			}
+		}
+		if q := p.sb.Sand.Config.Quota.Copies; q == 0 || len(p.copies) < q {
+			return p.create().Id
+		}
+		if !p.wait || !wait {
+			p.stats.Failures++
+			return ""
+		}
+		p.stats.Waits++
+		p.cond.Wait()
+	}
+}
+
+// create adds a locked copy to the pool. It must be called with p.mu held.
+func (p *pool) create() *kvm.KVM {
+	v := p.sb.Copy(int(kvmFd.Fd()))
+	v.Locked = kvm.VM_LOCKED
+	commons.Check(v.Pid != 0)
+	pkgs := []int{v.Pid}
+	if share, ok := globals.SharePkgs[p.sb.Id]; ok {
+		pkgs = append(pkgs, share[0], share[1])
+	}
+	machinesMu.Lock()
+	setMachine(v.Id, v, true)
+	addDeps(v.Id, pkgs)
+	machinesMu.Unlock()
+	p.copies = append(p.copies, v)
+	p.stats.Created++
+	return v
+}
+
+// release unlocks a copy at the end of an entry.
+func (p *pool) release(v *kvm.KVM) {
+	p.mu.Lock()
+	v.LastUsed = time.Now().UnixNano()
+	atomic.StoreUint32(&v.Locked, kvm.VM_UNLOCKED)
+	p.mu.Unlock()
+	p.cond.Signal()
+}
+
+// reclaim destroys the copies beyond the warm ones that are idle since
+// before deadline.
+func (p *pool) reclaim(deadline int64) {
+	p.mu.Lock()
+	warm := p.sb.Sand.Config.Quota.Warm
+	kept := make([]*kvm.KVM, 0, len(p.copies))
+	var victims []*kvm.KVM
+	for i, v := range p.copies {
+		if len(kept)+len(p.copies)-i > warm && v.LastUsed < deadline &&
+			atomic.CompareAndSwapUint32(&v.Locked, kvm.VM_UNLOCKED, kvm.VM_LOCKED) {
+			victims = append(victims, v)
+			continue
+		}
+		kept = append(kept, v)
+	}
+	p.copies = kept
+	p.stats.Reclaimed += uint64(len(victims))
+	p.mu.Unlock()
+	for _, v := range victims {
+		destroyCopy(v)
+	}
+}
+
+// reclaimer periodically reclaims the idle copies of the pool, until its
+// idle delay is removed.
+func (p *pool) reclaimer() {
+	for {
+		p.mu.Lock()
+		idle := p.idle
+		if idle == 0 {
+			p.reclaiming = false
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+		time.Sleep(idle / 2)
+		p.reclaim(time.Now().Add(-idle).UnixNano())
+	}
+}
+
+// destroyCopy unpublishes a locked copy and the nested machines built on
+// it, and destroys them. Its heap spans are handed over to the trusted code.
+func destroyCopy(v *kvm.KVM) {
+	victims := []*kvm.KVM{v}
+	machinesMu.Lock()
+	ms := loadMachines()
+	// Nested machines can nest other nested machines: collect until no
+	// nested machine depends on a victim.
+	for found := true; found; {
+		found = false
+		for nid, n := range loadNests() {
+			for _, d := range victims {
+				if n.outer == d || n.inner == d {
+					victims = append(victims, ms[nid])
+					setMachine(nid, nil, false)
+					found = true
+					break
+				}
+			}
+		}
+	}
+	setMachine(v.Id, nil, false)
+	machinesMu.Unlock()
+	runtime.TransferPkgSpans(v.Pid, -1)
+	globals.ReleasePristine(v.Pid)
+	for _, m := range victims {
+		// Wait for the hooks that still see the machine.
+		m.Machine.Mu.Lock()
+		ok := m.Destroy()
+		m.Machine.Mu.Unlock()
+		if !ok {
+			panic("error destroying machine '" + m.Id + "': vCPU in use")
+		}
+	}
+}
+
+// setMachine publishes m as the machine id, and removes the machine and
+// its dependencies if m is nil. pristine is set for a pristine copy.
+// It must be called with machinesMu held.
+func setMachine(id commons.SandId, m *kvm.KVM, pristine bool) {
+	old := loadMachines()
+	ms := make(map[commons.SandId]*kvm.KVM, len(old)+1)
+	for k, v := range old {
+		ms[k] = v
+	}
+	isp := make(map[commons.SandId]bool, len(globals.IsPristine)+1)
+	for k, v := range globals.IsPristine {
+		isp[k] = v
+	}
+	if m != nil {
+		ms[id] = m
+		if pristine {
+			isp[id] = true
+		}
+	} else {
+		delete(ms, id)
+		delete(isp, id)
+		removeDeps(id)
+		if _, ok := loadNests()[id]; ok {
+			setNest(id, nil)
+		}
+	}
+	atomic.StorePointer(&machines, unsafe.Pointer(&ms))
+	globals.IsPristine = isp
+}
+
+// setNest publishes the outer and inner machines of the nested machine id,
+// nil removes them. It must be called with machinesMu held.
+func setNest(id commons.SandId, n *nest) {
+	old := loadNests()
+	ns := make(map[commons.SandId]nest, len(old)+1)
+	for k, v := range old {
+		ns[k] = v
+	}
+	if n != nil {
+		ns[id] = *n
+	} else {
+		delete(ns, id)
+	}
+	atomic.StorePointer(&nests, unsafe.Pointer(&ns))
+}
+
+// addDeps makes machine id follow the heap spans of pkgs.
+// It must be called with machinesMu held.
+func addDeps(id commons.SandId, pkgs []int) {
+	deps := make(map[int][]commons.SandId, len(globals.PkgDeps)+len(pkgs))
+	for k, v := range globals.PkgDeps {
+		deps[k] = v
+	}
+	for _, pkg := range pkgs {
+		l := deps[pkg]
+		deps[pkg] = append(l[:len(l):len(l)], id)
+	}
+	globals.PkgDeps = deps
+}
+
+// removeDeps removes machine id from the dependencies.
+// It must be called with machinesMu held.
+func removeDeps(id commons.SandId) {
+	deps := make(map[int][]commons.SandId, len(globals.PkgDeps))
+	for k, v := range globals.PkgDeps {
+		l := make([]commons.SandId, 0, len(v))
+		for _, d := range v {
+			if d != id {
+				l = append(l, d)
+			}
+		}
+		if len(l) != 0 {
+			deps[k] = l
+		}
+	}
+	globals.PkgDeps = deps
+}
+
+// SetPool sets the policy of the pool of pristine copies of sandbox id.
+// If wait is set, an entry that finds the pool exhausted blocks until a
+// copy is released instead of failing. If idle is not 0, the copies beyond
+// the warm ones are reclaimed once they are idle for that long.
+func SetPool(id commons.SandId, wait bool, idle time.Duration) error {
+	p, ok := pools[id]
+	if !ok {
+		return fmt.Errorf("gosb: sandbox %v is not pristine", id)
+	}
+	if idle < 0 {
+		return fmt.Errorf("gosb: invalid idle delay %v", idle)
+	}
+	p.mu.Lock()
+	p.wait, p.idle = wait, idle
+	start := idle != 0 && !p.reclaiming
+	if start {
+		p.reclaiming = true
+	}
+	p.mu.Unlock()
+	// Wake up the waiters, they fail if we no longer wait.
+	p.cond.Broadcast()
+	if start {
+		go p.reclaimer()
+	}
+	return nil
+}
+
+// ReadPoolStats returns the statistics of the pool of sandbox id.
+func ReadPoolStats(id commons.SandId) (PoolStats, bool) {
+	p, ok := pools[id]
+	if !ok {
+		return PoolStats{}, false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.stats
+	s.Copies = len(p.copies)
+	for _, v := range p.copies {
+		if atomic.LoadUint32(&v.Locked) == kvm.VM_LOCKED {
+			s.InUse++
+		}
+	}
+	return s, true
+}
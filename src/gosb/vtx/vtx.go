@@ -21,12 +21,41 @@ const (
 )
 
 var (
-	kvmOnce   sync.Once
-	kvmFd     *os.File
-	machines  map[commons.SandId]*kvm.KVM
-	pristines map[commons.SandId][]*kvm.KVM
+	kvmOnce sync.Once
+	kvmFd   *os.File
+
+	// machines points to the map of the machines by sandbox id. The map is
+	// published copy-on-write by setMachine, read it with loadMachines.
+	machines unsafe.Pointer // *map[commons.SandId]*kvm.KVM
+
+	// nests points to the map of the nested machines, created on the first
+	// nested entry, to the machines they nest. Read it with loadNests.
+	nests unsafe.Pointer // *map[commons.SandId]nest
 )
 
+// nest records the machines of the outer and inner sandboxes of a nested
+// machine. The nested machine is destroyed with either of them.
+type nest struct {
+	outer *kvm.KVM
+	inner *kvm.KVM
+}
+
+//go:nosplit
+func loadMachines() map[commons.SandId]*kvm.KVM {
+	if p := atomic.LoadPointer(&machines); p != nil {
+		return *(*map[commons.SandId]*kvm.KVM)(p)
+	}
+	return nil
+}
+
+//go:nosplit
+func loadNests() map[commons.SandId]nest {
+	if p := atomic.LoadPointer(&nests); p != nil {
+		return *(*map[commons.SandId]nest)(p)
+	}
+	return nil
+}
+
 func Init() {
 	kvmOnce.Do(func() {
 		// Initialize the full memory templates.
@@ -41,9 +70,10 @@ func Init() {
 		if err != nil {
 			log.Fatalf("error updating globals: %v\n", err)
 		}
+		// Interrupt the vCPUs of the sandboxes that overrun their limits.
+		runtime.RegisterStopHook(kvm.Stop)
 		// Initialize the different sandboxes.
-		machines = make(map[commons.SandId]*kvm.KVM)
-		pristines = make(map[commons.SandId][]*kvm.KVM)
+		ms := make(map[commons.SandId]*kvm.KVM)
 		for _, d := range globals.Sandboxes {
 			// Skip over the non-sandbox.
 			if d.Config.Id == "-1" {
@@ -51,24 +81,41 @@ func Init() {
 			}
 			m := kvm.New(int(kvmFd.Fd()), d, mv.AddressSpaceTemplate)
 			m.Id = d.Config.Id
-			machines[d.Config.Id] = m
+			ms[d.Config.Id] = m
 		}
+		atomic.StorePointer(&machines, unsafe.Pointer(&ms))
+		initPools()
 		//kvmFd.Close()
 	})
 }
 
 //go:nosplit
 func Prolog(id commons.SandId) {
+	// Leave the outer sandbox, if any, before we allocate.
+	outer := runtime.GetgSbIds()
+	_, _ = tryRedpill()
 	// Check if we're trying to get into a pristine sandbox.
 	if _, ok := globals.IsPristine[id]; ok {
-		id = acquirePristine(id)
+		pid := acquirePristine(id, outer == "")
+		if pid == "" {
+			copiesViolation(outer, id)
+		}
+		id = pid
 	}
+	if outer != "" {
+		id = nested(outer, id)
+	}
+	pid := 0
+	if sb, ok := loadMachines()[id]; ok {
+		pid = sb.Pid
+	}
+	runtime.PushSbId(id, pid)
 	prolog_internal(id, true)
 }
 
 //go:nosplit
 func prolog_internal(id commons.SandId, replenish bool) {
-	if sb, ok := machines[id]; ok {
+	if sb, ok := loadMachines()[id]; ok {
 		if replenish {
 			sb.Machine.Replenish()
 		}
@@ -83,11 +130,79 @@ func prolog_internal(id commons.SandId, replenish bool) {
 //go:nosplit
 func Epilog(id commons.SandId) {
 	_, _ = tryRedpill()
-	if sb, ok := machines[id]; ok && sb.Sand.Config.Pristine {
-		sb.Locked = kvm.VM_UNLOCKED
+	// id is the declared sandbox, release the machine we actually used.
+	top, outer := runtime.PopSbId()
+	if sb, ok := loadMachines()[top]; ok && sb.Sand.Config.Pristine {
+		releasePristine(sb)
+	}
+	if n, ok := loadNests()[top]; ok && n.inner.Sand.Config.Pristine {
+		releasePristine(n.inner)
+	}
+	// Return to the outer sandbox.
+	if outer != "" {
+		prolog_internal(outer, false)
 	}
 }
 
+// nested returns the machine for sandbox inner entered from sandbox outer,
+// creating it if needed. Its memory view, syscalls and syscall arguments are
+// the intersection of the ones of both sandboxes.
+func nested(outer, inner commons.SandId) commons.SandId {
+	nid := outer + ">" + inner
+	machinesMu.Lock()
+	defer machinesMu.Unlock()
+	ms := loadMachines()
+	if _, ok := ms[nid]; ok {
+		return nid
+	}
+	o, ok := ms[outer]
+	i, ok1 := ms[inner]
+	if !ok || !ok1 {
+		throw("error finding nested sandbox vtx machines: '" + nid + "'")
+	}
+	config := *i.Sand.Config
+	config.Id = nid
+	config.Sys = o.Sand.Config.Sys & i.Sand.Config.Sys
+	config.Args = o.Sand.Config.Args.Intersect(&i.Sand.Config.Args)
+	config.Pristine = false
+	sand := &commons.SandboxMemory{
+		Static: o.Sand.Static.Intersect(i.Sand.Static),
+		Config: &config,
+		View:   make(map[int]uint8),
+	}
+	for pkg, prot := range i.Sand.View {
+		if oprot, ok := o.Sand.View[pkg]; ok && prot&oprot != 0 {
+			sand.View[pkg] = prot & oprot
+		}
+	}
+	m := kvm.New(int(kvmFd.Fd()), sand, mv.AddressSpaceTemplate)
+	m.Id, m.Pid = nid, i.Pid
+	setMachine(nid, m, false)
+	setNest(nid, &nest{outer: o, inner: i})
+
+	// Get the heap updates from now on, and replay the current heap.
+	pkgs := make([]int, 0, len(sand.View)+1)
+	for pkg := range sand.View {
+		pkgs = append(pkgs, pkg)
+	}
+	if m.Pid != 0 {
+		pkgs = append(pkgs, m.Pid)
+	}
+	addDeps(nid, pkgs)
+	runtime.ForEachPkgSpan(func(id int, start, size uintptr) {
+		m.Machine.Mu.Lock()
+		if prot, ok := sand.View[id]; ok {
+			m.Map(start, size, prot&commons.HEAP_VAL)
+		} else if id != 0 && id == m.Pid {
+			m.Map(start, size, commons.HEAP_VAL)
+		} else if id > 0 {
+			m.Unmap(start, size)
+		}
+		m.Machine.Mu.Unlock()
+	})
+	return nid
+}
+
 //go:nosplit
 func Transfer(oldid, newid int, start, size uintptr) {
 	tryInHost(func() {
@@ -96,7 +211,7 @@ func Transfer(oldid, newid int, start, size uintptr) {
 		lmap, ok1 := globals.PkgDeps[newid]
 		if ok {
 			for _, u := range lunmap {
-				if vm, ok2 := machines[u]; ok2 {
+				if vm, ok2 := loadMachines()[u]; ok2 {
 					vm.Machine.Mu.Lock()
 					vm.Unmap(start, size)
 					vm.Machine.Mu.Unlock()
@@ -106,7 +221,7 @@ func Transfer(oldid, newid int, start, size uintptr) {
 		// Map the pages.
 		if ok1 {
 			for _, m := range lmap {
-				if vm, ok2 := machines[m]; ok2 {
+				if vm, ok2 := loadMachines()[m]; ok2 {
 					// Map with the correct view.
 					if prot, ok := vm.Sand.View[newid]; ok {
 						vm.Machine.Mu.Lock()
@@ -130,7 +245,7 @@ func Register(id int, start, size uintptr) {
 		lmap, ok := globals.PkgDeps[id]
 		if ok {
 			for _, m := range lmap {
-				if vm, ok1 := machines[m]; ok1 {
+				if vm, ok1 := loadMachines()[m]; ok1 {
 					if prot, ok := vm.Sand.View[id]; ok {
 						vm.Machine.Mu.Lock()
 						vm.Map(start, size, prot&commons.HEAP_VAL)
@@ -145,7 +260,7 @@ func Register(id int, start, size uintptr) {
 		}
 		if id == -1 {
 			for _, s := range globals.Sandboxes {
-				m, ok := machines[s.Config.Id]
+				m, ok := loadMachines()[s.Config.Id]
 				if s.Config.Id == "-1" || !ok {
 					continue
 				}
@@ -153,6 +268,16 @@ func Register(id int, start, size uintptr) {
 				m.Unmap(start, size)
 				m.Machine.Mu.Unlock()
 			}
+			ms := loadMachines()
+			for nid := range loadNests() {
+				m, ok := ms[nid]
+				if !ok {
+					continue
+				}
+				m.Machine.Mu.Lock()
+				m.Unmap(start, size)
+				m.Machine.Mu.Unlock()
+			}
 		}
 	})
 }
@@ -166,7 +291,7 @@ func RuntimeGrowth(isheap bool, id int, start, size uintptr) {
 			lmap, ok := globals.PkgDeps[id]
 			if ok {
 				for _, m := range lmap {
-					if vm, ok1 := machines[m]; ok1 {
+					if vm, ok1 := loadMachines()[m]; ok1 {
 						vm.Machine.Mu.Lock()
 						vm.ExtendRuntime(isheap, start, size, commons.HEAP_VAL)
 						vm.Machine.Mu.Unlock()
@@ -193,19 +318,13 @@ func Execute(id commons.SandId) {
 	}
 	// We are inside the VM, scheduling something else.
 	// Redpill out.
-	if id == "" {
+	if msbid != "" {
 		kvm.Redpill()
-		runtime.AssignSbId(id, 0)
-		return
+		runtime.SetmSbId("")
 	}
-	// We are outside the VM, scheduling something outside.
-	if msbid == "" && id != "" {
+	// Enter the goroutine's innermost sandbox.
+	if id != "" {
 		prolog_internal(id, false)
-		return
-	}
-	// nested VMs? Or just the scheduler?
-	if msbid != "" && id != "" && msbid != id {
-		throw("Urf shit")
 	}
 }
 
@@ -219,7 +338,7 @@ func tryRedpill() (bool, string) {
 		return false, msbid
 	}
 	kvm.Redpill()
-	runtime.AssignSbId("", 0)
+	runtime.SetmSbId("")
 	return true, msbid
 }
 
@@ -241,38 +360,38 @@ func tryInHost(f func()) {
 	tryBluepill(do, msbid)
 }
 
-// acquirePristine looks for an available pristine sandbox.
-func acquirePristine(id string) string {
-	if sb, ok := machines[id]; ok && sb.Sand.Config.Pristine {
-		var candidate *kvm.KVM = nil
-		if ps, ok1 := pristines[id]; ok1 {
-			for _, v := range ps {
-				if atomic.CompareAndSwapUint32(&v.Locked, kvm.VM_UNLOCKED, kvm.VM_LOCKED) {
-					candidate = v
-					break
-				}
-			}
-		}
-		if candidate != nil {
-			commons.Check(candidate.Pid != 0)
-			return candidate.Id
-		}
-		// Need to create a new pristine.
-		candidate = sb.Copy(int(kvmFd.Fd()))
-		candidate.Locked = kvm.VM_LOCKED
-		machines[candidate.Id] = candidate
-		ps, _ := pristines[id]
-		pristines[id] = append(ps, candidate)
-		globals.IsPristine[candidate.Id] = true
-		commons.Check(candidate.Pid != 0)
-		v, _ := globals.PkgDeps[candidate.Pid]
-		commons.Check(len(v) == 0)
-		globals.PkgDeps[candidate.Pid] = append(v, candidate.Id)
-		return candidate.Id
+// acquirePristine locks a pristine copy of sandbox id, and returns its id.
+// It returns "" if the pool is exhausted and the entry cannot wait.
+func acquirePristine(id string, wait bool) string {
+	if p, ok := pools[id]; ok {
+		return p.acquire(wait)
 	}
 	return id
 }
 
+// releasePristine unlocks a pristine copy at the end of its entry.
+//
+//go:nosplit
+func releasePristine(v *kvm.KVM) {
+	if p, ok := pools[v.Sand.Config.Id]; ok {
+		p.release(v)
+	}
+}
+
+// copiesViolation aborts the entry in sandbox id, whose pristine copies are
+// exhausted, and returns to the outer sandbox before raising the violation.
+func copiesViolation(outer, id commons.SandId) {
+	if outer != "" {
+		prolog_internal(outer, false)
+	}
+	panic(&commons.Violation{
+		Sandbox: id,
+		Syscall: -1,
+		Quota:   commons.QUOTA_COPIES,
+		Limit:   uint64(loadMachines()[id].Sand.Config.Quota.Copies),
+	})
+}
+
 // Deps returns the ids of sandboxes that have a dependency on this package id.
 func Deps(id int) []commons.SandId {
 	v, _ := globals.PkgDeps[id]
@@ -280,7 +399,7 @@ func Deps(id int) []commons.SandId {
 }
 
 func AddressMapped(mid string, addr uintptr) uintptr {
-	vm, ok := machines[mid]
+	vm, ok := loadMachines()[mid]
 	commons.Check(ok)
 	_, _, e := vm.Machine.MemView.Tables.FindMapping(addr)
 	return e
@@ -289,7 +408,7 @@ func AddressMapped(mid string, addr uintptr) uintptr {
 
 func GetTable() uintptr {
 	mid := runtime.GetmSbIds()
-	vm, ok := machines[mid]
+	vm, ok := loadMachines()[mid]
 	commons.Check(ok)
 	return uintptr(unsafe.Pointer(vm.Machine.MemView.Tables))
 }
@@ -314,11 +433,16 @@ func Stats() {
 	)
 
 	// Collect per vcpu statistics
-	for _, m := range machines {
+	for _, m := range loadMachines() {
 		e, ex, es := m.Machine.CollectStats()
 		entries += e
 		exits += ex
 		escapes += es
 	}
 	fmt.Printf("entries: %v, exits: %v, escapes: %v\n", entries, exits, escapes)
+	fmt.Printf("cpu: %v\n", globals.CPUStats())
+	for id := range pools {
+		s, _ := ReadPoolStats(id)
+		fmt.Printf("pool %v: %+v\n", id, s)
+	}
 }
@@ -57,19 +57,20 @@ type waitq struct {
 
 //go:linkname reflect_makechan reflect.makechan
 func reflect_makechan(t *chantype, size int) *hchan {
-	return makechan(t, size)
+	return makechan(t, size, -1)
 }
 
-func makechan64(t *chantype, size int64) *hchan {
+func makechan64(t *chantype, size int64, id int) *hchan {
 	if int64(int(size)) != size {
 		panic(plainError("makechan: size out of range"))
 	}
 
-	return makechan(t, int(size))
+	return makechan(t, int(size), id)
 }
 
-func makechan(t *chantype, size int) *hchan {
+func makechan(t *chantype, size int, id int) *hchan {
 	elem := t.elem
+	id = gosbAllocId(id)
 
 	// compiler checks this but be safe.
 	if elem.size >= 1<<16 {
@@ -92,18 +93,18 @@ func makechan(t *chantype, size int) *hchan {
 	switch {
 	case mem == 0:
 		// Queue or element size is zero.
-		c = (*hchan)(mallocgc(hchanSize, nil, true, gosbInterpose(CALLER_LVL)))
+		c = (*hchan)(mallocgc(hchanSize, nil, true, id))
 		// Race detector uses this location for synchronization.
 		c.buf = c.raceaddr()
 	case elem.ptrdata == 0:
 		// Elements do not contain pointers.
 		// Allocate hchan and buf in one call.
-		c = (*hchan)(mallocgc(hchanSize+mem, nil, true, gosbInterpose(CALLER_LVL)))
+		c = (*hchan)(mallocgc(hchanSize+mem, nil, true, id))
 		c.buf = add(unsafe.Pointer(c), hchanSize)
 	default:
 		// Elements contain pointers.
 		c = new(hchan)
-		c.buf = mallocgc(mem, elem, true, gosbInterpose(CALLER_LVL))
+		c.buf = mallocgc(mem, elem, true, id)
 	}
 
 	c.elemsize = uint16(elem.size)
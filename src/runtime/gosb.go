@@ -37,6 +37,7 @@ var (
 	prologHook        func(id string)                                = nil
 	epilogHook        func(id string)                                = nil
 	mstartHook        func()                                         = nil
+	exitHook          func()                                         = nil
 )
 
 //go:nosplit
@@ -47,6 +48,9 @@ func sandbox_prolog(id, mem, syscalls string) {
 //go:nosplit
 func sandbox_epilog(id, mem, syscalls string) {
 	epilogHook(id)
+	if s := getg().sb; s != nil && s.quota.q != nil {
+		raiseHeapQuota()
+	}
 }
 
 func LitterboxHooks(
@@ -83,8 +87,95 @@ func RegisterEmergencyGrowth(f func(bool, int, uintptr, uintptr)) {
 	runtimeGrowth = f
 }
 
+// RegisterExitHook registers a function called when the program exits,
+// either by returning from main.main or by calling os.Exit(0).
+func RegisterExitHook(f func()) {
+	exitHook = f
+}
+
+// gosbExit calls the exit hook, at most once.
+func gosbExit() {
+	if f := exitHook; f != nil {
+		exitHook = nil
+		f()
+	}
+}
+
+// sbentry is a sandbox entered by a goroutine.
+type sbentry struct {
+	id  string // gosb sandbox ID
+	pid int    // pristine package id, 0 if the sandbox is not pristine
+	cpu int64  // CPU time of the goroutine when it entered the sandbox
+}
+
+// sbstate is the gosb state of a goroutine. Most goroutines never enter a
+// sandbox, it is kept out of the g and allocated on first use. A g keeps it
+// when it is reused.
+type sbstate struct {
+	stack []sbentry // sandboxes entered, innermost last
+
+	// limits and CPU time, see gosb_deadline.go
+	deadline int64   // nanotime, 0 if none
+	budget   int64   // CPU time, 0 if none
+	cpu      int64   // CPU time spent inside sandboxes
+	run      int64   // CPU time of the thread when the goroutine last started running in a sandbox, 0 if it does not
+	tid      uint64  // thread of run
+	stop     uint32  // _SbStopNone, _SbStopRequested or _SbStopDelivered
+	armed    bool    // the limits are armed in sbtimers
+	overCPU  bool    // the goroutine is stopped because of its CPU budget
+	timer    sbtimer // the armed limits
+
+	quota quotaViolation // heap quota violation to raise, see gosb_quota.go
+}
+
+// sballoc returns the gosb state of gp, allocated if needed.
+func (gp *g) sballoc() *sbstate {
+	if gp.sb == nil {
+		gp.sb = new(sbstate)
+	}
+	return gp.sb
+}
+
+// sbdepth returns the number of sandboxes entered by gp.
+// g0 allocates on behalf of its m, it is inside the sandbox of the m.
+//
+//go:nosplit
+func (gp *g) sbdepth() int {
+	if s := gp.sb; s != nil {
+		return len(s.stack)
+	}
+	if mp := gp.m; mp != nil && gp == mp.g0 && mp.sbid != "" {
+		return 1
+	}
+	return 0
+}
+
+// sbid returns the innermost sandbox of gp, "" if gp is trusted.
+//
+//go:nosplit
+func (gp *g) sbid() string {
+	if s := gp.sb; s != nil && len(s.stack) != 0 {
+		return s.stack[len(s.stack)-1].id
+	}
+	if mp := gp.m; mp != nil && gp == mp.g0 {
+		return mp.sbid
+	}
+	return ""
+}
+
+// pristineid returns the pristine id of the innermost sandbox of gp.
+//
+//go:nosplit
+func (gp *g) pristineid() int {
+	if s := gp.sb; s != nil && len(s.stack) != 0 {
+		return s.stack[len(s.stack)-1].pid
+	}
+	return 0
+}
+
 // AssignSbId acquires assigns g.sbid == m.sbid == id
-// This might change g0? Should we make it explicit?
+// It replaces the sandboxes entered by g with id, backends that do not
+// support nesting use it instead of PushSbId and PopSbId.
 //
 //go:nosplit
 func AssignSbId(id string, pid int) {
@@ -92,28 +183,109 @@ func AssignSbId(id string, pid int) {
 	if _g_ == nil || _g_.m == nil || _g_.m.g0 == nil {
 		throw("g, m, or g0 is nil")
 	}
-	_g_.sbid = id
 	_g_.m.sbid = id
-	_g_.m.g0.sbid = id
-	_g_.pristineid = 0
-	_g_.pristine = false
-	if pid != 0 {
-		_g_.pristine = true
-		_g_.m.g0.pristine = true
-		_g_.pristineid = pid
+	if _g_ == _g_.m.g0 {
+		return
+	}
+	if _g_.sbdepth() == 1 && _g_.sb.stack[0].id == id {
+		// The goroutine already executes the sandbox.
+		_g_.sb.stack[0].pid = pid
+		return
+	}
+	for _g_.sbdepth() != 0 {
+		PopSbId()
+	}
+	if id != "" {
+		PushSbId(id, pid)
 	}
 }
 
-// GetmSbIds returns the m ids
+// SetmSbId marks the current m as executing sandbox id, without changing
+// the sandboxes entered by the goroutine.
 //
 //go:nosplit
-func GetmSbIds() string {
+func SetmSbId(id string) {
 	_g_ := getg()
-	if _g_.sbid != _g_.m.sbid || _g_.sbid != _g_.m.g0.sbid {
-		println(_g_.sbid, "|", _g_.m.sbid, "|", _g_.m.g0.sbid)
-		throw("sbids do not match.")
+	if _g_ == nil || _g_.m == nil || _g_.m.g0 == nil {
+		throw("g, m, or g0 is nil")
+	}
+	_g_.m.sbid = id
+}
+
+// PushSbId records that the goroutine enters sandbox id, nested inside the
+// sandboxes it already entered. It allocates the gosb state of the goroutine
+// and grows its stack of sandboxes, the backends call it from their prologs
+// where the stack can grow.
+func PushSbId(id string, pid int) {
+	_g_ := getg()
+	if _g_ == _g_.m.g0 {
+		throw("sandbox entered on g0")
+	}
+	s := _g_.sballoc()
+	if len(s.stack) == 0 {
+		sbenter(_g_)
 	}
-	return _g_.m.sbid
+	s.stack = append(s.stack, sbentry{id, pid, sbcputime(_g_)})
+}
+
+// PopSbId records that the goroutine leaves its innermost sandbox id, and
+// returns it with the sandbox it returns to, "" if it is trusted.
+//
+//go:nosplit
+func PopSbId() (id, outer string) {
+	_g_ := getg()
+	s := _g_.sb
+	if s == nil || len(s.stack) == 0 {
+		throw("leaving a sandbox that was not entered")
+	}
+	e := &s.stack[len(s.stack)-1]
+	id = e.id
+	sbcharge(_g_, e)
+	*e = sbentry{}
+	s.stack = s.stack[:len(s.stack)-1]
+	if len(s.stack) == 0 {
+		sbleave(_g_)
+	}
+	return id, _g_.sbid()
+}
+
+// GetgSbIds returns the innermost sandbox entered by the goroutine.
+//
+//go:nosplit
+func GetgSbIds() string {
+	return getg().sbid()
+}
+
+// GetmSbIds returns the m ids
+// The goroutine can be in an outer sandbox while the m is trusted, e.g.,
+// between a nested epilog and the reentry of the outer sandbox.
+//
+//go:nosplit
+func GetmSbIds() string {
+	return getg().m.sbid
+}
+
+// GetmSbSlot returns the slot of the current thread in the tables of the
+// backend, -1 if it has none. It can be called from a signal handler.
+//
+//go:nosplit
+func GetmSbSlot() int {
+	return int(getg().m.sbslot) - 1
+}
+
+// SetmSbSlot sets the slot of the current thread in the tables of the backend.
+//
+//go:nosplit
+func SetmSbSlot(slot int) {
+	getg().m.sbslot = int32(slot) + 1
+}
+
+// SbThrow aborts the program, for the backends that detect an error where
+// they cannot fail otherwise, e.g., in the scheduler.
+//
+//go:nosplit
+func SbThrow(s string) {
+	throw(s)
 }
 
 //go:nosplit
@@ -169,11 +341,16 @@ func Iscgo() bool {
 	return iscgo
 }
 
+// SbNoPkg is not the id of a package. SpanIdOf returns it for the addresses
+// outside of the heap spans, and TransferSpan takes it to hand a span over
+// whatever its owner.
+const SbNoPkg = -10
+
 //go:nosplit
 func SpanIdOf(addr uintptr) int {
 	span := spanOf(addr)
 	if span == nil {
-		return -10
+		return SbNoPkg
 	}
 	return span.id
 }
@@ -37,8 +37,8 @@ func getpackageid(level int) int {
 		panic("Unable to unwind the stack")
 	}
 	id := pcToPkg(pcbuf[n-1])
-	if id != 0 && gp.pristine {
-		return gp.pristineid
+	if pid := gp.pristineid(); id != 0 && pid != 0 {
+		return pid
 	}
 	return id
 }
@@ -72,3 +72,18 @@ cleanup:
 	releasem(mp)
 	return id
 }
+
+// gosbAllocId returns the package id of an allocation site. The compiler
+// passes the id of the allocating package to the allocation functions, we
+// only unwind the stack for the sites it did not tag, with id -1.
+//
+//go:noinline
+func gosbAllocId(id int) int {
+	if id == -1 {
+		return gosbInterpose(CALLER_LVL + INCR_LVL)
+	}
+	if !bloatInitDone {
+		return 0
+	}
+	return filterPkgId(id)
+}
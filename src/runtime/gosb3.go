@@ -8,13 +8,14 @@ type sbSpanList struct {
 
 //go:notinheap
 type spanExtras struct {
-	id    int // package id
-	oldid int
-	dirty bool
-	move  bool
-	inext *mspan      // next entry in list
-	iprev *mspan      // previous entry in list
-	ilist *sbSpanList // link back to the list
+	id      int // package id
+	oldid   int
+	charged int // package charged for the span, see gosb_quota.go
+	dirty   bool
+	move    bool
+	inext   *mspan      // next entry in list
+	iprev   *mspan      // previous entry in list
+	ilist   *sbSpanList // link back to the list
 
 	// Allocator cache for tiny objects w/o pointers.
 	// See "Tiny allocator" comment in malloc.go.
@@ -35,6 +36,9 @@ type spanExtras struct {
 //go:nosplit
 func (e *mspan) setId(id int, move bool) {
 	mp := acquirem()
+	if e.charged != id {
+		e.charge(id)
+	}
 	if e.id == id || transferSection == nil || registerSection == nil {
 		e.id = id
 		releasem(mp)
@@ -95,6 +99,10 @@ func (list *sbSpanList) getId(id int) *mspan {
 	for s := list.first; s != nil; s = s.inext {
 		if s.id == id || s.allocCount == 0 {
 			if s.id != id {
+				// Do not hand the span over if it does not fit the quota.
+				if heapQuotaExceeded(id, s.npages<<_PageShift) != nil {
+					continue
+				}
 				s.setId(id, true)
 			}
 			return s
@@ -0,0 +1,6 @@
+package runtime
+
+// threadcputime returns the CPU time of the thread tid, read from its
+// per-thread CPU clock, or -1 if the clock cannot be read.
+// Unlike nanotime, it does not count the time the thread is descheduled.
+func threadcputime(tid uint64) int64
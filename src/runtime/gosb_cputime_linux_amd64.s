@@ -0,0 +1,28 @@
+#include "textflag.h"
+
+#define SYS_clock_gettime	228
+
+// The clock of a thread, MAKE_THREAD_CPUCLOCK(tid, CPUCLOCK_SCHED) in the
+// kernel.
+#define CPUCLOCK_PERTHREAD_SCHED	6
+
+// func threadcputime(tid uint64) int64
+TEXT runtime·threadcputime(SB),NOSPLIT,$16-16
+	MOVQ	tid+0(FP), DI
+	NOTQ	DI
+	SHLQ	$3, DI
+	ORQ	$CPUCLOCK_PERTHREAD_SCHED, DI
+	LEAQ	0(SP), SI
+	MOVL	$SYS_clock_gettime, AX
+	SYSCALL
+	CMPQ	AX, $0
+	JNE	fail
+	MOVQ	0(SP), AX	// sec
+	MOVQ	8(SP), DX	// nsec
+	IMULQ	$1000000000, AX
+	ADDQ	DX, AX
+	MOVQ	AX, ret+8(FP)
+	RET
+fail:
+	MOVQ	$-1, ret+8(FP)
+	RET
@@ -0,0 +1,12 @@
+// +build !linux !amd64
+
+package runtime
+
+// threadcputime returns the CPU time of the thread tid. There is no clock
+// per thread on this platform, it is approximated with nanotime, which also
+// counts the time the thread is descheduled.
+//
+//go:nosplit
+func threadcputime(tid uint64) int64 {
+	return nanotime()
+}
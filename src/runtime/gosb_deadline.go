@@ -0,0 +1,342 @@
+package runtime
+
+import (
+	"runtime/internal/atomic"
+)
+
+// Sandbox deadlines and CPU budgets.
+//
+// A goroutine sets its limits with SetSbLimits before it enters a sandbox.
+// They are armed when it enters its outermost sandbox, and disarmed when it
+// leaves it. sysmon checks the armed limits on every tick: a goroutine that
+// overruns them is stopped, either by the stop hook of the backend, e.g., a
+// forced exit of the VM, or by a SIGXCPU sent to its thread. The signal
+// handler makes the goroutine panic, as for a nil dereference, if it
+// executes the code of a sandbox. Otherwise, e.g., when it is in the
+// runtime, in a system call or parked, sysmon sends the signal again on a
+// later tick. The panic is raised by overrunHook, which the trusted caller
+// of the sandbox can recover.
+//
+// The CPU time of a goroutine is the CPU time of the threads that run it
+// while it is inside a sandbox, system calls excluded, see threadcputime. It
+// is charged to the sandboxes that the goroutine entered when they return.
+
+const (
+	// Upper bound on the sandboxes whose CPU time we report.
+	_MaxSbCPU = 256
+
+	// Interval between two attempts to stop a goroutine.
+	_SbStopRetry = 1 * 1000 * 1000
+
+	// Interval before a goroutine that recovered from its stop is stopped
+	// again.
+	_SbStopRedeliver = 10 * 1000 * 1000
+
+	// si_code of the signals sent by tgkill.
+	_SI_TKILL = -6
+)
+
+// Values of sbstate.stop.
+const (
+	_SbStopNone      = iota
+	_SbStopRequested // sysmon asked for the goroutine to be stopped
+	_SbStopDelivered // the goroutine panics
+)
+
+// sbtimer is the armed limits of a goroutine, linked in sbtimers.
+type sbtimer struct {
+	deadline   int64 // nanotime, 0 if none
+	budget     int64 // CPU time, 0 if none
+	cpu0       int64 // CPU time of the goroutine when the limits were armed
+	sent       int64 // last attempt to stop the goroutine
+	prev, next guintptr
+}
+
+var (
+	// sbtimers are the goroutines with armed limits, checked by sysmon.
+	// The gs are never freed, the list does not keep them alive.
+	sbtimers struct {
+		lock mutex
+		n    uint32
+		head guintptr
+	}
+
+	// sbcpu is the CPU time consumed by each sandbox.
+	sbcpu struct {
+		lock mutex
+		n    int
+		ids  [_MaxSbCPU]string
+		ns   [_MaxSbCPU]int64
+	}
+
+	// stopHook stops the thread tid if it executes a sandbox that the
+	// backend can interrupt, and reports whether it did.
+	stopHook func(tid uint64) bool = nil
+
+	// overrunHook raises the violation, it does not return.
+	overrunHook func(id string, pc uintptr, cpu bool, limit int64) = nil
+)
+
+// SetSbLimits sets the limits of the sandboxes entered by the goroutine: a
+// deadline, in Unix nanoseconds, and a budget of CPU time, in nanoseconds.
+// 0 removes a limit. It returns the previous limits.
+//
+// The limits apply to the outermost sandbox the goroutine enters. If it is
+// already inside a sandbox, they replace the armed ones.
+func SetSbLimits(deadline, budget int64) (int64, int64) {
+	gp := getg()
+	pdeadline, pbudget := SbLimits()
+	s := gp.sballoc()
+	s.deadline = 0
+	if deadline != 0 {
+		s.deadline = nanotime() + deadline - unixnanotime()
+		if s.deadline == 0 {
+			s.deadline = 1
+		}
+	}
+	s.budget = budget
+	if s.armed {
+		lock(&sbtimers.lock)
+		s.timer.deadline, s.timer.budget = s.deadline, s.budget
+		unlock(&sbtimers.lock)
+	}
+	return pdeadline, pbudget
+}
+
+// SbLimits returns the limits set by the goroutine.
+func SbLimits() (deadline, budget int64) {
+	s := getg().sb
+	if s == nil {
+		return 0, 0
+	}
+	if s.deadline != 0 {
+		deadline = unixnanotime() + s.deadline - nanotime()
+	}
+	return deadline, s.budget
+}
+
+// SandboxCPUTimes returns the CPU time, in nanoseconds, consumed by each
+// sandbox that returned at least once.
+func SandboxCPUTimes() map[string]int64 {
+	lock(&sbcpu.lock)
+	n := sbcpu.n
+	ids, ns := sbcpu.ids, sbcpu.ns
+	unlock(&sbcpu.lock)
+	times := make(map[string]int64, n)
+	for i := 0; i < n; i++ {
+		times[ids[i]] = ns[i]
+	}
+	return times
+}
+
+// RegisterStopHook registers the function that interrupts a thread that
+// executes a sandbox when the backend cannot rely on signals.
+func RegisterStopHook(f func(tid uint64) bool) {
+	stopHook = f
+}
+
+// RegisterOverrunHook registers the function that raises the violation of
+// a goroutine that overran its limits.
+func RegisterOverrunHook(f func(id string, pc uintptr, cpu bool, limit int64)) {
+	overrunHook = f
+}
+
+// SbOverrun is called by a backend that interrupted the goroutine through
+// its stop hook. pc is the interrupted instruction.
+func SbOverrun(pc uintptr) {
+	gp := getg()
+	atomic.Store(&gp.sb.stop, _SbStopDelivered)
+	gp.sigpc = pc
+	sbOverrun(gp)
+}
+
+// unixnanotime returns the wall clock in Unix nanoseconds.
+func unixnanotime() int64 {
+	sec, nsec := walltime()
+	return sec*1e9 + int64(nsec)
+}
+
+// sbenter is called when gp enters a sandbox while it is trusted.
+//
+//go:nosplit
+func sbenter(gp *g) {
+	s := gp.sb
+	s.tid = gp.m.procid
+	s.run = threadcputime(s.tid)
+	s.stop = _SbStopNone
+	if s.deadline == 0 && s.budget == 0 {
+		return
+	}
+	lock(&sbtimers.lock)
+	s.timer = sbtimer{deadline: s.deadline, budget: s.budget, cpu0: s.cpu, next: sbtimers.head}
+	if next := sbtimers.head.ptr(); next != nil {
+		next.sb.timer.prev.set(gp)
+	}
+	sbtimers.head.set(gp)
+	atomic.Store(&sbtimers.n, sbtimers.n+1)
+	s.armed = true
+	unlock(&sbtimers.lock)
+}
+
+// sbleave is called when gp leaves its last sandbox.
+//
+//go:nosplit
+func sbleave(gp *g) {
+	s := gp.sb
+	sbpause(gp)
+	if s.armed {
+		lock(&sbtimers.lock)
+		t := &s.timer
+		if prev := t.prev.ptr(); prev != nil {
+			prev.sb.timer.next = t.next
+		} else {
+			sbtimers.head = t.next
+		}
+		if next := t.next.ptr(); next != nil {
+			next.sb.timer.prev = t.prev
+		}
+		*t = sbtimer{}
+		atomic.Store(&sbtimers.n, sbtimers.n-1)
+		s.armed = false
+		unlock(&sbtimers.lock)
+	}
+	atomic.Store(&s.stop, _SbStopNone)
+}
+
+// sbpause stops counting the CPU time of gp, on the thread that runs it.
+//
+//go:nosplit
+func sbpause(gp *g) {
+	if s := gp.sb; s != nil && s.run != 0 {
+		if now := threadcputime(s.tid); now > s.run {
+			s.cpu += now - s.run
+		}
+		s.run = 0
+	}
+}
+
+// sbresume counts the CPU time of gp, if it is inside a sandbox, on the
+// thread that runs it.
+//
+//go:nosplit
+func sbresume(gp *g) {
+	if s := gp.sb; s != nil && len(s.stack) != 0 && s.run == 0 {
+		s.tid = getg().m.procid
+		s.run = threadcputime(s.tid)
+	}
+}
+
+// sbcputime returns the CPU time of gp. sysmon reads it racily, it retries
+// if gp moves to another thread while it reads the clock of the thread.
+//
+//go:nosplit
+func sbcputime(gp *g) int64 {
+	s := gp.sb
+	if s == nil {
+		return 0
+	}
+	for {
+		cpu, run, tid := s.cpu, s.run, s.tid
+		if run == 0 {
+			return cpu
+		}
+		now := threadcputime(tid)
+		if s.run != run || s.tid != tid {
+			continue
+		}
+		if now > run {
+			cpu += now - run
+		}
+		return cpu
+	}
+}
+
+// sbcharge adds the CPU time that gp spent in the sandbox it leaves.
+func sbcharge(gp *g, e *sbentry) {
+	if e.id == "" {
+		return
+	}
+	ns := sbcputime(gp) - e.cpu
+	lock(&sbcpu.lock)
+	i := 0
+	for i < sbcpu.n && sbcpu.ids[i] != e.id {
+		i++
+	}
+	if i == sbcpu.n && sbcpu.n < _MaxSbCPU {
+		sbcpu.ids[i] = e.id
+		sbcpu.n++
+	}
+	if i < sbcpu.n {
+		sbcpu.ns[i] += ns
+	}
+	unlock(&sbcpu.lock)
+}
+
+// sbCheckLimits is called by sysmon, it stops the goroutines that overran
+// their limits.
+func sbCheckLimits(now int64) {
+	lock(&sbtimers.lock)
+	for gp := sbtimers.head.ptr(); gp != nil; gp = gp.sb.timer.next.ptr() {
+		s := gp.sb
+		t := &s.timer
+		cpu := t.budget != 0 && sbcputime(gp)-t.cpu0 >= t.budget
+		if !cpu && (t.deadline == 0 || now < t.deadline) {
+			continue
+		}
+		switch atomic.Load(&s.stop) {
+		case _SbStopNone:
+			s.overCPU = cpu
+			atomic.Store(&s.stop, _SbStopRequested)
+		case _SbStopRequested:
+			if now-t.sent < _SbStopRetry {
+				continue
+			}
+		case _SbStopDelivered:
+			// The goroutine recovered inside the sandbox.
+			if now-t.sent < _SbStopRedeliver {
+				continue
+			}
+			atomic.Cas(&s.stop, _SbStopDelivered, _SbStopRequested)
+		}
+		t.sent = now
+		mp := gp.m
+		if mp == nil || readgstatus(gp) != _Grunning {
+			continue
+		}
+		if stopHook != nil && stopHook(mp.procid) {
+			continue
+		}
+		sbSignalStop(mp)
+	}
+	unlock(&sbtimers.lock)
+}
+
+// sbStopPC reports whether a goroutine interrupted at pc can panic: pc
+// must belong to Go code that is neither the runtime nor a backend.
+//
+//go:nowritebarrierrec
+func sbStopPC(pc uintptr) bool {
+	f := findfunc(pc)
+	if !f.valid() {
+		return false
+	}
+	name := funcname(f)
+	return !hasPrefix(name, "runtime.") && !hasPrefix(name, "gosb/") && !hasPrefix(name, "gosb.")
+}
+
+// sbOverrun raises the violation of gp, that overran its limits.
+func sbOverrun(gp *g) {
+	id, s := gp.sbid(), gp.sb
+	limit := s.budget
+	if !s.overCPU {
+		limit, _ = SbLimits()
+	}
+	if overrunHook != nil {
+		overrunHook(id, gp.sigpc, s.overCPU, limit)
+		throw("gosb: overrun hook returned")
+	}
+	if s.overCPU {
+		panic(plainError("sandbox " + id + ": cpu budget exceeded"))
+	}
+	panic(plainError("sandbox " + id + ": deadline exceeded"))
+}
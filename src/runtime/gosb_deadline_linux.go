@@ -0,0 +1,7 @@
+package runtime
+
+// sbSignalStop sends the SIGXCPU that stops the goroutine running on mp,
+// see sbStopSignal.
+func sbSignalStop(mp *m) {
+	tgkill(getpid(), int(mp.procid), _SIGXCPU)
+}
@@ -0,0 +1,7 @@
+// +build !linux
+
+package runtime
+
+// sbSignalStop does nothing, goroutines are only stopped by the stop hook
+// of the backend.
+func sbSignalStop(mp *m) {}
@@ -0,0 +1,36 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runtime
+
+import "runtime/internal/atomic"
+
+// sbStopSignal handles a SIGXCPU on gp. It reports whether the signal was
+// sent to stop a goroutine. If gp executes a sandbox, it makes it call
+// sigpanic.
+//
+//go:nowritebarrierrec
+func sbStopSignal(c *sigctxt, gp *g) bool {
+	if int32(c.sigcode()) != _SI_TKILL || atomic.Load(&sbtimers.n) == 0 {
+		return false
+	}
+	if gp == nil || gp.sb == nil || atomic.Load(&gp.sb.stop) != _SbStopRequested {
+		// The goroutine moved to another thread, sysmon retries.
+		return true
+	}
+	mp := gp.m
+	if gp != mp.curg || gp.sbdepth() == 0 || gp.throwsplit || gp.syscallsp != 0 {
+		return true
+	}
+	if mp.locks != 0 || mp.mallocing != 0 || mp.preemptoff != "" || mp.dying != 0 {
+		return true
+	}
+	if !sbStopPC(c.sigpc()) || !atomic.Cas(&gp.sb.stop, _SbStopRequested, _SbStopDelivered) {
+		return true
+	}
+	gp.sig = _SIGXCPU
+	gp.sigcode0 = uintptr(c.sigcode())
+	gp.sigcode1 = 0
+	gp.sigpc = c.sigpc()
+	c.preparePanic(_SIGXCPU, gp)
+	return true
+}
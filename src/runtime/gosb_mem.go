@@ -0,0 +1,268 @@
+package runtime
+
+import (
+	"runtime/internal/atomic"
+	_ "unsafe" // for go:linkname
+)
+
+// Upper bound on the package ids for which we count allocations.
+const _MaxPkgIds = 1 << 12
+
+// pkgMallocs counts the heap objects allocated by each package.
+var pkgMallocs [_MaxPkgIds]uint64
+
+// PkgMemStats records the heap usage of a gosb package.
+type PkgMemStats struct {
+	// Id is the package id, 0 for the runtime and the allocations
+	// that are not attributed to a package.
+	Id int
+
+	// HeapAlloc is bytes of allocated heap objects. As for
+	// MemStats.HeapAlloc, objects are counted until their span is swept.
+	HeapAlloc uint64
+
+	// HeapInuse is bytes in in-use spans owned by the package.
+	HeapInuse uint64
+
+	// Spans is the number of in-use spans owned by the package.
+	Spans uint64
+
+	// HeapObjects is the number of allocated heap objects.
+	HeapObjects uint64
+
+	// Mallocs is the cumulative count of heap objects allocated.
+	Mallocs uint64
+}
+
+// countPkgMalloc is called by mallocgc.
+//
+//go:nosplit
+func countPkgMalloc(id int) {
+	if id > 0 && id < _MaxPkgIds {
+		atomic.Xadd64(&pkgMallocs[id], 1)
+	}
+}
+
+// pkgSpan is a snapshot of an in-use heap span.
+type pkgSpan struct {
+	id          int
+	start, size uintptr
+	elemsize    uintptr
+	objects     uint16
+}
+
+// pkgSpans returns the heap spans in use. The spans are collected under the
+// heap lock, spans created after the snapshot go through the backend hooks.
+// The snapshot cannot allocate under the lock, it is retried until the
+// spans fit.
+func pkgSpans() []pkgSpan {
+	n := len(mheap_.allspans)
+	for {
+		spans := make([]pkgSpan, 0, n+64)
+		full := false
+		systemstack(func() {
+			lock(&mheap_.lock)
+			if n = len(mheap_.allspans); n > cap(spans) {
+				full = true
+			} else {
+				for _, s := range mheap_.allspans {
+					if s.state == mSpanInUse {
+						spans = append(spans, pkgSpan{s.id, s.base(), s.npages << _PageShift, s.elemsize, s.allocCount})
+					}
+				}
+			}
+			unlock(&mheap_.lock)
+		})
+		if !full {
+			return spans
+		}
+	}
+}
+
+// ForEachPkgSpan calls f on every heap span in use, with the id of the
+// package that owns it. f is called without the heap lock and can allocate.
+func ForEachPkgSpan(f func(id int, start, size uintptr)) {
+	for _, s := range pkgSpans() {
+		f(s.id, s.start, s.size)
+	}
+}
+
+// TransferPkgSpans hands the heap spans in use by package from over to
+// package to, e.g., when the package of a pristine copy is released, and
+// returns their number. The backend is notified through its transfer hook.
+// Objects in the spans are not freed, the spans return to the heap once
+// they are swept empty.
+func TransferPkgSpans(from, to int) int {
+	n := 0
+	for _, ps := range pkgSpans() {
+		if ps.id != from {
+			continue
+		}
+		moved := false
+		systemstack(func() {
+			lock(&mheap_.lock)
+			if s := spanOfHeap(ps.start); s != nil && s.state == mSpanInUse && s.id == from && !s.dirty {
+				s.charge(to)
+				s.id = to
+				moved = true
+			}
+			unlock(&mheap_.lock)
+		})
+		if moved {
+			n++
+			if transferSection != nil {
+				transferSection(from, to, ps.start, ps.size)
+			}
+		}
+	}
+	return n
+}
+
+// HeapSpanOf returns the bounds of the in-use heap span that contains addr.
+// large reports whether the span holds a single large object, and no other
+// object can be allocated in it.
+func HeapSpanOf(addr uintptr) (start, size uintptr, large, ok bool) {
+	if s := spanOfHeap(addr); s != nil {
+		return s.base(), s.npages << _PageShift, s.spanclass.sizeclass() == 0, true
+	}
+	return 0, 0, false, false
+}
+
+// sbArenaMap is the heap arena that sysAlloc maps, before it has metadata.
+// It is protected by mheap_.lock.
+var sbArenaMap struct {
+	base, size uintptr
+}
+
+// SbRuntimeMemory reports whether the runtime owns [addr, addr+size) and no
+// object uses it: the pages of the heap arenas outside of in-use spans,
+// e.g., the ones that the scavenger releases, and the arena being mapped.
+// The backends call it from their syscall handlers, it reads the heap
+// without locks.
+//
+//go:nosplit
+func SbRuntimeMemory(addr, size uintptr) bool {
+	if size == 0 || addr+size < addr {
+		return false
+	}
+	if m := &sbArenaMap; m.size != 0 && addr >= m.base && addr+size <= m.base+m.size {
+		return true
+	}
+	for p := addr &^ (pageSize - 1); p < addr+size; p += pageSize {
+		ha := sbHeapArena(p)
+		if ha == nil {
+			return false
+		}
+		s := ha.spans[(p/pageSize)%pagesPerArena]
+		if s != nil && (s.state == mSpanInUse || s.state == mSpanManual) &&
+			p >= s.base() && p < s.base()+s.npages*pageSize {
+			return false
+		}
+	}
+	return true
+}
+
+// sbHeapArena returns the heap arena that contains p, nil if there is none.
+//
+//go:nosplit
+func sbHeapArena(p uintptr) *heapArena {
+	ri := arenaIndex(p)
+	if arenaL1Bits == 0 {
+		if ri.l2() >= uint(len(mheap_.arenas[0])) {
+			return nil
+		}
+	} else if ri.l1() >= uint(len(mheap_.arenas)) {
+		return nil
+	}
+	l2 := mheap_.arenas[ri.l1()]
+	if l2 == nil {
+		return nil
+	}
+	return l2[ri.l2()]
+}
+
+// sbKeepsMappings reports whether sysFree leaks memory instead of unmapping
+// it: a sandbox can only unmap SbRuntimeMemory, and sysFree releases memory
+// outside of the heap arenas, e.g., failed reservations.
+//
+//go:nosplit
+func sbKeepsMappings() bool {
+	gp := getg()
+	return gp != nil && gp.m != nil && gp.m.sbid != ""
+}
+
+// TransferSpan hands the in-use heap span that contains addr over to
+// package to, if package from owns it, or whatever its owner if from is
+// SbNoPkg. It returns the bounds of the span and its previous owner, ok is
+// false if there is no such span. The backend is notified through its
+// transfer hook.
+func TransferSpan(addr uintptr, from, to int) (start, size uintptr, old int, ok bool) {
+	systemstack(func() {
+		lock(&mheap_.lock)
+		if s := spanOfHeap(addr); s != nil && s.state == mSpanInUse && !s.dirty && (from == SbNoPkg || s.id == from) {
+			start, size, old = s.base(), s.npages<<_PageShift, s.id
+			s.charge(to)
+			s.id = to
+			ok = true
+		}
+		unlock(&mheap_.lock)
+	})
+	if ok && old != to && transferSection != nil {
+		transferSection(old, to, start, size)
+	}
+	return start, size, old, ok
+}
+
+// ReadPkgMemStats returns the heap usage of every package that owns heap
+// spans or allocated objects, sorted by package id.
+func ReadPkgMemStats() []PkgMemStats {
+	var stats []PkgMemStats
+	get := func(id int) *PkgMemStats {
+		i := len(stats)
+		for i > 0 && stats[i-1].Id >= id {
+			i--
+		}
+		if i < len(stats) && stats[i].Id == id {
+			return &stats[i]
+		}
+		stats = append(stats, PkgMemStats{})
+		copy(stats[i+1:], stats[i:])
+		stats[i] = PkgMemStats{Id: id}
+		return &stats[i]
+	}
+	for _, s := range pkgSpans() {
+		st := get(s.id)
+		st.HeapAlloc += uint64(s.objects) * uint64(s.elemsize)
+		st.HeapInuse += uint64(s.size)
+		st.Spans++
+		st.HeapObjects += uint64(s.objects)
+	}
+	for id := range pkgMallocs {
+		if n := atomic.Load64(&pkgMallocs[id]); n != 0 {
+			get(id).Mallocs = n
+		}
+	}
+	return stats
+}
+
+// pprof_pkgOfStack returns the name of the package that allocated the
+// objects of a heap profile record, "" if it is not a gosb package.
+//
+//go:linkname pprof_pkgOfStack runtime/pprof.runtime_pkgOfStack
+func pprof_pkgOfStack(stk []uintptr) string {
+	if !bloatInitDone || pcToPkg == nil {
+		return ""
+	}
+	for _, pc := range stk {
+		// The stack holds return addresses.
+		f := findfunc(pc - 1)
+		if !f.valid() || hasPrefix(funcname(f), "runtime.") {
+			continue
+		}
+		if id := pcToPkg(pc - 1); id > 0 {
+			return idToPkg[id]
+		}
+		return ""
+	}
+	return ""
+}
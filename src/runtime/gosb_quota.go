@@ -0,0 +1,167 @@
+package runtime
+
+import (
+	"runtime/internal/atomic"
+)
+
+// Heap quotas.
+//
+// In-use heap spans are charged to the package that owns them when setId
+// hands them over, and uncharged when they return to the heap. A quota
+// bounds the bytes charged to the packages of a sandbox. It is checked
+// before a new span is handed over to a package on behalf of a goroutine
+// that executes a sandbox. mallocgc cannot fail half-way, so if the span
+// does not fit, the violation is recorded on the goroutine and raised by
+// quotaHook once the allocation returns and the goroutine holds no runtime
+// lock. The trusted caller of the sandbox can recover it. Allocations of
+// trusted goroutines are charged but never fail.
+
+// pkgInuse is the bytes of in-use heap spans charged to each package.
+var pkgInuse [_MaxPkgIds]uint64
+
+// heapQuota bounds the heap spans of the packages of a sandbox.
+type heapQuota struct {
+	id    string // gosb sandbox ID
+	pkgs  []int
+	limit uintptr
+}
+
+// quotaViolation is a violation recorded by checkHeapQuota.
+type quotaViolation struct {
+	q   *heapQuota // nil if none
+	pkg int
+	pc  uintptr
+}
+
+var (
+	// quotaLock protects quotas, which is replaced and never modified.
+	quotaLock mutex
+	quotas    map[int][]*heapQuota // the quotas that cover a package
+	nquotas   uint32
+
+	// quotaSetLock serializes the updates of sbQuotas.
+	quotaSetLock mutex
+	sbQuotas     map[string]*heapQuota
+
+	// quotaHook raises the violation, it does not return.
+	quotaHook func(id string, pkg int, pc, limit uintptr) = nil
+)
+
+// SetHeapQuota bounds the bytes of the heap spans owned by pkgs, the
+// packages of sandbox id, to limit. A limit of 0 removes the quota.
+// The spans that the packages already own are not reclaimed.
+func SetHeapQuota(id string, pkgs []int, limit uintptr) {
+	lock(&quotaSetLock)
+	if sbQuotas == nil {
+		sbQuotas = make(map[string]*heapQuota)
+	}
+	delete(sbQuotas, id)
+	if limit != 0 {
+		q := &heapQuota{id, make([]int, 0, len(pkgs)), limit}
+		for _, p := range pkgs {
+			if p > 0 && p < _MaxPkgIds {
+				q.pkgs = append(q.pkgs, p)
+			}
+		}
+		sbQuotas[id] = q
+	}
+	byPkg := make(map[int][]*heapQuota)
+	for _, q := range sbQuotas {
+		for _, p := range q.pkgs {
+			byPkg[p] = append(byPkg[p], q)
+		}
+	}
+	lock(&quotaLock)
+	quotas = byPkg
+	atomic.Store(&nquotas, uint32(len(sbQuotas)))
+	unlock(&quotaLock)
+	unlock(&quotaSetLock)
+}
+
+// RegisterQuotaHook registers the function that raises a quota violation.
+func RegisterQuotaHook(f func(id string, pkg int, pc, limit uintptr)) {
+	quotaHook = f
+}
+
+// charge moves the bytes of s to package id, 0 uncharges them.
+//
+//go:nosplit
+func (s *mspan) charge(id int) {
+	size := int64(s.npages << _PageShift)
+	if old := s.charged; old > 0 && old < _MaxPkgIds {
+		atomic.Xadd64(&pkgInuse[old], -size)
+	}
+	s.charged = 0
+	if id > 0 && id < _MaxPkgIds {
+		atomic.Xadd64(&pkgInuse[id], size)
+		s.charged = id
+	}
+}
+
+// heapQuotaExceeded returns the quota that a new span of size bytes for
+// package id would exceed, nil if the span fits or if the current goroutine
+// does not execute a sandbox.
+func heapQuotaExceeded(id int, size uintptr) *heapQuota {
+	if atomic.Load(&nquotas) == 0 || id <= 0 || id >= _MaxPkgIds {
+		return nil
+	}
+	if gp := getg().m.curg; gp == nil || gp.sbdepth() == 0 {
+		return nil
+	}
+	lock(&quotaLock)
+	qs := quotas[id]
+	unlock(&quotaLock)
+	for _, q := range qs {
+		inuse := uintptr(0)
+		for _, p := range q.pkgs {
+			inuse += uintptr(atomic.Load64(&pkgInuse[p]))
+		}
+		if inuse+size > q.limit {
+			return q
+		}
+	}
+	return nil
+}
+
+// checkHeapQuota is called by mallocgc before a new span of size bytes is
+// handed over to package id. The allocation proceeds, the violation is
+// recorded on the goroutine, see raiseHeapQuota.
+func checkHeapQuota(id int, size uintptr) {
+	q := heapQuotaExceeded(id, size)
+	if q == nil {
+		return
+	}
+	s := getg().m.curg.sb
+	if s.quota.q != nil {
+		return
+	}
+	// Blame the first frame outside of the runtime.
+	var pcs [16]uintptr
+	pc := uintptr(0)
+	n := callers(2, pcs[:])
+	for _, p := range pcs[:n] {
+		if f := findfunc(p - 1); f.valid() && !hasPrefix(funcname(f), "runtime.") {
+			pc = p - 1
+			break
+		}
+	}
+	s.quota = quotaViolation{q, id, pc}
+}
+
+// raiseHeapQuota raises the violation recorded on the goroutine, if any.
+// mallocgc calls it before it returns, and sandbox_epilog once the goroutine
+// left the sandbox. The violation stays pending while the goroutine holds
+// runtime locks, e.g., when the runtime allocates on its behalf with a lock
+// held, until one of its next allocations returns without them or, at the
+// latest, until it leaves the sandbox.
+func raiseHeapQuota() {
+	gp := getg()
+	mp := gp.m
+	if gp != mp.curg || mp.locks != 0 || mp.mallocing != 0 || mp.toclean != nil || quotaHook == nil {
+		return
+	}
+	v := gp.sb.quota
+	gp.sb.quota = quotaViolation{}
+	quotaHook(v.q.id, v.pkg, v.pc, v.q.limit)
+	throw("gosb: quota hook returned")
+}
@@ -0,0 +1,19 @@
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package runtime
+
+import "runtime/internal/atomic"
+
+// InstallSigHandler installs the runtime's handler for sig if it does not
+// handle it yet. In c-archive and c-shared build modes, the runtime leaves
+// the asynchronous signals, e.g., SIGTRAP and SIGSYS, to the host, while the
+// sandbox backends need a handler to fall back to.
+func InstallSigHandler(sig uint32) {
+	if sig >= uint32(len(sigtable)) || !(isarchive || islibrary) {
+		return
+	}
+	if atomic.Cas(&handlingSig[sig], 0, 1) {
+		atomic.Storeuintptr(&fwdSig[sig], getsig(sig))
+		setsig(sig, funcPC(sighandler))
+	}
+}
@@ -309,14 +309,14 @@ var (
 // The convXXX functions succeed on a nil input, whereas the assertXXX
 // functions fail on a nil input.
 
-func convT2E(t *_type, elem unsafe.Pointer) (e eface) {
+func convT2E(t *_type, elem unsafe.Pointer, id int) (e eface) {
 	if raceenabled {
 		raceReadObjectPC(t, elem, getcallerpc(), funcPC(convT2E))
 	}
 	if msanenabled {
 		msanread(elem, t.size)
 	}
-	x := mallocgc(t.size, t, true, gosbInterpose(CALLER_LVL))
+	x := mallocgc(t.size, t, true, gosbAllocId(id))
 	// TODO: We allocate a zeroed object only to overwrite it with actual data.
 	// Figure out how to avoid zeroing. Also below in convT2Eslice, convT2I, convT2Islice.
 	typedmemmove(t, x, elem)
@@ -325,72 +325,72 @@ func convT2E(t *_type, elem unsafe.Pointer) (e eface) {
 	return
 }
 
-func convT16(val uint16) (x unsafe.Pointer) {
+func convT16(val uint16, id int) (x unsafe.Pointer) {
 	if val == 0 {
 		x = unsafe.Pointer(&zeroVal[0])
 	} else {
-		x = mallocgc(2, uint16Type, false, gosbInterpose(CALLER_LVL))
+		x = mallocgc(2, uint16Type, false, gosbAllocId(id))
 		*(*uint16)(x) = val
 	}
 	return
 }
 
-func convT32(val uint32) (x unsafe.Pointer) {
+func convT32(val uint32, id int) (x unsafe.Pointer) {
 	if val == 0 {
 		x = unsafe.Pointer(&zeroVal[0])
 	} else {
-		x = mallocgc(4, uint32Type, false, gosbInterpose(CALLER_LVL))
+		x = mallocgc(4, uint32Type, false, gosbAllocId(id))
 		*(*uint32)(x) = val
 	}
 	return
 }
 
-func convT64(val uint64) (x unsafe.Pointer) {
+func convT64(val uint64, id int) (x unsafe.Pointer) {
 	if val == 0 {
 		x = unsafe.Pointer(&zeroVal[0])
 	} else {
-		x = mallocgc(8, uint64Type, false, gosbInterpose(CALLER_LVL))
+		x = mallocgc(8, uint64Type, false, gosbAllocId(id))
 		*(*uint64)(x) = val
 	}
 	return
 }
 
-func convTstring(val string) (x unsafe.Pointer) {
+func convTstring(val string, id int) (x unsafe.Pointer) {
 	if val == "" {
 		x = unsafe.Pointer(&zeroVal[0])
 	} else {
-		x = mallocgc(unsafe.Sizeof(val), stringType, true, gosbInterpose(CALLER_LVL))
+		x = mallocgc(unsafe.Sizeof(val), stringType, true, gosbAllocId(id))
 		*(*string)(x) = val
 	}
 	return
 }
 
-func convTslice(val []byte) (x unsafe.Pointer) {
+func convTslice(val []byte, id int) (x unsafe.Pointer) {
 	// Note: this must work for any element type, not just byte.
 	if (*slice)(unsafe.Pointer(&val)).array == nil {
 		x = unsafe.Pointer(&zeroVal[0])
 	} else {
-		x = mallocgc(unsafe.Sizeof(val), sliceType, true, gosbInterpose(CALLER_LVL))
+		x = mallocgc(unsafe.Sizeof(val), sliceType, true, gosbAllocId(id))
 		*(*[]byte)(x) = val
 	}
 	return
 }
 
-func convT2Enoptr(t *_type, elem unsafe.Pointer) (e eface) {
+func convT2Enoptr(t *_type, elem unsafe.Pointer, id int) (e eface) {
 	if raceenabled {
 		raceReadObjectPC(t, elem, getcallerpc(), funcPC(convT2Enoptr))
 	}
 	if msanenabled {
 		msanread(elem, t.size)
 	}
-	x := mallocgc(t.size, t, false, gosbInterpose(CALLER_LVL))
+	x := mallocgc(t.size, t, false, gosbAllocId(id))
 	memmove(x, elem, t.size)
 	e._type = t
 	e.data = x
 	return
 }
 
-func convT2I(tab *itab, elem unsafe.Pointer) (i iface) {
+func convT2I(tab *itab, elem unsafe.Pointer, id int) (i iface) {
 	t := tab._type
 	if raceenabled {
 		raceReadObjectPC(t, elem, getcallerpc(), funcPC(convT2I))
@@ -398,14 +398,14 @@ func convT2I(tab *itab, elem unsafe.Pointer) (i iface) {
 	if msanenabled {
 		msanread(elem, t.size)
 	}
-	x := mallocgc(t.size, t, true, gosbInterpose(CALLER_LVL))
+	x := mallocgc(t.size, t, true, gosbAllocId(id))
 	typedmemmove(t, x, elem)
 	i.tab = tab
 	i.data = x
 	return
 }
 
-func convT2Inoptr(tab *itab, elem unsafe.Pointer) (i iface) {
+func convT2Inoptr(tab *itab, elem unsafe.Pointer, id int) (i iface) {
 	t := tab._type
 	if raceenabled {
 		raceReadObjectPC(t, elem, getcallerpc(), funcPC(convT2Inoptr))
@@ -413,7 +413,7 @@ func convT2Inoptr(tab *itab, elem unsafe.Pointer) (i iface) {
 	if msanenabled {
 		msanread(elem, t.size)
 	}
-	x := mallocgc(t.size, t, false, gosbInterpose(CALLER_LVL))
+	x := mallocgc(t.size, t, false, gosbAllocId(id))
 	memmove(x, elem, t.size)
 	i.tab = tab
 	i.data = x
@@ -698,7 +698,10 @@ func (h *mheap) sysAlloc(n uintptr) (v unsafe.Pointer, size uintptr) {
 	}
 
 	// Transition from Reserved to Prepared.
+	sbArenaMap.base = uintptr(v)
+	sbArenaMap.size = size
 	sysMap(v, size, &memstats.heap_sys)
+	sbArenaMap.size = 0
 
 mapped:
 	// Create arena metadata.
@@ -851,6 +854,7 @@ func (c *mcache) nextFree(id int, spc spanClass) (v gclinkptr, s *mspan, shouldh
 			println("runtime: s.allocCount=", s.allocCount, "s.nelems=", s.nelems)
 			throw("s.allocCount != s.nelems && freeIndex == s.nelems")
 		}
+		checkHeapQuota(id, uintptr(class_to_allocnpages[spc.sizeclass()])*_PageSize)
 		c.refill(id, spc)
 		shouldhelpgc = true
 		s = c.allocWithId(id, spc)
@@ -880,8 +884,8 @@ func mallocgc(size uintptr, typ *_type, needzero bool, id int) unsafe.Pointer {
 	}
 
 	// Check if we are in a pristine sandbox
-	if g := getg(); g.pristine && g.pristineid != 0 && id != 0 {
-		id = g.pristineid
+	if pid := getg().pristineid(); pid != 0 && id != 0 {
+		id = pid
 	}
 
 	if size == 0 {
@@ -1069,6 +1073,7 @@ func mallocgc(size uintptr, typ *_type, needzero bool, id int) unsafe.Pointer {
 	} else {
 		var s *mspan
 		shouldhelpgc = true
+		checkHeapQuota(id, round(size, _PageSize))
 		systemstack(func() {
 			s = largeAlloc(size, needzero, noscan)
 		})
@@ -1079,6 +1084,7 @@ func mallocgc(size uintptr, typ *_type, needzero bool, id int) unsafe.Pointer {
 		//mark the span with the id.
 		s.setId(id, true)
 	}
+	countPkgMalloc(id)
 
 	var scanSize uintptr
 	if !noscan {
@@ -1156,6 +1162,11 @@ func mallocgc(size uintptr, typ *_type, needzero bool, id int) unsafe.Pointer {
 			gcStart(t)
 		}
 	}
+
+	// Fail the allocation if it exceeded a heap quota.
+	if s := getg().sb; s != nil && s.quota.q != nil {
+		raiseHeapQuota()
+	}
 	return x
 }
 
@@ -1189,7 +1200,7 @@ func largeAlloc(size uintptr, needzero bool, noscan bool) *mspan {
 // of this function
 func newobject(typ *_type, id int) unsafe.Pointer {
 	id1 := filterPkgId(id)
-	if gp := getg(); gp.sbid != "" && id1 == -1 {
+	if gp := getg(); gp.sbdepth() != 0 && id1 == -1 {
 		id1 = gosbInterpose(CALLER_LVL)
 		//id1 = filterPkgId(id)
 	}
@@ -146,6 +146,9 @@ func sysHugePage(v unsafe.Pointer, n uintptr) {
 //go:nosplit
 func sysFree(v unsafe.Pointer, n uintptr, sysStat *uint64) {
 	mSysStatDec(sysStat, n)
+	if sbKeepsMappings() {
+		return
+	}
 	munmap(v, n)
 }
 
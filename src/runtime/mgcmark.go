@@ -373,6 +373,11 @@ func gcAssistAlloc(gp *g) {
 	if mp := getg().m; mp.locks > 0 || mp.preemptoff != "" {
 		return
 	}
+	// A sandbox cannot access the stacks and objects of the packages
+	// outside of its view. The background workers scan them instead.
+	if gp.m.sbid != "" {
+		return
+	}
 
 	traced := false
 retry:
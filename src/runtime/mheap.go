@@ -1392,6 +1392,7 @@ func (h *mheap) freeSpanLocked(s *mspan, acctinuse, acctidle bool) {
 			throw("mheap.freeSpanLocked - invalid free")
 		}
 		h.pagesInUse -= uint64(s.npages)
+		s.charge(0)
 
 		// Clear in-use bit in arena page bitmap.
 		arena, pageIdx, pageMask := pageIndexOf(s.base())
@@ -1580,6 +1581,7 @@ func (span *mspan) init(base uintptr, npages uintptr) {
 	span.ilist = nil
 	span.tiny = 0
 	span.tinyoffset = 0
+	span.charged = 0
 }
 
 func (span *mspan) inList() bool {
@@ -367,6 +367,8 @@ func sigprocmask(how int32, new, old *sigset) {
 
 func raise(sig uint32)
 func raiseproc(sig uint32)
+func getpid() int
+func tgkill(tgid, tid, sig int)
 
 //go:noescape
 func sched_getaffinity(pid, len uintptr, buf *byte) int32
@@ -380,6 +382,10 @@ func setsig(i uint32, fn uintptr) {
 	var sa sigactiont
 	sa.sa_flags = _SA_SIGINFO | _SA_ONSTACK | _SA_RESTORER | _SA_RESTART
 	sigfillset(&sa.sa_mask)
+	if GOARCH == "amd64" && isMPK == 1 {
+		// The MPK backend traps the syscalls of the handlers, see initsig.
+		*(*uint64)(unsafe.Pointer(&sa.sa_mask)) &^= 1<<(_SIGSYS-1) | 1<<(_SIGTRAP-1)
+	}
 	// Although Linux manpage says "sa_restorer element is obsolete and
 	// should not be used". x86_64 kernel requires it. Only use it on
 	// x86.
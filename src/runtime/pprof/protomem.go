@@ -59,10 +59,14 @@ func writeHeapProto(w io.Writer, p []runtime.MemProfileRecord, rate int64, defau
 		if r.AllocObjects > 0 {
 			blockSize = r.AllocBytes / r.AllocObjects
 		}
+		pkg := runtime_pkgOfStack(r.Stack())
 		b.pbSample(values, locs, func() {
 			if blockSize != 0 {
 				b.pbLabel(tagSample_Label, "bytes", "", blockSize)
 			}
+			if pkg != "" {
+				b.pbLabel(tagSample_Label, "package", pkg, 0)
+			}
 		})
 	}
 	b.build()
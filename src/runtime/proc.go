@@ -202,6 +202,7 @@ func main() {
 	}
 	fn := main_main // make an indirect call, as the linker doesn't know the address of the main package when laying down the runtime
 	fn()
+	gosbExit()
 	if raceenabled {
 		racefini()
 	}
@@ -233,6 +234,7 @@ func main() {
 // os_beforeExit is called from os.Exit(0).
 //go:linkname os_beforeExit os.runtime_beforeExit
 func os_beforeExit() {
+	gosbExit()
 	if raceenabled {
 		racefini()
 	}
@@ -1855,7 +1857,7 @@ func newm(fn func(), _p_ *p) {
 	mp := allocm(_p_, fn)
 	mp.nextp.set(_p_)
 	mp.sigmask = initSigmask
-	if gp := getg(); gp != nil && gp.m != nil && (gp.m.lockedExt != 0 || gp.m.incgo) && GOOS != "plan9" {
+	if gp := getg(); gp != nil && gp.m != nil && (gp.m.lockedExt != 0 || gp.m.incgo || (isMPK == 1 && gp.m.sbslot != 0)) && GOOS != "plan9" {
 		// We're on a locked M or a thread that may have been
 		// started by C. The kernel state of this thread may
 		// be strange (the user may have locked it for that
@@ -1863,6 +1865,9 @@ func newm(fn func(), _p_ *p) {
 		// thread. Instead, ask a known-good thread to create
 		// the thread for us.
 		//
+		// The threads that ran a sandbox under MPK cannot
+		// create threads, their syscalls might be trapped.
+		//
 		// This is disabled on Plan 9. See golang.org/issue/22227.
 		//
 		// TODO: This may be unnecessary on Windows, which
@@ -2215,8 +2220,9 @@ func execute(gp *g, inheritTime bool) {
 
 	// GOSB hook
 	if executeSandbox != nil {
-		executeSandbox(gp.sbid)
+		executeSandbox(gp.sbid())
 	}
+	sbresume(gp)
 
 	gogo(&gp.sched)
 }
@@ -2720,6 +2726,7 @@ top:
 func dropg() {
 	_g_ := getg()
 
+	sbpause(_g_.m.curg)
 	setMNoWB(&_g_.m.curg.m, nil)
 	setGNoWB(&_g_.m.curg, nil)
 }
@@ -2883,6 +2890,15 @@ func goexit0(gp *g) {
 	gp.param = nil
 	gp.labels = nil
 	gp.timer = nil
+	if s := gp.sb; s != nil {
+		// The goroutine may have exited inside a sandbox.
+		for i := range s.stack {
+			s.stack[i] = sbentry{}
+		}
+		s.stack = s.stack[:0]
+		sbleave(gp)
+		s.deadline, s.budget = 0, 0
+	}
 
 	if gcBlackenEnabled != 0 && gp.gcAssistBytes > 0 {
 		// Flush assist credit to the global pool. This gives
@@ -3006,6 +3022,7 @@ func reentersyscall(pc, sp uintptr) {
 	_g_.syscallsp = sp
 	_g_.syscallpc = pc
 	casgstatus(_g_, _Grunning, _Gsyscall)
+	sbpause(_g_)
 	if _g_.syscallsp < _g_.stack.lo || _g_.stack.hi < _g_.syscallsp {
 		systemstack(func() {
 			print("entersyscall inconsistent ", hex(_g_.syscallsp), " [", hex(_g_.stack.lo), ",", hex(_g_.stack.hi), "]\n")
@@ -3113,6 +3130,7 @@ func entersyscallblock() {
 		})
 	}
 	casgstatus(_g_, _Grunning, _Gsyscall)
+	sbpause(_g_)
 	if _g_.syscallsp < _g_.stack.lo || _g_.stack.hi < _g_.syscallsp {
 		systemstack(func() {
 			print("entersyscallblock inconsistent ", hex(sp), " ", hex(_g_.sched.sp), " ", hex(_g_.syscallsp), " [", hex(_g_.stack.lo), ",", hex(_g_.stack.hi), "]\n")
@@ -3176,6 +3194,7 @@ func exitsyscall() {
 		// Garbage collector isn't running (since we are),
 		// so okay to clear syscallsp.
 		_g_.syscallsp = 0
+		sbresume(_g_)
 		_g_.m.locks--
 		if _g_.preempt {
 			// restore the preemption request in case we've cleared it in newstack
@@ -4606,6 +4625,10 @@ func sysmon() {
 			// Try to start an M to run them.
 			startm(nil, false)
 		}
+		// stop the goroutines that overran their sandbox limits
+		if atomic.Load(&sbtimers.n) != 0 {
+			sbCheckLimits(now)
+		}
 		// retake P's blocked in syscalls
 		// and preempt long running G's
 		if retake(now) != 0 {
@@ -436,9 +436,7 @@ type g struct {
 	labels         unsafe.Pointer // profiler labels
 	timer          *timer         // cached timer for time.Sleep
 	selectDone     uint32         // are we participating in a select and did someone win the race?
-	sbid           string         // gosb sandbox ID
-	pristine       bool
-	pristineid     int
+	sb             *sbstate       // gosb sandboxes and limits, nil until the first entry
 
 	// Per-G GC state
 
@@ -528,6 +526,7 @@ type m struct {
 	sbid    string
 	nester  int32
 	toclean *mspan
+	sbslot  int32 // slot of the thread in the backend, plus one
 }
 
 type p struct {
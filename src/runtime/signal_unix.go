@@ -82,6 +82,14 @@ func initsig(preinit bool) {
 		signalsOK = true
 	}
 
+	// The MPK backend traps the syscalls of the sandboxes, including the
+	// ones of the runtime, with SIGSYS and SIGTRAP. The kernel kills the
+	// process if it forces a blocked signal, they are never blocked.
+	if isMPK == 1 {
+		sigdelset(&sigset_all, _SIGSYS)
+		sigdelset(&sigset_all, _SIGTRAP)
+	}
+
 	// For c-archive/c-shared this is called by libpreinit with
 	// preinit == true.
 	if (isarchive || islibrary) && !preinit {
@@ -327,6 +335,14 @@ func sigFetchG(c *sigctxt) *g {
 //go:nosplit
 //go:nowritebarrierrec
 func sigtrampgo(sig uint32, info *siginfo, ctx unsafe.Pointer) {
+	// The kernel runs the handler with the default PKRU, which has no
+	// rights on the memory tagged by the MPK backend, e.g., goroutine
+	// stacks, and the SIGSYS handler of the syscall dispatch reads the
+	// g of the trapped thread. sigreturn restores the PKRU of the
+	// interrupted thread.
+	if isMPK == 1 {
+		WritePKRU(0)
+	}
 	if sigfwdgo(sig, info, ctx) {
 		return
 	}
@@ -441,6 +457,10 @@ func sighandler(sig uint32, info *siginfo, ctxt unsafe.Pointer, gp *g) {
 		return
 	}
 
+	if sig == _SIGXCPU && sbStopSignal(c, gp) {
+		return
+	}
+
 	flags := int32(_SigThrow)
 	if sig < uint32(len(sigtable)) {
 		flags = sigtable[sig].flags
@@ -602,6 +622,10 @@ func sigpanic() {
 			panicoverflow()
 		}
 		panicfloat()
+	case _SIGXCPU:
+		if g.sb != nil && g.sb.stop == _SbStopDelivered {
+			sbOverrun(g)
+		}
 	}
 
 	if g.sig >= uint32(len(sigtable)) {
@@ -31,7 +31,7 @@ func panicmakeslicecap() {
 	panic(errorString("makeslice: cap out of range"))
 }
 
-func makeslice(et *_type, len, cap int) unsafe.Pointer {
+func makeslice(et *_type, len, cap int, id int) unsafe.Pointer {
 	mem, overflow := math.MulUintptr(et.size, uintptr(cap))
 	if overflow || mem > maxAlloc || len < 0 || len > cap {
 		// NOTE: Produce a 'len out of range' error instead of a
@@ -46,10 +46,10 @@ func makeslice(et *_type, len, cap int) unsafe.Pointer {
 		panicmakeslicecap()
 	}
 
-	return mallocgc(mem, et, true, gosbInterpose(CALLER_LVL))
+	return mallocgc(mem, et, true, gosbAllocId(id))
 }
 
-func makeslice64(et *_type, len64, cap64 int64) unsafe.Pointer {
+func makeslice64(et *_type, len64, cap64 int64, id int) unsafe.Pointer {
 	len := int(len64)
 	if int64(len) != len64 {
 		panicmakeslicelen()
@@ -77,7 +77,7 @@ func makeslice64(et *_type, len64, cap64 int64) unsafe.Pointer {
 		panicmakeslicecap()
 	}
 
-	return mallocgc(mem, et, true, gosbInterpose(CALLER_LVL))
+	return mallocgc(mem, et, true, gosbAllocId(id))
 }
 
 // growslice handles slice growth during append.
@@ -90,7 +90,7 @@ func makeslice64(et *_type, len64, cap64 int64) unsafe.Pointer {
 // to calculate where to write new values during an append.
 // TODO: When the old backend is gone, reconsider this decision.
 // The SSA backend might prefer the new length or to return only ptr/cap and save stack space.
-func growslice(et *_type, old slice, cap int) slice {
+func growslice(et *_type, old slice, cap int, id int) slice {
 	if raceenabled {
 		callerpc := getcallerpc()
 		racereadrangepc(old.array, uintptr(old.len*int(et.size)), callerpc, funcPC(growslice))
@@ -189,13 +189,13 @@ func growslice(et *_type, old slice, cap int) slice {
 
 	var p unsafe.Pointer
 	if et.ptrdata == 0 {
-		p = mallocgc(capmem, nil, false, gosbInterpose(CALLER_LVL))
+		p = mallocgc(capmem, nil, false, gosbAllocId(id))
 		// The append() that calls growslice is going to overwrite from old.len to cap (which will be the new length).
 		// Only clear the part that will not be overwritten.
 		memclrNoHeapPointers(add(p, newlenmem), capmem-newlenmem)
 	} else {
 		// Note: can't use rawmem (which avoids zeroing of memory), because then GC can scan uninitialized memory.
-		p = mallocgc(capmem, et, true, gosbInterpose(CALLER_LVL))
+		p = mallocgc(capmem, et, true, gosbAllocId(id))
 		if lenmem > 0 && writeBarrier.enabled {
 			// Only shade the pointers in old.array since we know the destination slice p
 			// only contains nil pointers because it has been cleared during alloc.